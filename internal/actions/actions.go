@@ -532,6 +532,45 @@ func unmarshalTimedEntry(te *timed.Entry) *entry {
 	return &e
 }
 
+func init() {
+	timed.RegisterDecoder(logKind, formatEntry)
+	timed.RegisterDecoder(pendingKind, nil)
+}
+
+// formatEntry is the decoder for action log entries,
+// registered with [timed.RegisterDecoder].
+func formatEntry(_, val []byte) (string, error) {
+	var e entry
+	if err := json.Unmarshal(val, &e); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Kind: %s\n", e.Kind)
+	fmt.Fprintf(&b, "Key: %s\n", storage.Fmt(e.Key))
+	fmt.Fprintf(&b, "Created: %s\n", e.Created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Action: %s\n", toEntry(&e).ActionForDisplay())
+	if e.ApprovalRequired {
+		fmt.Fprintf(&b, "Approval required; approved: %t\n", e.approved())
+		for _, d := range e.Decisions {
+			what := "denied"
+			if d.Approved {
+				what = "approved"
+			}
+			fmt.Fprintf(&b, "  %s by %s at %s\n", what, d.Name, d.Time.Format(time.RFC3339))
+		}
+	}
+	if e.Done.IsZero() {
+		fmt.Fprintf(&b, "Not done\n")
+	} else {
+		fmt.Fprintf(&b, "Done: %s\n", e.Done.Format(time.RFC3339))
+		fmt.Fprintf(&b, "Result: %s\n", e.Result)
+		if e.Error != "" {
+			fmt.Fprintf(&b, "Error: %s\n", e.Error)
+		}
+	}
+	return b.String(), nil
+}
+
 // lockAction locks the action with the given kind and key in db, and returns a function
 // that unlocks it.
 func lockAction(db storage.DB, actionKind string, key []byte) func() {
@@ -57,6 +57,13 @@ const (
 // [1] https://cloud.google.com/run/docs/about-instance-autoscaling
 // [2] https://cloud.google.com/tasks/docs
 
+func init() {
+	storage.RegisterDecoder(taskKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(Task))
+	})
+	timed.RegisterDecoder(taskUpdateKind, nil)
+}
+
 // o is short for ordered.Encode.
 func o(list ...any) []byte { return ordered.Encode(list...) }
 
@@ -7,12 +7,12 @@ package codeimage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go/format"
 	"io"
 	"net/http"
-	"strconv"
 
 	"golang.org/x/oscar/internal/llm"
 )
@@ -51,13 +51,14 @@ func InBlob(ctx context.Context, blob llm.Blob, cgen llm.ContentGenerator) (stri
 	}
 	// Retry several times in the hope that the LLM will eventually produce a valid program.
 	for range 3 {
-		output, err := cgen.GenerateContent(ctx, schema, parts)
+		output, err := llm.GenerateJSON(ctx, cgen, schema, parts, maxJSONRepairs)
 		if err != nil {
 			return "", err
 		}
-		unq, err := strconv.Unquote(output)
-		if err != nil {
-			return "", fmt.Errorf("strconv.Unquote: %w", err)
+		var unq string
+		if err := json.Unmarshal([]byte(output), &unq); err != nil {
+			// unreachable: GenerateJSON checked that output is a JSON string
+			return "", fmt.Errorf("unmarshaling %q: %w", output, err)
 		}
 		fbytes, err := format.Source([]byte(unq))
 		if err != nil {
@@ -69,6 +70,10 @@ func InBlob(ctx context.Context, blob llm.Blob, cgen llm.ContentGenerator) (stri
 	return "", errors.New("could not produce a valid Go program")
 }
 
+// maxJSONRepairs is the maximum number of times to ask the LLM
+// to correct a response that is not a JSON string.
+const maxJSONRepairs = 2
+
 const instructions = `
 The following image contains code in the Go programming language.
 Extract the Go code from the image.
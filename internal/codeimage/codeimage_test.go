@@ -49,6 +49,26 @@ func TestInBlob(t *testing.T) {
 	}
 }
 
+func TestInBlobRepair(t *testing.T) {
+	// The first response is not a JSON string; the second one is.
+	calls := 0
+	gen := llm.TestContentGenerator("imageMock",
+		func(context.Context, *llm.Schema, []llm.Part) (string, error) {
+			calls++
+			if calls == 1 {
+				return "package p", nil
+			}
+			return strconv.Quote("package p"), nil
+		})
+	got, err := InBlob(ctx, llm.Blob{MIMEType: "image/png"}, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package p\n"; got != want || calls != 2 {
+		t.Errorf("InBlob = %q after %d calls, want %q after 2", got, calls, want)
+	}
+}
+
 func removeBlankLines(s string) string {
 	lines := strings.Split(s, "\n")
 	lines = slices.DeleteFunc(lines, func(s string) bool {
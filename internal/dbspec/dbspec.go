@@ -10,6 +10,12 @@
 //	A Pebble database in the directory DIR.
 //	DIR can be relative or absolute.
 //
+// sqlite:FILE[~VECTOR_NAMESPACE]
+//
+//	A SQLite database in the file FILE.
+//	FILE can be relative or absolute.
+//	The file must exist, but it can be empty.
+//
 // firestore:PROJECT,DATABASE[~VECTOR_NAMESPACE]
 //
 //	A Firestore DB in the given GCP project and Firestore database.
@@ -20,6 +26,11 @@
 //
 // If a VECTOR_NAMESPACE is present, the spec refers to the vector DB portion of the database.
 // The namespace can be empty, in which case the spec ends with a '~'.
+// Use [Spec.OpenVector] to open it.
+// For pebble, the vector DB is a durable, on-disk [pebble.VectorDB],
+// which stores the vectors in half precision and does not load them into memory.
+// For sqlite, the vector DB is a [storage.MemVectorDB]
+// stored in the SQLite database.
 package dbspec
 
 import (
@@ -32,13 +43,14 @@ import (
 
 	"golang.org/x/oscar/internal/gcp/firestore"
 	"golang.org/x/oscar/internal/pebble"
+	"golang.org/x/oscar/internal/sqlite"
 	"golang.org/x/oscar/internal/storage"
 )
 
 // A Spec is the parsed representation of a DB specification string.
 type Spec struct {
-	Kind      string // "pebble", "firestore", etc.
-	Location  string // directory, project, etc.
+	Kind      string // "pebble", "sqlite", "firestore", etc.
+	Location  string // directory, file, project, etc.
 	Name      string // database name, for firestore
 	IsVector  bool   // spec refers to the vector part of the database
 	Namespace string // namespace of vector DB, possibly empty
@@ -54,6 +66,8 @@ func (s *Spec) String() string {
 		return "mem" + vs
 	case "pebble":
 		return "pebble:" + s.Location + vs
+	case "sqlite":
+		return "sqlite:" + s.Location + vs
 	case "firestore":
 		return fmt.Sprintf("firestore:%s,%s%s", s.Location, s.Name, vs)
 	default:
@@ -68,6 +82,8 @@ func (s *Spec) Open(ctx context.Context, lg *slog.Logger) (storage.DB, error) {
 		return storage.MemDB(), nil
 	case "pebble":
 		return pebble.Open(lg, s.Location)
+	case "sqlite":
+		return sqlite.Open(lg, s.Location)
 	case "firestore":
 		return firestore.NewDB(ctx, lg, s.Location, s.Name)
 	default:
@@ -75,6 +91,30 @@ func (s *Spec) Open(ctx context.Context, lg *slog.Logger) (storage.DB, error) {
 	}
 }
 
+// OpenVector opens the vector database described by the spec,
+// which must have IsVector set.
+func (s *Spec) OpenVector(ctx context.Context, lg *slog.Logger) (storage.VectorDB, error) {
+	if !s.IsVector {
+		return nil, fmt.Errorf("dbspec %v is not a vector DB spec", s)
+	}
+	switch s.Kind {
+	case "mem":
+		return storage.MemVectorDB(storage.MemDB(), lg, s.Namespace), nil
+	case "pebble":
+		return pebble.OpenVectorDB(lg, s.Location, s.Namespace)
+	case "sqlite":
+		db, err := sqlite.Open(lg, s.Location)
+		if err != nil {
+			return nil, err
+		}
+		return storage.MemVectorDB(db, lg, s.Namespace), nil
+	case "firestore":
+		return firestore.NewVectorDB(ctx, lg, s.Location, s.Name, s.Namespace)
+	default:
+		return nil, fmt.Errorf("unknown DB kind %q", s.Kind)
+	}
+}
+
 // Parse parses a DB specification string into a [Spec].
 func Parse(s string) (_ *Spec, err error) {
 	defer func() {
@@ -107,6 +147,12 @@ func Parse(s string) (_ *Spec, err error) {
 		}
 		spec.Location = filepath.Clean(middle)
 
+	case "sqlite":
+		if len(middle) == 0 {
+			return nil, errors.New("sqlite spec missing file; want sqlite:FILE[~VECTOR_NAMESPACE]")
+		}
+		spec.Location = filepath.Clean(middle)
+
 	case "firestore":
 		proj, db, _ := strings.Cut(middle, ",")
 		if proj == "" || db == "" {
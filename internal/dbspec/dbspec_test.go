@@ -5,9 +5,16 @@
 package dbspec
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/pebble"
+	"golang.org/x/oscar/internal/sqlite"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
 )
 
 func TestParse(t *testing.T) {
@@ -89,6 +96,19 @@ func TestParse(t *testing.T) {
 				Namespace: "ns",
 			},
 		},
+		{
+			in: "sqlite:" + dir + "~ns",
+			want: Spec{
+				Kind:      "sqlite",
+				Location:  dir,
+				IsVector:  true,
+				Namespace: "ns",
+			},
+		},
+		{
+			in:      "sqlite:",
+			wantErr: "missing file",
+		},
 		{
 			in:      "firestore",
 			wantErr: "invalid firestore",
@@ -171,6 +191,10 @@ func TestString(t *testing.T) {
 			in:   Spec{Kind: "pebble", Location: "dir"},
 			want: "pebble:dir",
 		},
+		{
+			in:   Spec{Kind: "sqlite", Location: "file", IsVector: true},
+			want: "sqlite:file~",
+		},
 		{
 			in:   Spec{Kind: "firestore", Location: "p", Name: "o"},
 			want: "firestore:p,o",
@@ -182,3 +206,61 @@ func TestString(t *testing.T) {
 		}
 	}
 }
+
+func TestOpenVector(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+
+	spec, err := Parse("mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spec.OpenVector(ctx, lg); err == nil {
+		t.Errorf("OpenVector(mem) succeeded, want error for non-vector spec")
+	}
+
+	dir := filepath.Join(t.TempDir(), "db")
+	db, err := pebble.Create(lg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	spec, err = Parse("pebble:" + dir + "~ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vdb, err := spec.OpenVector(ctx, lg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pvdb, ok := vdb.(*pebble.VectorDB)
+	if !ok {
+		t.Fatalf("OpenVector(%v) = %T, want *pebble.VectorDB", spec, vdb)
+	}
+	defer pvdb.Close()
+	vdb.Set("id", llm.Vector{1})
+	if _, ok := vdb.Get("id"); !ok {
+		t.Errorf("Get after Set failed")
+	}
+
+	file := filepath.Join(t.TempDir(), "sqlite.db")
+	sdb, err := sqlite.Create(lg, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.MemVectorDB(sdb, lg, "ns").Set("id", llm.Vector{1})
+	sdb.Close()
+
+	spec, err = Parse("sqlite:" + file + "~ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vdb, err = spec.OpenVector(ctx, lg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vdb.Get("id"); !ok {
+		t.Errorf("Get from reopened sqlite vector DB failed")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Dbarchive exports and imports snapshots of a database
+// in the portable format of package [archive].
+//
+// Usage:
+//
+//	dbarchive [-z] [-since T] [-vec NS,...] DBSPEC export FILE
+//	dbarchive DBSPEC import FILE
+//
+// The DBSPEC argument is a [dbspec] specification, such as pebble:DIR,
+// firestore:PROJECT,DATABASE, or mem.
+// A FILE of "-" means standard output or standard input.
+//
+// Export writes a snapshot of the database to FILE.
+// The -z flag compresses the snapshot with gzip.
+// The -vec flag names vector namespaces to include in the snapshot.
+// The -since flag writes an incremental snapshot containing only the
+// timed entries set after T, which is either a time in RFC3339 format
+// or a DBTime (an integer number of nanoseconds since the Unix epoch).
+// After writing a snapshot, export prints the -since value to use
+// for the next incremental snapshot.
+//
+// Import reads a snapshot from FILE and writes it to the database,
+// including any vectors, in the namespaces recorded in the snapshot.
+// Import detects whether FILE is compressed.
+//
+// For example, to copy a Firestore database and its "gaby" vectors
+// to a local Pebble database:
+//
+//	dbarchive -z -vec gaby firestore:oscar-go-1,prod export prod.oscardb
+//	dbarchive pebble:$HOME/gabydb import prod.oscardb
+//
+// [archive]: https://pkg.go.dev/golang.org/x/oscar/internal/storage/archive
+// [dbspec]: https://pkg.go.dev/golang.org/x/oscar/internal/dbspec
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oscar/internal/dbspec"
+	"golang.org/x/oscar/internal/gcp/firestore"
+	"golang.org/x/oscar/internal/pebble"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/storage/archive"
+	"golang.org/x/oscar/internal/storage/timed"
+)
+
+var flags struct {
+	compress bool
+	since    string
+	vec      string
+}
+
+func init() {
+	flag.BoolVar(&flags.compress, "z", false, "compress the exported snapshot")
+	flag.StringVar(&flags.since, "since", "", "export only timed entries set after `T` (RFC3339 time or DBTime)")
+	flag.StringVar(&flags.vec, "vec", "", "comma-separated vector `namespaces` to export")
+}
+
+var logger = slog.Default()
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: dbarchive [-z] [-since T] [-vec NS,...] dbspec export file\n")
+	fmt.Fprintf(os.Stderr, "       dbarchive dbspec import file\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dbarchive: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 3 {
+		usage()
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), flag.Arg(2)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(specArg, cmd, file string) error {
+	ctx := context.Background()
+	spec, err := dbspec.Parse(specArg)
+	if err != nil {
+		return err
+	}
+	if spec.IsVector {
+		return fmt.Errorf("omit vector namespace from dbspec; use -vec")
+	}
+	db, err := spec.Open(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch cmd {
+	case "export":
+		return doExport(ctx, spec, db, file)
+	case "import":
+		return doImport(ctx, spec, db, file)
+	}
+	usage()
+	return nil
+}
+
+func doExport(ctx context.Context, spec *dbspec.Spec, db storage.DB, file string) error {
+	opts := &archive.Options{Compress: flags.compress}
+	if flags.since != "" {
+		t, err := parseSince(flags.since)
+		if err != nil {
+			return err
+		}
+		opts.Since = t
+	}
+	if flags.vec != "" {
+		opts.Vectors = make(map[string]storage.VectorDB)
+		for _, ns := range strings.Split(flags.vec, ",") {
+			vdb, err := openVector(ctx, spec, db, ns)
+			if err != nil {
+				return err
+			}
+			opts.Vectors[ns] = vdb
+		}
+	}
+
+	w := os.Stdout
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+	// Entries set during the export may or may not be included,
+	// so the next incremental snapshot starts before the export did.
+	next := time.Now()
+	stats, err := archive.Export(logger, w, db, opts)
+	if w != os.Stdout {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d keys, %d vectors; next incremental snapshot: -since %d\n",
+		stats.Keys, stats.Vectors, next.UnixNano())
+	return nil
+}
+
+func doImport(ctx context.Context, spec *dbspec.Spec, db storage.DB, file string) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	vector := func(ns string) (storage.VectorDB, error) {
+		return openVector(ctx, spec, db, ns)
+	}
+	h, stats, err := archive.Import(logger, r, db, vector)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d keys, %d vectors from snapshot created %v\n",
+		stats.Keys, stats.Vectors, h.Created.Format(time.RFC3339))
+	return nil
+}
+
+// openVector opens the vector database for namespace ns
+// stored alongside db, which was opened from spec.
+func openVector(ctx context.Context, spec *dbspec.Spec, db storage.DB, ns string) (storage.VectorDB, error) {
+	switch spec.Kind {
+	case "mem":
+		return storage.MemVectorDB(db, logger, ns), nil
+	case "pebble":
+		// A Pebble directory can only be opened once,
+		// so use db instead of pebble.OpenVectorDB.
+		return pebble.NewVectorDB(db, ns)
+	case "firestore":
+		return firestore.NewVectorDB(ctx, logger, spec.Location, spec.Name, ns)
+	}
+	return nil, fmt.Errorf("unknown DB kind %q", spec.Kind)
+}
+
+// parseSince parses the -since flag value.
+func parseSince(s string) (timed.DBTime, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return timed.DBTime(n), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -since %q: want RFC3339 time or DBTime", s)
+	}
+	return timed.DBTime(t.UnixNano()), nil
+}
@@ -13,6 +13,7 @@
 //
 //	get(key [, end])
 //	hex(key [, end])
+//	show(key [, end])
 //	list(start, end)
 //	set(key, value)
 //	delete(key [, end])
@@ -25,6 +26,10 @@
 // Hex is similar to get but prints hexadecimal dumps of
 // the values instead of using value syntax.
 //
+// Show is similar to get but prints a readable, typed view of the
+// values, using the decoders registered by the packages that store them
+// (see [storage.RegisterDecoder]).
+//
 // List lists all known keys k such that start ≤ k < end,
 // but not their values.
 //
@@ -37,6 +42,8 @@
 //
 // Mvprefix replaces every database entry with a key starting with old
 // by an entry with a key starting with new instead (s/old/new/).
+// To change the key layout of a package, register a migration
+// using [migrate.Move] instead, so that every database is migrated.
 //
 // Each of the key, value, start, and end arguments can be a
 // Go quoted string or else a Go expression o(list) denoting an
@@ -58,6 +65,8 @@
 // The command output uses the same syntax to print keys and values.
 //
 // [ordered code]: https://pkg.go.dev/rsc.io/ordered
+// [migrate.Move]: https://pkg.go.dev/golang.org/x/oscar/internal/storage/migrate#Move
+// [storage.RegisterDecoder]: https://pkg.go.dev/golang.org/x/oscar/internal/storage#RegisterDecoder
 package main
 
 import (
@@ -84,6 +93,15 @@ import (
 	"golang.org/x/oscar/internal/storage"
 	"golang.org/x/term"
 	"rsc.io/ordered"
+
+	// Packages that register decoders for the show command.
+	_ "golang.org/x/oscar/internal/actions"
+	_ "golang.org/x/oscar/internal/bisect"
+	_ "golang.org/x/oscar/internal/gerrit"
+	_ "golang.org/x/oscar/internal/github"
+	_ "golang.org/x/oscar/internal/googlegroups"
+	_ "golang.org/x/oscar/internal/labels"
+	_ "golang.org/x/oscar/internal/overview"
 )
 
 func usage() {
@@ -154,7 +172,7 @@ func do(db storage.DB, line string, readonly bool) {
 	default:
 		fmt.Fprintf(os.Stderr, "unknown operation %s\n", id.Name)
 
-	case "get", "hex", "list":
+	case "get", "hex", "list", "show":
 		key, end, ok := getRange(id.Name, call.Args, id.Name == "list")
 		if !ok {
 			return
@@ -165,9 +183,13 @@ func do(db storage.DB, line string, readonly bool) {
 				fmt.Fprintf(os.Stderr, "?missing key\n")
 				return
 			}
-			if id.Name == "hex" {
+			switch id.Name {
+			case "hex":
 				fmt.Printf("%s\n", hex.Dump(val))
 				return
+			case "show":
+				fmt.Printf("%s\n", storage.Decode(key, val))
+				return
 			}
 			fmt.Printf("%s\n", decode(val))
 			return
@@ -179,6 +201,8 @@ func do(db storage.DB, line string, readonly bool) {
 				fmt.Printf("%s: %s\n", decode(key), decode(valf()))
 			case "hex":
 				fmt.Printf("%s:\n%s\n", decode(key), hex.Dump(valf()))
+			case "show":
+				fmt.Printf("%s:\n%s\n", decode(key), storage.Decode(key, valf()))
 			case "list":
 				fmt.Printf("%s\n", decode(key))
 			}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Overlay reviews and commits the changes in an overlay database,
+// such as one written by running gaby with the -overlay flag.
+//
+// Usage:
+//
+//	overlay [-commit] OVERLAY BASE
+//
+// OVERLAY and BASE are [dbspec] specifications of the overlay
+// database and the base database it was used with.
+// Overlay prints the changes made in the overlay, one per line.
+// With -commit, it then applies the changes to the base,
+// unless the base has changed since the overlay first changed
+// the same keys, and clears the overlay.
+//
+// [dbspec]: https://pkg.go.dev/golang.org/x/oscar/internal/dbspec
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"golang.org/x/oscar/internal/dbspec"
+	"golang.org/x/oscar/internal/storage"
+)
+
+var commit = flag.Bool("commit", false, "commit the changes to the base database")
+
+var logger = slog.Default()
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: overlay [-commit] overlay-dbspec base-dbspec\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("overlay: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 2 {
+		usage()
+	}
+
+	over, err := open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	base, err := open(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	db := storage.NewOverlayDB(over, base).(storage.Overlay)
+	defer db.Close()
+
+	d := db.Diff()
+	fmt.Print(d)
+	if !*commit {
+		return
+	}
+	if err := db.Commit(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "committed %d changes and %d range deletions\n", len(d.Changes), len(d.Ranges))
+}
+
+func open(s string) (storage.DB, error) {
+	spec, err := dbspec.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if spec.IsVector {
+		return nil, fmt.Errorf("omit vector namespace from dbspec %s", s)
+	}
+	return spec.Open(context.Background(), logger)
+}
@@ -5,6 +5,14 @@
 // rmdoc deletes the documents from the corpus (including the vector db).
 //
 //	Usage:  go run . -project oscar-go-1 -firestoredb devel https://go.dev/x/y/z
+//
+// To use a local database instead of Firestore, pass the -db and -vectordb flags
+// with [dbspec] specifications, for example:
+//
+//	go run . -db pebble:~/gabydb -vectordb pebble:~/gabydb~gaby https://go.dev/x/y/z
+//
+// A Pebble database can only be opened by one process at a time,
+// so when both flags name the same Pebble directory, rmdoc opens it once.
 package main
 
 import (
@@ -19,6 +27,7 @@ import (
 	"golang.org/x/oscar/internal/dbspec"
 	"golang.org/x/oscar/internal/docs"
 	"golang.org/x/oscar/internal/gcp/firestore"
+	"golang.org/x/oscar/internal/pebble"
 	"golang.org/x/oscar/internal/storage"
 )
 
@@ -26,11 +35,15 @@ var flags = struct {
 	project     string
 	firestoredb string
 	overlay     string
+	db          string
+	vectordb    string
 }{}
 
 func init() {
 	flag.StringVar(&flags.project, "project", "", "name of the Google Cloud Project")
 	flag.StringVar(&flags.firestoredb, "firestoredb", "", "name of the firestore db")
+	flag.StringVar(&flags.db, "db", "", "dbspec of the database, instead of -project and -firestoredb")
+	flag.StringVar(&flags.vectordb, "vectordb", "", "dbspec of the vector database, instead of -project and -firestoredb")
 }
 
 var logger = slog.Default()
@@ -43,7 +56,13 @@ func main() {
 		log.Fatal("no args")
 	}
 
-	gabyDB, gabyVectorDB := initGCP()
+	var gabyDB storage.DB
+	var gabyVectorDB storage.VectorDB
+	if flags.db != "" || flags.vectordb != "" {
+		gabyDB, gabyVectorDB = initSpec()
+	} else {
+		gabyDB, gabyVectorDB = initGCP()
+	}
 	corpus := docs.New(logger, gabyDB)
 
 	for _, url := range args {
@@ -110,3 +129,41 @@ func initGCP() (storage.DB, storage.VectorDB) {
 	}
 	return db, vdb
 }
+
+func initSpec() (storage.DB, storage.VectorDB) {
+	ctx := context.TODO()
+
+	if flags.db == "" || flags.vectordb == "" {
+		log.Fatal("-db and -vectordb must be used together")
+	}
+	spec, err := dbspec.Parse(flags.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if spec.IsVector {
+		log.Fatal("omit vector DB spec for -db")
+	}
+	vspec, err := dbspec.Parse(flags.vectordb)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !vspec.IsVector {
+		log.Fatal("-vectordb must be a vector DB spec (ending in ~NAMESPACE)")
+	}
+	db, err := spec.Open(ctx, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if spec.Kind == "pebble" && vspec.Kind == "pebble" && spec.Location == vspec.Location {
+		vdb, err := pebble.NewVectorDB(db, vspec.Namespace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return db, vdb
+	}
+	vdb, err := vspec.OpenVector(ctx, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db, vdb
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Timedgc removes stale time index entries from a database,
+// using [timed.GC].
+//
+// Usage:
+//
+//	timedgc [-n] [-kind KIND,...] [-age D] DBSPEC
+//
+// The DBSPEC argument is a [dbspec] specification, such as pebble:DIR
+// or firestore:PROJECT,DATABASE.
+//
+// By default, timedgc collects the entries of every kind in the database.
+// The -kind flag restricts it to the listed kinds.
+// The -n flag reports the stale entries without deleting them.
+// Only index entries older than the -age duration (default 1h), and
+// older than the progress of every watcher of their kind, are examined.
+//
+// [timed.GC]: https://pkg.go.dev/golang.org/x/oscar/internal/storage/timed#GC
+// [dbspec]: https://pkg.go.dev/golang.org/x/oscar/internal/dbspec
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oscar/internal/dbspec"
+	"golang.org/x/oscar/internal/storage/timed"
+)
+
+var flags struct {
+	dryRun bool
+	kind   string
+	age    time.Duration
+}
+
+func init() {
+	flag.BoolVar(&flags.dryRun, "n", false, "report stale entries without deleting them")
+	flag.StringVar(&flags.kind, "kind", "", "comma-separated `kinds` to collect (default all)")
+	flag.DurationVar(&flags.age, "age", 1*time.Hour, "only examine index entries older than `duration`")
+}
+
+var logger = slog.Default()
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: timedgc [-n] [-kind KIND,...] [-age D] dbspec\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("timedgc: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+
+	spec, err := dbspec.Parse(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := spec.Open(context.Background(), logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	kinds := timed.Kinds(db)
+	if flags.kind != "" {
+		kinds = strings.Split(flags.kind, ",")
+	}
+	before := timed.DBTime(time.Now().Add(-flags.age).UnixNano())
+	for _, kind := range kinds {
+		r := timed.GC(logger, db, kind, before, flags.dryRun)
+		verb := "deleted"
+		if r.DryRun {
+			verb = "would delete"
+		}
+		fmt.Printf("%s: %s %d of %d index entries at or before %s\n",
+			r.Kind, verb, r.Stale, r.Scanned, fmtTime(r.Limit))
+		for _, name := range slices.Sorted(maps.Keys(r.Watchers)) {
+			fmt.Printf("\twatcher %s at %s\n", name, fmtTime(r.Watchers[name]))
+		}
+	}
+}
+
+// fmtTime formats a DBTime for printing.
+// DBTimes are opaque, but in practice they are Unix times in nanoseconds.
+func fmtTime(t timed.DBTime) string {
+	return fmt.Sprintf("%d (%s)", t, time.Unix(0, int64(t)).UTC().Format(time.RFC3339))
+}
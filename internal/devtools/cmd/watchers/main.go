@@ -0,0 +1,140 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Watchers lists and resets the [timed.Watcher]s of a database.
+//
+// Usage:
+//
+//	watchers DBSPEC list
+//	watchers DBSPEC reset KIND NAME T
+//
+// The DBSPEC argument is a [dbspec] specification, such as pebble:DIR
+// or firestore:PROJECT,DATABASE.
+//
+// List prints each registered watcher with its position,
+// the number of entries it has not yet processed, its lag behind
+// the newest entry of its kind, the time it last ran,
+// and the holder of its lock, if any.
+//
+// Reset sets the position of the watcher with the given kind and name,
+// so that it next processes the entries set after T, which is either
+// a DBTime (an integer, 0 to start over) or a time in RFC3339 format.
+//
+// [timed.Watcher]: https://pkg.go.dev/golang.org/x/oscar/internal/storage/timed#Watcher
+// [dbspec]: https://pkg.go.dev/golang.org/x/oscar/internal/dbspec
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/oscar/internal/dbspec"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/storage/timed"
+)
+
+var logger = slog.Default()
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: watchers dbspec list\n")
+	fmt.Fprintf(os.Stderr, "       watchers dbspec reset kind name time\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("watchers: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 2 {
+		usage()
+	}
+
+	spec, err := dbspec.Parse(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := spec.Open(context.Background(), logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	args := flag.Args()[2:]
+	switch flag.Arg(1) {
+	case "list":
+		if len(args) != 0 {
+			usage()
+		}
+		list(db)
+	case "reset":
+		if len(args) != 3 {
+			usage()
+		}
+		if err := reset(db, args[0], args[1], args[2]); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		usage()
+	}
+}
+
+func list(db storage.DB) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "KIND\tNAME\tLATEST\tPENDING\tLAG\tLAST RUN\tHOLDER\n")
+	for _, w := range timed.Watchers(db) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%v\t%s\t%s\n",
+			w.Kind, w.Name, fmtTime(w.Latest), w.Pending, w.Lag().Round(time.Second),
+			w.LastRun.UTC().Format(time.RFC3339), w.Holder)
+	}
+	tw.Flush()
+}
+
+func reset(db storage.DB, kind, name, to string) error {
+	found := false
+	for _, w := range timed.Watchers(db) {
+		if w.Kind == kind && w.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("no watcher %q of kind %q", name, kind)
+	}
+	t, err := parseTime(to)
+	if err != nil {
+		return err
+	}
+	timed.Reset(db, kind, name, t)
+	fmt.Printf("reset %s watcher %s to %s\n", kind, name, fmtTime(t))
+	return nil
+}
+
+// parseTime parses s as a DBTime, either an integer
+// or a wall-clock time in RFC3339 format.
+func parseTime(s string) (timed.DBTime, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return timed.DBTime(n), nil
+	}
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: want DBTime or RFC3339 time", s)
+	}
+	return timed.FromTime(tm), nil
+}
+
+// fmtTime formats a DBTime for printing.
+func fmtTime(t timed.DBTime) string {
+	if t == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%s)", t, t.Time().UTC().Format(time.RFC3339))
+}
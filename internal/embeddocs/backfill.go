@@ -0,0 +1,48 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package embeddocs
+
+import (
+	"log/slog"
+
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+// BackfillMeta sets the metadata of every vector already stored in vdb
+// to meta(id), for vector databases populated before [SyncMeta]
+// stored metadata. If meta returns nil for an id, that vector is left alone.
+// BackfillMeta does nothing if vdb is not a [storage.MetaVectorDB].
+//
+// BackfillMeta records in db, under the given name, that it has finished,
+// so that later calls with the same name return immediately.
+// A BackfillMeta that is interrupted starts over on the next call,
+// which is harmless since setting metadata is idempotent.
+func BackfillMeta(lg *slog.Logger, db storage.DB, vdb storage.VectorDB, name string, meta func(id string) *storage.VectorMeta) {
+	if _, ok := vdb.(storage.MetaVectorDB); !ok {
+		return
+	}
+	key := ordered.Encode("embeddocs.BackfillMeta", name)
+	if _, ok := db.Get(key); ok {
+		return
+	}
+	lg.Info("embeddocs backfill meta start", "name", name)
+	n := 0
+	b := vdb.Batch().(storage.MetaVectorBatch)
+	for id := range vdb.All() {
+		m := meta(id)
+		if m == nil {
+			continue
+		}
+		b.SetMeta(id, m)
+		b.MaybeApply()
+		n++
+	}
+	b.Apply()
+	vdb.Flush()
+	db.Set(key, nil)
+	db.Flush()
+	lg.Info("embeddocs backfill meta done", "name", name, "n", n)
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package embeddocs
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/oscar/internal/docs"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestBackfillMeta(t *testing.T) {
+	check := testutil.Checker(t)
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	vdb := storage.MemVectorDB(db, lg, "vdb").(storage.MetaVectorDB)
+	dc := docs.New(lg, db)
+	for i, text := range texts {
+		dc.Add(fmt.Sprintf("URL%d", i), "", text)
+	}
+	check(Sync(ctx, lg, vdb, llm.QuoteEmbedder(), dc))
+
+	calls := 0
+	meta := func(id string) *storage.VectorMeta {
+		calls++
+		if id == "URL0" {
+			return nil
+		}
+		return &storage.VectorMeta{Kind: "kind-" + id}
+	}
+	BackfillMeta(lg, db, vdb, "test", meta)
+	if calls != len(texts) {
+		t.Errorf("BackfillMeta called meta %d times, want %d", calls, len(texts))
+	}
+	if m, ok := vdb.Meta("URL0"); ok {
+		t.Errorf("Meta(URL0) = %+v, want none", m)
+	}
+	for i := 1; i < len(texts); i++ {
+		id := fmt.Sprintf("URL%d", i)
+		if m, ok := vdb.Meta(id); !ok || m.Kind != "kind-"+id {
+			t.Errorf("Meta(%s) = %+v, %v, want kind-%s", id, m, ok, id)
+		}
+	}
+
+	// A second call with the same name does nothing.
+	calls = 0
+	BackfillMeta(lg, db, vdb, "test", meta)
+	if calls != 0 {
+		t.Errorf("second BackfillMeta called meta %d times, want 0", calls)
+	}
+}
@@ -24,6 +24,16 @@ import (
 //
 // Sync logs status and unexpected problems to lg.
 func Sync(ctx context.Context, lg *slog.Logger, vdb storage.VectorDB, embed llm.Embedder, dc *docs.Corpus) error {
+	return SyncMeta(ctx, lg, vdb, embed, dc, nil)
+}
+
+// SyncMeta is like [Sync], but when vdb is a [storage.MetaVectorDB],
+// it also stores meta(d) as the metadata for each document d.
+// If meta is nil, SyncMeta is the same as Sync.
+func SyncMeta(ctx context.Context, lg *slog.Logger, vdb storage.VectorDB, embed llm.Embedder, dc *docs.Corpus, meta func(*docs.Doc) *storage.VectorMeta) error {
+	if _, ok := vdb.(storage.MetaVectorDB); !ok {
+		meta = nil
+	}
 	model := embed.EmbeddingModel()
 	lg.Info("embeddocs sync", "model", model)
 
@@ -31,6 +41,7 @@ func Sync(ctx context.Context, lg *slog.Logger, vdb storage.VectorDB, embed llm.
 	var (
 		batch     []llm.EmbedDoc
 		ids       []string
+		metas     []*storage.VectorMeta
 		batchLast timed.DBTime
 	)
 	w := dc.DocWatcher(watcherKey(model))
@@ -43,6 +54,9 @@ func Sync(ctx context.Context, lg *slog.Logger, vdb storage.VectorDB, embed llm.
 		vbatch := vdb.Batch()
 		for i, v := range vecs {
 			vbatch.Set(ids[i], v)
+			if meta != nil {
+				vbatch.(storage.MetaVectorBatch).SetMeta(ids[i], metas[i])
+			}
 		}
 		vbatch.Apply()
 		if err != nil {
@@ -56,6 +70,7 @@ func Sync(ctx context.Context, lg *slog.Logger, vdb storage.VectorDB, embed llm.
 		w.Flush()
 		batch = nil
 		ids = nil
+		metas = nil
 		return nil
 	}
 
@@ -67,6 +82,9 @@ func Sync(ctx context.Context, lg *slog.Logger, vdb storage.VectorDB, embed llm.
 		end = d.ID
 		batch = append(batch, llm.EmbedDoc{Title: d.Title, Text: d.Text})
 		ids = append(ids, d.ID)
+		if meta != nil {
+			metas = append(metas, meta(d))
+		}
 		batchLast = d.DBTime
 		if len(batch) >= batchSize {
 			lg.Debug("embeddocs sync flush", "model", model, "start", start, "end", end)
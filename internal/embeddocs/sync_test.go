@@ -78,6 +78,28 @@ func TestSync(t *testing.T) {
 	}
 }
 
+func TestSyncMeta(t *testing.T) {
+	check := testutil.Checker(t)
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	vdb := storage.MemVectorDB(db, lg, "vdb").(storage.MetaVectorDB)
+	dc := docs.New(lg, db)
+	for i, text := range texts {
+		dc.Add(fmt.Sprintf("URL%d", i), "", text)
+	}
+
+	meta := func(d *docs.Doc) *storage.VectorMeta {
+		return &storage.VectorMeta{Kind: "kind-" + d.ID}
+	}
+	check(SyncMeta(ctx, lg, vdb, llm.QuoteEmbedder(), dc, meta))
+	for i := range texts {
+		id := fmt.Sprintf("URL%d", i)
+		if m, ok := vdb.Meta(id); !ok || m.Kind != "kind-"+id {
+			t.Errorf("Meta(%s) = %+v, %v, want kind-%s", id, m, ok, id)
+		}
+	}
+}
+
 func TestBigSync(t *testing.T) {
 	const N = 10000
 
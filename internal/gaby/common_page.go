@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"net/http"
 
 	"github.com/google/safehtml"
 	"github.com/google/safehtml/template"
@@ -20,6 +21,59 @@ func Exec(tmpl *template.Template, p page) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// handleStreamPage writes the page p, executed using tmpl, progressively.
+// It writes the start of the page, including the header and form,
+// and sends it to the client before calling fill to compute the result.
+// While fill runs, it can call stream to write text, such as
+// a partially generated LLM response, as a preview of the result.
+// When fill returns, handleStreamPage writes the result,
+// using the template named result, and the end of the page.
+//
+// tmpl must define the "page-start", "page-end" and stream templates
+// from tmpl/common.tmpl. Executing tmpl itself must produce the
+// same page, without any preview.
+//
+// Errors after the start of the page is written are logged,
+// since it is too late to report them to the client.
+func (g *Gaby) handleStreamPage(w http.ResponseWriter, p page, tmpl *template.Template, result string, fill func(stream func(text string))) {
+	if err := tmpl.ExecuteTemplate(w, "page-start", p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rc := http.NewResponseController(w)
+	_ = rc.Flush()
+
+	var err error
+	streaming := false
+	fill(func(text string) {
+		if err != nil {
+			return
+		}
+		if !streaming {
+			streaming = true
+			err = tmpl.ExecuteTemplate(w, "stream-start", nil)
+		}
+		if err == nil {
+			err = tmpl.ExecuteTemplate(w, "stream-chunk", text)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+	})
+	if err == nil && streaming {
+		err = tmpl.ExecuteTemplate(w, "stream-end", nil)
+	}
+	if err == nil {
+		err = tmpl.ExecuteTemplate(w, result, p)
+	}
+	if err == nil {
+		err = tmpl.ExecuteTemplate(w, "page-end", p)
+	}
+	if err != nil {
+		g.slog.Error("handleStreamPage", "result", result, "err", err)
+	}
+}
+
 // page is a Gaby webpage containing a [CommonPage].
 // Any struct that embeds a [CommonPage] implements this interface.
 type page interface {
@@ -54,6 +108,9 @@ type Form struct {
 	Description string
 	// The text to display on the form's submit button.
 	SubmitText string
+	// (Optional) The HTTP method used to submit the form: GET by default,
+	// or POST for forms that change the database.
+	Method string
 	// The form's inputs.
 	Inputs []FormInput
 }
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -21,7 +22,14 @@ type dbviewPage struct {
 
 	Params dbviewParams // the raw parameters
 	Result *dbviewResult
-	Error  error // if non-nil, the error to display instead of the result
+	Error  error      // if non-nil, the error to display instead of the result
+	Kinds  []kindLink // key kinds to browse, shown when no key is given
+}
+
+// A kindLink is a link to view all the keys of a kind.
+type kindLink struct {
+	Kind string
+	URL  string
 }
 
 type dbviewParams struct {
@@ -55,6 +63,10 @@ func (g *Gaby) populateDBviewPage(r *http.Request) *dbviewPage {
 		},
 	}
 	p.setCommonPage()
+	if p.Params.Start == "" && p.Params.End == "" {
+		p.Kinds = kindLinks()
+		return p
+	}
 	limit := parseInt(p.Params.Limit, 100)
 	start := parseOrdered(p.Params.Start)
 	end := parseOrdered(p.Params.End)
@@ -108,7 +120,26 @@ func (g *Gaby) dbview(start, end []byte, limit int) (*dbviewResult, error) {
 	return &dbviewResult{Items: items}, nil
 }
 
+// kindLinks returns links to browse the kinds of keys
+// with decoders registered by [storage.RegisterDecoder].
+func kindLinks() []kindLink {
+	var links []kindLink
+	for _, kind := range storage.DecoderKinds() {
+		form := url.Values{
+			"start": {kind},
+			"end":   {kind + ",inf"},
+		}
+		links = append(links, kindLink{Kind: kind, URL: dbviewID.Endpoint() + "?" + form.Encode()})
+	}
+	return links
+}
+
+// makeItem returns the item for the key-value pair k, v,
+// formatting v with the decoder registered for k's kind, if any.
 func makeItem(k, v []byte) item {
+	if storage.LookupDecoder(k) != nil {
+		return item{Key: storage.Fmt(k), Value: storage.Decode(k, v)}
+	}
 	var sval string
 	// If v consists of an ordered int64 followed by what might be a JSON object,
 	// guess that it was created by the timed package.
@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
@@ -71,3 +72,37 @@ func TestDBView(t *testing.T) {
 		}
 	}
 }
+
+func TestDBViewDecoder(t *testing.T) {
+	g := &Gaby{
+		db:   storage.MemDB(),
+		slog: testutil.Slogger(t),
+	}
+	storage.RegisterDecoder("gaby.test", func(key, val []byte) (string, error) {
+		return "decoded " + string(val), nil
+	})
+	g.db.Set(o("gaby.test", 1), []byte("v"))
+
+	got, err := g.dbview(o("gaby.test"), o("gaby.test", ordered.Inf), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &dbviewResult{Items: []item{{`("gaby.test", 1)`, "decoded v"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	p := g.populateDBviewPage(httptest.NewRequest("GET", "/dbview", nil))
+	found := false
+	for _, k := range p.Kinds {
+		if k.Kind == "gaby.test" {
+			found = true
+			if want := "/dbview?end=gaby.test%2Cinf&start=gaby.test"; k.URL != want {
+				t.Errorf("URL = %q, want %q", k.URL, want)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("kinds %v missing gaby.test", p.Kinds)
+	}
+}
@@ -121,7 +121,12 @@
 //
 // The primary implementation is [golang.org/x/oscar/internal/gcp/gemini],
 // which uses [Google Gemini]. Other implementations include
-// [golang.org/x/oscar/internal/ollama].
+// [golang.org/x/oscar/internal/ollama], which Gaby uses for both
+// embeddings and content generation when run with the `-ollama` flag,
+// so that it can run entirely offline, and
+// [golang.org/x/oscar/internal/openai], which talks to any
+// OpenAI-compatible server, such as vLLM or llama.cpp,
+// and which Gaby uses when run with the `-openai` flag.
 //
 // For tests that need an embedder but don't care about the quality of
 // the embeddings, [llm.QuoteEmbedder] copies a prefix of the text
@@ -133,6 +138,25 @@
 // application layer on top of these interfaces, including support for
 // prompt templates.
 //
+// With the `-llmquota` flag, Gaby wraps its LLMs using
+// [golang.org/x/oscar/internal/llmquota], which records the requests
+// and tokens used by each component, such as "overview", "related"
+// (analysis of related documents), "chat", "rules", "labels" and "embed"
+// (shown on the /llmusage page), and enforces the limits given by the flag.
+// Token counts are reported by the model for generated content
+// when it streams its responses, as Gemini does;
+// otherwise, and for embeddings and tool calls, they are estimated.
+// Gemini calls are also wrapped using [golang.org/x/oscar/internal/llmretry],
+// which retries transient errors and, with the `-ollamabackup` flag,
+// generates content with a local Ollama model when Gemini fails.
+//
+// With the `-enforcepolicy` flag, Gaby checks LLM inputs and outputs
+// against safety policies using the GCP Checks API
+// ([golang.org/x/oscar/internal/gcp/checks]) or, with `-localpolicy`,
+// offline rules ([golang.org/x/oscar/internal/rulecheck]) that
+// detect secrets and personal information, the terms given by
+// the `-blockedterms` flag, and attempts at prompt injection.
+//
 // # Storage
 //
 // As noted above, Gaby defines interfaces for all the functionality it needs
@@ -176,6 +200,15 @@
 // [storage.MemVectorDB] returns an in-memory implementation that
 // stores the actual vectors in a [storage.DB] for persistence but also
 // keeps a copy in memory and searches by comparing against all the vectors.
+// [storage.HNSWVectorDB] is similar but searches using an approximate
+// nearest-neighbor graph index, also persisted in the [storage.DB],
+// which is much faster for large numbers of vectors.
+// [storage.QuantizedVectorDB] is also similar but keeps only a
+// quantized copy of the vectors in memory, using much less memory;
+// Gaby uses it when run with the `-vectorquant` flag.
+// [golang.org/x/oscar/internal/pebble.VectorDB] stores vectors on disk
+// in half precision and searches them without keeping them in memory;
+// Gaby uses it when run with the `-pebblevectors` flag.
 // There is also a [Google Cloud Firestore] implementation in
 // [golang.org/x/oscar/internal/gcp/firestore].
 //
@@ -196,6 +229,10 @@
 // without risk of modifying the production database. The `-overlay` flag
 // in the main Gaby program enables this mode.
 //
+// The `-encryptdb` flag instead wraps the base DB in
+// [storage.NewEncryptedDB], so that the values stored in it
+// are unreadable without the keys held in a secret.
+//
 // # Ordered Keys
 //
 // Because Gaby makes minimal demands of its storage layer,
@@ -345,6 +382,11 @@
 // Gaby can generate overviews of issues and discussions to help
 // maintainers quickly understand the state of a thread.
 // The [golang.org/x/oscar/internal/overview] package implements this.
+// On the overview page, maintainers can also ask follow-up questions
+// about an issue, which are answered using the issue, its comments
+// and related documents (see [golang.org/x/oscar/internal/llmapp.Chat]).
+// Questions and answers are checked against the same policies as overviews.
+// Conversations are deleted after 30 days without use.
 //
 // # Bisection
 //
@@ -0,0 +1,144 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oscar/internal/llmquota"
+)
+
+// llmUsagePage holds the fields needed to display LLM usage and limits.
+type llmUsagePage struct {
+	CommonPage
+
+	Params llmUsageParams // the raw parameters
+	Limits []llmLimitItem
+	Days   []llmUsageDay // most recent first
+	Error  error         // if non-nil, the error to display instead of the usage
+}
+
+// llmUsageParams are the parameters of the LLM usage page.
+type llmUsageParams struct {
+	Days string // number of days of usage to display
+}
+
+// An llmLimitItem is a displayable form of an [llmquota.Limit].
+type llmLimitItem struct {
+	Component         string // "(global)" for the global limit
+	RequestsPerMinute string
+	TokensPerDay      string
+}
+
+// An llmUsageDay is the LLM usage of all components on one day.
+type llmUsageDay struct {
+	Day   string
+	Usage []*llmquota.Usage
+	Total llmquota.Usage
+}
+
+// defaultUsageDays is the default number of days of usage to display.
+const defaultUsageDays = 7
+
+var llmUsagePageTmpl = newTemplate(llmUsagePageTmplFile, nil)
+
+func (g *Gaby) handleLLMUsage(w http.ResponseWriter, r *http.Request) {
+	handlePage(w, g.populateLLMUsagePage(r), llmUsagePageTmpl)
+}
+
+// populateLLMUsagePage returns the contents of the LLM usage page.
+func (g *Gaby) populateLLMUsagePage(r *http.Request) *llmUsagePage {
+	p := &llmUsagePage{
+		Params: llmUsageParams{
+			Days: r.FormValue("days"),
+		},
+	}
+	p.setCommonPage()
+	if g.quota == nil {
+		p.Error = fmt.Errorf("LLM usage is not being recorded (see the -llmquota flag)")
+		return p
+	}
+	days := defaultUsageDays
+	if s := strings.TrimSpace(p.Params.Days); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			p.Error = fmt.Errorf("invalid number of days %q", s)
+			return p
+		}
+		days = n
+	}
+
+	global, limits := g.quota.Limits()
+	p.Limits = append(p.Limits, limitItem("(global)", global))
+	for _, c := range slices.Sorted(maps.Keys(limits)) {
+		p.Limits = append(p.Limits, limitItem(c, limits[c]))
+	}
+
+	today, _ := time.Parse(time.DateOnly, g.quota.Today())
+	for i := range days {
+		d := llmUsageDay{Day: today.AddDate(0, 0, -i).Format(time.DateOnly)}
+		d.Total.Component = "(total)"
+		for u := range g.quota.Usage(d.Day) {
+			d.Usage = append(d.Usage, u)
+			d.Total.Requests += u.Requests
+			d.Total.InputTokens += u.InputTokens
+			d.Total.OutputTokens += u.OutputTokens
+			d.Total.Rejected += u.Rejected
+		}
+		if len(d.Usage) > 0 {
+			p.Days = append(p.Days, d)
+		}
+	}
+	return p
+}
+
+// limitItem returns the displayable form of the component's limit.
+func limitItem(component string, lim llmquota.Limit) llmLimitItem {
+	show := func(n int64) string {
+		if n <= 0 {
+			return "none"
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	return llmLimitItem{
+		Component:         component,
+		RequestsPerMinute: show(int64(lim.RequestsPerMinute)),
+		TokensPerDay:      show(lim.TokensPerDay),
+	}
+}
+
+func (p *llmUsagePage) setCommonPage() {
+	p.CommonPage = CommonPage{
+		ID:          llmusageID,
+		Description: "View the LLM requests and tokens used by each component, and the limits on them.",
+		Form: Form{
+			Inputs:     p.Params.inputs(),
+			SubmitText: "show",
+		},
+	}
+}
+
+var safeDays = toSafeID("days")
+
+func (pm *llmUsageParams) inputs() []FormInput {
+	return []FormInput{
+		{
+			Label:       "Days",
+			Type:        "int",
+			Description: fmt.Sprintf("the number of days of usage to show (default %d)", defaultUsageDays),
+			Name:        safeDays,
+			Typed: TextInput{
+				ID:    safeDays,
+				Value: pm.Days,
+			},
+		},
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/llmapp"
+	"golang.org/x/oscar/internal/llmquota"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestLLMUsagePage(t *testing.T) {
+	g := &Gaby{
+		db:   storage.MemDB(),
+		slog: testutil.Slogger(t),
+		llm:  llm.EchoContentGenerator(),
+	}
+	get := func(form url.Values) *llmUsagePage {
+		r := httptest.NewRequest("GET", "/llmusage?"+form.Encode(), nil)
+		return g.populateLLMUsagePage(r)
+	}
+	if p := get(nil); p.Error == nil {
+		t.Errorf("no error without quota")
+	}
+
+	g.quota = llmquota.New(g.slog, g.db, llmquota.Limit{RequestsPerMinute: 100})
+	g.quota.SetLimit("rules", llmquota.Limit{TokensPerDay: 1000})
+	ctx := context.Background()
+	for _, c := range []string{"rules", "labels", "rules"} {
+		if _, err := g.llmFor(c).GenerateContent(ctx, nil, []llm.Part{llm.Text("12345678")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := get(nil)
+	if p.Error != nil {
+		t.Fatal(p.Error)
+	}
+	wantLimits := []llmLimitItem{
+		{Component: "(global)", RequestsPerMinute: "100", TokensPerDay: "none"},
+		{Component: "rules", RequestsPerMinute: "none", TokensPerDay: "1000"},
+	}
+	if !slices.Equal(p.Limits, wantLimits) {
+		t.Errorf("limits = %+v, want %+v", p.Limits, wantLimits)
+	}
+	if len(p.Days) != 1 {
+		t.Fatalf("got %d days of usage, want 1", len(p.Days))
+	}
+	d := p.Days[0]
+	if d.Day != g.quota.Today() || len(d.Usage) != 2 || d.Usage[1].Component != "rules" || d.Usage[1].Requests != 2 {
+		t.Errorf("usage = %+v, want 2 components on %s", d, g.quota.Today())
+	}
+	// The echo generator reports 1 input and 1 output token per call.
+	if d.Total.Requests != 3 || d.Total.Tokens() != 6 {
+		t.Errorf("total = %+v, want 3 requests and 6 tokens", d.Total)
+	}
+
+	if p := get(url.Values{"days": {"x"}}); p.Error == nil {
+		t.Errorf("days=x: no error")
+	}
+}
+
+func TestLLMAppFor(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	g := &Gaby{
+		db:     db,
+		slog:   lg,
+		llm:    llm.EchoContentGenerator(),
+		llmapp: llmapp.New(lg, llm.EchoContentGenerator(), db),
+	}
+	if g.llmappFor("chat") != g.llmapp {
+		t.Errorf("llmappFor without quota is not g.llmapp")
+	}
+
+	// With a quota, each component's use is recorded separately.
+	g.quota = llmquota.New(lg, db, llmquota.Limit{})
+	ctx := context.Background()
+	if _, err := g.llmappFor("chat").NewChat("", nil).Ask(ctx, "hello?"); err != nil {
+		t.Fatal(err)
+	}
+	var components []string
+	for u := range g.quota.Usage(g.quota.Today()) {
+		components = append(components, u.Component)
+	}
+	if want := []string{"chat"}; !slices.Equal(components, want) {
+		t.Errorf("components = %q, want %q", components, want)
+	}
+}
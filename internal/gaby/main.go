@@ -10,6 +10,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"log/slog"
 	"net"
@@ -45,13 +46,22 @@ import (
 	"golang.org/x/oscar/internal/labels"
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/llmapp"
+	"golang.org/x/oscar/internal/llmquota"
+	"golang.org/x/oscar/internal/llmretry"
+	"golang.org/x/oscar/internal/localmetrics"
+	"golang.org/x/oscar/internal/ollama"
+	"golang.org/x/oscar/internal/openai"
 	"golang.org/x/oscar/internal/overview"
+	"golang.org/x/oscar/internal/pebble"
 	"golang.org/x/oscar/internal/queue"
 	"golang.org/x/oscar/internal/related"
+	"golang.org/x/oscar/internal/rulecheck"
 	"golang.org/x/oscar/internal/rules"
 	"golang.org/x/oscar/internal/search"
 	"golang.org/x/oscar/internal/secret"
 	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/storage/dbmetrics"
+	"golang.org/x/oscar/internal/storage/migrate"
 	"golang.org/x/oscar/internal/storage/timed"
 )
 
@@ -67,6 +77,17 @@ type gabyFlags struct {
 	overlay       string
 	autoApprove   string // list of packages that do not require manual approval
 	enforcePolicy bool
+	metrics       string // local metrics exporter: "", "stdout" or "prometheus"
+	ollama        bool   // use a local Ollama server instead of Gemini
+	openai        string // "embedmodel,genmodel" to use an OpenAI-compatible server instead of Gemini
+	lookupDocs    bool   // let the LLM look up documents when writing overviews
+	llmQuota      string // limits on LLM use; see [llmquota.ParseLimits]
+	ollamaBackup  bool   // generate content with a local Ollama server when Gemini fails
+	localPolicy   bool   // enforce policies with local rules instead of the GCP Checks API
+	blockedTerms  string // comma-separated terms that violate the local blocked-terms policy
+	pebbleVectors string // directory of a Pebble database to store vectors in instead of Firestore
+	vectorQuant   string // quantization for searching vectors stored in the DB instead of Firestore
+	encryptDB     string // name of the secret holding the keys to encrypt DB values with
 }
 
 var flags gabyFlags
@@ -80,9 +101,20 @@ func init() {
 	flag.BoolVar(&flags.testactions, "testactions", false, "allow approved actions to run (for testing only)")
 	flag.StringVar(&flags.level, "level", "info", "initial log level")
 	flag.StringVar(&flags.overlay, "overlay", "", "spec for overlay to DB; see internal/dbspec for syntax")
+	flag.StringVar(&flags.pebbleVectors, "pebblevectors", "", "store vectors in the Pebble database in `dir`, creating it if needed, instead of in Firestore")
+	flag.StringVar(&flags.vectorQuant, "vectorquant", "", "store vectors in the DB instead of in Firestore and search an in-memory copy quantized as `q` (\"int8\" or \"binary\")")
+	flag.StringVar(&flags.encryptDB, "encryptdb", "", "encrypt all values stored in the DB with the keys in the secret `name` (see storage.NewEncryptedDB); the DB must not hold unencrypted values")
 	flag.StringVar(&flags.autoApprove, "autoapprove", "", "comma-separated list of packages whose actions do not require approval")
 	flag.BoolVar(&flags.enforcePolicy, "enforcepolicy", false, "whether to enforce safety policies on LLM inputs and outputs")
+	flag.BoolVar(&flags.localPolicy, "localpolicy", false, "with -enforcepolicy, check LLM inputs and outputs with local rules (see internal/rulecheck) instead of the GCP Checks API")
+	flag.StringVar(&flags.blockedTerms, "blockedterms", "", "with -localpolicy, comma-separated list of terms that LLM inputs and outputs must not contain")
 	flag.BoolVar(&flags.netrc, "netrc", false, "use netrc for secrets")
+	flag.BoolVar(&flags.ollama, "ollama", false, "use a local Ollama server ($OLLAMA_HOST) for embeddings and content generation instead of Gemini")
+	flag.StringVar(&flags.openai, "openai", "", "use the `embedmodel,genmodel` models on an OpenAI-compatible server ($OPENAI_BASE_URL, default a local vLLM server) for embeddings and content generation instead of Gemini")
+	flag.BoolVar(&flags.lookupDocs, "lookupdocs", false, "let the LLM look up linked issues, changes and docs when generating overviews (Gemini only, without -ollamabackup)")
+	flag.BoolVar(&flags.ollamaBackup, "ollamabackup", false, "generate content with a local Ollama server ($OLLAMA_HOST) when Gemini fails")
+	flag.StringVar(&flags.llmQuota, "llmquota", "", "comma-separated limits on LLM use, such as \"rpm=60,tpd=5000000,embed.rpm=10\" (see internal/llmquota); LLM usage is recorded only if set, and \"rpm=0\" records it without limits")
+	flag.StringVar(&flags.metrics, "metrics", "", "when not on Cloud Run, export metrics to \"stdout\" or serve them for \"prometheus\" at /metrics")
 }
 
 // Gaby holds the state for gaby's execution.
@@ -103,7 +135,8 @@ type Gaby struct {
 	secret    secret.DB              // secret database to use
 	docs      *docs.Corpus           // document corpus to use
 	embed     llm.Embedder           // LLM embedder to use
-	llm       llm.ContentGenerator   // LLM content generator to use
+	llm       llm.ContentGenerator   // LLM content generator to use; see llmFor
+	quota     *llmquota.Limiter      // limits on LLM use, if non-nil
 	policy    llm.PolicyChecker      // LLM checker to use
 	llmapp    *llmapp.Client         // LLM client to use
 	github    *github.Client         // github client to use
@@ -113,6 +146,7 @@ type Gaby struct {
 	crawler   *crawl.Crawler         // web crawler to use
 	bisect    *bisect.Client         // bisect client to use
 	meter     ometric.Meter          // used to create Open Telemetry instruments
+	metrics   http.Handler           // serves metrics locally, if non-nil
 	report    *errorreporting.Client // used to report important gaby errors to Cloud Error Reporting service
 
 	relatedPoster *related.Poster   // used to post related issues
@@ -150,46 +184,50 @@ func main() {
 	shutdown := g.initGCP() // sets up g.db, g.vector, g.secret, ...
 	defer shutdown()
 
-	ai, err := gemini.NewClient(g.ctx, g.slog, g.secret, g.http, gemini.DefaultEmbeddingModel, gemini.DefaultGenerativeModel)
-	if err != nil {
-		log.Fatal(err)
-	}
-	g.embed = ai
-	g.llm = ai
+	g.initLLM()
 
 	g.initDB()
 
-	g.github = github.New(g.slog, g.db, g.secret, g.http)
+	g.github = github.New(g.slog, g.dbFor("github"), g.secret, g.http)
 	for _, project := range g.githubProjects {
 		if err := g.github.Add(project); err != nil {
 			log.Fatalf("github.Add failed: %v", err)
 		}
 	}
-	g.disc = discussion.New(g.ctx, g.slog, g.secret, g.db)
+	g.disc = discussion.New(g.ctx, g.slog, g.secret, g.dbFor("discussion"))
 	for _, project := range g.githubProjects {
 		if err := g.disc.Add(project); err != nil {
 			log.Fatalf("discussion.Add failed: %v", err)
 		}
 	}
 
-	g.gerrit = gerrit.New("go-review.googlesource.com", g.slog, g.db, g.secret, g.http)
+	g.gerrit = gerrit.New("go-review.googlesource.com", g.slog, g.dbFor("gerrit"), g.secret, g.http)
 	for _, project := range g.gerritProjects {
 		if err := g.gerrit.Add(project); err != nil {
 			log.Fatalf("gerrit.Add failed: %v", err)
 		}
 	}
 
-	g.ggroups = googlegroups.New(g.slog, g.db, g.secret, g.http)
+	g.ggroups = googlegroups.New(g.slog, g.dbFor("googlegroups"), g.secret, g.http)
 	for _, group := range g.googleGroups {
 		if err := g.ggroups.Add(group); err != nil {
 			log.Fatalf("googlegroups.Add failed: %v", err)
 		}
 	}
 
-	g.docs = docs.New(g.slog, g.db)
+	g.docs = docs.New(g.slog, g.dbFor("docs"))
 
-	g.llmapp = llmapp.NewWithChecker(g.slog, ai, g.policy, g.db)
-	ov := overview.New(g.slog, g.db, g.github, g.llmapp, "overview", "gabyhelp")
+	// Each use of llmapp is a separate LLM component; see llmappFor.
+	g.llmapp = llmapp.NewWithChecker(g.slog, g.llm, g.policy, g.dbFor("llmapp"))
+	if flags.lookupDocs {
+		// Tools are silently unused if the LLM cannot call them,
+		// as is the case for Ollama, including as a backup for Gemini.
+		if _, ok := g.llm.(llm.ToolCaller); !ok {
+			log.Fatal("-lookupdocs: the LLM cannot call tools; it cannot be used with -ollama, -ollamabackup or -openai")
+		}
+		g.llmapp.SetTools(llmapp.DocLookupTool(g.docs))
+	}
+	ov := overview.New(g.slog, g.dbFor("overview"), g.github, g.llmappFor("overview"), "overview", "gabyhelp")
 	for _, proj := range g.githubProjects {
 		ov.EnableProject(proj)
 	}
@@ -203,7 +241,7 @@ func main() {
 	ov.SkipCommentsBy("gopherbot")
 	g.overview = ov
 
-	cr := crawl.New(g.slog, g.db, g.http)
+	cr := crawl.New(g.slog, g.dbFor("crawl"), g.http)
 	cr.Add("https://go.dev/")
 	cr.Allow(godevAllow...)
 	cr.Deny(godevDeny...)
@@ -216,7 +254,7 @@ func main() {
 		if err != nil {
 			log.Fatalf("task Queue creation failed: %v", err)
 		}
-		bs := bisect.New(g.slog, g.db, q)
+		bs := bisect.New(g.slog, g.dbFor("bisect"), q)
 		g.bisect = bs
 	}
 
@@ -225,7 +263,7 @@ func main() {
 		return
 	}
 
-	cf := commentfix.New(g.slog, g.github, g.db, "gerritlinks")
+	cf := commentfix.New(g.slog, g.github, g.dbFor("commentfix"), "gerritlinks")
 	for _, proj := range g.githubProjects {
 		cf.EnableProject(proj)
 	}
@@ -237,7 +275,7 @@ func main() {
 	}
 	g.commentFixer = cf
 
-	rp := related.New(g.slog, g.db, g.github, g.vector, g.docs, "related")
+	rp := related.New(g.slog, g.dbFor("related"), g.github, g.vector, g.docs, "related")
 	for _, proj := range g.githubProjects {
 		rp.EnableProject(proj)
 	}
@@ -252,7 +290,7 @@ func main() {
 	}
 	g.relatedPoster = rp
 
-	rulep := rules.New(g.slog, g.db, g.github, g.llm, "rules")
+	rulep := rules.New(g.slog, g.dbFor("rules"), g.github, g.llmFor("rules"), "rules")
 	for _, proj := range g.githubProjects {
 		rulep.EnableProject(proj)
 	}
@@ -262,7 +300,7 @@ func main() {
 	}
 	g.rulesPoster = rulep
 
-	labeler := labels.New(g.slog, g.db, g.github, ai, "gabyhelp")
+	labeler := labels.New(g.slog, g.dbFor("labels"), g.github, g.llmFor("labels"), "gabyhelp")
 	for _, proj := range g.githubProjects {
 		// TODO: support other projects.
 		if proj != "golang/go" {
@@ -277,25 +315,10 @@ func main() {
 	}
 	g.labeler = labeler
 
-	// Named functions to retrieve latest Watcher times.
-	watcherLatests := map[string]func() timed.DBTime{
-		github.DocWatcherID:       docs.LatestFunc(g.github),
-		gerrit.DocWatcherID:       docs.LatestFunc(g.gerrit),
-		discussion.DocWatcherID:   docs.LatestFunc(g.disc),
-		crawl.DocWatcherID:        docs.LatestFunc(cr),
-		googlegroups.DocWatcherID: docs.LatestFunc(g.ggroups),
-
-		"embeddocs": func() timed.DBTime { return embeddocs.Latest(g.docs, g.embed) },
-
-		"gerritlinks fix": cf.Latest,
-		"related":         rp.Latest,
-		"rules":           rulep.Latest,
-		"labeler":         labeler.Latest,
-		"overview":        ov.Latest,
-	}
-
-	// Install a metric that observes the latest values of the watchers each time metrics are sampled.
-	g.registerWatcherMetric(watcherLatests)
+	// Install metrics that observe the registered watchers each time metrics are sampled.
+	g.registerWatcherMetrics()
+	// Install metrics that observe today's LLM usage.
+	g.registerLLMUsageMetrics()
 
 	g.serveHTTP()
 	log.Printf("serving %s", g.addr)
@@ -304,6 +327,7 @@ func main() {
 		// Simulate Cloud Scheduler.
 		go g.localCron()
 	}
+	go g.react(g.ctx)
 	select {}
 }
 
@@ -325,6 +349,81 @@ func parseApprovalPkgs(s string) ([]string, error) {
 	return pkgs, nil
 }
 
+// initLLM initializes g.embed, g.llm and g.quota.
+func (g *Gaby) initLLM() {
+	var embed llm.Embedder
+	switch {
+	case flags.ollama && flags.openai != "":
+		log.Fatal("-ollama and -openai are mutually exclusive")
+	case flags.ollama:
+		ai, err := ollama.NewClient(g.slog, g.http, "", ollama.DefaultEmbeddingModel, ollama.DefaultGenerativeModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		embed = ai
+		g.llm = ai
+	case flags.openai != "":
+		embedModel, genModel, ok := strings.Cut(flags.openai, ",")
+		if !ok {
+			log.Fatalf("invalid -openai %q: want embedmodel,genmodel", flags.openai)
+		}
+		ai, err := openai.NewClient(g.slog, g.secret, g.http, "", embedModel, genModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		embed = ai
+		g.llm = ai
+	default:
+		ai, err := gemini.NewClient(g.ctx, g.slog, g.secret, g.http, gemini.DefaultEmbeddingModel, gemini.DefaultGenerativeModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Retry transient errors, such as overloaded servers,
+		// so that they do not fail whole syncs or actions.
+		embed = llmretry.RetryEmbedder(ai, llmretry.DefaultPolicy)
+		g.llm = llmretry.Retry(ai, llmretry.DefaultPolicy)
+		if flags.ollamaBackup {
+			backup, err := ollama.NewClient(g.slog, g.http, "", ollama.DefaultEmbeddingModel, ollama.DefaultGenerativeModel)
+			if err != nil {
+				log.Fatal(err)
+			}
+			g.llm = llmretry.Fallback(g.llm, backup)
+		}
+	}
+
+	g.embed = embed
+	if flags.llmQuota == "" {
+		return
+	}
+	global, limits, err := llmquota.ParseLimits(flags.llmQuota)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g.quota = llmquota.New(g.slog, g.dbFor("llmquota"), global)
+	for component, lim := range limits {
+		g.quota.SetLimit(component, lim)
+	}
+	g.embed = g.quota.Embedder("embed", embed)
+}
+
+// llmFor returns the LLM content generator to use for the named component,
+// which is subject to the component's limits (see [llmquota.Limiter]).
+func (g *Gaby) llmFor(component string) llm.ContentGenerator {
+	if g.quota == nil {
+		return g.llm
+	}
+	return g.quota.ContentGenerator(component, g.llm)
+}
+
+// llmappFor returns the LLM application client to use for the named
+// component, whose LLM calls are subject to the component's limits.
+func (g *Gaby) llmappFor(component string) *llmapp.Client {
+	if g.quota == nil {
+		return g.llmapp
+	}
+	return g.llmapp.WithGenerator(g.llmFor(component))
+}
+
 // initGCP initializes a Gaby instance to use GCP databases and other resources.
 func (g *Gaby) initGCP() (shutdown func()) {
 	shutdown = func() {}
@@ -369,11 +468,19 @@ func (g *Gaby) initGCP() (shutdown func()) {
 	}
 
 	if flags.enforcePolicy {
-		llmchecker, err := checks.New(g.ctx, g.slog, flags.project, llm.AllPolicyTypes())
-		if err != nil {
-			log.Fatal(err)
+		if flags.localPolicy {
+			llmchecker, err := rulecheck.New(rulecheck.DefaultPolicies(), strings.Split(flags.blockedTerms, ","))
+			if err != nil {
+				log.Fatal(err)
+			}
+			g.policy = llmchecker
+		} else {
+			llmchecker, err := checks.New(g.ctx, g.slog, flags.project, llm.AllPolicyTypes())
+			if err != nil {
+				log.Fatal(err)
+			}
+			g.policy = llmchecker
 		}
-		g.policy = llmchecker
 	}
 
 	// Initialize error reporting if we are running on Cloud Run.
@@ -404,7 +511,30 @@ func (g *Gaby) initGCP() (shutdown func()) {
 			}
 		}
 	} else {
-		g.meter = noop.Meter{}
+		switch flags.metrics {
+		case "":
+			g.meter = noop.Meter{}
+		case "stdout":
+			mp, err := localmetrics.NewStdoutMeterProvider(os.Stdout, time.Minute)
+			if err != nil {
+				log.Fatal(err)
+			}
+			g.meter = mp.Meter("local")
+			shutdown = func() {
+				if err := mp.Shutdown(g.ctx); err != nil {
+					log.Fatal(err)
+				}
+			}
+		case "prometheus":
+			mp, h, err := localmetrics.NewPrometheusMeterProvider()
+			if err != nil {
+				log.Fatal(err)
+			}
+			g.meter = mp.Meter("local")
+			g.metrics = h
+		default:
+			log.Fatalf("invalid -metrics %q: want stdout or prometheus", flags.metrics)
+		}
 	}
 	return shutdown
 }
@@ -420,6 +550,12 @@ func (g *Gaby) initDB() {
 		log.Fatal(err)
 	}
 	g.db = db
+	if flags.encryptDB != "" {
+		g.db, err = storage.NewEncryptedDB(g.db, g.secret, flags.encryptDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	vectorDBNamespace := "gaby" + slashEmbed(g.embed)
 	if flags.overlay != "" {
@@ -435,14 +571,64 @@ func (g *Gaby) initDB() {
 			log.Fatal(err)
 		}
 		g.db = storage.NewOverlayDB(odb, g.db)
-		g.vector = storage.MemVectorDB(g.db, g.slog, vectorDBNamespace)
-	} else {
+	}
+	switch {
+	case flags.pebbleVectors != "" && flags.vectorQuant != "":
+		log.Fatal("-pebblevectors and -vectorquant are mutually exclusive")
+	case flags.pebbleVectors != "":
+		vdb, err := openPebbleVectorDB(g.slog, flags.pebbleVectors, vectorDBNamespace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g.vector = vdb
+	case flags.vectorQuant != "":
+		q, err := storage.ParseQuantization(flags.vectorQuant)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g.vector = storage.QuantizedVectorDB(g.db, g.slog, vectorDBNamespace, q)
+	case flags.overlay != "":
+		g.vector = storage.HNSWVectorDB(g.db, g.slog, vectorDBNamespace)
+	default:
 		vdb, err := firestore.NewVectorDB(g.ctx, g.slog, spec.Location, spec.Name, vectorDBNamespace)
 		if err != nil {
 			log.Fatal(err)
 		}
 		g.vector = vdb
 	}
+
+	// Record the latency and size of database operations.
+	// Clients use [Gaby.dbFor] to attribute their operations.
+	dbm, err := dbmetrics.New(g.meter, metricName("db"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	g.db = dbm.DB(g.db, "gaby")
+	g.vector = dbm.VectorDB(g.vector, "gaby")
+
+	// Bring the key layouts up to date before anything reads them.
+	if _, err := migrate.Run(g.slog, g.dbFor("migrate"), false); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openPebbleVectorDB returns the vector DB with the given namespace
+// in the Pebble database in dir, creating the database if it does not exist.
+func openPebbleVectorDB(lg *slog.Logger, dir, namespace string) (*pebble.VectorDB, error) {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		db, err := pebble.Create(lg, dir)
+		if err != nil {
+			return nil, err
+		}
+		db.Close()
+	}
+	return pebble.OpenVectorDB(lg, dir, namespace)
+}
+
+// dbFor returns a view of g.db that attributes the metrics
+// for its operations to the named component.
+func (g *Gaby) dbFor(component string) storage.DB {
+	return dbmetrics.Component(g.db, component)
 }
 
 // taskQueue returns a bisection Cloud Task queue.
@@ -562,6 +748,10 @@ func (g *Gaby) newServer(report func(error, *http.Request)) *http.ServeMux {
 		fmt.Fprintf(w, "log level: %v\n", g.slogLevel.Level())
 	})
 
+	if g.metrics != nil {
+		mux.Handle("GET /metrics", g.metrics)
+	}
+
 	// serve static files
 	mux.Handle("GET /static/", http.FileServerFS(staticFS))
 
@@ -757,6 +947,9 @@ func (g *Gaby) newServer(report func(error, *http.Request)) *http.ServeMux {
 	// /overview: display a form for LLM-generated overviews of data.
 	// /overview?q=...: generate an overview using the value of q as input.
 	mux.HandleFunc(get(overviewID), g.handleOverview)
+	// /overview/ask: ask a question about the issue on the overview page.
+	// POST because it adds to the stored conversation.
+	mux.HandleFunc("POST "+askEndpoint, g.handleOverviewAsk)
 
 	// /rules: display a form for entering an issue to check for rule violations.
 	// /rules?q=...: generate a list of violated rules for issue q.
@@ -781,6 +974,16 @@ func (g *Gaby) newServer(report func(error, *http.Request)) *http.ServeMux {
 
 	// /bisectlog: display bisection tasks
 	mux.HandleFunc(get(bisectlogID), g.handleBisectLog)
+
+	// /watchers: display the database watchers.
+	mux.HandleFunc(get(watchersID), g.handleWatchers)
+	// /watchers with kind, name and to in the body: reset a watcher,
+	// then redirect to /watchers to display them.
+	// POST because it changes the database.
+	mux.HandleFunc("POST "+watchersID.Endpoint(), g.handleWatchersReset)
+
+	// /llmusage: display LLM usage and limits.
+	mux.HandleFunc(get(llmusageID), g.handleLLMUsage)
 	return mux
 }
 
@@ -849,6 +1052,8 @@ func (g *Gaby) syncAndRunAll(ctx context.Context) (errs []error) {
 		check(g.runActions())
 	}
 
+	g.expireChats()
+
 	return errs
 }
 
@@ -938,7 +1143,13 @@ func (g *Gaby) embedAll(ctx context.Context) error {
 	g.db.Lock(lock)
 	defer g.db.Unlock(lock)
 
-	return embeddocs.Sync(ctx, g.slog, g.vector, g.embed, g.docs)
+	// Store metadata with the vectors so that searches can filter on it.
+	meta := func(d *docs.Doc) *storage.VectorMeta { return g.docMeta(d.ID) }
+	if err := embeddocs.SyncMeta(ctx, g.slog, g.vector, g.embed, g.docs, meta); err != nil {
+		return err
+	}
+	g.updateVectorMeta()
+	return nil
 }
 
 func slashEmbed(embed llm.Embedder) string {
@@ -1000,6 +1211,68 @@ func (g *Gaby) postAllBisections(ctx context.Context) error {
 	return nil
 }
 
+// reactDelay is how long [Gaby.react] waits after a notification
+// before acting, so that a burst of changes is handled together.
+const reactDelay = 5 * time.Second
+
+// react runs the work that depends on new GitHub events and documents
+// soon after they are written, rather than waiting for the next /cron.
+// It only has an effect when g.db supports change notifications
+// (see [storage.Notifier]), as the in-memory and Pebble databases do,
+// and only for changes made by this process, such as the events
+// written when handling a GitHub webhook.
+func (g *Gaby) react(ctx context.Context) {
+	events := g.github.EventWatcher("gabyreact").Subscribe()
+	defer events.Close()
+	dw := g.docs.DocWatcher("gabyreact")
+	newDocs := dw.Subscribe()
+	defer newDocs.Close()
+
+	// React only to documents written from now on.
+	skipDocs(dw)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-events.C:
+		case <-newDocs.C:
+			// The documents written by docs.Sync below also
+			// cause notifications, but they have been handled.
+			if !skipDocs(dw) {
+				continue
+			}
+		}
+		time.Sleep(reactDelay)
+
+		var errs []error
+		if flags.enablesync {
+			g.db.Lock(gabyGitHubSyncLock)
+			docs.Sync(g.docs, g.github)
+			g.db.Unlock(gabyGitHubSyncLock)
+			skipDocs(dw)
+			errs = append(errs, g.embedAll(ctx))
+		}
+		if flags.enablechanges {
+			errs = append(errs, g.postAllRelated(ctx), g.labelAll(ctx), g.runActions())
+		}
+		if err := errors.Join(errs...); err != nil {
+			g.slog.Error("react", "err", err)
+		}
+	}
+}
+
+// skipDocs marks all the documents that dw has not yet returned as old,
+// reporting whether there were any.
+func skipDocs(dw *timed.Watcher[*docs.Doc]) bool {
+	found := false
+	for d := range dw.Recent() {
+		dw.MarkOld(d.DBTime)
+		found = true
+	}
+	dw.Flush()
+	return found
+}
+
 // localCron simulates Cloud Scheduler by fetching our server's /cron endpoint once per minute.
 func (g *Gaby) localCron() {
 	for ; ; time.Sleep(1 * time.Minute) {
@@ -57,3 +57,19 @@ func TestNewServer(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSkipDocs(t *testing.T) {
+	g := newTestGaby(t)
+	dw := g.docs.DocWatcher("gabyreact")
+	if skipDocs(dw) {
+		t.Errorf("skipDocs with no docs = true, want false")
+	}
+	g.docs.Add("id1", "title", "text")
+	g.docs.Add("id2", "title", "text")
+	if !skipDocs(dw) {
+		t.Errorf("skipDocs with new docs = false, want true")
+	}
+	if skipDocs(dw) {
+		t.Errorf("skipDocs after skipDocs = true, want false")
+	}
+}
@@ -7,6 +7,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"go.opentelemetry.io/otel/attribute"
 	ometric "go.opentelemetry.io/otel/metric"
@@ -32,22 +34,90 @@ func (g *Gaby) newEndpointCounter(endpoint string) ometric.Int64Counter {
 	return g.newCounter(name, desc)
 }
 
-// registerWatcherMetric adds a metric called "watcher-latest" for the latest times of Watchers.
-// The latests map contains the functions to compute the latest times, each labeled
-// by a string which becomes the value of the "name" attribute in the metric.
-func (g *Gaby) registerWatcherMetric(latests map[string]func() timed.DBTime) {
-	_, err := g.meter.Int64ObservableGauge(metricName("watcher-latest"),
-		ometric.WithDescription("latest DBTime of watcher"),
-		ometric.WithInt64Callback(func(_ context.Context, observer ometric.Int64Observer) error {
-			for name, f := range latests {
-				observer.Observe(int64(f()), ometric.WithAttributes(attribute.String("name", name)))
-			}
-			return nil
-		}))
+// registerWatcherMetrics adds metrics called "watcher-latest" and "watcher-pending"
+// for the latest times and numbers of pending entries of the Watchers
+// registered in the database (see [timed.Watchers]).
+// The watcher's name and kind become the values of the "name" and "kind"
+// attributes in the metrics.
+//
+// Computing the pending entries scans the time index of each kind
+// from the oldest watcher's position, which can take a long time,
+// so the metrics reuse the results for watcherMetricsInterval.
+func (g *Gaby) registerWatcherMetrics() {
+	latest, err := g.meter.Int64ObservableGauge(metricName("watcher-latest"),
+		ometric.WithDescription("latest DBTime of watcher"))
 	if err != nil {
 		g.slog.Error("watcher gauge creation failed")
 		panic(err)
 	}
+	pending, err := g.meter.Int64ObservableGauge(metricName("watcher-pending"),
+		ometric.WithDescription("number of entries not yet processed by watcher"))
+	if err != nil {
+		g.slog.Error("watcher gauge creation failed")
+		panic(err)
+	}
+	var (
+		mu       sync.Mutex
+		watchers []*timed.WatcherInfo
+		last     time.Time
+	)
+	_, err = g.meter.RegisterCallback(func(_ context.Context, observer ometric.Observer) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(last) >= watcherMetricsInterval {
+			watchers = timed.Watchers(g.db)
+			last = time.Now()
+		}
+		for _, w := range watchers {
+			attrs := ometric.WithAttributes(attribute.String("name", w.Name), attribute.String("kind", w.Kind))
+			observer.ObserveInt64(latest, int64(w.Latest), attrs)
+			observer.ObserveInt64(pending, w.Pending, attrs)
+		}
+		return nil
+	}, latest, pending)
+	if err != nil {
+		g.slog.Error("watcher gauge callback registration failed")
+		panic(err)
+	}
+}
+
+// watcherMetricsInterval is how often the watcher metrics are recomputed.
+const watcherMetricsInterval = 5 * time.Minute
+
+// registerLLMUsageMetrics adds metrics called "llm-requests", "llm-input-tokens",
+// "llm-output-tokens" and "llm-rejected" for the LLM usage of each component
+// today (see [llmquota.Limiter.Usage]), which reset at the start of each UTC day.
+// The component's name becomes the value of the "component" attribute in the metrics.
+func (g *Gaby) registerLLMUsageMetrics() {
+	if g.quota == nil {
+		return
+	}
+	gauge := func(name, description string) ometric.Int64ObservableGauge {
+		m, err := g.meter.Int64ObservableGauge(metricName(name), ometric.WithDescription(description))
+		if err != nil {
+			g.slog.Error("LLM usage gauge creation failed", "name", name)
+			panic(err)
+		}
+		return m
+	}
+	requests := gauge("llm-requests", "LLM requests today")
+	input := gauge("llm-input-tokens", "LLM input tokens today")
+	output := gauge("llm-output-tokens", "LLM output tokens today")
+	rejected := gauge("llm-rejected", "LLM requests rejected for exceeding quota today")
+	_, err := g.meter.RegisterCallback(func(_ context.Context, observer ometric.Observer) error {
+		for u := range g.quota.Usage(g.quota.Today()) {
+			attrs := ometric.WithAttributes(attribute.String("component", u.Component))
+			observer.ObserveInt64(requests, u.Requests, attrs)
+			observer.ObserveInt64(input, u.InputTokens, attrs)
+			observer.ObserveInt64(output, u.OutputTokens, attrs)
+			observer.ObserveInt64(rejected, u.Rejected, attrs)
+		}
+		return nil
+	}, requests, input, output, rejected)
+	if err != nil {
+		g.slog.Error("LLM usage gauge callback registration failed")
+		panic(err)
+	}
 }
 
 // metricName returns the full metric name for the given short name.
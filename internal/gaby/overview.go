@@ -30,7 +30,8 @@ type overviewPage struct {
 
 	Params overviewParams // the raw query params
 	Result *overviewResult
-	Error  error // if non-nil, the error to display instead of the result
+	Error  error        // if non-nil, the error to display instead of the result
+	Chat   *llmapp.Chat // (optional) the conversation about the issue; see [Gaby.handleOverviewAsk]
 }
 
 type overviewResult struct {
@@ -48,6 +49,7 @@ type overviewParams struct {
 	Query           string // the issue ID to lookup, or golang/go#12345 or github.com/golang/go/issues/12345 form
 	LastReadComment string // (for [updateOverviewType]: summarize all comments after this comment ID)
 	OverviewType    string // the type of overview to generate
+	Chat            string // (optional) the ID of the conversation about the issue
 }
 
 // the possible overview types
@@ -64,7 +66,10 @@ func validOverviewType(t string) bool {
 }
 
 func (g *Gaby) handleOverview(w http.ResponseWriter, r *http.Request) {
-	handlePage(w, g.populateOverviewPage(r), overviewPageTmpl)
+	p := newOverviewPage(r)
+	g.handleStreamPage(w, p, overviewPageTmpl, "overview-result", func(stream func(string)) {
+		g.fillOverviewPage(llmapp.WithStream(r.Context(), stream), p)
+	})
 }
 
 // fixMarkdown fixes mistakes that we have observed the LLM make
@@ -75,9 +80,15 @@ func fixMarkdown(text string) string {
 }
 
 var overviewPageTmpl = newTemplate(overviewPageTmplFile, template.FuncMap{
-	"fmttime": fmtTimeString,
+	"fmttime":  fmtTimeString,
+	"markdown": markdownToHTML,
 })
 
+// markdownToHTML converts LLM-generated markdown to safe HTML.
+func markdownToHTML(md string) safehtml.HTML {
+	return htmlutil.MarkdownToSafeHTML(fixMarkdown(md))
+}
+
 // fmtTimeString formats an [time.RFC3339]-encoded time string
 // as a [time.DateOnly] time string.
 func fmtTimeString(s string) string {
@@ -146,25 +157,45 @@ func parseIssueComment(commentID string) (int64, error) {
 
 // populateOverviewPage returns the contents of the overview page.
 func (g *Gaby) populateOverviewPage(r *http.Request) *overviewPage {
+	p := newOverviewPage(r)
+	g.fillOverviewPage(r.Context(), p)
+	return p
+}
+
+// newOverviewPage returns the overview page for the request,
+// without its result.
+func newOverviewPage(r *http.Request) *overviewPage {
 	pm := overviewParams{
 		Query:           r.FormValue(paramQuery),
 		OverviewType:    r.FormValue(paramOverviewType),
 		LastReadComment: r.FormValue(paramLastRead),
+		Chat:            r.FormValue(paramChat),
 	}
 	p := &overviewPage{
 		Params: pm,
 	}
 	p.setCommonPage()
+	return p
+}
+
+// fillOverviewPage generates the overview described by p's parameters,
+// if any, and stores the result (or error) in p.
+// If ctx was created by [llmapp.WithStream], the overview
+// is streamed as it is generated.
+func (g *Gaby) fillOverviewPage(ctx context.Context, p *overviewPage) {
 	if trim(p.Params.Query) == "" {
-		return p
+		return
 	}
-	overview, err := g.newOverview(r.Context(), &p.Params)
+	overview, err := g.newOverview(ctx, &p.Params)
 	if err != nil {
 		p.Error = err
-		return p
+		return
 	}
 	p.Result = overview
-	return p
+	if id := trim(p.Params.Chat); id != "" {
+		// An unknown chat is ignored: asking a question starts a new one.
+		p.Chat, _ = g.llmapp.LoadChat(id)
+	}
 }
 
 func (p *overviewPage) setCommonPage() {
@@ -258,17 +289,7 @@ func (f *overviewParams) checkRadio(value string) bool {
 
 // newOverview generates an newOverview of the issue based on the given parameters.
 func (g *Gaby) newOverview(ctx context.Context, pm *overviewParams) (*overviewResult, error) {
-	proj, issue, err := parseIssueNumber(pm.Query)
-	if err != nil {
-		return nil, fmt.Errorf("invalid form value: %v", err)
-	}
-	if proj == "" && len(g.githubProjects) > 0 {
-		proj = g.githubProjects[0] // default to first project.
-	}
-	if !slices.Contains(g.githubProjects, proj) {
-		return nil, fmt.Errorf("invalid form value (unrecognized project): %q", pm.Query)
-	}
-	iss, err := github.LookupIssue(g.db, proj, issue)
+	iss, err := g.lookupIssue(pm.Query)
 	if err != nil {
 		return nil, err
 	}
@@ -289,6 +310,22 @@ func (g *Gaby) newOverview(ctx context.Context, pm *overviewParams) (*overviewRe
 	}
 }
 
+// lookupIssue returns the issue identified by the query,
+// in one of the forms accepted by [parseIssueNumber].
+func (g *Gaby) lookupIssue(query string) (*github.Issue, error) {
+	proj, issue, err := parseIssueNumber(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid form value: %v", err)
+	}
+	if proj == "" && len(g.githubProjects) > 0 {
+		proj = g.githubProjects[0] // default to first project.
+	}
+	if !slices.Contains(g.githubProjects, proj) {
+		return nil, fmt.Errorf("invalid form value (unrecognized project): %q", query)
+	}
+	return github.LookupIssue(g.db, proj, issue)
+}
+
 // issueOverview generates an overview of the issue and its comments.
 func (g *Gaby) issueOverview(ctx context.Context, iss *github.Issue) (*overviewResult, error) {
 	overview, err := g.overview.ForIssue(ctx, iss)
@@ -306,7 +343,7 @@ func (g *Gaby) issueOverview(ctx context.Context, iss *github.Issue) (*overviewR
 
 // relatedOverview generates an overview of the issue and its related documents.
 func (g *Gaby) relatedOverview(ctx context.Context, iss *github.Issue) (*overviewResult, error) {
-	analysis, err := search.Analyze(ctx, g.llmapp, g.vector, g.docs, iss.DocID())
+	analysis, err := search.Analyze(ctx, g.llmappFor("related"), g.vector, g.docs, iss.DocID())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,126 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oscar/internal/github"
+	"golang.org/x/oscar/internal/llmapp"
+	"golang.org/x/oscar/internal/search"
+)
+
+const (
+	paramChat     = "chat"
+	paramQuestion = "question"
+)
+
+// askEndpoint is the endpoint for asking questions about
+// the issue on the overview page.
+var askEndpoint = overviewID.Endpoint() + "/ask"
+
+// chatLifetime is how long a conversation about an issue
+// is kept after it was last used.
+const chatLifetime = 30 * 24 * time.Hour
+
+// issueChatInstructions are the system instructions for
+// conversations about an issue.
+const issueChatInstructions = `You are helping a maintainer of an open source project
+understand a GitHub issue. Answer their questions using the issue, its comments
+and the related documents provided, and cite the URLs of the documents you rely on.
+If the documents do not contain the answer, say so. Format answers as markdown.`
+
+// handleOverviewAsk handles a question about the issue on the overview page.
+// It adds the question and the LLM's answer to the conversation
+// identified by the "chat" parameter, or to a new conversation grounded
+// in the issue if there is none, and then redirects to the overview page,
+// which displays the conversation.
+func (g *Gaby) handleOverviewAsk(w http.ResponseWriter, r *http.Request) {
+	pm := newOverviewPage(r).Params
+	question := trim(r.FormValue(paramQuestion))
+	if question == "" {
+		http.Error(w, "missing question", http.StatusBadRequest)
+		return
+	}
+	ch, err := g.issueChat(&pm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := ch.Ask(r.Context(), question)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pe := res.PolicyEvaluation; pe != nil && pe.Violative {
+		// The violations are recorded in the chat and shown on the page.
+		g.slog.Warn("handleOverviewAsk: policy violations", "chat", ch.ID, "question", question)
+	}
+	pm.Chat = ch.ID
+	http.Redirect(w, r, pm.url()+"#chat", http.StatusSeeOther)
+}
+
+// expireChats deletes the conversations that
+// have not been used within [chatLifetime].
+func (g *Gaby) expireChats() {
+	if n := g.llmapp.ExpireChats(time.Now().Add(-chatLifetime)); n > 0 {
+		g.slog.Info("expired chats", "n", n)
+	}
+}
+
+// issueChat returns the conversation identified by pm.Chat,
+// or a new conversation about the issue pm.Query if pm.Chat is empty.
+func (g *Gaby) issueChat(pm *overviewParams) (*llmapp.Chat, error) {
+	if id := trim(pm.Chat); id != "" {
+		ch, ok := g.llmappFor("chat").LoadChat(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown chat %q", id)
+		}
+		return ch, nil
+	}
+	if trim(pm.Query) == "" {
+		return nil, errors.New("missing issue")
+	}
+	iss, err := g.lookupIssue(pm.Query)
+	if err != nil {
+		return nil, err
+	}
+	return g.llmappFor("chat").NewChat(issueChatInstructions, g.issueChatDocs(iss)), nil
+}
+
+// issueChatDocs returns the documents to ground a conversation
+// about the issue: the issue, its comments, and related documents.
+func (g *Gaby) issueChatDocs(iss *github.Issue) []*llmapp.Doc {
+	docs := []*llmapp.Doc{iss.ToLLMDoc()}
+	for ic := range g.github.Comments(iss) {
+		docs = append(docs, ic.ToLLMDoc())
+	}
+	related, err := search.RelatedDocs(g.vector, g.docs, iss.DocID())
+	if err != nil {
+		// The conversation can still be about the issue itself.
+		g.slog.Warn("issueChatDocs: no related docs", "issue", iss.HTMLURL, "err", err)
+	}
+	return append(docs, related...)
+}
+
+// url returns the URL of the overview page with the params.
+func (pm *overviewParams) url() string {
+	form := url.Values{}
+	for _, p := range []struct{ name, value string }{
+		{paramQuery, pm.Query},
+		{paramOverviewType, pm.OverviewType},
+		{paramLastRead, pm.LastReadComment},
+		{paramChat, pm.Chat},
+	} {
+		if p.value != "" {
+			form.Set(p.name, p.value)
+		}
+	}
+	return overviewID.Endpoint() + "?" + form.Encode()
+}
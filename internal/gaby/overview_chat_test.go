@@ -0,0 +1,110 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oscar/internal/docs"
+	"golang.org/x/oscar/internal/github"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/llmapp"
+	"golang.org/x/oscar/internal/overview"
+	"golang.org/x/oscar/internal/secret"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestHandleOverviewAsk(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	gh := github.New(lg, db, secret.Empty(), nil)
+	lc := llmapp.New(lg, llm.EchoContentGenerator(), db)
+	g := &Gaby{
+		slog:     lg,
+		db:       db,
+		vector:   storage.MemVectorDB(db, lg, "vector"),
+		docs:     docs.New(lg, db),
+		github:   gh,
+		llmapp:   lc,
+		overview: overview.New(lg, db, gh, lc, "test", "test-bot"),
+	}
+	project := "hello/world"
+	g.githubProjects = []string{project}
+	gh.Add(project)
+	gh.Testing().AddIssue(project, &github.Issue{Number: 1, Title: "hello", Body: "hello world"})
+	gh.Testing().AddIssueComment(project, 1, &github.IssueComment{Body: "a comment"})
+
+	ask := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", askEndpoint, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		g.handleOverviewAsk(w, r)
+		return w
+	}
+	// chatOf returns the chat shown on the page at the redirect location.
+	chatOf := func(w *httptest.ResponseRecorder) (*llmapp.Chat, string) {
+		t.Helper()
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("ask: status %d, want %d: %s", w.Code, http.StatusSeeOther, w.Body)
+		}
+		u, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch, ok := lc.LoadChat(u.Query().Get(paramChat))
+		if !ok {
+			t.Fatalf("redirect to %s: no such chat", u)
+		}
+		r := httptest.NewRequest("GET", u.RequestURI(), nil)
+		pw := httptest.NewRecorder()
+		g.handleOverview(pw, r)
+		body := pw.Body.String()
+		if err := validateHTML(body); err != nil {
+			printNumbered(body)
+			t.Fatalf("\n%s", err)
+		}
+		return ch, body
+	}
+
+	// The first question starts a conversation grounded in the issue.
+	ch, body := chatOf(ask(url.Values{paramQuery: {"1"}, paramQuestion: {"what is this?"}}))
+	if len(ch.Turns) != 2 || len(ch.Docs) != 2 {
+		t.Fatalf("new chat has %d turns and %d docs, want 2 and 2", len(ch.Turns), len(ch.Docs))
+	}
+	// The echoed answer includes the issue and the question.
+	for _, want := range []string{"hello world", "a comment", "what is this?"} {
+		if !strings.Contains(ch.Turns[1].Text, want) {
+			t.Errorf("answer %q does not contain %q", ch.Turns[1].Text, want)
+		}
+	}
+	if !strings.Contains(body, "Q: what is this?") || !strings.Contains(body, `name="chat" value="`+ch.ID+`"`) {
+		t.Errorf("overview page does not show chat:\n%s", body)
+	}
+
+	// A follow-up question continues it.
+	ch2, body := chatOf(ask(url.Values{paramQuery: {"1"}, paramChat: {ch.ID}, paramQuestion: {"and then?"}}))
+	if ch2.ID != ch.ID || len(ch2.Turns) != 4 {
+		t.Errorf("follow-up: chat %s has %d turns, want %s and 4", ch2.ID, len(ch2.Turns), ch.ID)
+	}
+	if !strings.Contains(body, "Q: and then?") {
+		t.Errorf("overview page does not show follow-up:\n%s", body)
+	}
+
+	for _, form := range []url.Values{
+		{paramQuery: {"1"}},
+		{paramQuestion: {"what?"}},
+		{paramQuery: {"2"}, paramQuestion: {"what?"}},
+		{paramQuery: {"1"}, paramChat: {"nope"}, paramQuestion: {"what?"}},
+	} {
+		if w := ask(form); w.Code != http.StatusBadRequest {
+			t.Errorf("ask(%v): status %d, want %d", form, w.Code, http.StatusBadRequest)
+		}
+	}
+}
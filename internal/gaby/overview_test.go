@@ -8,7 +8,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -323,3 +325,49 @@ func TestParseOverviewPageQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleOverviewStream(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	gh := github.New(lg, db, secret.Empty(), nil)
+	lc := llmapp.New(lg, llm.EchoContentGenerator(), db)
+	g := &Gaby{
+		slog:     lg,
+		db:       db,
+		github:   gh,
+		llmapp:   lc,
+		overview: overview.New(lg, db, gh, lc, "test", "test-bot"),
+	}
+	project := "hello/world"
+	g.githubProjects = []string{project}
+	gh.Add(project)
+	gh.Testing().AddIssue(project, &github.Issue{Number: 1, Title: "hello", Body: "hello world"})
+
+	get := func() string {
+		r := httptest.NewRequest("GET", "/overview?q=1", nil)
+		w := httptest.NewRecorder()
+		g.handleOverview(w, r)
+		body := w.Body.String()
+		if err := validateHTML(body); err != nil {
+			printNumbered(body)
+			t.Fatalf("\n%s", err)
+		}
+		return body
+	}
+
+	// The first request streams the overview before showing the result.
+	body := get()
+	stream, result := strings.Index(body, `id="streaming"`), strings.Index(body, `id="result"`)
+	if stream < 0 || result < stream {
+		t.Fatalf("streamed page has streaming section at %d and result at %d, want both in order:\n%s", stream, result, body)
+	}
+	if !strings.Contains(body[stream:result], "hello world") {
+		t.Errorf("streaming section does not contain overview:\n%s", body[stream:result])
+	}
+
+	// The second request finds the overview in the cache and does not stream it.
+	body = get()
+	if strings.Contains(body, `id="streaming"`) || !strings.Contains(body, "(cached)") {
+		t.Errorf("cached page streamed or not cached:\n%s", body)
+	}
+}
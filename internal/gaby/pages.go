@@ -8,7 +8,7 @@ package main
 // Pages listed here will appear in navigation.
 var pages = []pageID{
 	// Dev pages.
-	actionlogID, dbviewID, bisectlogID,
+	actionlogID, dbviewID, bisectlogID, watchersID, llmusageID,
 	// User pages.
 	overviewID, searchID, rulesID, labelsID,
 	// reviews omitted for now, as it loads very slowly
@@ -24,6 +24,8 @@ const (
 	labelsID    pageID = "labels"
 	reviewsID   pageID = "reviews"
 	bisectlogID pageID = "bisectlog"
+	watchersID  pageID = "watchers"
+	llmusageID  pageID = "llmusage"
 )
 
 // Gaby webpage titles.
@@ -36,4 +38,6 @@ var titles = map[pageID]string{
 	reviewsID:   "Reviews",
 	labelsID:    "Issue Labels",
 	bisectlogID: "Bisect Log",
+	watchersID:  "Watchers",
+	llmusageID:  "LLM Usage",
 }
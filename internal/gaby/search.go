@@ -29,7 +29,10 @@ type searchPage struct {
 }
 
 func (g *Gaby) handleSearch(w http.ResponseWriter, r *http.Request) {
-	handlePage(w, g.populateSearchPage(r), searchPageTmpl)
+	p := newSearchPage(r)
+	g.handleStreamPage(w, p, searchPageTmpl, "search-result", func(stream func(string)) {
+		g.fillSearchPage(r.Context(), p, stream)
+	})
 }
 
 func handlePage(w http.ResponseWriter, p page, tmpl *template.Template) {
@@ -43,25 +46,47 @@ func handlePage(w http.ResponseWriter, p page, tmpl *template.Template) {
 
 // populateSearchPage returns the contents of the vector search page.
 func (g *Gaby) populateSearchPage(r *http.Request) *searchPage {
+	p := newSearchPage(r)
+	g.fillSearchPage(r.Context(), p, func(string) {})
+	return p
+}
+
+// newSearchPage returns the vector search page for the request,
+// without its results.
+func newSearchPage(r *http.Request) *searchPage {
 	var pm searchParams
 	pm.parseParams(r)
 	p := &searchPage{
 		Params: pm,
 	}
 	p.setCommonPage()
-	opts, err := pm.toOptions()
+	return p
+}
+
+// fillSearchPage performs the search described by p's parameters
+// and stores the results (or error) in p.
+// It calls stream with the progress of the search and then
+// a line for each result, as a preview of the results.
+func (g *Gaby) fillSearchPage(ctx context.Context, p *searchPage, stream func(string)) {
+	opts, err := p.Params.toOptions()
 	if err != nil {
 		p.Error = fmt.Errorf("invalid form value: %w", err)
-		return p
+		return
 	}
-	q := trim(pm.Query)
-	results, err := g.search(r.Context(), q, *opts)
+	q := trim(p.Params.Query)
+	if q == "" {
+		return
+	}
+	stream(fmt.Sprintf("Searching for %q...\n", q))
+	results, err := g.search(ctx, q, *opts)
 	if err != nil {
 		p.Error = fmt.Errorf("search: %w", err)
-		return p
+		return
+	}
+	for _, r := range results {
+		stream(fmt.Sprintf("%.2f %s %s\n", r.Score, r.ID, r.Title))
 	}
 	p.Results = results
-	return p
 }
 
 // search performs a search on the query and options.
@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
@@ -289,6 +290,28 @@ func TestPopulateSearchPage(t *testing.T) {
 	}
 }
 
+func TestHandleSearchStream(t *testing.T) {
+	g := newTestGaby(t)
+	g.docs.Add("id1", "hello", "hello world")
+	g.embedAll(context.Background())
+
+	r := httptest.NewRequest("GET", "/search?q=hello", nil)
+	w := httptest.NewRecorder()
+	g.handleSearch(w, r)
+	body := w.Body.String()
+	if err := validateHTML(body); err != nil {
+		printNumbered(body)
+		t.Fatalf("\n%s", err)
+	}
+	stream, result := strings.Index(body, `id="streaming"`), strings.Index(body, `id="result"`)
+	if stream < 0 || result < stream {
+		t.Fatalf("search page has streaming section at %d and result at %d, want both in order:\n%s", stream, result, body)
+	}
+	if preview := body[stream:result]; !strings.Contains(preview, "Searching for") || !strings.Contains(preview, "id1 hello") {
+		t.Errorf("streaming section does not show search and result:\n%s", preview)
+	}
+}
+
 func newTestGaby(t *testing.T) *Gaby {
 	t.Helper()
 
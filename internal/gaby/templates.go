@@ -30,6 +30,8 @@ const (
 	labelsPageTmplFile   = "labelspage.tmpl"
 	dbviewPageTmplFile   = "dbviewpage.tmpl"
 	bisectLogTmplFile    = "bisectlogpage.tmpl"
+	watchersPageTmplFile = "watcherspage.tmpl"
+	llmUsagePageTmplFile = "llmusagepage.tmpl"
 
 	// Common template file
 	commonTmpl = "common.tmpl"
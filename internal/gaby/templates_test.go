@@ -20,6 +20,7 @@ import (
 	"golang.org/x/oscar/internal/github"
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/llmapp"
+	"golang.org/x/oscar/internal/llmquota"
 	"golang.org/x/oscar/internal/overview"
 	"golang.org/x/oscar/internal/search"
 )
@@ -63,6 +64,31 @@ func TestTemplates(t *testing.T) {
 			Params: overviewParams{Query: "12"},
 			Error:  fmt.Errorf("an error"),
 		}},
+		{"dbview", dbviewPageTmpl, &dbviewPage{
+			Params: dbviewParams{Start: "x"},
+			Result: &dbviewResult{Items: []item{{Key: `("x")`, Value: "v"}}},
+		}},
+		{"dbview-kinds", dbviewPageTmpl, &dbviewPage{
+			Kinds: []kindLink{{Kind: "k", URL: "/dbview?start=k"}},
+		}},
+		{"watchers", watchersPageTmpl, &watchersPage{
+			Message:  "reset",
+			Watchers: []watcherItem{{Kind: "k", Name: "n", Pending: 1}},
+		}},
+		{"watchers-error", watchersPageTmpl, &watchersPage{
+			Error: fmt.Errorf("an error"),
+		}},
+		{"llmusage", llmUsagePageTmpl, &llmUsagePage{
+			Limits: []llmLimitItem{{Component: "(global)", RequestsPerMinute: "1", TokensPerDay: "none"}},
+			Days: []llmUsageDay{{
+				Day:   "2024-10-01",
+				Usage: []*llmquota.Usage{{Component: "c", Requests: 1}},
+				Total: llmquota.Usage{Component: "(total)", Requests: 1},
+			}},
+		}},
+		{"llmusage-error", llmUsagePageTmpl, &llmUsagePage{
+			Error: fmt.Errorf("an error"),
+		}},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			test.value.setCommonPage()
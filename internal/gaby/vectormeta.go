@@ -0,0 +1,74 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/oscar/internal/embeddocs"
+	"golang.org/x/oscar/internal/search"
+	"golang.org/x/oscar/internal/storage"
+)
+
+// docMeta returns the vector metadata for the document with the given ID.
+// In addition to what [search.DocMeta] sets, it sets the creation time
+// and state of GitHub issues ("open" or "closed") and Gerrit changes
+// ("new", "merged" or "abandoned"), as recorded in g's database.
+func (g *Gaby) docMeta(id string) *storage.VectorMeta {
+	meta := search.DocMeta(id)
+	switch meta.Kind {
+	case search.KindGitHubIssue:
+		if issue, err := g.github.LookupIssueURL(id); err == nil {
+			meta.Created = issue.CreatedAt_()
+			meta.State = issue.State
+		}
+	case search.KindGoGerritChange:
+		if g.gerrit == nil {
+			break
+		}
+		if ch, err := g.gerrit.LookupDocURL(id); err == nil {
+			meta.Created = g.gerrit.ChangeTimes(ch).Created
+			meta.State = strings.ToLower(g.gerrit.ChangeStatus(ch))
+		}
+	}
+	return meta
+}
+
+// updateVectorMeta brings the metadata of the vectors in g.vector up to date.
+// The first time, it sets the metadata of all vectors stored
+// before gaby stored metadata with the vectors.
+// After that, it updates the state of GitHub issues that have changed
+// since the last call: an issue that is closed without changing its
+// title or text is not re-embedded, so embedding alone would leave
+// its state stale.
+// It must be called with the embed lock held.
+func (g *Gaby) updateVectorMeta() {
+	mvdb, ok := g.vector.(storage.MetaVectorDB)
+	if !ok {
+		return
+	}
+	w := g.github.EventWatcher("gaby.vectormeta" + slashEmbed(g.embed))
+	if w.Latest() == 0 {
+		// The backfill below computes the current state of every issue,
+		// so skip the existing events, which only cause needless lookups.
+		for e := range w.Recent() {
+			w.MarkOld(e.DBTime)
+		}
+		w.Flush()
+	}
+	embeddocs.BackfillMeta(g.slog, g.db, g.vector, "gaby"+slashEmbed(g.embed), g.docMeta)
+
+	for e := range w.Recent() {
+		id := fmt.Sprintf("https://github.com/%s/issues/%d", e.Project, e.Issue)
+		if old, ok := mvdb.Meta(id); ok {
+			if meta := g.docMeta(id); meta.State != old.State {
+				mvdb.SetMeta(id, meta)
+			}
+		}
+		w.MarkOld(e.DBTime)
+	}
+	w.Flush()
+}
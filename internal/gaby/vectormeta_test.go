@@ -0,0 +1,68 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/docs"
+	"golang.org/x/oscar/internal/embeddocs"
+	"golang.org/x/oscar/internal/github"
+	"golang.org/x/oscar/internal/search"
+	"golang.org/x/oscar/internal/secret"
+	"golang.org/x/oscar/internal/storage"
+)
+
+func TestUpdateVectorMeta(t *testing.T) {
+	g := newTestGaby(t)
+	ctx := context.Background()
+	mvdb := g.vector.(storage.MetaVectorDB)
+
+	const project = "golang/go"
+	created := "2024-01-02T03:04:05Z"
+	issue := &github.Issue{Number: 1, Title: "hello", Body: "hello world", CreatedAt: created, State: "open"}
+	g.github.Testing().AddIssue(project, issue)
+	docs.Sync(g.docs, g.github)
+
+	// Embed without metadata, as gaby did before storing metadata.
+	if err := embeddocs.Sync(ctx, g.slog, g.vector, g.embed, g.docs); err != nil {
+		t.Fatal(err)
+	}
+	id := issue.HTMLURL
+	if m, ok := mvdb.Meta(id); ok {
+		t.Fatalf("Meta(%s) = %+v before backfill, want none", id, m)
+	}
+
+	check := func(state string) {
+		t.Helper()
+		m, ok := mvdb.Meta(id)
+		want := &storage.VectorMeta{Kind: search.KindGitHubIssue, Project: project, State: state}
+		want.Created, _ = time.Parse(time.RFC3339, created)
+		if !ok || m.Kind != want.Kind || m.Project != want.Project || m.State != want.State || !m.Created.Equal(want.Created) {
+			t.Errorf("Meta(%s) = %+v, %v, want %+v", id, m, ok, want)
+		}
+	}
+
+	// The first embedAll backfills the metadata.
+	if err := g.embedAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check("open")
+
+	// Closing the issue does not change its document,
+	// but embedAll still updates the state.
+	closed := *issue
+	closed.State = "closed"
+	// Use a new testing client, which reuses the issue's event ID,
+	// so that the closed issue replaces the open one, as on GitHub.
+	github.New(g.slog, g.db, secret.Empty(), nil).Testing().AddIssue(project, &closed)
+	docs.Sync(g.docs, g.github)
+	if err := g.embedAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check("closed")
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oscar/internal/storage/timed"
+)
+
+// watchersPage holds the fields needed to display the watcher registry.
+type watchersPage struct {
+	CommonPage
+
+	Params   watchersParams // the raw parameters
+	Watchers []watcherItem
+	Message  string // result of the previous reset, if any
+	Error    error  // if non-nil, the error to display before the watchers
+}
+
+// watchersParams are the parameters for resetting a watcher.
+type watchersParams struct {
+	Kind, Name string
+	To         string // DBTime or RFC3339 time; see [parseDBTime]
+}
+
+// A watcherItem is a displayable form of a [timed.WatcherInfo].
+type watcherItem struct {
+	Kind, Name string
+	Latest     string
+	LastRun    string
+	Holder     string
+	Pending    int64
+	Lag        string
+}
+
+var watchersPageTmpl = newTemplate(watchersPageTmplFile, nil)
+
+func (g *Gaby) handleWatchers(w http.ResponseWriter, r *http.Request) {
+	handlePage(w, g.populateWatchersPage(r), watchersPageTmpl)
+}
+
+// handleWatchersReset resets the watcher described by the form
+// and then redirects to the watchers page, which reports the reset.
+// If the reset fails, it displays the watchers page with the error.
+func (g *Gaby) handleWatchersReset(w http.ResponseWriter, r *http.Request) {
+	p := g.populateWatchersPage(r)
+	if p.Error = g.resetWatcher(p.Params); p.Error != nil {
+		p.Message = ""
+		handlePage(w, p, watchersPageTmpl)
+		return
+	}
+	http.Redirect(w, r, p.Params.url()+"&reset=1", http.StatusSeeOther)
+}
+
+// populateWatchersPage returns the contents of the watchers page.
+// The request's parameters fill in the reset form;
+// the "reset" parameter means the watcher they describe was just reset.
+func (g *Gaby) populateWatchersPage(r *http.Request) *watchersPage {
+	p := &watchersPage{
+		Params: watchersParams{
+			Kind: r.FormValue("kind"),
+			Name: r.FormValue("name"),
+			To:   r.FormValue("to"),
+		},
+	}
+	p.setCommonPage()
+	if r.FormValue("reset") != "" {
+		p.Message = fmt.Sprintf("Reset %s watcher %s.", p.Params.Kind, p.Params.Name)
+	}
+	for _, w := range timed.Watchers(g.db) {
+		p.Watchers = append(p.Watchers, watcherItem{
+			Kind:    w.Kind,
+			Name:    w.Name,
+			Latest:  fmtDBTime(w.Latest),
+			LastRun: w.LastRun.UTC().Format(time.DateTime),
+			Holder:  w.Holder,
+			Pending: w.Pending,
+			Lag:     w.Lag().Round(time.Second).String(),
+		})
+	}
+	return p
+}
+
+// url returns the watchers page URL with the parameters pm.
+func (pm *watchersParams) url() string {
+	return watchersID.Endpoint() + "?" + url.Values{
+		"kind": {pm.Kind},
+		"name": {pm.Name},
+		"to":   {pm.To},
+	}.Encode()
+}
+
+// resetWatcher resets the watcher described by pm.
+func (g *Gaby) resetWatcher(pm watchersParams) error {
+	if pm.Kind == "" || pm.Name == "" || pm.To == "" {
+		return fmt.Errorf("reset needs kind, name, and time")
+	}
+	found := false
+	for _, w := range timed.Watchers(g.db) {
+		if w.Kind == pm.Kind && w.Name == pm.Name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("no watcher %q of kind %q", pm.Name, pm.Kind)
+	}
+	t, err := parseDBTime(pm.To)
+	if err != nil {
+		return err
+	}
+	g.slog.Info("gaby reset watcher", "kind", pm.Kind, "name", pm.Name, "to", t)
+	timed.Reset(g.db, pm.Kind, pm.Name, t)
+	return nil
+}
+
+// parseDBTime parses s as a DBTime, either an integer
+// or a wall-clock time in RFC3339 format.
+func parseDBTime(s string) (timed.DBTime, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return timed.DBTime(n), nil
+	}
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: want DBTime or RFC3339 time", s)
+	}
+	return timed.FromTime(tm), nil
+}
+
+// fmtDBTime formats t for display.
+func fmtDBTime(t timed.DBTime) string {
+	if t == 0 {
+		return "0 (start)"
+	}
+	return fmt.Sprintf("%d (%s)", t, t.Time().UTC().Format(time.DateTime))
+}
+
+func (p *watchersPage) setCommonPage() {
+	p.CommonPage = CommonPage{
+		ID:          watchersID,
+		Description: "View the database watchers and reset their positions.",
+		Form: Form{
+			Description: `To reset a watcher, so that it reprocesses or skips entries,
+provide its kind and name and the time to reset it to.`,
+			Inputs:     p.Params.inputs(),
+			SubmitText: "Reset",
+			Method:     http.MethodPost,
+		},
+	}
+}
+
+var (
+	safeKind = toSafeID("kind")
+	safeName = toSafeID("name")
+	safeTo   = toSafeID("to")
+)
+
+func (pm *watchersParams) inputs() []FormInput {
+	return []FormInput{
+		{
+			Label:       "Kind",
+			Type:        "string",
+			Description: "the kind of entries the watcher reads",
+			Name:        safeKind,
+			Required:    true,
+			Typed: TextInput{
+				ID:    safeKind,
+				Value: pm.Kind,
+			},
+		},
+		{
+			Label:       "Name",
+			Type:        "string",
+			Description: "the name of the watcher",
+			Name:        safeName,
+			Required:    true,
+			Typed: TextInput{
+				ID:    safeName,
+				Value: pm.Name,
+			},
+		},
+		{
+			Label:       "Reset to",
+			Type:        "DBTime or time",
+			Description: "the watcher will next process entries set after this time: an integer DBTime (0 to start over) or an RFC3339 time such as 2024-10-01T00:00:00Z",
+			Name:        safeTo,
+			Required:    true,
+			Typed: TextInput{
+				ID:    safeTo,
+				Value: pm.To,
+			},
+		},
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/storage/timed"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestWatchersPage(t *testing.T) {
+	g := &Gaby{
+		db:   storage.MemDB(),
+		slog: testutil.Slogger(t),
+	}
+	b := g.db.Batch()
+	timed.Set(g.db, b, "kind", []byte("k1"), nil)
+	timed.Set(g.db, b, "kind", []byte("k2"), nil)
+	b.Apply()
+	w := timed.NewWatcher(g.slog, g.db, "w", "kind", func(e *timed.Entry) *timed.Entry { return e })
+	for e := range w.Recent() {
+		w.MarkOld(e.ModTime)
+	}
+
+	get := func(form url.Values) *watchersPage {
+		r := httptest.NewRequest("GET", "/watchers?"+form.Encode(), nil)
+		return g.populateWatchersPage(r)
+	}
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/watchers", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		g.handleWatchersReset(w, r)
+		return w
+	}
+
+	p := get(nil)
+	if p.Error != nil || len(p.Watchers) != 1 || p.Watchers[0].Name != "w" || p.Watchers[0].Pending != 0 {
+		t.Fatalf("watchers page = %+v, want one up-to-date watcher", p)
+	}
+
+	// A GET does not reset the watcher.
+	reset := url.Values{"kind": {"kind"}, "name": {"w"}, "to": {"0"}}
+	p = get(reset)
+	if p.Error != nil || p.Message != "" || len(p.Watchers) != 1 || p.Watchers[0].Pending != 0 {
+		t.Fatalf("GET with reset parameters: page = %+v, want no reset", p)
+	}
+
+	resp := post(reset)
+	if resp.Code != http.StatusSeeOther {
+		t.Fatalf("reset: status %d, want %d; body:\n%s", resp.Code, http.StatusSeeOther, resp.Body)
+	}
+	loc, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = get(loc.Query())
+	if p.Error != nil || p.Message == "" {
+		t.Fatalf("after reset: Error = %v, Message = %q", p.Error, p.Message)
+	}
+	if len(p.Watchers) != 1 || p.Watchers[0].Pending != 2 {
+		t.Errorf("after reset: watchers = %+v, want 2 pending", p.Watchers)
+	}
+
+	for _, form := range []url.Values{
+		{"kind": {"kind"}, "name": {"missing"}, "to": {"0"}},
+		{"kind": {"kind"}, "name": {"w"}, "to": {"yesterday"}},
+		{"kind": {"kind"}, "name": {"w"}},
+	} {
+		if w := post(form); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Error:") {
+			t.Errorf("%v: status %d, want %d with error; body:\n%s", form, w.Code, http.StatusOK, w.Body)
+		}
+	}
+}
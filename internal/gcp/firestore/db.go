@@ -14,6 +14,7 @@ import (
 	"maps"
 	"math/rand/v2"
 	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -72,40 +73,96 @@ var (
 // Otherwise, locks are renewed every minute if Unlock is not called.
 // There is no way to change the timeout or renew value.
 func (db *DB) Lock(name string) {
+	if err := db.LockContext(context.Background(), name); err != nil {
+		// unreachable
+		db.Panic("firestore lock", "name", name, "err", err)
+	}
+}
+
+// LockContext implements [storage.ContextLocker.LockContext].
+// The locks are the same as for [DB.Lock].
+func (db *DB) LockContext(ctx context.Context, name string) error {
 	// Wait for the lock in a separate function to avoid defers inside a loop, consuming
 	// memory on each iteration.
-	for !db.waitForLock(name) {
+	for {
+		ok, err := db.waitForLock(ctx, name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+	}
+	db.slog.Debug("firestore locked", "name", storage.Fmt([]byte(name)))
+	return nil
+}
+
+// TryLock implements [storage.ContextLocker.TryLock].
+func (db *DB) TryLock(name string) bool {
+	if !db.lock(name) {
+		return false
 	}
 	db.slog.Debug("firestore locked", "name", storage.Fmt([]byte(name)))
+	return true
+}
+
+// Locks implements [storage.ContextLocker.Locks].
+// It returns the unexpired locks held by all clients of the database.
+// The holder of each lock is the UID of the [DB] that holds it,
+// formatted in decimal.
+func (db *DB) Locks() []storage.LockInfo {
+	var list []storage.LockInfo
+	// Lock document IDs are hex-encoded, so they all sort before "g".
+	for ds := range db.scan(nil, db.locks, "", "g") {
+		name, err := hex.DecodeString(ds.Ref.ID)
+		if err != nil {
+			// unreachable except for bad DB
+			db.Panic("firestore locks decode", "id", ds.Ref.ID, "err", err)
+		}
+		if timeSince(ds.UpdateTime) > lockTimeout {
+			continue
+		}
+		list = append(list, storage.LockInfo{
+			Name:     string(name),
+			Holder:   strconv.FormatInt(dataTo[lock](db.fstore, ds).UID, 10),
+			Acquired: ds.CreateTime,
+			Expires:  ds.UpdateTime.Add(lockTimeout),
+		})
+	}
+	return list
 }
 
 // waitForLock waits for the lock to become available.
 // It returns true if it acquires the lock, or false if it cannot
 // acquire the lock after lockTimeout elapses.
-func (db *DB) waitForLock(name string) bool {
+// It returns ctx.Err() if ctx is done first.
+func (db *DB) waitForLock(ctx context.Context, name string) (bool, error) {
 	// Use a snapshot iterator to iterate over changing states of the document.
 	// It yields its first value immediately, and subsequent values only when
 	// the document changes state.
 	// We want the iterator to time out eventually, or an orphaned lock document
 	// that remains unchanged could cause it to wait indefinitely.
-	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	wctx, cancel := context.WithTimeout(ctx, lockTimeout)
 	defer cancel()
 	dr := db.locks.Doc(encodeLockName(name))
-	iter := dr.Snapshots(ctx)
+	iter := dr.Snapshots(wctx)
 	defer iter.Stop()
 	for {
 		_, err := iter.Next()
 		if err == nil {
 			if db.lock(name) {
-				return true
+				return true, nil
 			}
 			// We didn't get the lock; wait for a change in the lock document.
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
 		if grpcerrors.IsTimeout(err) {
 			// The lock document may not have changed for lockTimeout;
 			// assume that's true and try to steal it.
-			return db.lock(name)
+			return db.lock(name), nil
 		}
 		// unreachable except for bad DB
 		db.Panic("firestore waiting for lock", "name", name, "err", err)
@@ -374,6 +431,46 @@ func (db *DB) Scan(start, end []byte) iter.Seq2[[]byte, func() []byte] {
 	}
 }
 
+// Transaction implements [storage.TxDB.Transaction]
+// using a Firestore transaction, which Firestore retries
+// if another client changes a document that it read.
+// The writes are buffered until f returns,
+// because Firestore requires all reads to precede all writes.
+func (db *DB) Transaction(f func(tx storage.Tx) error) error {
+	var ferr error
+	err := db.client.RunTransaction(context.TODO(), func(ctx context.Context, ftx *firestore.Transaction) error {
+		t := storage.NewTxLog(func(key []byte) ([]byte, bool) {
+			ds := db.get(ftx, db.values, encodeKey(key))
+			if ds == nil {
+				return nil, false
+			}
+			return dataTo[value](db.fstore, ds).V, true
+		})
+		if ferr = f(t); ferr != nil {
+			return ferr
+		}
+		for key, val := range t.Writes() {
+			if val == nil {
+				db.delete(ftx, db.values, encodeKey(key))
+			} else {
+				db.set(ftx, db.values, encodeKey(key), value{val})
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		return nil
+	case ferr != nil && err == ferr:
+		return ferr
+	case grpcerrors.IsAborted(err):
+		return fmt.Errorf("firestore transaction: %w: %v", storage.ErrTxConflict, err)
+	}
+	// unreachable except for bad DB
+	db.Panic("firestore transaction", "err", err)
+	return nil
+}
+
 // Batch implements [storage.DB.Batch].
 func (db *DB) Batch() storage.Batch {
 	return &dbBatch{db.newBatch(db.values)}
@@ -6,9 +6,13 @@ package firestore
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"math/rand/v2"
+	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -51,6 +55,58 @@ func TestDB(t *testing.T) {
 	}
 }
 
+func TestTransaction(t *testing.T) {
+	// Record with
+	//	OSCAR_PROJECT=oscar-go-1 go test -v -run=TestTransaction -grpcrecord=/transaction
+	const file = "testdata/transaction.grpcrr"
+	if _, err := os.Stat(file); err != nil && flag.Lookup("grpcrecord").Value.String() == "" {
+		t.Skipf("%s not recorded", file)
+	}
+	rr, project := openRR(t, file)
+	ctx := context.Background()
+
+	db, err := NewDB(ctx, testutil.Slogger(t), project, firestoreTestDatabase, rr.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.uid = 1
+	defer db.Close()
+
+	// The concurrent parts of storage.TestTxDB cannot be replayed,
+	// so check a sequence of transactions.
+	db.Set([]byte("tx.n"), []byte("0"))
+	for range 3 {
+		err := storage.Transaction(db, func(tx storage.Tx) error {
+			val, _ := tx.Get([]byte("tx.n"))
+			n, err := strconv.Atoi(string(val))
+			if err != nil {
+				return err
+			}
+			tx.Set([]byte("tx.n"), []byte(strconv.Itoa(n+1)))
+			tx.Delete([]byte("tx.gone"))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if val, _ := db.Get([]byte("tx.n")); string(val) != "3" {
+		t.Errorf("after 3 transactions, n = %q, want 3", val)
+	}
+
+	errTest := errors.New("test error")
+	err = db.Transaction(func(tx storage.Tx) error {
+		tx.Set([]byte("tx.n"), []byte("error"))
+		return errTest
+	})
+	if err != errTest {
+		t.Errorf("Transaction returning error = %v, want %v", err, errTest)
+	}
+	if val, _ := db.Get([]byte("tx.n")); string(val) != "3" {
+		t.Errorf("after failed transaction, n = %q, want 3", val)
+	}
+}
+
 // TestDBLimit checks that [DB.Scan] properly restarts from query limits (see docLimit).
 func TestDBLimit(t *testing.T) {
 	// Re-record with
@@ -129,6 +185,11 @@ func TestLock(t *testing.T) {
 		storage.TestDBLock(t, db)
 	})
 
+	t.Run("context", func(t *testing.T) {
+		db, _ := newTestDB(t, projectID)
+		storage.TestDBContextLock(t, db)
+	})
+
 	t.Run("timeout", func(t *testing.T) {
 		db1, name := newTestDB(t, projectID)
 		db2, _ := newTestDB(t, projectID)
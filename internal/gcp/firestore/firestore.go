@@ -109,16 +109,18 @@ func (f *fstore) get(tx *firestore.Transaction, coll *firestore.CollectionRef, i
 
 // set sets the document with the given collection and ID to value.
 // If tx is non-nil, the set happens inside the transaction.
-func (f *fstore) set(tx *firestore.Transaction, coll *firestore.CollectionRef, key string, value any) {
+// The opts are passed to Firestore, for example to merge value
+// into an existing document.
+func (f *fstore) set(tx *firestore.Transaction, coll *firestore.CollectionRef, key string, value any, opts ...firestore.SetOption) {
 	dr := coll.Doc(key)
 	if dr == nil {
 		f.Panic("firestore set bad doc ref args", "collection", coll, "key", key)
 	}
 	var err error
 	if tx == nil {
-		_, err = dr.Set(context.TODO(), value)
+		_, err = dr.Set(context.TODO(), value, opts...)
 	} else {
-		err = tx.Set(dr, value)
+		err = tx.Set(dr, value, opts...)
 	}
 	if err != nil {
 		// unreachable except for bad DB
@@ -251,6 +253,7 @@ func (f *fstore) newBatch(coll *firestore.CollectionRef) *batch {
 type op struct {
 	id    string // or start, for deleteRange
 	value any    // nil for delete, deleteRange
+	merge bool   // for set: merge value into the existing document
 	// for deleteRange:
 	end       string
 	deleteIDs []string // the list of IDs to delete, determined inside the transaction
@@ -279,6 +282,14 @@ func (b *batch) set(id string, val any, valSize int) {
 	b.size += perWriteSize + len(id) + valSize
 }
 
+// setMerge adds a set operation to the batch that merges val, which must be a map,
+// into the existing document. It is the caller's responsibility to
+// estimate the size of val.
+func (b *batch) setMerge(id string, val map[string]any, valSize int) {
+	b.ops = append(b.ops, &op{id: id, value: val, merge: true})
+	b.size += perWriteSize + len(id) + valSize
+}
+
 // delete adds a delete operation to the batch.
 func (b *batch) delete(id string) {
 	if len(id) == 0 {
@@ -325,6 +336,8 @@ func (b *batch) apply() {
 		// Execute each op inside the transaction.
 		for _, op := range b.ops {
 			switch {
+			case op.value != nil && op.merge: // set, merging
+				b.f.set(tx, b.coll, op.id, op.value, firestore.MergeAll)
 			case op.value != nil: // set
 				b.f.set(tx, b.coll, op.id, op.value)
 			case op.end == "": // delete
@@ -10,6 +10,7 @@ import (
 	"iter"
 	"log/slog"
 	"path"
+	"slices"
 
 	"cloud.google.com/go/firestore"
 	"golang.org/x/oscar/internal/gcp/grpcerrors"
@@ -36,6 +37,16 @@ type VectorDB struct {
 // Vectors in a VectorDB with namespace NS are stored in the Firestore collection
 // "vectorDBs/NS/vectors".
 //
+// The VectorDB also implements [storage.MetaVectorDB]. The metadata for a vector
+// is stored in the field "Meta" of the vector's document, and SearchFilter
+// adds conditions on the "Meta" fields to the nearest-neighbor query,
+// so that Firestore applies the filter before choosing the nearest vectors.
+// Such queries need a composite vector index on the filtered fields
+// and the "Embedding" field; Firestore's error for a missing index
+// explains how to create it.
+// Firestore does not match documents that lack a filtered field,
+// so a vector without metadata never matches a non-zero filter.
+//
 // [valid Firestore collection ID]: https://firebase.google.com/docs/firestore/quotas#collections_documents_and_fields
 func NewVectorDB(ctx context.Context, lg *slog.Logger, projectID, database, namespace string, opts ...option.ClientOption) (*VectorDB, error) {
 	fs, err := newFstore(ctx, lg, projectID, database, opts)
@@ -72,6 +83,32 @@ func (db *VectorDB) Set(id string, vec llm.Vector) {
 	}
 }
 
+// A metaDoc holds the metadata stored in a vector document.
+type metaDoc struct {
+	Meta *storage.VectorMeta
+}
+
+// SetMeta implements [storage.MetaVectorDB.SetMeta].
+func (db *VectorDB) SetMeta(id string, meta *storage.VectorMeta) {
+	db.fs.set(nil, db.coll, encodeVectorID(id), map[string]any{"Meta": meta}, firestore.MergeAll)
+}
+
+// Meta implements [storage.MetaVectorDB.Meta].
+func (db *VectorDB) Meta(id string) (*storage.VectorMeta, bool) {
+	docsnap, err := db.docref(id).Get(context.TODO())
+	if err != nil {
+		if grpcerrors.IsNotFound(err) {
+			return nil, false
+		}
+		db.fs.Panic("firestore VectorDB Meta", "id", id, "err", err)
+	}
+	var doc metaDoc
+	if err := docsnap.DataTo(&doc); err != nil {
+		db.fs.Panic("firestore VectorDB Meta", "id", id, "err", err)
+	}
+	return doc.Meta, doc.Meta != nil
+}
+
 // Get implements [storage.VectorDB.Get].
 func (db *VectorDB) Get(id string) (llm.Vector, bool) {
 	docsnap, err := db.docref(id).Get(context.TODO())
@@ -142,8 +179,38 @@ func (db *VectorDB) All() iter.Seq2[string, func() llm.Vector] {
 
 // Search implements [storage.VectorDB.Search].
 func (db *VectorDB) Search(vec llm.Vector, n int) []storage.VectorResult {
-	q := db.coll.FindNearest("Embedding", firestore.Vector32(vec), n, firestore.DistanceMeasureDotProduct, nil)
-	iter := q.Documents(context.TODO())
+	return db.SearchFilter(vec, n, nil)
+}
+
+// SearchFilter implements [storage.MetaVectorDB.SearchFilter].
+func (db *VectorDB) SearchFilter(vec llm.Vector, n int, f *storage.VectorFilter) []storage.VectorResult {
+	q := db.coll.Query
+	if !f.IsZero() {
+		in, notIn, ok := kindConditions(f)
+		if !ok {
+			return nil
+		}
+		if len(in) > 0 {
+			q = q.Where("Meta.Kind", "in", in)
+		}
+		if len(notIn) > 0 {
+			q = q.Where("Meta.Kind", "not-in", notIn)
+		}
+		if f.Project != "" {
+			q = q.Where("Meta.Project", "==", f.Project)
+		}
+		if f.State != "" {
+			q = q.Where("Meta.State", "==", f.State)
+		}
+		if !f.CreatedAfter.IsZero() {
+			q = q.Where("Meta.Created", ">", f.CreatedAfter)
+		}
+		if !f.CreatedBefore.IsZero() {
+			q = q.Where("Meta.Created", "<", f.CreatedBefore)
+		}
+	}
+	vq := q.FindNearest("Embedding", firestore.Vector32(vec), n, firestore.DistanceMeasureDotProduct, nil)
+	iter := vq.Documents(context.TODO())
 	defer iter.Stop()
 	var res []storage.VectorResult
 	for {
@@ -154,7 +221,10 @@ func (db *VectorDB) Search(vec llm.Vector, n int) []storage.VectorResult {
 		if err != nil {
 			db.fs.Panic("firestore VectorDB Search", "err", err)
 		}
-		var doc vectorDoc
+		var doc struct {
+			Embedding firestore.Vector32
+			Meta      *storage.VectorMeta
+		}
 		if err := docsnap.DataTo(&doc); err != nil {
 			db.fs.Panic("firestore VectorDB Search", "err", err)
 		}
@@ -167,6 +237,25 @@ func (db *VectorDB) Search(vec llm.Vector, n int) []storage.VectorResult {
 	return res
 }
 
+// kindConditions returns the kinds for the "in" and "not-in" conditions
+// on "Meta.Kind" that implement the Kinds and DenyKinds of f.
+// Firestore allows only one of "in" and "not-in" in a query,
+// so when f has both, kindConditions removes the denied kinds
+// from the allowed ones, so that Firestore applies the whole filter
+// and the search still returns up to the requested number of results.
+// It returns ok == false if f matches no kinds.
+func kindConditions(f *storage.VectorFilter) (in, notIn []string, ok bool) {
+	if len(f.Kinds) == 0 {
+		return nil, f.DenyKinds, true
+	}
+	for _, k := range f.Kinds {
+		if !slices.Contains(f.DenyKinds, k) {
+			in = append(in, k)
+		}
+	}
+	return in, nil, len(in) > 0
+}
+
 // docref returns a DocumentReference for the document with the given ID.
 func (db *VectorDB) docref(id string) *firestore.DocumentRef {
 	// To avoid running into the restrictions on Firestore document IDs, escape the id.
@@ -205,6 +294,14 @@ func (b *vBatch) Delete(id string) {
 	b.b.delete(encodeVectorID(id))
 }
 
+// Approximate size of a VectorMeta encoded as a Firestore value.
+const metaSize = 150
+
+// SetMeta implements [storage.MetaVectorBatch.SetMeta].
+func (b *vBatch) SetMeta(id string, meta *storage.VectorMeta) {
+	b.b.setMerge(encodeVectorID(id), map[string]any{"Meta": meta}, metaSize)
+}
+
 // MaybeApply implements [storage.VectorBatch.MaybeApply].
 func (b *vBatch) MaybeApply() bool { return b.b.maybeApply() }
 
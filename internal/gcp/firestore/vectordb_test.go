@@ -7,6 +7,7 @@ package firestore
 import (
 	"context"
 	"fmt"
+	"slices"
 	"testing"
 
 	"cloud.google.com/go/firestore"
@@ -113,3 +114,21 @@ Restart:
 	}
 	bw.Flush()
 }
+
+func TestKindConditions(t *testing.T) {
+	for _, tt := range []struct {
+		f         storage.VectorFilter
+		in, notIn []string
+		ok        bool
+	}{
+		{storage.VectorFilter{Kinds: []string{"a", "b"}}, []string{"a", "b"}, nil, true},
+		{storage.VectorFilter{DenyKinds: []string{"a"}}, nil, []string{"a"}, true},
+		{storage.VectorFilter{Kinds: []string{"a", "b", "c"}, DenyKinds: []string{"b"}}, []string{"a", "c"}, nil, true},
+		{storage.VectorFilter{Kinds: []string{"a"}, DenyKinds: []string{"a", "b"}}, nil, nil, false},
+	} {
+		in, notIn, ok := kindConditions(&tt.f)
+		if !slices.Equal(in, tt.in) || !slices.Equal(notIn, tt.notIn) || ok != tt.ok {
+			t.Errorf("kindConditions(%+v) = %q, %q, %v, want %q, %q, %v", tt.f, in, notIn, ok, tt.in, tt.notIn, tt.ok)
+		}
+	}
+}
@@ -13,11 +13,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"log/slog"
 	"net/http"
 	"slices"
 	"strings"
 
+	"golang.org/x/oscar/internal/gcp/grpcerrors"
 	"golang.org/x/oscar/internal/httprr"
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/secret"
@@ -105,6 +107,18 @@ func NewClient(ctx context.Context, lg *slog.Logger, sdb secret.DB, hc *http.Cli
 
 const maxBatch = 100 // empirical limit
 
+// apiError returns err, annotated with the gRPC code corresponding
+// to its HTTP status if it is an error response from the Gemini API,
+// so that transient errors can be recognized by
+// [grpcerrors.IsRetryable].
+func apiError(err error) error {
+	var ae genai.APIError
+	if errors.As(err, &ae) {
+		return grpcerrors.WithHTTPStatus(err, ae.Code)
+	}
+	return err
+}
+
 var _ llm.Embedder = (*Client)(nil)
 
 // EmbeddingModel returns the name of the embedding model.
@@ -127,7 +141,7 @@ func (c *Client) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vect
 		}
 		resp, err := c.genai.Models.EmbedContent(ctx, c.embeddingModel, contents, config)
 		if err != nil {
-			return nil, err
+			return nil, apiError(err)
 		}
 		for _, e := range resp.Embeddings {
 			vecs = append(vecs, llm.Vector(e.Values).Normal())
@@ -171,10 +185,28 @@ func (c *Client) GenerateContent(ctx context.Context, schema *llm.Schema, prompt
 // generate returns the model's response (of the specified MIME type) for the prompt parts.
 // It returns an error if a response cannot be generated.
 func (c *Client) generate(ctx context.Context, mimeType string, schema *genai.Schema, promptParts ...llm.Part) (string, error) {
-	parts, err := c.parts(promptParts)
+	contents, config, err := c.request(mimeType, schema, promptParts)
 	if err != nil {
 		return "", err
 	}
+	resp, err := c.genai.Models.GenerateContent(ctx, c.generativeModel, contents, config)
+	if err != nil {
+		return "", apiError(err)
+	}
+	text := resp.Text()
+	if text == "" {
+		return "", errors.New("no content generated")
+	}
+	return text, nil
+}
+
+// request returns the contents and configuration of a request
+// for a response (of the specified MIME type) to the prompt parts.
+func (c *Client) request(mimeType string, schema *genai.Schema, promptParts []llm.Part) ([]*genai.Content, *genai.GenerateContentConfig, error) {
+	parts, err := c.parts(promptParts)
+	if err != nil {
+		return nil, nil, err
+	}
 	config := &genai.GenerateContentConfig{
 		CandidateCount:   1,
 		ResponseMIMEType: mimeType,
@@ -183,15 +215,63 @@ func (c *Client) generate(ctx context.Context, mimeType string, schema *genai.Sc
 	if c.temperature >= 0 {
 		config.Temperature = &c.temperature
 	}
-	resp, err := c.genai.Models.GenerateContent(ctx, c.generativeModel, []*genai.Content{{Role: genai.RoleUser, Parts: parts}}, config)
-	if err != nil {
-		return "", err
-	}
-	text := resp.Text()
-	if text == "" {
-		return "", errors.New("no content generated")
+	return []*genai.Content{{Role: genai.RoleUser, Parts: parts}}, config, nil
+}
+
+var _ llm.ContentStreamer = (*Client)(nil)
+
+// GenerateContentStream returns an iterator over the model's response
+// for the prompt parts, as it is generated,
+// implementing [llm.ContentStreamer.GenerateContentStream].
+func (c *Client) GenerateContentStream(ctx context.Context, schema *llm.Schema, promptParts []llm.Part) iter.Seq2[*llm.Chunk, error] {
+	return func(yield func(*llm.Chunk, error) bool) {
+		mimeType := "text/plain"
+		var gschema *genai.Schema
+		if schema != nil {
+			mimeType, gschema = "application/json", genaiSchema(schema)
+		}
+		contents, config, err := c.request(mimeType, gschema, promptParts)
+		if err != nil {
+			yield(nil, fmt.Errorf("gemini.GenerateContentStream: %w", err))
+			return
+		}
+
+		// Hold back each chunk until the next arrives,
+		// so that the usage can be attached to the final one.
+		// Each response reports the usage so far.
+		var last *llm.Chunk
+		var usage *genai.GenerateContentResponseUsageMetadata
+		for resp, err := range c.genai.Models.GenerateContentStream(ctx, c.generativeModel, contents, config) {
+			if err != nil {
+				yield(nil, fmt.Errorf("gemini.GenerateContentStream: %w", apiError(err)))
+				return
+			}
+			if resp.UsageMetadata != nil {
+				usage = resp.UsageMetadata
+			}
+			text := resp.Text()
+			if text == "" {
+				continue
+			}
+			if last != nil && !yield(last, nil) {
+				return
+			}
+			last = &llm.Chunk{Text: text}
+		}
+		if last == nil {
+			yield(nil, errors.New("gemini.GenerateContentStream: no content generated"))
+			return
+		}
+		last.Usage = &llm.Usage{}
+		if usage != nil {
+			last.Usage = &llm.Usage{
+				PromptTokens:   int(usage.PromptTokenCount),
+				ResponseTokens: int(usage.CandidatesTokenCount),
+				TotalTokens:    int(usage.TotalTokenCount),
+			}
+		}
+		yield(last, nil)
 	}
-	return text, nil
 }
 
 // parts converts the given prompt parts to [genai.Part]s of
@@ -204,9 +284,98 @@ func (c *Client) parts(promptParts []llm.Part) ([]*genai.Part, error) {
 			parts[i] = genai.NewPartFromText(string(p))
 		case llm.Blob:
 			parts[i] = genai.NewPartFromBytes(p.Data, p.MIMEType)
+		case llm.ToolCall:
+			var args map[string]any
+			if len(p.Args) > 0 {
+				if err := json.Unmarshal(p.Args, &args); err != nil {
+					return nil, fmt.Errorf("bad arguments for tool call %s: %w", p.Name, err)
+				}
+			}
+			parts[i] = genai.NewPartFromFunctionCall(p.Name, args)
+			parts[i].FunctionCall.ID = p.ID
+		case llm.ToolResult:
+			// Gemini expects the keys "output" and "error".
+			response := map[string]any{"output": p.Output}
+			if p.Error != "" {
+				response = map[string]any{"error": p.Error}
+			}
+			parts[i] = genai.NewPartFromFunctionResponse(p.Name, response)
+			parts[i].FunctionResponse.ID = p.ID
 		default:
 			return nil, fmt.Errorf("bad type for part: %T; need string or llm.Blob", p)
 		}
 	}
 	return parts, nil
 }
+
+var _ llm.ToolCaller = (*Client)(nil)
+
+// GenerateMessage returns the model's next message in the conversation,
+// which may call the tools,
+// implementing [llm.ToolCaller.GenerateMessage].
+func (c *Client) GenerateMessage(ctx context.Context, tools []*llm.Tool, msgs []*llm.Message) (*llm.Message, error) {
+	var contents []*genai.Content
+	var system []*genai.Part
+	for _, m := range msgs {
+		parts, err := c.parts(m.Parts)
+		if err != nil {
+			return nil, fmt.Errorf("gemini.GenerateMessage: %w", err)
+		}
+		if m.Role == llm.RoleSystem {
+			// Gemini takes instructions separately from the conversation.
+			system = append(system, parts...)
+			continue
+		}
+		// The other llm roles are the same as Gemini's.
+		contents = append(contents, &genai.Content{Role: string(m.Role), Parts: parts})
+	}
+	config := &genai.GenerateContentConfig{
+		CandidateCount: 1,
+	}
+	if len(system) > 0 {
+		config.SystemInstruction = &genai.Content{Parts: system}
+	}
+	if c.temperature >= 0 {
+		config.Temperature = &c.temperature
+	}
+	if len(tools) > 0 {
+		var decls []*genai.FunctionDeclaration
+		for _, t := range tools {
+			decls = append(decls, &genai.FunctionDeclaration{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  genaiSchema(t.Parameters),
+			})
+		}
+		config.Tools = []*genai.Tool{{FunctionDeclarations: decls}}
+	}
+	resp, err := c.genai.Models.GenerateContent(ctx, c.generativeModel, contents, config)
+	if err != nil {
+		return nil, fmt.Errorf("gemini.GenerateMessage: %w", apiError(err))
+	}
+	m := &llm.Message{Role: llm.RoleModel}
+	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		for _, p := range resp.Candidates[0].Content.Parts {
+			switch {
+			case p.Thought:
+				// Omit summaries of the model's thinking.
+			case p.FunctionCall != nil:
+				args := []byte("{}")
+				if p.FunctionCall.Args != nil {
+					var err error
+					if args, err = json.Marshal(p.FunctionCall.Args); err != nil {
+						// unreachable: the arguments were decoded from JSON
+						return nil, fmt.Errorf("gemini.GenerateMessage: %w", err)
+					}
+				}
+				m.Parts = append(m.Parts, llm.ToolCall{ID: p.FunctionCall.ID, Name: p.FunctionCall.Name, Args: args})
+			case p.Text != "":
+				m.Parts = append(m.Parts, llm.Text(p.Text))
+			}
+		}
+	}
+	if len(m.Parts) == 0 {
+		return nil, errors.New("gemini.GenerateMessage: no content generated")
+	}
+	return m, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oscar/internal/gcp/grpcerrors"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/secret"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+// streamResponses are the server-sent events for a streamed response,
+// in the form the Gemini API uses.
+var streamResponses = []string{
+	`{"candidates":[{"content":{"parts":[{"text":"Use it "}],"role":"model"}}],"usageMetadata":{"promptTokenCount":9,"totalTokenCount":9}}`,
+	`{"candidates":[{"content":{"parts":[{"text":"when comparing "}],"role":"model"}}],"usageMetadata":{"promptTokenCount":9,"totalTokenCount":9}}`,
+	`{"candidates":[{"content":{"parts":[{"text":"header names."}],"role":"model"},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":7,"totalTokenCount":16}}`,
+}
+
+// newFakeServerClient returns a client whose requests
+// are all sent to a test server that runs handler.
+func newFakeServerClient(t *testing.T, handler http.HandlerFunc) *Client {
+	check := testutil.Checker(t)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	check(err)
+	hc := &http.Client{Transport: redirectTransport{u}}
+	c, err := NewClient(context.Background(), testutil.Slogger(t), secret.ReadOnlyMap{"ai.google.dev": "nokey"}, hc, DefaultEmbeddingModel, DefaultGenerativeModel)
+	check(err)
+	return c
+}
+
+// redirectTransport sends all requests to the host u.
+type redirectTransport struct {
+	u *url.URL
+}
+
+func (r redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = r.u.Scheme
+	req.URL.Host = r.u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGenerateContentStream(t *testing.T) {
+	c := newFakeServerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":streamGenerateContent") || r.URL.Query().Get("alt") != "sse" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, resp := range streamResponses {
+			fmt.Fprintf(w, "data: %s\r\n\r\n", resp)
+		}
+	})
+	var chunks []string
+	var usage *llm.Usage
+	for chunk, err := range c.GenerateContentStream(ctx, nil, []llm.Part{llm.Text("When should I use CanonicalHeaderKey?")}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage != nil {
+			t.Fatalf("chunk %q follows chunk with usage", chunk.Text)
+		}
+		chunks = append(chunks, chunk.Text)
+		usage = chunk.Usage
+	}
+	if got, want := strings.Join(chunks, "|"), "Use it |when comparing |header names."; got != want {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+	if want := (llm.Usage{PromptTokens: 9, ResponseTokens: 7, TotalTokens: 16}); usage == nil || *usage != want {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+}
+
+func TestGenerateContentStreamError(t *testing.T) {
+	c := newFakeServerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, `{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`)
+	})
+	text, _, err := llm.Collect(c.GenerateContentStream(ctx, nil, []llm.Part{llm.Text("hello")}))
+	if err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Fatalf("GenerateContentStream = %q, %v, want error", text, err)
+	}
+	if !grpcerrors.IsRetryable(err) {
+		t.Errorf("GenerateContentStream error %v is not retryable", err)
+	}
+	if _, err := c.GenerateContent(ctx, nil, []llm.Part{llm.Text("hello")}); !grpcerrors.IsRetryable(err) {
+		t.Errorf("GenerateContent error %v is not retryable", err)
+	}
+}
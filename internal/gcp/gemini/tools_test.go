@@ -0,0 +1,125 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+)
+
+func TestRunTools(t *testing.T) {
+	// The server asks for a call of the lookup tool,
+	// and then answers using the result.
+	var requests []string
+	c := newFakeServerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Contents []struct {
+				Role  string
+				Parts []map[string]any
+			}
+			Tools []struct {
+				FunctionDeclarations []struct{ Name string }
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		js, _ := json.Marshal(req)
+		requests = append(requests, string(js))
+		w.Header().Set("Content-Type", "application/json")
+		switch len(req.Contents) {
+		case 1:
+			fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"id":"c1","name":"lookup","args":{"id":"golang/go#1"}}}]}}]}`)
+		case 3:
+			resp := req.Contents[2].Parts[0]["functionResponse"].(map[string]any)["response"].(map[string]any)
+			fmt.Fprintf(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"The issue says %s."}]}}]}`, resp["output"])
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	})
+
+	lookup := &llm.Tool{
+		Name:        "lookup",
+		Description: "looks up a document by ID",
+		Parameters: &llm.Schema{
+			Type:       llm.TypeObject,
+			Properties: map[string]*llm.Schema{"id": {Type: llm.TypeString}},
+			Required:   []string{"id"},
+		},
+		Call: func(_ context.Context, args json.RawMessage) (string, error) {
+			var a struct{ ID string }
+			if err := json.Unmarshal(args, &a); err != nil {
+				return "", err
+			}
+			return "hello from " + a.ID, nil
+		},
+	}
+	got, _, err := llm.RunTools(ctx, c, []*llm.Tool{lookup}, 3, []llm.Part{llm.Text("What does golang/go#1 say?")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "The issue says hello from golang/go#1."; got != want {
+		t.Errorf("RunTools = %q, want %q", got, want)
+	}
+
+	want := []string{
+		`{"Contents":[{"Role":"user","Parts":[{"text":"What does golang/go#1 say?"}]}],"Tools":[{"FunctionDeclarations":[{"Name":"lookup"}]}]}`,
+		`{"Contents":[{"Role":"user","Parts":[{"text":"What does golang/go#1 say?"}]},{"Role":"model","Parts":[{"functionCall":{"args":{"id":"golang/go#1"},"id":"c1","name":"lookup"}}]},{"Role":"user","Parts":[{"functionResponse":{"id":"c1","name":"lookup","response":{"output":"hello from golang/go#1"}}}]}],"Tools":[{"FunctionDeclarations":[{"Name":"lookup"}]}]}`,
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("server got %d requests, want %d:\n%q", len(requests), len(want), requests)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("request %d:\nhave %s\nwant %s", i, requests[i], want[i])
+		}
+	}
+}
+
+func TestGenerateChat(t *testing.T) {
+	var request string
+	c := newFakeServerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SystemInstruction struct {
+				Parts []map[string]any
+			}
+			Contents []struct {
+				Role  string
+				Parts []map[string]any
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		js, _ := json.Marshal(req)
+		request = string(js)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"Fine, thanks."}]}}]}`)
+	})
+
+	got, err := llm.GenerateChat(ctx, c, []*llm.Message{
+		{Role: llm.RoleSystem, Parts: []llm.Part{llm.Text("Be brief.")}},
+		{Role: llm.RoleUser, Parts: []llm.Part{llm.Text("Hello.")}},
+		{Role: llm.RoleModel, Parts: []llm.Part{llm.Text("Hi.")}},
+		{Role: llm.RoleUser, Parts: []llm.Part{llm.Text("How are you?")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Fine, thanks."; got != want {
+		t.Errorf("GenerateChat = %q, want %q", got, want)
+	}
+	want := `{"SystemInstruction":{"Parts":[{"text":"Be brief."}]},"Contents":[{"Role":"user","Parts":[{"text":"Hello."}]},{"Role":"model","Parts":[{"text":"Hi."}]},{"Role":"user","Parts":[{"text":"How are you?"}]}]}`
+	if request != want {
+		t.Errorf("request:\nhave %s\nwant %s", request, want)
+	}
+}
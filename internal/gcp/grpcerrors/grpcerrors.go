@@ -7,6 +7,8 @@
 package grpcerrors
 
 import (
+	"net/http"
+
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -26,3 +28,76 @@ func IsTimeout(err error) bool {
 func IsUnavailable(err error) bool {
 	return status.Code(err) == codes.Unavailable
 }
+
+// IsAborted reports whether an error returned by a gRPC client indicates code “aborted”,
+// as happens when a transaction fails due to contention.
+func IsAborted(err error) bool {
+	return status.Code(err) == codes.Aborted
+}
+
+// IsRetryable reports whether an error returned by a gRPC client indicates
+// a transient failure, so that the call may succeed if it is retried:
+// codes “unavailable”, “resource exhausted”, “deadline exceeded” and “aborted”.
+func IsRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// WithHTTPStatus returns an error wrapping err, an error from
+// an HTTP server that responded with the given status code,
+// that carries the corresponding gRPC code, so that it can be
+// classified by the functions in this package.
+// The mapping of HTTP status codes to gRPC codes is the one used
+// by Google APIs.
+func WithHTTPStatus(err error, httpStatus int) error {
+	return &httpError{err: err, code: httpCode(httpStatus)}
+}
+
+// An httpError is an error returned by [WithHTTPStatus].
+type httpError struct {
+	err  error
+	code codes.Code
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+func (e *httpError) Unwrap() error { return e.err }
+
+// GRPCStatus returns the gRPC status of the error,
+// as used by [status.Code].
+func (e *httpError) GRPCStatus() *status.Status {
+	return status.New(e.code, e.err.Error())
+}
+
+// httpCode returns the gRPC code corresponding to an HTTP status code.
+func httpCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499: // client closed request
+		return codes.Canceled
+	case http.StatusInternalServerError:
+		return codes.Internal
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grpcerrors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryable(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("plain"), false},
+		{status.Error(codes.Unavailable, "x"), true},
+		{status.Error(codes.NotFound, "x"), false},
+		{fmt.Errorf("wrapped: %w", status.Error(codes.ResourceExhausted, "x")), true},
+		{WithHTTPStatus(errors.New("x"), 429), true},
+		{WithHTTPStatus(errors.New("x"), 503), true},
+		{fmt.Errorf("wrapped: %w", WithHTTPStatus(errors.New("x"), 504)), true},
+		{WithHTTPStatus(errors.New("x"), 400), false},
+		{WithHTTPStatus(errors.New("x"), 500), false},
+	} {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v (code %v)) = %v, want %v", tt.err, status.Code(tt.err), got, tt.want)
+		}
+	}
+
+	base := errors.New("not found")
+	err := WithHTTPStatus(base, 404)
+	if !IsNotFound(err) || !errors.Is(err, base) || err.Error() != "not found" {
+		t.Errorf("WithHTTPStatus(404) = %v: not a NotFound error wrapping the original", err)
+	}
+}
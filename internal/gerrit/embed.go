@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"iter"
 	"slices"
+	"strconv"
 	"strings"
 
 	"golang.org/x/oscar/internal/docs"
@@ -141,6 +142,39 @@ func relatedDocURL(ci *changeInfo) string {
 	return fmt.Sprintf("https://%s/c/%s/+/%d#related-content", ci.instance, ci.project, ci.number)
 }
 
+// LookupDocURL looks up the change for a document ID returned by
+// [Client.ToDocs] (for example
+// "https://go-review.googlesource.com/c/go/+/12345#related-content"),
+// only consulting the database (not actual Gerrit).
+// It returns an error if url is not such a document ID for c's instance
+// or if the change is not in the database.
+func (c *Client) LookupDocURL(url string) (*Change, error) {
+	bad := func() (*Change, error) {
+		return nil, fmt.Errorf("not a gerrit document URL for %s: %q", c.instance, url)
+	}
+	rest, ok := strings.CutPrefix(url, "https://"+c.instance+"/c/")
+	if !ok {
+		return bad()
+	}
+	rest, ok = strings.CutSuffix(rest, "#related-content")
+	if !ok {
+		return bad()
+	}
+	project, num, ok := strings.Cut(rest, "/+/")
+	if !ok {
+		return bad()
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n <= 0 {
+		return bad()
+	}
+	ch := c.Change(project, n)
+	if ch == nil {
+		return nil, fmt.Errorf("gerrit change %s/%d not found", project, n)
+	}
+	return ch, nil
+}
+
 // comments returns file comments for the gerrit change.
 func (c *Client) comments(ci *changeInfo) ([]*CommentInfo, error) {
 	var cmts []*CommentInfo
@@ -60,6 +60,19 @@ const (
 // A watcher on "gerrit.ChangeUpdate" will see all Gerrit changes,
 // and can read the new data from the database.
 
+func init() {
+	storage.RegisterDecoder(syncProjectKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(projectSync))
+	})
+	storage.RegisterDecoder(changeKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(ChangeInfo))
+	})
+	storage.RegisterDecoder(commentKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(map[string][]*CommentInfo))
+	})
+	timed.RegisterDecoder(changeUpdateKind, nil)
+}
+
 // Gerrit APIs for searching changes return results only in reverse
 // chronological order. As execution of [Client.Sync] can in principle
 // be interrupted by the enclosing environment (for instance, Cloud Run
@@ -71,6 +71,32 @@ func TestSyncGerritDocs(t *testing.T) {
 	}
 }
 
+func TestLookupDocURL(t *testing.T) {
+	check := testutil.Checker(t)
+	lg := testutil.Slogger(t)
+	gr := New("go-review.googlesource.com", lg, storage.MemDB(), nil, nil)
+	check(gr.Testing().LoadTxtar("testdata/changes.txt"))
+
+	ch, err := gr.LookupDocURL(ch1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gr.ChangeNumber(ch); got != 1 {
+		t.Errorf("LookupDocURL(%q) = change %d, want 1", ch1, got)
+	}
+	for _, bad := range []string{
+		"https://go-review.googlesource.com/c/test/+/1",
+		"https://other.googlesource.com/c/test/+/1#related-content",
+		"https://go-review.googlesource.com/c/test/+/x#related-content",
+		"https://go-review.googlesource.com/c/test/1#related-content",
+		"https://github.com/golang/go/issues/1",
+	} {
+		if ch, err := gr.LookupDocURL(bad); err == nil {
+			t.Errorf("LookupDocURL(%q) = %v, want error", bad, ch)
+		}
+	}
+}
+
 var (
 	ch1      = "https://go-review.googlesource.com/c/test/+/1#related-content"
 	ch1Title = "this is change number 1"
@@ -247,20 +247,30 @@ func (c *Client) EventsAfter(t timed.DBTime, project string) iter.Seq[*Event] {
 // decodeEvent decodes the key, val pair into an Event.
 // It calls db.Panic for malformed data.
 func decodeEvent(db storage.DB, t *timed.Entry) *Event {
-	var e Event
+	e, err := unmarshalEvent(t.Key, t.Val)
+	if err != nil {
+		db.Panic("github event decode", "key", storage.Fmt(t.Key), "val", storage.Fmt(t.Val), "err", err)
+	}
 	e.DBTime = t.ModTime
-	if err := ordered.Decode(t.Key, &e.Project, &e.Issue, &e.API, &e.ID); err != nil {
-		db.Panic("github event decode", "key", storage.Fmt(t.Key), "err", err)
+	return e
+}
+
+// unmarshalEvent decodes the key, val pair of a timed entry into an Event.
+// The returned Event's DBTime is unset.
+func unmarshalEvent(key, val []byte) (*Event, error) {
+	var e Event
+	if err := ordered.Decode(key, &e.Project, &e.Issue, &e.API, &e.ID); err != nil {
+		return nil, fmt.Errorf("github event key: %v", err)
 	}
 
 	var js ordered.Raw
-	if err := ordered.Decode(t.Val, &js); err != nil {
-		db.Panic("github event val decode", "key", storage.Fmt(t.Key), "val", storage.Fmt(t.Val), "err", err)
+	if err := ordered.Decode(val, &js); err != nil {
+		return nil, fmt.Errorf("github event val: %v", err)
 	}
 	e.JSON = js
 	switch e.API {
 	default:
-		db.Panic("github event invalid API", "api", e.API)
+		return nil, fmt.Errorf("github event invalid API %q", e.API)
 	case "/issues":
 		e.Typed = new(Issue)
 	case "/issues/comments":
@@ -269,9 +279,26 @@ func decodeEvent(db storage.DB, t *timed.Entry) *Event {
 		e.Typed = new(IssueEvent)
 	}
 	if err := json.Unmarshal(js, e.Typed); err != nil {
-		db.Panic("github event json", "js", string(js), "err", err)
+		return nil, fmt.Errorf("github event json: %v", err)
 	}
-	return &e
+	return &e, nil
+}
+
+func init() {
+	timed.RegisterDecoder(eventKind, func(key, val []byte) (string, error) {
+		e, err := unmarshalEvent(key, val)
+		if err != nil {
+			return "", err
+		}
+		js, err := json.MarshalIndent(e.Typed, "", "\t")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%T\n%s", e.Typed, js), nil
+	})
+	storage.RegisterDecoder(syncProjectKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(projectSync))
+	})
 }
 
 // EventWatcher returns a new [timed.Watcher] with the given name.
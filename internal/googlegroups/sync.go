@@ -66,6 +66,16 @@ const (
 // updated conversations for a day. This is because Google Search page
 // shows only 30 recently updated conversations.
 
+func init() {
+	storage.RegisterDecoder(syncGroupKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(groupSync))
+	})
+	storage.RegisterDecoder(conversationKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(Conversation))
+	})
+	timed.RegisterDecoder(conversationUpdateKind, nil)
+}
+
 // o is short for ordered.Encode.
 func o(list ...any) []byte { return ordered.Encode(list...) }
 
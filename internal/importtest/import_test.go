@@ -83,6 +83,18 @@ var rules = []*rule{
 		packages: "internal/dbspec/...",
 		allow:    anything,
 	},
+	{
+		packages: "internal/sqlite/...",
+		allow:    anything,
+	},
+	{
+		packages: "internal/localmetrics/...",
+		allow:    anything,
+	},
+	{
+		packages: "internal/storage/dbmetrics/...",
+		allow:    anything,
+	},
 	// The remaining packages under internal should not depend on GCP.
 	{
 		packages: "internal/...",
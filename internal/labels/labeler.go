@@ -401,6 +401,12 @@ func (l *Labeler) setCategories(i *github.Issue, cats []string) {
 
 const categoriesPrefix = "labels.Categories"
 
+func init() {
+	storage.RegisterDecoder(categoriesPrefix, func(_, val []byte) (string, error) {
+		return "categories: " + strings.ReplaceAll(string(val), ",", ", "), nil
+	})
+}
+
 func categoriesKey(project string, num int64) []byte {
 	return ordered.Encode(categoriesPrefix, project, num)
 }
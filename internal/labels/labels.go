@@ -83,7 +83,7 @@ func IssueCategoryFromLists(ctx context.Context, cgen llm.ContentGenerator, iss
 		return Category{}, "", err
 	}
 	// Ask the LLM about the category of the issue.
-	jsonRes, err := cgen.GenerateContent(ctx, responseSchema, []llm.Part{llm.Text(prompt)})
+	jsonRes, err := llm.GenerateJSON(ctx, cgen, responseSchema, []llm.Part{llm.Text(prompt)}, maxJSONRepairs)
 	if err != nil {
 		return Category{}, "", fmt.Errorf("llm request failed: %w\n", err)
 	}
@@ -272,6 +272,10 @@ func blocks(b markdown.Block) iter.Seq2[markdown.Block, bool] {
 	}
 }
 
+// maxJSONRepairs is the maximum number of times to ask the LLM
+// to correct a response that does not match [responseSchema].
+const maxJSONRepairs = 2
+
 // response is the response that should generated by the LLM.
 // It must match [responseSchema].
 type response struct {
@@ -291,6 +295,7 @@ var responseSchema = &llm.Schema{
 			Description: "an explanation of why the issue belongs to the category",
 		},
 	},
+	Required: []string{"CategoryName", "Explanation"},
 }
 
 var config struct {
@@ -6,6 +6,7 @@ package labels
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"testing"
 
@@ -36,6 +37,30 @@ func TestIssueLabels(t *testing.T) {
 	}
 }
 
+func TestIssueLabelsRepair(t *testing.T) {
+	ctx := context.Background()
+	db := storage.MemDB()
+	iss := &github.Issue{
+		URL:   "https://api.github.com/repos/golang/go/issues/1",
+		Title: "title",
+		Body:  "body",
+	}
+
+	// Invalid responses are repaired.
+	g := llm.InjectOutputs(kindTestGenerator(), `{"Explanation":"whatever"}`, `{"CategoryName":1,"Explanation":"whatever"}`)
+	cat, _, err := IssueCategory(ctx, db, g, iss)
+	if err != nil || cat.Name != "other" {
+		t.Fatalf("IssueCategory = %v, %v, want other", cat.Name, err)
+	}
+
+	// Too many invalid responses.
+	g = llm.InjectOutputs(kindTestGenerator(), "{}", "{}", "{}")
+	var ve *llm.ValidationError
+	if _, _, err := IssueCategory(ctx, db, g, iss); !errors.As(err, &ve) {
+		t.Errorf("IssueCategory with invalid responses: err = %v, want *llm.ValidationError", err)
+	}
+}
+
 func kindTestGenerator() llm.ContentGenerator {
 	return llm.TestContentGenerator(
 		"kindTestGenerator",
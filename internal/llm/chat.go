@@ -0,0 +1,60 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GenerateChat returns the model's response to the conversation msgs,
+// which must end with a [RoleUser] message.
+// Messages with role [RoleSystem] hold instructions for the model,
+// and must precede the rest of the conversation.
+//
+// If g implements [ToolCaller], GenerateChat sends the conversation
+// to the model as a sequence of messages, without any tools.
+// Otherwise, it flattens the conversation into a single prompt:
+// the system instructions followed by a transcript in which
+// each message is introduced by its role.
+func GenerateChat(ctx context.Context, g ContentGenerator, msgs []*Message) (string, error) {
+	if len(msgs) == 0 || msgs[len(msgs)-1].Role != RoleUser {
+		return "", fmt.Errorf("llm.GenerateChat: conversation does not end with a user message")
+	}
+	if tc, ok := g.(ToolCaller); ok {
+		m, err := tc.GenerateMessage(ctx, nil, msgs)
+		if err != nil {
+			return "", err
+		}
+		var text []string
+		for _, p := range m.Parts {
+			if t, ok := p.(Text); ok {
+				text = append(text, string(t))
+			}
+		}
+		return strings.Join(text, ""), nil
+	}
+	return g.GenerateContent(ctx, nil, transcript(msgs))
+}
+
+// transcript flattens the conversation msgs into prompt parts
+// for a [ContentGenerator] that does not support messages.
+func transcript(msgs []*Message) []Part {
+	var parts []Part
+	for _, m := range msgs {
+		if m.Role == RoleSystem {
+			parts = append(parts, m.Parts...)
+		}
+	}
+	for _, m := range msgs {
+		if m.Role == RoleSystem {
+			continue
+		}
+		parts = append(parts, Text(fmt.Sprintf("[%s]", m.Role)))
+		parts = append(parts, m.Parts...)
+	}
+	return append(parts, Text(fmt.Sprintf("Respond to the last message of the conversation above as the %s.", RoleModel)))
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGenerateChat(t *testing.T) {
+	ctx := context.Background()
+	msgs := []*Message{
+		{Role: RoleSystem, Parts: []Part{Text("be brief|")}},
+		{Role: RoleUser, Parts: []Part{Text("hello|")}},
+		{Role: RoleModel, Parts: []Part{Text("hi|")}},
+		{Role: RoleUser, Parts: []Part{Text("how are you?|")}},
+	}
+
+	// A plain ContentGenerator sees a transcript.
+	got, err := GenerateChat(ctx, EchoContentGenerator(), msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "be brief|[user]hello|[model]hi|[user]how are you?|" +
+		"Respond to the last message of the conversation above as the model."
+	if got != want {
+		t.Errorf("GenerateChat(echo) = %q, want %q", got, want)
+	}
+
+	// A ToolCaller sees the messages.
+	got, err = GenerateChat(ctx, EchoToolCaller(), msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "how are you?|"; got != want {
+		t.Errorf("GenerateChat(echoTools) = %q, want %q", got, want)
+	}
+
+	if _, err := GenerateChat(ctx, EchoContentGenerator(), msgs[:3]); err == nil {
+		t.Errorf("GenerateChat ending in model message succeeded")
+	}
+}
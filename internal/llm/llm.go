@@ -118,6 +118,9 @@ func (Blob) isPart() {}
 // always responds with a deterministic message derived from the prompts.
 //
 // See [golang.org/x/oscar/internal/gcp/gemini] for a real implementation.
+//
+// A ContentGenerator may also implement [ContentStreamer]
+// to return responses incrementally.
 type ContentGenerator interface {
 	// Model returns the name of the generative model
 	// used by this ContentGenerator.
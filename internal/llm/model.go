@@ -0,0 +1,32 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import "context"
+
+// modelReporterKey is the context key for the function passed to [WithModelReporter].
+type modelReporterKey struct{}
+
+// WithModelReporter returns a copy of ctx that asks the generators
+// it is passed to to report the name of the model that actually
+// generated each response, by calling report.
+//
+// Most generators use a single model, the one returned by their
+// Model method, and report nothing. Generators that choose among
+// several models, such as a chain of fallbacks, call [ReportModel].
+func WithModelReporter(ctx context.Context, report func(model string)) context.Context {
+	return context.WithValue(ctx, modelReporterKey{}, report)
+}
+
+// ReportModel reports that model generated the response to a request
+// made with ctx, by calling the function passed to [WithModelReporter],
+// if any. Wrappers of generators that choose among models call it after
+// each successful request. When wrappers are nested, the innermost
+// reports first, so callers should usually keep the first report.
+func ReportModel(ctx context.Context, model string) {
+	if report, _ := ctx.Value(modelReporterKey{}).(func(string)); report != nil {
+		report(model)
+	}
+}
@@ -82,6 +82,14 @@ const (
 	PolicyTypeViolenceAndGore = PolicyType("VIOLENCE_AND_GORE")
 	// The model generates profanity and obscenities.
 	PolicyTypeObscenityAndProfanity = PolicyType("OBSCENITY_AND_PROFANITY")
+
+	// The following policies are not supported by the GCP Checks API.
+	// See [golang.org/x/oscar/internal/rulecheck].
+
+	// The text contains terms that are not allowed in the deployment.
+	PolicyTypeBlockedTerms = PolicyType("BLOCKED_TERMS")
+	// The text tries to override the instructions given to the model.
+	PolicyTypePromptInjection = PolicyType("PROMPT_INJECTION")
 )
 
 // AllPolicyTypes returns a list of policies that checks for all available dangerous
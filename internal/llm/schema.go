@@ -60,3 +60,70 @@ const (
 	// TypeObject means object type.
 	TypeObject Type = 6
 )
+
+// JSONSchema converts s, which is a subset of an OpenAPI 3.0 schema,
+// to the equivalent JSON Schema, which is what OpenAI-compatible
+// servers and Ollama accept for structured output.
+// It returns nil for a nil schema, meaning an unconstrained response.
+//
+// The differences are that types are lower case,
+// nullable values are expressed by allowing the type "null",
+// and objects do not allow additional properties.
+// The Format field is omitted: the OpenAPI formats for numbers
+// (float, int32 and so on) are not JSON Schema formats,
+// and servers may reject them.
+func (s *Schema) JSONSchema() map[string]any {
+	if s == nil {
+		return nil
+	}
+	js := make(map[string]any)
+	typ := s.Type.jsonName()
+	if typ != "" {
+		if s.Nullable {
+			js["type"] = []string{typ, "null"}
+		} else {
+			js["type"] = typ
+		}
+	}
+	if s.Description != "" {
+		js["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		js["enum"] = s.Enum
+	}
+	if s.Items != nil {
+		js["items"] = s.Items.JSONSchema()
+	}
+	if s.Type == TypeObject {
+		props := make(map[string]any, len(s.Properties))
+		for k, v := range s.Properties {
+			props[k] = v.JSONSchema()
+		}
+		js["properties"] = props
+		js["additionalProperties"] = false
+	}
+	if len(s.Required) > 0 {
+		js["required"] = s.Required
+	}
+	return js
+}
+
+// jsonName returns the JSON Schema type name for t,
+// or "" for [TypeUnspecified].
+func (t Type) jsonName() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeNumber:
+		return "number"
+	case TypeInteger:
+		return "integer"
+	case TypeBoolean:
+		return "boolean"
+	case TypeArray:
+		return "array"
+	case TypeObject:
+		return "object"
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	if s := (*Schema)(nil).JSONSchema(); s != nil {
+		t.Errorf("JSONSchema(nil) = %v, want nil", s)
+	}
+	s := &Schema{
+		Type: TypeObject,
+		Properties: map[string]*Schema{
+			"tags": {
+				Type:        TypeArray,
+				Description: "the tags",
+				Items:       &Schema{Type: TypeString, Enum: []string{"a", "b"}},
+			},
+			"score": {Type: TypeNumber, Format: "double", Nullable: true},
+		},
+		Required: []string{"tags"},
+	}
+	js, err := json.Marshal(s.JSONSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"additionalProperties":false,"properties":{"score":{"type":["number","null"]},"tags":{"description":"the tags","items":{"enum":["a","b"],"type":"string"},"type":"array"}},"required":["tags"],"type":"object"}`
+	if string(js) != want {
+		t.Errorf("JSONSchema:\nhave %s\nwant %s", js, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"context"
+	"iter"
+)
+
+// A ContentStreamer is a [ContentGenerator] that can also return
+// its response incrementally, as it is generated.
+// It is an optional interface: use [Stream] to stream
+// from any ContentGenerator.
+//
+// See [EchoContentGenerator] for a streaming generator useful for testing.
+type ContentStreamer interface {
+	ContentGenerator
+
+	// GenerateContentStream is like GenerateContent but returns
+	// an iterator over the response, in chunks, as it is generated.
+	// The concatenation of the chunks' Text fields is the full response.
+	// The final chunk of a complete response has its Usage field set.
+	// If an error occurs, the iterator yields it (with a nil chunk)
+	// and stops; the chunks already yielded are then only a prefix
+	// of a response.
+	GenerateContentStream(ctx context.Context, schema *Schema, parts []Part) iter.Seq2[*Chunk, error]
+}
+
+// A Chunk is part of a streamed response from a [ContentStreamer].
+type Chunk struct {
+	Text  string // next part of the response text
+	Usage *Usage // usage for the entire response; set only in the final chunk
+}
+
+// A Usage describes the resources used to generate a response.
+// Generators that do not report usage leave the counts zero.
+type Usage struct {
+	PromptTokens   int // tokens in the prompt
+	ResponseTokens int // tokens in the response
+	TotalTokens    int // total billed tokens, which may include others, like thinking
+}
+
+// Stream returns an iterator over the response of g to the prompt parts,
+// as described by [ContentStreamer.GenerateContentStream].
+// If g does not implement [ContentStreamer], Stream calls
+// g.GenerateContent and returns the entire response as a single chunk.
+func Stream(ctx context.Context, g ContentGenerator, schema *Schema, parts []Part) iter.Seq2[*Chunk, error] {
+	if s, ok := g.(ContentStreamer); ok {
+		return s.GenerateContentStream(ctx, schema, parts)
+	}
+	return func(yield func(*Chunk, error) bool) {
+		text, err := g.GenerateContent(ctx, schema, parts)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		yield(&Chunk{Text: text, Usage: &Usage{}}, nil)
+	}
+}
+
+// Collect reads the stream to completion and returns the full response
+// and its usage.
+// If the stream yields an error, Collect returns the response
+// generated so far along with the error.
+func Collect(stream iter.Seq2[*Chunk, error]) (string, *Usage, error) {
+	var text []byte
+	var usage *Usage
+	for c, err := range stream {
+		if err != nil {
+			return string(text), nil, err
+		}
+		text = append(text, c.Text...)
+		if c.Usage != nil {
+			usage = c.Usage
+		}
+	}
+	return string(text), usage, nil
+}
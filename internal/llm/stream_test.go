@@ -0,0 +1,43 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	errBad := errors.New("bad")
+	fail := func(context.Context, *Schema, []Part) (string, error) { return "", errBad }
+	for _, tt := range []struct {
+		name string
+		gen  ContentGenerator
+		text string
+		err  error
+	}{
+		{"streamer", TestContentGenerator("t", nil), "a b c", nil},
+		{"streamer-error", TestContentGenerator("t", fail), "", errBad},
+		{"generator", nonStreamer{EchoContentGenerator()}, "a b c", nil},
+		{"generator-error", nonStreamer{TestContentGenerator("t", fail)}, "", errBad},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			text, usage, err := Collect(Stream(ctx, tt.gen, nil, []Part{Text("a b c")}))
+			if text != tt.text || err != tt.err {
+				t.Fatalf("Collect(Stream(...)) = %q, %v, want %q, %v", text, err, tt.text, tt.err)
+			}
+			if err == nil && usage == nil {
+				t.Errorf("Collect(Stream(...)) returned nil usage")
+			}
+		})
+	}
+}
+
+// nonStreamer hides the [ContentStreamer] method of a generator.
+type nonStreamer struct {
+	ContentGenerator
+}
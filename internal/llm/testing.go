@@ -7,8 +7,10 @@ package llm
 import (
 	"context"
 	"fmt"
+	"iter"
 	"math"
 	"strings"
+	"sync"
 )
 
 const quoteLen = 123
@@ -87,6 +89,8 @@ func UnquoteVector(v Vector) string {
 // EchoContentGenerator returns an implementation
 // of [ContentGenerator] that responds to Generate calls
 // with responses trivially derived from the prompt.
+// It also implements [ContentStreamer], streaming
+// the same responses one word at a time.
 //
 // For testing.
 func EchoContentGenerator() ContentGenerator {
@@ -112,6 +116,41 @@ func (echo) GenerateContent(_ context.Context, schema *Schema, promptParts []Par
 	return EchoJSONResponse(promptParts...), nil
 }
 
+// GenerateContentStream streams the response of GenerateContent
+// one word at a time.
+// Implements [ContentStreamer.GenerateContentStream].
+func (e echo) GenerateContentStream(ctx context.Context, schema *Schema, promptParts []Part) iter.Seq2[*Chunk, error] {
+	return streamWords(ctx, e.GenerateContent, schema, promptParts)
+}
+
+// streamWords returns an iterator that calls generateContent
+// and yields the response one word (and its trailing space) at a time.
+// The final chunk reports the number of prompt parts as PromptTokens
+// and the number of chunks as ResponseTokens.
+func streamWords(ctx context.Context, generateContent generateContentFunc, schema *Schema, promptParts []Part) iter.Seq2[*Chunk, error] {
+	return func(yield func(*Chunk, error) bool) {
+		text, err := generateContent(ctx, schema, promptParts)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		words := strings.SplitAfter(text, " ")
+		for i, w := range words {
+			c := &Chunk{Text: w}
+			if i == len(words)-1 {
+				c.Usage = &Usage{
+					PromptTokens:   len(promptParts),
+					ResponseTokens: len(words),
+					TotalTokens:    len(promptParts) + len(words),
+				}
+			}
+			if !yield(c, nil) {
+				return
+			}
+		}
+	}
+}
+
 // EchoTextResponse returns the concatenation of the prompt parts.
 // For testing.
 func EchoTextResponse(promptParts ...Part) string {
@@ -140,6 +179,8 @@ type generateContentFunc func(ctx context.Context, schema *Schema, promptParts [
 
 // TestContentGenerator returns a [ContentGenerator] with the given implementations
 // of [GenerateContent].
+// The result also implements [ContentStreamer], streaming the
+// response of generateContent one word at a time.
 //
 // This is a convenience function for quickly creating custom test implementations
 // of [ContentGenerator].
@@ -147,7 +188,7 @@ func TestContentGenerator(name string, generateContent generateContentFunc) Cont
 	if generateContent == nil {
 		generateContent = echo{}.GenerateContent
 	}
-	return &generator{generateContent: generateContent}
+	return &generator{model: name, generateContent: generateContent}
 }
 
 // generator is a flexible test implementation of [ContentGenerator].
@@ -174,3 +215,106 @@ func (g *generator) GenerateContent(ctx context.Context, schema *Schema, promptP
 	}
 	return g.generateContent(ctx, schema, promptParts)
 }
+
+// GenerateContentStream implements [ContentStreamer.GenerateContentStream].
+func (g *generator) GenerateContentStream(ctx context.Context, schema *Schema, promptParts []Part) iter.Seq2[*Chunk, error] {
+	return streamWords(ctx, g.GenerateContent, schema, promptParts)
+}
+
+// EchoToolCaller returns an implementation of [ToolCaller]
+// that responds deterministically to the last message
+// in the conversation, which is useful for testing tool use.
+//
+// Each line of the form "call NAME ARGS" in the message's
+// text or tool outputs is a request to call the tool NAME,
+// with the JSON arguments ARGS (or {} if ARGS is omitted).
+// If there are such lines, the response contains those calls.
+// Otherwise, the response is the text of the message or,
+// if the message contains tool results, one line "NAME: OUTPUT"
+// or "NAME error: ERROR" for each result.
+//
+// Its GenerateContent method behaves like [EchoContentGenerator]'s.
+//
+// For testing.
+func EchoToolCaller() ToolCaller {
+	return echoTools{}
+}
+
+type echoTools struct {
+	echo
+}
+
+// GenerateMessage implements [ToolCaller.GenerateMessage].
+func (echoTools) GenerateMessage(_ context.Context, _ []*Tool, msgs []*Message) (*Message, error) {
+	if len(msgs) == 0 || msgs[len(msgs)-1].Role != RoleUser {
+		return nil, fmt.Errorf("GenerateMessage: conversation does not end with a user message")
+	}
+	var text, lines []string
+	for _, p := range msgs[len(msgs)-1].Parts {
+		switch p := p.(type) {
+		case Text:
+			text = append(text, string(p))
+			lines = append(lines, strings.Split(string(p), "\n")...)
+		case ToolResult:
+			if p.Error != "" {
+				text = append(text, p.Name+" error: "+p.Error+"\n")
+			} else {
+				text = append(text, p.Name+": "+p.Output+"\n")
+			}
+			lines = append(lines, strings.Split(p.Output, "\n")...)
+		default:
+			return nil, fmt.Errorf("GenerateMessage: unexpected part type %T", p)
+		}
+	}
+	resp := &Message{Role: RoleModel}
+	for _, line := range lines {
+		call, ok := strings.CutPrefix(line, "call ")
+		if !ok {
+			continue
+		}
+		name, args, _ := strings.Cut(call, " ")
+		if args == "" {
+			args = "{}"
+		}
+		resp.Parts = append(resp.Parts, ToolCall{
+			ID:   fmt.Sprintf("call%d.%d", len(msgs), len(resp.Parts)),
+			Name: name,
+			Args: []byte(args),
+		})
+	}
+	if len(resp.Parts) == 0 {
+		resp.Parts = []Part{Text(strings.Join(text, ""))}
+	}
+	return resp, nil
+}
+
+// InjectOutputs returns a [ContentGenerator] that responds to
+// its first len(outputs) requests with outputs, in order,
+// and makes any later requests to g.
+// It is useful for testing how callers handle bad responses,
+// such as JSON that does not conform to the requested schema.
+// The requests answered with outputs are not passed to g.
+//
+// For testing.
+func InjectOutputs(g ContentGenerator, outputs ...string) ContentGenerator {
+	return &injector{ContentGenerator: g, outputs: outputs}
+}
+
+type injector struct {
+	ContentGenerator
+	mu      sync.Mutex
+	outputs []string
+}
+
+// GenerateContent implements [ContentGenerator.GenerateContent].
+func (i *injector) GenerateContent(ctx context.Context, schema *Schema, promptParts []Part) (string, error) {
+	i.mu.Lock()
+	if len(i.outputs) > 0 {
+		out := i.outputs[0]
+		i.outputs = i.outputs[1:]
+		i.mu.Unlock()
+		return out, nil
+	}
+	i.mu.Unlock()
+	return i.ContentGenerator.GenerateContent(ctx, schema, promptParts)
+}
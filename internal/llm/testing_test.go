@@ -7,6 +7,7 @@ package llm
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -52,3 +53,25 @@ func TestEcho(t *testing.T) {
 		t.Errorf("resp  = %q, want %q", resp, want)
 	}
 }
+
+func TestEchoStream(t *testing.T) {
+	ctx := context.Background()
+	gen := EchoContentGenerator()
+	parts := []Part{Text("the quick "), Text("brown fox")}
+	var chunks []string
+	var usage *Usage
+	for c, err := range Stream(ctx, gen, nil, parts) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, c.Text)
+		usage = c.Usage
+	}
+	want := []string{"the ", "quick ", "brown ", "fox"}
+	if !slices.Equal(chunks, want) {
+		t.Errorf("chunks = %q, want %q", chunks, want)
+	}
+	if wantUsage := (Usage{PromptTokens: 2, ResponseTokens: 4, TotalTokens: 6}); usage == nil || *usage != wantUsage {
+		t.Errorf("final usage = %+v, want %+v", usage, wantUsage)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+// blobTokens is the estimated number of tokens in a [Blob].
+// Gemini counts 258 tokens for each (small) image.
+const blobTokens = 258
+
+// EstimateTokens returns a rough estimate of the number of tokens
+// a model would use to represent the text, assuming about
+// four bytes per token. It is useful for budgeting when a
+// model does not report its usage.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// EstimatePartsTokens returns a rough estimate of the number of
+// tokens a model would use to represent the parts.
+// See [EstimateTokens].
+func EstimatePartsTokens(parts []Part) int {
+	n := 0
+	for _, p := range parts {
+		switch p := p.(type) {
+		case Text:
+			n += EstimateTokens(string(p))
+		case Blob:
+			n += blobTokens
+		case ToolCall:
+			n += EstimateTokens(p.Name) + EstimateTokens(string(p.Args))
+		case ToolResult:
+			n += EstimateTokens(p.Name) + EstimateTokens(p.Output) + EstimateTokens(p.Error)
+		}
+	}
+	return n
+}
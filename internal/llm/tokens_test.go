@@ -0,0 +1,33 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+	} {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	parts := []Part{
+		Text("abcdefgh"),
+		Blob{MIMEType: "image/png", Data: make([]byte, 1000)},
+		ToolCall{Name: "f", Args: []byte(`{}`)},
+		ToolResult{Name: "f", Output: "abcd"},
+	}
+	if got, want := EstimatePartsTokens(parts), 2+blobTokens+2+2; got != want {
+		t.Errorf("EstimatePartsTokens = %d, want %d", got, want)
+	}
+}
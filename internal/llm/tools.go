@@ -0,0 +1,156 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A Tool is a function that a model may ask to call
+// while generating a response. See [RunTools].
+type Tool struct {
+	// Name is the name the model uses to call the tool.
+	// It must be a valid identifier.
+	Name string
+	// Description tells the model what the tool does
+	// and when to use it.
+	Description string
+	// Parameters is the schema of the tool's arguments,
+	// which must be of type [TypeObject], or nil if the tool
+	// takes no arguments.
+	Parameters *Schema
+	// Call runs the tool. Its args are the JSON encoding
+	// of an object matching Parameters, as generated by the model.
+	// The result (or the error message) is returned to the model.
+	Call func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// A ToolCall is a [Part] of a model's [Message]
+// requesting a call to a [Tool].
+type ToolCall struct {
+	ID   string          // identifier for the call, if provided by the model
+	Name string          // name of the tool to call
+	Args json.RawMessage // JSON encoding of the arguments object
+}
+
+// A ToolResult is a [Part] of a [Message] reporting
+// the outcome of a [ToolCall] to the model.
+type ToolResult struct {
+	ID     string // identifier of the call (ToolCall.ID)
+	Name   string // name of the tool that was called
+	Output string // the result of the call, if it succeeded
+	Error  string // the error message, if the call failed
+}
+
+func (ToolCall) isPart()   {}
+func (ToolResult) isPart() {}
+
+// A Role identifies the author of a [Message].
+type Role string
+
+const (
+	RoleSystem Role = "system" // instructions for the model; see [GenerateChat]
+	RoleUser   Role = "user"   // prompts and tool results
+	RoleModel  Role = "model"  // responses and tool calls
+)
+
+// A Message is one turn of a conversation with a model.
+type Message struct {
+	Role  Role
+	Parts []Part
+}
+
+// A ToolCaller is a [ContentGenerator] that supports tool calls.
+// Use [RunTools] to generate a response using tools.
+type ToolCaller interface {
+	ContentGenerator
+
+	// GenerateMessage returns the model's next message in the
+	// conversation msgs, which must end with a [RoleUser] message.
+	// The model may use the tools: if it asks to call any,
+	// the returned message contains [ToolCall] parts,
+	// and the caller should run the calls and continue the
+	// conversation with a message containing their [ToolResult]s.
+	// Otherwise the message contains the model's [Text] response.
+	GenerateMessage(ctx context.Context, tools []*Tool, msgs []*Message) (*Message, error)
+}
+
+// ErrTooManyToolCalls is returned (wrapped) by [RunTools]
+// when the model is still calling tools after the maximum number of rounds.
+var ErrTooManyToolCalls = errors.New("too many rounds of tool calls")
+
+// RunTools returns the response of g to the prompt parts,
+// allowing the model to call the tools.
+// It runs a loop in which it sends the conversation so far to the model,
+// runs any tool calls the model requests, and adds the results
+// to the conversation, until the model responds with text
+// instead of tool calls.
+// The model may request multiple calls in each round;
+// after maxRounds rounds of calls, RunTools gives up and
+// returns an error wrapping [ErrTooManyToolCalls].
+//
+// A tool call with an unknown tool name, or one whose Call returns
+// an error, is reported to the model as a [ToolResult] with an Error,
+// so that the model can recover.
+//
+// RunTools also returns the conversation, including the tool calls
+// and results, which is useful for debugging.
+func RunTools(ctx context.Context, g ToolCaller, tools []*Tool, maxRounds int, parts []Part) (string, []*Message, error) {
+	byName := make(map[string]*Tool)
+	for _, t := range tools {
+		byName[t.Name] = t
+	}
+	msgs := []*Message{{Role: RoleUser, Parts: parts}}
+	for round := 0; ; round++ {
+		m, err := g.GenerateMessage(ctx, tools, msgs)
+		if err != nil {
+			return "", msgs, err
+		}
+		msgs = append(msgs, m)
+
+		var text []string
+		var calls []ToolCall
+		for _, p := range m.Parts {
+			switch p := p.(type) {
+			case Text:
+				text = append(text, string(p))
+			case ToolCall:
+				calls = append(calls, p)
+			}
+		}
+		if len(calls) == 0 {
+			return strings.Join(text, ""), msgs, nil
+		}
+		if round >= maxRounds {
+			return "", msgs, fmt.Errorf("llm.RunTools: %w (%d)", ErrTooManyToolCalls, maxRounds)
+		}
+		var results []Part
+		for _, call := range calls {
+			results = append(results, callTool(ctx, byName[call.Name], call))
+		}
+		msgs = append(msgs, &Message{Role: RoleUser, Parts: results})
+	}
+}
+
+// callTool runs the call of t, which is nil if the model
+// asked for a tool that does not exist.
+func callTool(ctx context.Context, t *Tool, call ToolCall) ToolResult {
+	r := ToolResult{ID: call.ID, Name: call.Name}
+	if t == nil {
+		r.Error = fmt.Sprintf("unknown tool %q", call.Name)
+		return r
+	}
+	out, err := t.Call(ctx, call.Args)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Output = out
+	return r
+}
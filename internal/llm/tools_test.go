@@ -0,0 +1,105 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testTools = []*Tool{
+	{
+		Name:        "upper",
+		Description: "converts text to upper case",
+		Parameters: &Schema{
+			Type:       TypeObject,
+			Properties: map[string]*Schema{"text": {Type: TypeString}},
+			Required:   []string{"text"},
+		},
+		Call: func(_ context.Context, args json.RawMessage) (string, error) {
+			var a struct{ Text string }
+			if err := json.Unmarshal(args, &a); err != nil {
+				return "", err
+			}
+			return strings.ToUpper(a.Text), nil
+		},
+	},
+	{
+		Name: "echo",
+		Call: func(_ context.Context, args json.RawMessage) (string, error) {
+			var a struct{ Text string }
+			err := json.Unmarshal(args, &a)
+			return a.Text, err
+		},
+	},
+	{
+		Name: "fail",
+		Call: func(context.Context, json.RawMessage) (string, error) {
+			return "", errors.New("failed")
+		},
+	},
+	{
+		// again asks for another call to itself, forever.
+		Name: "again",
+		Call: func(context.Context, json.RawMessage) (string, error) {
+			return "call again", nil
+		},
+	},
+}
+
+func TestRunTools(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name   string
+		prompt string
+		want   string
+		rounds int // number of rounds of tool calls
+	}{
+		{"none", "hello", "hello", 0},
+		{"one", "call upper {\"text\": \"hello\"}", "upper: HELLO\n", 1},
+		{"two", "call upper {\"text\": \"a\"}\ncall upper {\"text\": \"b\"}", "upper: A\nupper: B\n", 1},
+		{"chain", "call echo {\"text\": \"call upper {\\\"text\\\": \\\"x\\\"}\"}", "upper: X\n", 2},
+		{"error", "call fail", "fail error: failed\n", 1},
+		{"unknown", "call missing", "missing error: unknown tool \"missing\"\n", 1},
+		{"badargs", "call upper [", "upper error: unexpected end of JSON input\n", 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, msgs, err := RunTools(ctx, EchoToolCaller(), testTools, 3, []Part{Text(tt.prompt)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("RunTools(%q) = %q, want %q", tt.prompt, got, tt.want)
+			}
+			// Each round adds a model message and a user message,
+			// and the response adds one more model message.
+			if want := 2 + 2*tt.rounds; len(msgs) != want {
+				t.Errorf("RunTools(%q) conversation has %d messages, want %d", tt.prompt, len(msgs), want)
+			}
+		})
+	}
+}
+
+func TestRunToolsLimit(t *testing.T) {
+	ctx := context.Background()
+	_, msgs, err := RunTools(ctx, EchoToolCaller(), testTools, 3, []Part{Text("call again")})
+	if !errors.Is(err, ErrTooManyToolCalls) {
+		t.Fatalf("RunTools with endless calls = %v, want ErrTooManyToolCalls", err)
+	}
+	calls := 0
+	for _, m := range msgs {
+		for _, p := range m.Parts {
+			if _, ok := p.(ToolResult); ok {
+				calls++
+			}
+		}
+	}
+	if calls != 3 {
+		t.Errorf("RunTools with limit 3 made %d calls", calls)
+	}
+}
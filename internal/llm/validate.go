@@ -0,0 +1,213 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A SchemaError describes one way in which a JSON value
+// does not conform to a [Schema].
+type SchemaError struct {
+	// Path locates the value in the JSON document, as in
+	// "$.related[2].url", where "$" is the whole document.
+	Path string
+	Msg  string
+}
+
+func (e *SchemaError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+// A ValidationError is returned by [ValidateJSON]
+// for a JSON document that does not conform to a [Schema].
+type ValidationError struct {
+	Errors []*SchemaError
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, se := range e.Errors {
+		msgs = append(msgs, se.Error())
+	}
+	return "invalid JSON response: " + strings.Join(msgs, "; ")
+}
+
+// ValidateJSON checks that data is a single JSON value
+// conforming to schema, returning a [*ValidationError]
+// describing all the problems if it does not.
+//
+// It checks the types of values (an integer is a number with no
+// fractional part), that null appears only where the schema is
+// Nullable, that strings with an Enum are one of its values, and
+// that objects have their Required properties. As in OpenAPI,
+// objects may have properties that are not in the schema, and
+// a schema with type [TypeUnspecified] matches any value.
+// A nil schema matches any JSON value.
+func ValidateJSON(schema *Schema, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return &ValidationError{[]*SchemaError{{"$", "malformed JSON: " + err.Error()}}}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return &ValidationError{[]*SchemaError{{"$", "unexpected data after JSON value"}}}
+	}
+	var errs []*SchemaError
+	validate(schema, v, "$", &errs)
+	if len(errs) > 0 {
+		return &ValidationError{errs}
+	}
+	return nil
+}
+
+// validate appends to *errs the ways in which v, a value
+// decoded with [json.Decoder.UseNumber] at the given path,
+// does not conform to s.
+func validate(s *Schema, v any, path string, errs *[]*SchemaError) {
+	if s == nil || s.Type == TypeUnspecified {
+		return
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, &SchemaError{path, fmt.Sprintf(format, args...)})
+	}
+	if v == nil {
+		if !s.Nullable {
+			fail("null is not allowed")
+		}
+		return
+	}
+	switch s.Type {
+	case TypeString:
+		x, ok := v.(string)
+		if !ok {
+			fail("got %s, want string", jsonType(v))
+			return
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, x) {
+			fail("%q is not one of %q", x, s.Enum)
+		}
+	case TypeNumber:
+		if _, ok := v.(json.Number); !ok {
+			fail("got %s, want number", jsonType(v))
+		}
+	case TypeInteger:
+		x, ok := v.(json.Number)
+		if !ok {
+			fail("got %s, want integer", jsonType(v))
+			return
+		}
+		if _, err := strconv.ParseInt(string(x), 10, 64); err != nil {
+			if f, err := x.Float64(); err != nil || f != math.Trunc(f) {
+				fail("%s is not an integer", x)
+			}
+		}
+	case TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			fail("got %s, want boolean", jsonType(v))
+		}
+	case TypeArray:
+		x, ok := v.([]any)
+		if !ok {
+			fail("got %s, want array", jsonType(v))
+			return
+		}
+		for i, e := range x {
+			validate(s.Items, e, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case TypeObject:
+		x, ok := v.(map[string]any)
+		if !ok {
+			fail("got %s, want object", jsonType(v))
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := x[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		// Check properties in a deterministic order.
+		for _, name := range slices.Sorted(maps.Keys(x)) {
+			if ps, ok := s.Properties[name]; ok {
+				validate(ps, x[name], path+"."+name, errs)
+			}
+		}
+	default:
+		fail("unknown schema type %d", s.Type)
+	}
+}
+
+// jsonType returns the name of the JSON type of v,
+// a value decoded with [json.Decoder.UseNumber].
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// GenerateJSON returns the model's response to the prompt parts,
+// which must be JSON conforming to schema (see [ValidateJSON]).
+// If a response does not conform, GenerateJSON asks the model
+// again, showing it its previous response and the problems with it,
+// up to maxRepairs times. If no valid response is generated,
+// GenerateJSON returns an error wrapping the last [*ValidationError].
+func GenerateJSON(ctx context.Context, g ContentGenerator, schema *Schema, parts []Part, maxRepairs int) (string, error) {
+	prompt := parts
+	for try := 0; ; try++ {
+		out, err := g.GenerateContent(ctx, schema, prompt)
+		if err != nil {
+			return "", err
+		}
+		err = ValidateJSON(schema, []byte(out))
+		if err == nil {
+			return out, nil
+		}
+		if try >= maxRepairs {
+			return "", fmt.Errorf("llm.GenerateJSON: %w (after %d attempts)", err, try+1)
+		}
+		prompt = repairPrompt(parts, out, err)
+	}
+}
+
+// repairPrompt returns the prompt asking a model to correct
+// its response out to the original prompt parts,
+// which failed validation with err.
+func repairPrompt(parts []Part, out string, err error) []Part {
+	var msgs []string
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		for _, se := range ve.Errors {
+			msgs = append(msgs, "- "+se.Error())
+		}
+	}
+	return append(slices.Clip(parts),
+		Text("Your previous response to the above was:\n\n"+out),
+		Text("That response does not conform to the required JSON schema:\n\n"+strings.Join(msgs, "\n")+
+			"\n\nRespond again with only corrected JSON that conforms to the schema."),
+	)
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"name":  {Type: TypeString},
+		"kind":  {Type: TypeString, Enum: []string{"bug", "feature"}},
+		"count": {Type: TypeInteger},
+		"score": {Type: TypeNumber, Nullable: true},
+		"ok":    {Type: TypeBoolean},
+		"items": {
+			Type: TypeArray,
+			Items: &Schema{
+				Type:       TypeObject,
+				Properties: map[string]*Schema{"url": {Type: TypeString}},
+				Required:   []string{"url"},
+			},
+		},
+		"any": {},
+	},
+	Required: []string{"name", "kind"},
+}
+
+func TestValidateJSON(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string // errors, as "path: msg"
+	}{
+		{`{"name":"x","kind":"bug"}`, nil},
+		{`{"name":"x","kind":"bug","count":3,"score":1.5,"ok":true,"items":[{"url":"u"}],"any":[1,"a"],"extra":1}`, nil},
+		{`{"name":"x","kind":"bug","count":3.0,"score":null}`, nil},
+		{`{"name":"x"}`, []string{`$: missing required property "kind"`}},
+		{`{"name":1,"kind":"other"}`, []string{
+			`$.kind: "other" is not one of ["bug" "feature"]`,
+			`$.name: got number, want string`,
+		}},
+		{`{"name":null,"kind":"bug","count":1.5,"ok":"yes"}`, []string{
+			`$.count: 1.5 is not an integer`,
+			`$.name: null is not allowed`,
+			`$.ok: got string, want boolean`,
+		}},
+		{`{"name":"x","kind":"bug","items":[{"url":"u"},{},{"url":false}]}`, []string{
+			`$.items[1]: missing required property "url"`,
+			`$.items[2].url: got boolean, want string`,
+		}},
+		{`{"name":"x","kind":"bug","items":{}}`, []string{`$.items: got object, want array`}},
+		{`[]`, []string{`$: got array, want object`}},
+		{`{"name":"x",`, []string{`$: malformed JSON: unexpected EOF`}},
+		{`{"name":"x","kind":"bug"} {}`, []string{`$: unexpected data after JSON value`}},
+		{"```json\n{}\n```", []string{"$: malformed JSON: invalid character '`' looking for beginning of value"}},
+	} {
+		err := ValidateJSON(testSchema, []byte(tt.in))
+		var got []string
+		if err != nil {
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("ValidateJSON(%s) = %T, want *ValidationError", tt.in, err)
+			}
+			for _, se := range ve.Errors {
+				got = append(got, se.Error())
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ValidateJSON(%s):\nhave %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+
+	if err := ValidateJSON(nil, []byte(`"anything"`)); err != nil {
+		t.Errorf("ValidateJSON(nil schema) = %v", err)
+	}
+}
+
+func TestGenerateJSON(t *testing.T) {
+	ctx := context.Background()
+	valid := `{"name":"x","kind":"bug"}`
+	var prompts [][]Part
+	g := InjectOutputs(
+		TestContentGenerator("test", func(_ context.Context, _ *Schema, parts []Part) (string, error) {
+			prompts = append(prompts, parts)
+			return valid, nil
+		}),
+		`{"name":"x"}`, `not json`)
+	prompt := []Part{Text("describe x")}
+
+	// Two invalid responses, then a valid one.
+	out, err := GenerateJSON(ctx, g, testSchema, prompt, 2)
+	if err != nil || out != valid {
+		t.Fatalf("GenerateJSON = %q, %v, want %q", out, err, valid)
+	}
+	// The repair prompt shows the previous response and its problems.
+	if len(prompts) != 1 {
+		t.Fatalf("underlying generator called %d times, want 1", len(prompts))
+	}
+	repair := EchoTextResponse(prompts[0]...)
+	for _, want := range []string{"describe x", "not json", "$: malformed JSON"} {
+		if !strings.Contains(repair, want) {
+			t.Errorf("repair prompt does not contain %q:\n%s", want, repair)
+		}
+	}
+
+	// Too many invalid responses.
+	g = InjectOutputs(EchoContentGenerator(), `{}`, `{}`)
+	_, err = GenerateJSON(ctx, g, testSchema, prompt, 1)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Errors) != 2 {
+		t.Errorf("GenerateJSON after 2 invalid responses = %v, want *ValidationError with 2 errors", err)
+	}
+}
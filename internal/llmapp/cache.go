@@ -18,9 +18,10 @@ import (
 //
 // The llmapp cache stores the following database entries:
 //
-//   - ("llmapp.GenerateText", model, SHA-256(schema, prompts)) -> [responseGenerateContent]
-//     where model is the name of the generative model used to generate responses, schema is
-//     the input schema to the model, and prompts are the input prompts.
+//   - ("llmapp.GenerateText", model, SHA-256(schema, prompts[, tools])) -> [responseGenerateContent]
+//     where model is the name of the generative model that generated the response, schema is
+//     the input schema to the model, prompts are the input prompts, and tools are the
+//     declarations of the tools the model may call, if any (see [Client.SetTools]).
 //
 //   - ("llmapp.CheckPolicy", checker, SHA-256(policies, input, prompts)) -> [responseCheckText]
 //     where checker is the name of the policy checker used to check LLM inputs/outputs,
@@ -50,12 +51,17 @@ func load[R any](c *Client, key []byte) *R {
 
 // responseGenerateContent is a cached response to an [llm.ContentGenerator.GenerateContent] query.
 type responseGenerateContent struct {
-	// The generative model used to generate the response.
+	// The generative model that generated the response,
+	// as reported by [llm.ReportModel] if it differs from
+	// the client's model.
 	Model string
 	// The SHA-256 hash of the schema and prompts used to generate the response.
 	PromptHash []byte
 	// The raw generated response.
 	Response string
+	// The outputs of the tools called while generating the response,
+	// which the LLM read as additional input.
+	ToolResults []string
 }
 
 // keyAndHashGenerateContent returns the database key and input hash (hash of schema and parts)
@@ -64,6 +70,9 @@ func (c *Client) keyAndHashGenerateContent(schema *llm.Schema, parts []llm.Part)
 	h := sha256.New()
 	writeObjectToHash(h, schema)
 	c.writePromptsToHash(h, parts)
+	if _, tools := c.toolCaller(schema); tools != nil {
+		writeObjectToHash(h, toolDecls(tools))
+	}
 	hash = h.Sum(nil)
 	key = ordered.Encode(generateKind, c.g.Model(), hash)
 	return key, hash
@@ -0,0 +1,250 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmapp
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+// chatKind is the database key context for chat sessions.
+// A chat is stored as ("llmapp.Chat", id) -> [Chat].
+const chatKind = "llmapp.Chat"
+
+// DefaultChatTokens is the default token budget of a [Chat].
+const DefaultChatTokens = 100_000
+
+// A Chat is a multi-turn conversation with the LLM, grounded
+// in a set of documents.
+// Chats are stored in the Client's database, so that a conversation
+// can be continued later (for example, by a later HTTP request).
+//
+// Create a Chat with [Client.NewChat] and continue it with [Chat.Ask].
+type Chat struct {
+	ID      string    // unique identifier, for [Client.LoadChat]
+	System  string    // (optional) instructions for the LLM
+	Docs    []*Doc    // documents the conversation is about
+	Turns   []*Turn   // the conversation so far
+	Created time.Time // when the chat was created
+
+	// TokenBudget is the (estimated) maximum number of tokens
+	// to send to the LLM when generating a response.
+	// When the conversation grows beyond the budget, the oldest
+	// turns are left out of the prompt (but not the system
+	// instructions, the documents, or the latest question).
+	// If zero, [DefaultChatTokens] is used.
+	TokenBudget int
+
+	c *Client
+}
+
+// A Turn is a single message in a [Chat].
+type Turn struct {
+	Role llm.Role // [llm.RoleUser] or [llm.RoleModel]
+	Text string
+	Time time.Time
+
+	// Violations lists the policies violated by the question
+	// or by the answer, as found by the Client's policy checker.
+	// It is set only in answers.
+	Violations []string
+}
+
+// NewChat creates and stores a new chat with the given
+// system instructions and grounding documents.
+func (c *Client) NewChat(system string, docs []*Doc) *Chat {
+	ch := &Chat{
+		ID:      newChatID(),
+		System:  system,
+		Docs:    docs,
+		Created: time.Now(),
+		c:       c,
+	}
+	ch.save()
+	return ch
+}
+
+// newChatID returns a new random chat ID.
+func newChatID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// LoadChat returns the chat with the given ID.
+// It returns (nil, false) if there is no such chat.
+func (c *Client) LoadChat(id string) (*Chat, bool) {
+	ch := load[Chat](c, chatKey(id))
+	if ch == nil {
+		return nil, false
+	}
+	ch.c = c
+	return ch, true
+}
+
+// DeleteChat deletes the chat with the given ID, if it exists.
+func (c *Client) DeleteChat(id string) {
+	c.db.Delete(chatKey(id))
+}
+
+// chatKey returns the database key of the chat with the given ID.
+func chatKey(id string) []byte {
+	return ordered.Encode(chatKind, id)
+}
+
+// save stores the chat in the database.
+func (ch *Chat) save() {
+	ch.c.db.Set(chatKey(ch.ID), storage.JSON(ch))
+}
+
+// Ask adds the question to the chat, generates the LLM's answer,
+// adds the answer to the chat, and returns it.
+// The updated chat is stored in the database.
+//
+// If the Client has a policy checker (see [NewWithChecker]),
+// Ask checks the question and answer against its policies;
+// the result's PolicyEvaluation reports the violations,
+// which are also recorded in the answer's [Turn].
+//
+// The answer is generated from the stored chat as Ask finds it.
+// Any turns added by concurrent calls for the same chat while
+// the LLM is answering are kept, followed by this question and answer.
+// If the LLM fails to answer, the chat is unchanged.
+// Unlike other Client methods, Ask does not cache its responses.
+func (ch *Chat) Ask(ctx context.Context, question string) (*Result, error) {
+	if strings.TrimSpace(question) == "" {
+		return nil, errors.New("llmapp Chat.Ask: empty question")
+	}
+	c := ch.c
+	if latest, ok := c.LoadChat(ch.ID); ok {
+		*ch = *latest
+	}
+	q := &Turn{Role: llm.RoleUser, Text: question, Time: time.Now()}
+	msgs, dropped := chatMessages(ch, append(slices.Clip(ch.Turns), q))
+	if dropped > 0 {
+		c.slog.Debug("llmapp: chat history truncated", "chat", ch.ID, "dropped_turns", dropped)
+	}
+	answer, err := llm.GenerateChat(ctx, c.g, msgs)
+	if err != nil {
+		return nil, fmt.Errorf("llmapp Chat.Ask: %w", err)
+	}
+	prompt := []llm.Part{llm.Text(question)}
+	pe := c.EvaluatePolicy(ctx, prompt, answer)
+	a := &Turn{Role: llm.RoleModel, Text: answer, Time: time.Now(), Violations: pe.violations()}
+
+	// Hold the lock only while merging the new turns
+	// into the stored chat, not while the LLM answers.
+	k := string(chatKey(ch.ID))
+	c.db.Lock(k)
+	defer c.db.Unlock(k)
+	latest, ok := c.LoadChat(ch.ID)
+	if !ok {
+		return nil, fmt.Errorf("llmapp Chat.Ask: chat %s was deleted", ch.ID)
+	}
+	*ch = *latest
+	ch.Turns = append(ch.Turns, q, a)
+	ch.save()
+	return &Result{
+		Response:         answer,
+		Prompt:           prompt,
+		PolicyEvaluation: pe,
+	}, nil
+}
+
+// lastUsed returns the time of the latest turn of the chat,
+// or the time it was created if it has no turns.
+func (ch *Chat) lastUsed() time.Time {
+	if len(ch.Turns) == 0 {
+		return ch.Created
+	}
+	return ch.Turns[len(ch.Turns)-1].Time
+}
+
+// ExpireChats deletes the chats that have not been used since
+// before the given time, returning the number deleted.
+// A chat is used when it is created and when a question is asked.
+func (c *Client) ExpireChats(before time.Time) int {
+	var expired [][]byte
+	for key, val := range c.db.Scan(ordered.Encode(chatKind), ordered.Encode(chatKind, ordered.Inf)) {
+		var ch Chat
+		if err := json.Unmarshal(val(), &ch); err != nil {
+			// unreachable except data corruption
+			c.db.Panic("llmapp ExpireChats: cannot unmarshal chat", "key", storage.Fmt(key), "err", err)
+		}
+		if ch.lastUsed().Before(before) {
+			expired = append(expired, bytes.Clone(key))
+		}
+	}
+	b := c.db.Batch()
+	for _, key := range expired {
+		b.Delete(key)
+		b.MaybeApply()
+	}
+	b.Apply()
+	return len(expired)
+}
+
+// chatMessages returns the messages to send to the LLM to continue
+// the chat ch with the given turns, the last of which is a question,
+// and the number of turns left out to stay within the chat's token budget.
+//
+// The messages are the system instructions, if any, followed by
+// the most recent turns that fit in the budget, starting with a
+// user turn. The documents are given to the LLM along with the
+// first of those turns.
+func chatMessages(ch *Chat, turns []*Turn) (_ []*llm.Message, dropped int) {
+	var msgs []*llm.Message
+	used := 0
+	if ch.System != "" {
+		msgs = append(msgs, &llm.Message{Role: llm.RoleSystem, Parts: []llm.Part{llm.Text(ch.System)}})
+		used += llm.EstimateTokens(ch.System)
+	}
+	var docs []llm.Part
+	if len(ch.Docs) > 0 {
+		docs = append(docs, llm.Text("documents"))
+		for _, d := range ch.Docs {
+			docs = append(docs, llm.Text(storage.JSON(d)))
+		}
+		for _, p := range docs {
+			used += llm.EstimateTokens(string(p.(llm.Text)))
+		}
+	}
+
+	// Keep the latest turn, and as many earlier turns as fit.
+	budget := cmp.Or(ch.TokenBudget, DefaultChatTokens)
+	start := len(turns) - 1
+	used += llm.EstimateTokens(turns[start].Text)
+	for start > 0 && used+llm.EstimateTokens(turns[start-1].Text) <= budget {
+		start--
+		used += llm.EstimateTokens(turns[start].Text)
+	}
+	// The conversation must start with a question.
+	for turns[start].Role != llm.RoleUser {
+		start++
+	}
+
+	for i, t := range turns[start:] {
+		m := &llm.Message{Role: t.Role}
+		if i == 0 {
+			m.Parts = append(m.Parts, docs...)
+		}
+		m.Parts = append(m.Parts, llm.Text(t.Text))
+		msgs = append(msgs, m)
+	}
+	return msgs, start
+}
@@ -0,0 +1,276 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestChat(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+
+	// The generator reports the conversation it was given.
+	var got []*llm.Message
+	g := &messageRecorder{ContentGenerator: llm.EchoContentGenerator(), msgs: &got}
+	c := New(lg, g, db)
+
+	doc := &Doc{Type: "issue", URL: "https://example.com/1", Text: "the issue"}
+	ch := c.NewChat("be helpful", []*Doc{doc})
+	if _, err := ch.Ask(ctx, "first?"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reloaded chat continues the conversation.
+	ch2, ok := c.LoadChat(ch.ID)
+	if !ok {
+		t.Fatalf("LoadChat(%q) failed", ch.ID)
+	}
+	r, err := ch2.Ask(ctx, "second?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Response != "answer 2" || r.PolicyEvaluation != nil {
+		t.Errorf("Ask = %q, %v, want %q, nil", r.Response, r.PolicyEvaluation, "answer 2")
+	}
+	want := []string{
+		"system: be helpful",
+		`user: documents|{"type":"issue","url":"https://example.com/1","text":"the issue"}|first?`,
+		"model: answer 1",
+		"user: second?",
+	}
+	if s := messageStrings(got); !slices.Equal(s, want) {
+		t.Errorf("messages:\nhave %q\nwant %q", s, want)
+	}
+
+	// The original Chat sees the turns added through ch2.
+	if _, err := ch.Ask(ctx, "third?"); err != nil {
+		t.Fatal(err)
+	}
+	ch3, _ := c.LoadChat(ch.ID)
+	var turns []string
+	for _, t := range ch3.Turns {
+		turns = append(turns, fmt.Sprintf("%s: %s", t.Role, t.Text))
+	}
+	want = []string{"user: first?", "model: answer 1", "user: second?", "model: answer 2", "user: third?", "model: answer 3"}
+	if !slices.Equal(turns, want) {
+		t.Errorf("turns:\nhave %q\nwant %q", turns, want)
+	}
+
+	// Failures leave the chat unchanged.
+	g.err = errors.New("boom")
+	if _, err := ch.Ask(ctx, "fourth?"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Ask with failing LLM = %v, want boom", err)
+	}
+	if ch4, _ := c.LoadChat(ch.ID); len(ch4.Turns) != 6 {
+		t.Errorf("failed Ask changed chat to %d turns, want 6", len(ch4.Turns))
+	}
+	if _, err := ch.Ask(ctx, " "); err == nil {
+		t.Errorf("Ask with empty question succeeded")
+	}
+
+	c.DeleteChat(ch.ID)
+	if _, ok := c.LoadChat(ch.ID); ok {
+		t.Errorf("LoadChat after DeleteChat succeeded")
+	}
+}
+
+func TestChatMerge(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+
+	var got []*llm.Message
+	g := &messageRecorder{ContentGenerator: llm.EchoContentGenerator(), msgs: &got}
+	c := New(lg, g, db)
+	ch := c.NewChat("", nil)
+
+	// Another question is answered while the LLM answers this one.
+	g.during = func() {
+		g.during = nil
+		other, _ := c.LoadChat(ch.ID)
+		if _, err := other.Ask(ctx, "other?"); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := ch.Ask(ctx, "first?"); err != nil {
+		t.Fatal(err)
+	}
+	var turns []string
+	for _, t := range ch.Turns {
+		turns = append(turns, fmt.Sprintf("%s: %s", t.Role, t.Text))
+	}
+	want := []string{"user: other?", "model: answer 1", "user: first?", "model: answer 1"}
+	if !slices.Equal(turns, want) {
+		t.Errorf("turns:\nhave %q\nwant %q", turns, want)
+	}
+
+	// Asking about a chat deleted during generation fails.
+	g.during = func() { c.DeleteChat(ch.ID) }
+	if _, err := ch.Ask(ctx, "second?"); err == nil || !strings.Contains(err.Error(), "deleted") {
+		t.Errorf("Ask on deleted chat = %v, want deleted error", err)
+	}
+	if _, ok := c.LoadChat(ch.ID); ok {
+		t.Errorf("Ask recreated deleted chat")
+	}
+}
+
+func TestChatPolicy(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+
+	var got []*llm.Message
+	g := &messageRecorder{ContentGenerator: llm.EchoContentGenerator(), msgs: &got}
+	c := NewWithChecker(lg, g, badChecker{}, storage.MemDB())
+	ch := c.NewChat("", nil)
+
+	r, err := ch.Ask(ctx, "good?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.PolicyEvaluation == nil || r.PolicyEvaluation.Violative {
+		t.Errorf("Ask(good) PolicyEvaluation = %v, want non-violative", r.PolicyEvaluation)
+	}
+	r, err = ch.Ask(ctx, "bad?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.PolicyEvaluation == nil || !r.PolicyEvaluation.Violative {
+		t.Errorf("Ask(bad) PolicyEvaluation = %v, want violative", r.PolicyEvaluation)
+	}
+	saved, _ := c.LoadChat(ch.ID)
+	if vs := saved.Turns[1].Violations; len(vs) != 0 {
+		t.Errorf("good answer Violations = %q, want none", vs)
+	}
+	want := []string{violationResult.String()}
+	if vs := saved.Turns[3].Violations; !slices.Equal(vs, want) {
+		t.Errorf("bad answer Violations = %q, want %q", vs, want)
+	}
+}
+
+func TestExpireChats(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+
+	var got []*llm.Message
+	g := &messageRecorder{ContentGenerator: llm.EchoContentGenerator(), msgs: &got}
+	c := New(lg, g, storage.MemDB())
+	old := c.NewChat("", nil)
+	used := c.NewChat("", nil)
+	fresh := c.NewChat("", nil)
+
+	// Backdate two chats; one of them is used afterward.
+	now := time.Now()
+	for _, ch := range []*Chat{old, used} {
+		ch.Created = now.Add(-48 * time.Hour)
+		ch.save()
+	}
+	if _, err := used.Ask(ctx, "still here?"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.ExpireChats(now.Add(-24 * time.Hour)); n != 1 {
+		t.Errorf("ExpireChats = %d, want 1", n)
+	}
+	if _, ok := c.LoadChat(old.ID); ok {
+		t.Errorf("old chat not expired")
+	}
+	for _, ch := range []*Chat{used, fresh} {
+		if _, ok := c.LoadChat(ch.ID); !ok {
+			t.Errorf("chat %s expired, want kept", ch.ID)
+		}
+	}
+}
+
+func TestChatMessagesTruncate(t *testing.T) {
+	ch := &Chat{
+		System:      strings.Repeat("s", 40), // 10 tokens
+		Docs:        []*Doc{{Text: "d"}},     // "documents" and {"text":"d"}: 3+3 tokens
+		TokenBudget: 30,
+	}
+	var turns []*Turn
+	for i := range 5 {
+		role := llm.RoleUser
+		if i%2 == 1 {
+			role = llm.RoleModel
+		}
+		turns = append(turns, &Turn{Role: role, Text: fmt.Sprintf("%d%s", i, strings.Repeat("x", 11))}) // 3 tokens
+	}
+
+	// 16 tokens of grounding leaves room for 4 turns,
+	// but the conversation must start with a user turn.
+	msgs, dropped := chatMessages(ch, turns)
+	if dropped != 2 {
+		t.Errorf("dropped = %d, want 2", dropped)
+	}
+	want := []string{
+		"system: " + ch.System,
+		`user: documents|{"text":"d"}|2xxxxxxxxxxx`,
+		"model: 3xxxxxxxxxxx",
+		"user: 4xxxxxxxxxxx",
+	}
+	if s := messageStrings(msgs); !slices.Equal(s, want) {
+		t.Errorf("messages:\nhave %q\nwant %q", s, want)
+	}
+
+	// The latest question is kept even if it is over budget.
+	ch.TokenBudget = 1
+	msgs, dropped = chatMessages(ch, turns)
+	if dropped != 4 || len(msgs) != 2 {
+		t.Errorf("over budget: dropped = %d, len(msgs) = %d, want 4, 2", dropped, len(msgs))
+	}
+}
+
+// messageStrings returns a string "ROLE: PART1|PART2..." for each
+// of the messages, which must contain only text.
+func messageStrings(msgs []*llm.Message) []string {
+	var s []string
+	for _, m := range msgs {
+		var parts []string
+		for _, p := range m.Parts {
+			parts = append(parts, string(p.(llm.Text)))
+		}
+		s = append(s, fmt.Sprintf("%s: %s", m.Role, strings.Join(parts, "|")))
+	}
+	return s
+}
+
+// A messageRecorder is an [llm.ToolCaller] that records the
+// conversation it is given and answers with "answer N",
+// where N is the number of user messages.
+type messageRecorder struct {
+	llm.ContentGenerator
+	msgs   *[]*llm.Message
+	err    error
+	during func() // if non-nil, called while generating
+}
+
+func (r *messageRecorder) GenerateMessage(_ context.Context, _ []*llm.Tool, msgs []*llm.Message) (*llm.Message, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.during != nil {
+		r.during()
+	}
+	*r.msgs = msgs
+	n := 0
+	for _, m := range msgs {
+		if m.Role == llm.RoleUser {
+			n++
+		}
+	}
+	return &llm.Message{Role: llm.RoleModel, Parts: []llm.Part{llm.Text(fmt.Sprintf("answer %d", n))}}, nil
+}
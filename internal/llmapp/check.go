@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/storage"
@@ -54,6 +55,21 @@ func (c *Client) EvaluatePolicy(ctx context.Context, prompts []llm.Part, output
 	return pe
 }
 
+// violations returns the violations found by the evaluation pe,
+// which may be nil, as strings.
+func (pe *PolicyEvaluation) violations() []string {
+	if pe == nil || !pe.Violative {
+		return nil
+	}
+	var vs []string
+	for _, r := range append(slices.Clip(pe.PromptResults), pe.OutputResults) {
+		if r != nil {
+			vs = append(vs, toStrings(r.Violations)...)
+		}
+	}
+	return vs
+}
+
 // checkPolicy invokes the policy checker on the given text (with optional prompts)
 // and returns its (possibly cached) results.
 func (c *Client) checkPolicy(ctx context.Context, text string, prompts []llm.Part) *PolicyResult {
@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/oscar/internal/docs"
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/storage"
 	"golang.org/x/oscar/internal/testutil"
@@ -255,3 +256,29 @@ func (c *cacheChecker) CheckText(context.Context, string, ...llm.Part) ([]*llm.P
 	}
 	return []*llm.PolicyResult{violationResult}, nil
 }
+
+func TestWithCheckerTools(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	dc := docs.New(lg, db)
+	dc.Add("https://example.com/1", "one", "some bad text")
+	c := NewWithChecker(lg, llm.EchoToolCaller(), badChecker{}, db)
+	c.SetTools(DocLookupTool(dc))
+
+	// The document looked up by the LLM is checked like the prompt.
+	group := &docGroup{
+		label: `call lookup_document {"url": "https://example.com/1"}`,
+		docs:  []*Doc{{Text: "some good text"}},
+	}
+	for range 2 { // second time from cache
+		r, err := c.overview(context.Background(), documents, group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prs := r.PolicyEvaluation.PromptResults
+		// label, doc, instructions, tool result
+		if len(prs) != 4 || len(prs[3].Violations) == 0 || !strings.Contains(prs[3].Text, "some bad text") {
+			t.Errorf("c.Overview.PolicyEvaluation.PromptResults = %v, want violation in tool result", r.PolicyEvaluation)
+		}
+	}
+}
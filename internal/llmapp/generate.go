@@ -6,13 +6,17 @@ package llmapp
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
 )
 
-// generate returns a (possibly cached) response for the prompts.
-func (c *Client) generate(ctx context.Context, schema *llm.Schema, prompts []llm.Part) (string, bool, error) {
+// generate returns a (possibly cached) response for the prompts,
+// along with the outputs of any tools the LLM called (see [Client.SetTools]).
+func (c *Client) generate(ctx context.Context, schema *llm.Schema, prompts []llm.Part) (*responseGenerateContent, bool, error) {
 	k, h := c.keyAndHashGenerateContent(schema, prompts)
 	c.db.Lock(string(k))
 	defer c.db.Unlock(string(k))
@@ -20,19 +24,88 @@ func (c *Client) generate(ctx context.Context, schema *llm.Schema, prompts []llm
 	r := load[responseGenerateContent](c, k)
 	if r != nil {
 		// cache hit
-		return r.Response, true, nil
+		return r, true, nil
 	}
 
 	// cache miss
-	result, err := c.g.GenerateContent(ctx, schema, prompts)
+	var model string
+	ctx = llm.WithModelReporter(ctx, func(m string) {
+		if model == "" {
+			model = m
+		}
+	})
+	result, toolResults, err := c.generateContent(ctx, schema, prompts)
 	if err != nil {
-		return "", false, err
+		return nil, false, err
 	}
 
-	c.db.Set(k, storage.JSON(responseGenerateContent{
-		Model:      c.g.Model(),
-		PromptHash: h,
-		Response:   result,
-	}))
-	return result, false, nil
+	// A response from a model other than the client's own, such as
+	// a fallback, is cached under that model's name, so that it is
+	// not returned in place of a response from the client's model.
+	if model != "" && model != c.g.Model() {
+		c.slog.Info("llmapp: response generated by another model", "model", c.g.Model(), "answered_by", model)
+		k = ordered.Encode(generateKind, model, h)
+	} else {
+		model = c.g.Model()
+	}
+	r = &responseGenerateContent{
+		Model:       model,
+		PromptHash:  h,
+		Response:    result,
+		ToolResults: toolResults,
+	}
+	c.db.Set(k, storage.JSON(r))
+	return r, false, nil
+}
+
+// maxJSONRepairs is the maximum number of times to ask the LLM
+// to correct a JSON response that does not conform to its schema.
+const maxJSONRepairs = 2
+
+// generateContent returns the response for the prompts.
+// If tools are in use (see [Client.SetTools]), the model may call them,
+// and generateContent also returns the outputs of the calls.
+// Otherwise, the response is streamed to the context's
+// stream function (see [WithStream]), if any; a stream that ends
+// without its final chunk (see [llm.Chunk]) is an error.
+// JSON responses that do not conform to the schema are repaired
+// (see [llm.GenerateJSON]) or rejected, so that they are not cached.
+func (c *Client) generateContent(ctx context.Context, schema *llm.Schema, prompts []llm.Part) (string, []string, error) {
+	if tc, tools := c.toolCaller(schema); tc != nil {
+		text, msgs, err := llm.RunTools(ctx, tc, tools, maxToolRounds, prompts)
+		if err != nil {
+			return "", nil, err
+		}
+		return text, toolOutputs(msgs), nil
+	}
+	if schema != nil {
+		text, err := llm.GenerateJSON(ctx, c.g, schema, prompts, maxJSONRepairs)
+		return text, nil, err
+	}
+	stream := streamFunc(ctx)
+	if stream == nil {
+		text, err := c.g.GenerateContent(ctx, schema, prompts)
+		return text, nil, err
+	}
+	var b strings.Builder
+	complete := false
+	for chunk, err := range llm.Stream(ctx, c.g, schema, prompts) {
+		if err != nil {
+			// Discard the partial response, so that it is not cached.
+			return "", nil, err
+		}
+		b.WriteString(chunk.Text)
+		stream(chunk.Text)
+		if u := chunk.Usage; u != nil {
+			complete = true
+			c.slog.Debug("llmapp: streamed response", "model", c.g.Model(),
+				"prompt_tokens", u.PromptTokens, "response_tokens", u.ResponseTokens, "total_tokens", u.TotalTokens)
+		}
+	}
+	if !complete {
+		// The stream stopped without its final chunk,
+		// so the response may be truncated: do not cache it.
+		return "", nil, fmt.Errorf("llmapp: response stream from %s ended before its final chunk", c.g.Model())
+	}
+	return b.String(), nil, nil
 }
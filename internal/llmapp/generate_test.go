@@ -0,0 +1,51 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmapp
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+func TestGenerateReportedModel(t *testing.T) {
+	ctx := context.Background()
+	// The first response comes from a fallback model.
+	calls := 0
+	g := llm.TestContentGenerator("primary", func(ctx context.Context, _ *llm.Schema, parts []llm.Part) (string, error) {
+		if calls++; calls == 1 {
+			llm.ReportModel(ctx, "fallback")
+		}
+		return llm.EchoTextResponse(parts...), nil
+	})
+	db := storage.MemDB()
+	c := New(testutil.Slogger(t), g, db)
+
+	for _, want := range []struct {
+		cached bool
+		model  string
+	}{
+		{false, "fallback"},
+		{false, "primary"}, // not answered from the fallback's response
+		{true, "primary"},
+	} {
+		r, err := c.Overview(ctx, doc1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Cached != want.cached {
+			t.Errorf("Overview: Cached = %v, want %v", r.Cached, want.cached)
+		}
+		_, h := c.keyAndHashGenerateContent(nil, r.Prompt)
+		cr := load[responseGenerateContent](c, ordered.Encode(generateKind, want.model, h))
+		if cr == nil || cr.Model != want.model {
+			t.Errorf("no cached response from %s: %+v", want.model, cr)
+		}
+	}
+}
@@ -16,6 +16,10 @@
 //
 // We can, however, easily delete ALL cache values and start over by deleting
 // all database entries starting with "llmapp.GenerateText".
+//
+// Chat sessions (see [Client.NewChat]) are stored as:
+//
+//	("llmapp.Chat", id) -> [Chat]
 package llmapp
 
 import (
@@ -24,6 +28,7 @@ import (
 	_ "embed"
 	"errors"
 	"log/slog"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -36,7 +41,8 @@ type Client struct {
 	slog    *slog.Logger
 	g       llm.ContentGenerator
 	checker llm.PolicyChecker
-	db      storage.DB // cache for LLM responses
+	db      storage.DB  // cache for LLM responses
+	tools   []*llm.Tool // tools the LLM may call; see SetTools
 }
 
 // New returns a new client.
@@ -46,6 +52,15 @@ func New(lg *slog.Logger, g llm.ContentGenerator, db storage.DB) *Client {
 	return NewWithChecker(lg, g, nil, db)
 }
 
+// WithGenerator returns a copy of c that uses g as its
+// LLM content generator. The copy shares c's policy checker,
+// tools and cache.
+func (c *Client) WithGenerator(g llm.ContentGenerator) *Client {
+	c2 := *c
+	c2.g = g
+	return &c2
+}
+
 // Overview returns an LLM-generated overview of the given documents,
 // styled with markdown.
 // Overview returns an error if no documents are provided or the LLM is unable
@@ -97,16 +112,22 @@ func (c *Client) overview(ctx context.Context, kind docsKind, groups ...*docGrou
 	}
 	prompt := prompt(kind, groups)
 	schema := kind.schema()
-	overview, cached, err := c.generate(ctx, schema, prompt)
+	r, cached, err := c.generate(ctx, schema, prompt)
 	if err != nil {
 		return nil, err
 	}
+	// The outputs of any tools the LLM called are also inputs,
+	// so check them along with the prompt.
+	checked := slices.Clip(prompt)
+	for _, out := range r.ToolResults {
+		checked = append(checked, llm.Text(out))
+	}
 	return &Result{
-		Response:         overview,
+		Response:         r.Response,
 		Cached:           cached,
 		Schema:           schema,
 		Prompt:           prompt,
-		PolicyEvaluation: c.EvaluatePolicy(ctx, prompt, overview),
+		PolicyEvaluation: c.EvaluatePolicy(ctx, checked, r.Response),
 	}, nil
 }
 
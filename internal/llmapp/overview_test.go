@@ -91,10 +91,11 @@ func TestGenerate(t *testing.T) {
 	t.Run("echo", func(t *testing.T) {
 		c := New(lg, llm.EchoContentGenerator(), db)
 		prompt := []llm.Part{llm.Text("a"), llm.Text("b"), llm.Text("c")}
-		got, cached, err := c.generate(ctx, nil, prompt)
+		r, cached, err := c.generate(ctx, nil, prompt)
 		if err != nil {
 			t.Fatal(err)
 		}
+		got := r.Response
 		want := llm.EchoTextResponse(llm.Text("a"), llm.Text("b"), llm.Text("c"))
 		if got != want {
 			t.Errorf("generate() = %q, want %q", got, want)
@@ -104,11 +105,11 @@ func TestGenerate(t *testing.T) {
 		}
 
 		// The result should be cached on the second call.
-		got, cached, err = c.generate(ctx, nil, prompt)
+		r, cached, err = c.generate(ctx, nil, prompt)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got != want {
+		if got := r.Response; got != want {
 			t.Errorf("generate() = %q, want %q", got, want)
 		}
 		if !cached {
@@ -121,7 +122,7 @@ func TestGenerate(t *testing.T) {
 	t.Run("random", func(t *testing.T) {
 		c := New(lg, randomContentGenerator(), db)
 		prompt := []llm.Part{llm.Text("a"), llm.Text("b"), llm.Text("c")}
-		got1, cached, err := c.generate(ctx, nil, prompt)
+		r1, cached, err := c.generate(ctx, nil, prompt)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -129,11 +130,11 @@ func TestGenerate(t *testing.T) {
 			t.Error("generate() = cached, want not cached")
 		}
 
-		got2, cached, err := c.generate(ctx, nil, prompt)
+		r2, cached, err := c.generate(ctx, nil, prompt)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if got2 != got1 {
+		if got1, got2 := r1.Response, r2.Response; got2 != got1 {
 			t.Errorf("generate() = %s, want %s", got2, got1)
 		}
 		if !cached {
@@ -102,7 +102,8 @@ var relatedSchema = &llm.Schema{
 // document and related documents.
 // AnalyzeRelated returns an error if no initial document is provided, no related docs are
 // provided, or the LLM is unable to generate a response.
-// TODO(tatianabradley): Return an error if the LLM generates JSON with missing or unexpected elements.
+// TODO(tatianabradley): Return an error if the LLM generates JSON with unexpected elements.
+// (Responses with missing or mistyped elements are rejected by [llm.GenerateJSON].)
 func (c *Client) AnalyzeRelated(ctx context.Context, doc *Doc, related []*Doc) (*RelatedAnalysis, error) {
 	if doc == nil {
 		return nil, errors.New("llmapp AnalyzeRelated: no doc")
@@ -161,7 +162,7 @@ func relatedTestOutput(t *testing.T, numRelated int) (raw string, typed Related)
 			URL:             "URL",
 			Summary:         "related summary",
 			Relationship:    "related relationship",
-			Relevance:       "related relevance",
+			Relevance:       "HIGH",
 			RelevanceReason: "related relevance reason",
 		}
 	}
@@ -0,0 +1,33 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmapp
+
+import (
+	"context"
+)
+
+// streamKey is the context key for the function passed to [WithStream].
+type streamKey struct{}
+
+// WithStream returns a copy of ctx that causes [Client] methods
+// called with it to stream the LLM responses they generate:
+// each piece of a response is passed to f as soon as it is generated.
+// Responses found in the cache are returned as usual without
+// calling f, as are responses to requests for JSON,
+// which are usually not useful to display until complete.
+//
+// Streaming is for display only: the results of the Client methods
+// are the same whether or not they stream.
+// A streamed response is cached only if it is generated completely.
+func WithStream(ctx context.Context, f func(text string)) context.Context {
+	return context.WithValue(ctx, streamKey{}, f)
+}
+
+// streamFunc returns the function passed to [WithStream]
+// to create ctx, or nil if there is none.
+func streamFunc(ctx context.Context) func(string) {
+	f, _ := ctx.Value(streamKey{}).(func(string))
+	return f
+}
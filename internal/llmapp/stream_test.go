@@ -0,0 +1,130 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmapp
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestStream(t *testing.T) {
+	c := newTestClient(t)
+	var chunks []string
+	ctx := WithStream(context.Background(), func(text string) {
+		chunks = append(chunks, text)
+	})
+
+	got, err := c.Overview(ctx, doc1, doc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Errorf("Overview streamed %d chunks, want several", len(chunks))
+	}
+	if s := strings.Join(chunks, ""); s != got.Response {
+		t.Errorf("Overview streamed %q, returned %q", s, got.Response)
+	}
+	if got.Cached {
+		t.Errorf("Overview() = cached, want not cached")
+	}
+
+	// The completed stream is cached, and cached results are not streamed.
+	chunks = nil
+	got2, err := c.Overview(ctx, doc1, doc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got2.Cached || got2.Response != got.Response {
+		t.Errorf("Overview() = %q, cached=%v, want %q, cached=true", got2.Response, got2.Cached, got.Response)
+	}
+	if len(chunks) != 0 {
+		t.Errorf("cached Overview streamed %q, want nothing", chunks)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	g := &failStreamer{ContentGenerator: llm.EchoContentGenerator(), fail: true}
+	c := New(lg, g, db)
+	var chunks []string
+	ctx := WithStream(context.Background(), func(text string) {
+		chunks = append(chunks, text)
+	})
+
+	prompt := []llm.Part{llm.Text("a b c")}
+	if _, _, err := c.generate(ctx, nil, prompt); err == nil {
+		t.Fatal("generate succeeded with failing stream")
+	}
+	if len(chunks) != 1 {
+		t.Errorf("streamed %q before error, want one chunk", chunks)
+	}
+
+	// The incomplete response must not have been cached.
+	g.fail = false
+	r, cached, err := c.generate(ctx, nil, prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached {
+		t.Errorf("generate() = cached after failed stream, want not cached")
+	}
+	if got, want := r.Response, "a b c"; got != want {
+		t.Errorf("generate() = %q, want %q", got, want)
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	g := &failStreamer{ContentGenerator: llm.EchoContentGenerator(), truncate: true}
+	c := New(lg, g, db)
+	ctx := WithStream(context.Background(), func(string) {})
+
+	prompt := []llm.Part{llm.Text("a b c")}
+	if _, _, err := c.generate(ctx, nil, prompt); err == nil {
+		t.Fatal("generate succeeded with truncated stream")
+	}
+
+	// The truncated response must not have been cached.
+	g.truncate = false
+	if _, cached, err := c.generate(ctx, nil, prompt); err != nil || cached {
+		t.Errorf("generate() = cached %v, %v after truncated stream, want not cached, nil", cached, err)
+	}
+}
+
+// failStreamer is a [llm.ContentStreamer] that streams the
+// response of its ContentGenerator, failing after the first
+// chunk if fail is set, and ending without the final chunk's
+// usage if truncate is set.
+type failStreamer struct {
+	llm.ContentGenerator
+	fail     bool
+	truncate bool
+}
+
+func (f *failStreamer) GenerateContentStream(ctx context.Context, schema *llm.Schema, parts []llm.Part) iter.Seq2[*llm.Chunk, error] {
+	return func(yield func(*llm.Chunk, error) bool) {
+		for chunk, err := range f.ContentGenerator.(llm.ContentStreamer).GenerateContentStream(ctx, schema, parts) {
+			if f.truncate && chunk != nil && chunk.Usage != nil {
+				return
+			}
+			if !yield(chunk, err) {
+				return
+			}
+			if f.fail {
+				yield(nil, errors.New("stream failed"))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/oscar/internal/docs"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+)
+
+// maxToolRounds is the maximum number of rounds of tool calls
+// the LLM can make while generating a single response.
+const maxToolRounds = 5
+
+// SetTools sets the tools that the LLM may call while generating
+// plain text responses, such as overviews.
+// The tools are only used if the Client's [llm.ContentGenerator]
+// implements [llm.ToolCaller]. Responses generated using tools
+// are not streamed (see [WithStream]).
+//
+// Changing the set of tools changes the cache keys of responses,
+// so that responses generated with different tools are cached separately.
+func (c *Client) SetTools(tools ...*llm.Tool) {
+	c.tools = tools
+}
+
+// toolCaller returns the ToolCaller and tools to use to generate
+// a response with the given schema, or nil if tools are not in use.
+func (c *Client) toolCaller(schema *llm.Schema) (llm.ToolCaller, []*llm.Tool) {
+	tc, ok := c.g.(llm.ToolCaller)
+	if !ok || len(c.tools) == 0 || schema != nil {
+		return nil, nil
+	}
+	return tc, c.tools
+}
+
+// toolOutputs returns the outputs of the successful tool calls
+// in the conversation msgs, as returned by [llm.RunTools].
+func toolOutputs(msgs []*llm.Message) []string {
+	var outs []string
+	for _, m := range msgs {
+		for _, p := range m.Parts {
+			if r, ok := p.(llm.ToolResult); ok && r.Output != "" {
+				outs = append(outs, r.Output)
+			}
+		}
+	}
+	return outs
+}
+
+// toolDecl is the declaration of a tool, as recorded in cache keys.
+type toolDecl struct {
+	Name        string
+	Description string
+	Parameters  *llm.Schema
+}
+
+// toolDecls returns the declarations of tools.
+func toolDecls(tools []*llm.Tool) []toolDecl {
+	var decls []toolDecl
+	for _, t := range tools {
+		decls = append(decls, toolDecl{t.Name, t.Description, t.Parameters})
+	}
+	return decls
+}
+
+// maxLookupText is the maximum length of document text
+// returned by [DocLookupTool], to bound the size of prompts.
+const maxLookupText = 20000
+
+// DocLookupTool returns a tool the LLM can use to look up documents
+// in dc, such as issues, changes and web pages linked from the
+// documents in its prompt.
+// The result of a lookup is the JSON encoding of a [Doc],
+// with the text truncated to a reasonable length.
+func DocLookupTool(dc *docs.Corpus) *llm.Tool {
+	return &llm.Tool{
+		Name: "lookup_document",
+		Description: "Looks up a GitHub issue, Gerrit change, or documentation page by its URL, " +
+			"such as https://github.com/golang/go/issues/12345 or https://go-review.googlesource.com/c/go/+/12345, " +
+			"and returns its title and text. Use it to read documents that are linked or referred to " +
+			"when they are relevant to the task.",
+		Parameters: &llm.Schema{
+			Type: llm.TypeObject,
+			Properties: map[string]*llm.Schema{
+				"url": {
+					Type:        llm.TypeString,
+					Description: "the URL of the document",
+				},
+			},
+			Required: []string{"url"},
+		},
+		Call: func(_ context.Context, args json.RawMessage) (string, error) {
+			var a struct {
+				URL string `json:"url"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return "", err
+			}
+			d, ok := dc.Get(a.URL)
+			if !ok {
+				// Gerrit changes are stored with a fragment.
+				d, ok = dc.Get(a.URL + "#related-content")
+			}
+			if !ok {
+				return "", fmt.Errorf("no document with URL %q", a.URL)
+			}
+			text := d.Text
+			if len(text) > maxLookupText {
+				text = text[:maxLookupText] + "\n[truncated]"
+			}
+			return string(storage.JSON(&Doc{URL: a.URL, Title: d.Title, Text: text})), nil
+		},
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmapp
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/oscar/internal/docs"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestDocLookupTool(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	dc := docs.New(lg, db)
+	dc.Add("https://github.com/golang/go/issues/1", "issue one", "text of issue one")
+	dc.Add("https://go-review.googlesource.com/c/go/+/2#related-content", "change two", strings.Repeat("x", maxLookupText+1))
+
+	c := New(lg, llm.EchoToolCaller(), db)
+	prompt := []llm.Part{llm.Text("call lookup_document {\"url\": \"https://github.com/golang/go/issues/1\"}\n" +
+		"call lookup_document {\"url\": \"https://go-review.googlesource.com/c/go/+/2\"}\n" +
+		"call lookup_document {\"url\": \"https://example.com\"}")}
+
+	// Without tools, the generator just echoes the prompt.
+	r, _, err := c.generate(ctx, nil, prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Response; got != llm.EchoTextResponse(prompt...) {
+		t.Errorf("generate without tools = %q, want echo", got)
+	}
+	keyNoTools, _ := c.keyAndHashGenerateContent(nil, prompt)
+
+	c.SetTools(DocLookupTool(dc))
+	r, cached, err := c.generate(ctx, nil, prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached {
+		t.Errorf("generate with tools returned response cached without tools")
+	}
+	got := r.Response
+	for _, want := range []string{
+		`lookup_document: {"url":"https://github.com/golang/go/issues/1","title":"issue one","text":"text of issue one"}`,
+		`lookup_document: {"url":"https://go-review.googlesource.com/c/go/+/2","title":"change two","text":"xxx`,
+		`xxx\n[truncated]"}`,
+		`lookup_document error: no document with URL "https://example.com"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("generate with tools = %q, want it to contain %q", got, want)
+		}
+	}
+	if key, _ := c.keyAndHashGenerateContent(nil, prompt); bytes.Equal(key, keyNoTools) {
+		t.Errorf("cache key does not depend on tools")
+	}
+
+	// Tools are not used for JSON responses.
+	schema := &llm.Schema{Type: llm.TypeObject, Properties: map[string]*llm.Schema{"prompt": {Type: llm.TypeString}}}
+	r, _, err = c.generate(ctx, schema, prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Response; got != llm.EchoJSONResponse(prompt...) {
+		t.Errorf("generate with schema = %q, want echo", got)
+	}
+}
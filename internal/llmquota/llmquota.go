@@ -0,0 +1,277 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package llmquota accounts for and limits the use of LLMs.
+//
+// A [Limiter] wraps [llm.ContentGenerator] and [llm.Embedder]
+// implementations, one per component of a program (such as "overview"
+// or "embeddocs"), so that the components share global budgets and
+// can also be given their own budgets.
+// The wrappers count the requests and tokens used by each component,
+// wait when a requests-per-minute limit is reached, and fail with
+// [ErrQuotaExceeded] when a tokens-per-day budget is exhausted.
+//
+// Usage is stored in the Limiter's database, for each UTC day, as:
+//
+//	("llmquota.Usage", day, component) -> [Usage]
+//
+// so that token budgets are shared by all processes using the database.
+// Request rates, on the other hand, are limited separately in each process.
+package llmquota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+const usageKind = "llmquota.Usage"
+
+// ErrQuotaExceeded is returned (wrapped) by LLM calls made through a
+// [Limiter] when a tokens-per-day budget has been used up.
+var ErrQuotaExceeded = errors.New("LLM quota exceeded")
+
+// A Limit is a budget for LLM use.
+// Zero values mean no limit.
+type Limit struct {
+	RequestsPerMinute int   // maximum requests in any one-minute period
+	TokensPerDay      int64 // maximum input and output tokens per UTC day
+}
+
+// A Limiter accounts for and limits the use of LLMs
+// by the components of a program.
+type Limiter struct {
+	slog   *slog.Logger
+	db     storage.DB
+	global Limit
+	limits map[string]Limit // per-component limits
+
+	mu     sync.Mutex
+	recent map[string][]time.Time // per-component start times of requests in the last minute ("" for all)
+
+	// for testing
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a new Limiter that stores usage in db
+// and enforces the global limit on all components together.
+func New(lg *slog.Logger, db storage.DB, global Limit) *Limiter {
+	return &Limiter{
+		slog:   lg,
+		db:     db,
+		global: global,
+		limits: make(map[string]Limit),
+		recent: make(map[string][]time.Time),
+		now:    time.Now,
+		sleep:  sleep,
+	}
+}
+
+// sleep waits for d to pass or ctx to be done, whichever is first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// SetLimit sets the limit for the named component,
+// which also remains subject to the global limit.
+// It must be called before the component's first LLM call.
+func (l *Limiter) SetLimit(component string, lim Limit) {
+	l.limits[component] = lim
+}
+
+// Limits returns the global limit and the per-component limits.
+func (l *Limiter) Limits() (global Limit, components map[string]Limit) {
+	return l.global, l.limits
+}
+
+// A Usage is the use of LLMs by a component on a single day.
+type Usage struct {
+	Day          string // UTC day, in [time.DateOnly] format
+	Component    string
+	Requests     int64 // number of successful requests
+	InputTokens  int64 // tokens in the prompts of the requests
+	OutputTokens int64 // tokens in the responses to the requests
+	Rejected     int64 // number of requests refused for exceeding a token budget
+}
+
+// Tokens returns the total number of tokens used.
+func (u *Usage) Tokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// day returns the UTC day of t, in [time.DateOnly] format.
+func day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// Usage returns the usage of each component on the given UTC day,
+// in [time.DateOnly] format, ordered by component.
+func (l *Limiter) Usage(day string) iter.Seq[*Usage] {
+	return func(yield func(*Usage) bool) {
+		for _, vf := range l.db.Scan(ordered.Encode(usageKind, day), ordered.Encode(usageKind, day, ordered.Inf)) {
+			var u Usage
+			if err := json.Unmarshal(vf(), &u); err != nil {
+				// unreachable unless the database is corrupt
+				l.slog.Error("llmquota: cannot unmarshal usage", "day", day, "err", err)
+				continue
+			}
+			if !yield(&u) {
+				return
+			}
+		}
+	}
+}
+
+// Today returns the current UTC day, for use with [Limiter.Usage].
+func (l *Limiter) Today() string {
+	return day(l.now())
+}
+
+// acquire reserves the use of the LLM for one request by the component.
+// It fails immediately if the component or all components together have
+// used their tokens for the day, and otherwise waits until a request
+// is allowed by the requests-per-minute limits or ctx is done.
+func (l *Limiter) acquire(ctx context.Context, component string) error {
+	if err := l.checkTokens(component); err != nil {
+		l.record(component, &Usage{Rejected: 1})
+		return err
+	}
+	lim := l.limits[component]
+	for {
+		l.mu.Lock()
+		now := l.now()
+		wait := max(l.wait(now, component, lim.RequestsPerMinute), l.wait(now, "", l.global.RequestsPerMinute))
+		if wait == 0 {
+			l.recent[component] = append(l.recent[component], now)
+			l.recent[""] = append(l.recent[""], now)
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+		l.slog.Debug("llmquota: waiting for rate limit", "component", component, "wait", wait)
+		if err := l.sleep(ctx, wait); err != nil {
+			return fmt.Errorf("llmquota: waiting for rate limit: %w", err)
+		}
+	}
+}
+
+// wait returns how long to wait until the component (or "" for all
+// components) can make another request under the rate limit rpm,
+// discarding the requests made more than a minute before now.
+// l.mu must be held.
+func (l *Limiter) wait(now time.Time, component string, rpm int) time.Duration {
+	times := l.recent[component]
+	for len(times) > 0 && now.Sub(times[0]) >= time.Minute {
+		times = times[1:]
+	}
+	l.recent[component] = times
+	if rpm <= 0 || len(times) < rpm {
+		return 0
+	}
+	return times[len(times)-rpm].Add(time.Minute).Sub(now)
+}
+
+// checkTokens returns an error if the component or all components
+// together have used up their daily tokens.
+// Because the number of tokens a request will use is not known in advance,
+// the last request allowed each day may exceed the budgets.
+func (l *Limiter) checkTokens(component string) error {
+	lim := l.limits[component]
+	if lim.TokensPerDay <= 0 && l.global.TokensPerDay <= 0 {
+		return nil
+	}
+	today := l.Today()
+	var total int64
+	for u := range l.Usage(today) {
+		total += u.Tokens()
+		if u.Component == component && lim.TokensPerDay > 0 && u.Tokens() >= lim.TokensPerDay {
+			return fmt.Errorf("llmquota: %w: %s used %d tokens on %s (limit %d)", ErrQuotaExceeded, component, u.Tokens(), today, lim.TokensPerDay)
+		}
+	}
+	if l.global.TokensPerDay > 0 && total >= l.global.TokensPerDay {
+		return fmt.Errorf("llmquota: %w: %d tokens used on %s (global limit %d)", ErrQuotaExceeded, total, today, l.global.TokensPerDay)
+	}
+	return nil
+}
+
+// record adds the counts in u to the component's usage for today.
+func (l *Limiter) record(component string, u *Usage) {
+	today := l.Today()
+	key := ordered.Encode(usageKind, today, component)
+	l.db.Lock(string(key))
+	defer l.db.Unlock(string(key))
+
+	cur := &Usage{Day: today, Component: component}
+	if js, ok := l.db.Get(key); ok {
+		if err := json.Unmarshal(js, cur); err != nil {
+			// unreachable unless the database is corrupt
+			l.slog.Error("llmquota: cannot unmarshal usage", "key", storage.Fmt(key), "err", err)
+		}
+	}
+	cur.Requests += u.Requests
+	cur.InputTokens += u.InputTokens
+	cur.OutputTokens += u.OutputTokens
+	cur.Rejected += u.Rejected
+	l.db.Set(key, storage.JSON(cur))
+}
+
+// ParseLimits parses a comma-separated list of limits, such as
+//
+//	rpm=60,tpd=5000000,embeddocs.rpm=10,overview.tpd=1000000
+//
+// Each element is either rpm=N (requests per minute) or tpd=N (tokens per day),
+// optionally prefixed by a component name and a dot.
+// Limits without a component are global.
+func ParseLimits(s string) (global Limit, components map[string]Limit, err error) {
+	components = make(map[string]Limit)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(f, "=")
+		if !ok {
+			return Limit{}, nil, fmt.Errorf("llmquota: invalid limit %q: missing =", f)
+		}
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || n < 0 {
+			return Limit{}, nil, fmt.Errorf("llmquota: invalid limit %q: bad number", f)
+		}
+		component, unit := "", name
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			component, unit = name[:i], name[i+1:]
+		}
+		lim := components[component]
+		switch unit {
+		case "rpm":
+			lim.RequestsPerMinute = int(n)
+		case "tpd":
+			lim.TokensPerDay = n
+		default:
+			return Limit{}, nil, fmt.Errorf("llmquota: invalid limit %q: unknown unit %q", f, unit)
+		}
+		components[component] = lim
+	}
+	global = components[""]
+	delete(components, "")
+	return global, components, nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmquota
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+var ctx = context.Background()
+
+// newTestLimiter returns a Limiter using a fake clock,
+// which advances only when the Limiter sleeps.
+// It also returns a pointer to the total time slept.
+func newTestLimiter(t *testing.T, global Limit) (*Limiter, *time.Duration) {
+	l := New(testutil.Slogger(t), storage.MemDB(), global)
+	now := time.Date(2024, 10, 1, 23, 59, 0, 0, time.UTC)
+	var slept time.Duration
+	l.now = func() time.Time { return now }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		now = now.Add(d)
+		slept += d
+		return nil
+	}
+	return l, &slept
+}
+
+// usage returns the usage recorded today, without the Day field.
+func usage(l *Limiter) []Usage {
+	var us []Usage
+	for u := range l.Usage(l.Today()) {
+		u.Day = ""
+		us = append(us, *u)
+	}
+	return us
+}
+
+// nonStreaming returns g without its [llm.ContentStreamer] method,
+// so that its token counts are estimated.
+func nonStreaming(g llm.ContentGenerator) llm.ContentGenerator {
+	return struct{ llm.ContentGenerator }{g}
+}
+
+func TestContentGenerator(t *testing.T) {
+	l, _ := newTestLimiter(t, Limit{})
+	g := l.ContentGenerator("overview", llm.EchoContentGenerator())
+	if _, ok := g.(llm.ToolCaller); ok {
+		t.Errorf("wrapped echo generator is a ToolCaller")
+	}
+	if g.Model() != "echo" {
+		t.Errorf("Model() = %q, want echo", g.Model())
+	}
+
+	// The echo streamer reports 1 prompt token (part) and
+	// 1 response token (word), also for GenerateContent.
+	out, err := g.GenerateContent(ctx, nil, []llm.Part{llm.Text("12345678")})
+	if err != nil || out != "12345678" {
+		t.Fatalf("GenerateContent = %q, %v", out, err)
+	}
+	// The echo streamer reports 1 prompt token (part) and 2 response tokens (words).
+	text, _, err := llm.Collect(llm.Stream(ctx, g, nil, []llm.Part{llm.Text("hello world")}))
+	if err != nil || text != "hello world" {
+		t.Fatalf("Stream = %q, %v", text, err)
+	}
+
+	// Without streaming, 8 bytes of prompt and response are estimated as 2 tokens each.
+	ns := l.ContentGenerator("nostream", nonStreaming(llm.EchoContentGenerator()))
+	if out, err := ns.GenerateContent(ctx, nil, []llm.Part{llm.Text("12345678")}); err != nil || out != "12345678" {
+		t.Fatalf("GenerateContent without streaming = %q, %v", out, err)
+	}
+
+	e := l.Embedder("embed", llm.QuoteEmbedder())
+	if _, err := e.EmbedDocs(ctx, []llm.EmbedDoc{{Text: "1234"}, {Title: "1", Text: "1234"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := l.ContentGenerator("chat", llm.EchoToolCaller())
+	if _, ok := tc.(llm.ToolCaller); !ok {
+		t.Fatalf("wrapped ToolCaller is not a ToolCaller")
+	}
+	if _, err := llm.GenerateChat(ctx, tc, []*llm.Message{{Role: llm.RoleUser, Parts: []llm.Part{llm.Text("1234")}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Usage{
+		{Component: "chat", Requests: 1, InputTokens: 1, OutputTokens: 1},
+		{Component: "embed", Requests: 1, InputTokens: 3},
+		{Component: "nostream", Requests: 1, InputTokens: 2, OutputTokens: 2},
+		{Component: "overview", Requests: 2, InputTokens: 2, OutputTokens: 3},
+	}
+	if got := usage(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("usage:\nhave %+v\nwant %+v", got, want)
+	}
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	l, slept := newTestLimiter(t, Limit{RequestsPerMinute: 3})
+	l.SetLimit("a", Limit{RequestsPerMinute: 2})
+	a := l.ContentGenerator("a", llm.EchoContentGenerator())
+	b := l.ContentGenerator("b", llm.EchoContentGenerator())
+	call := func(g llm.ContentGenerator) {
+		t.Helper()
+		if _, err := g.GenerateContent(ctx, nil, []llm.Part{llm.Text("x")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	call(a)
+	call(a)
+	call(b)
+	if *slept != 0 {
+		t.Fatalf("slept %v before reaching limits", *slept)
+	}
+	// a is over its own limit, and also the global limit.
+	call(a)
+	if *slept != time.Minute {
+		t.Errorf("slept %v for a, want 1m", *slept)
+	}
+	// The first minute's requests have expired,
+	// so b can make a request without waiting.
+	call(b)
+	if *slept != time.Minute {
+		t.Errorf("slept %v for b, want 1m", *slept)
+	}
+
+	// Waiting stops when the context is canceled.
+	call(b)
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := b.GenerateContent(cctx, nil, []llm.Part{llm.Text("x")}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GenerateContent with canceled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestTokensPerDay(t *testing.T) {
+	l, _ := newTestLimiter(t, Limit{TokensPerDay: 10})
+	l.SetLimit("a", Limit{TokensPerDay: 4})
+	// Use estimated token counts.
+	a := l.ContentGenerator("a", nonStreaming(llm.EchoContentGenerator()))
+	b := l.ContentGenerator("b", nonStreaming(llm.EchoContentGenerator()))
+	prompt := []llm.Part{llm.Text("12345678")} // 2 tokens in, 2 out
+
+	if _, err := a.GenerateContent(ctx, nil, prompt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GenerateContent(ctx, nil, prompt); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("a over budget: err = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := b.GenerateContent(ctx, nil, prompt); err != nil {
+		t.Fatal(err)
+	}
+	// The last request may go over the global budget.
+	if _, err := b.GenerateContent(ctx, nil, append(prompt, prompt...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GenerateContent(ctx, nil, prompt); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("b over global budget: err = %v, want ErrQuotaExceeded", err)
+	}
+	want := []Usage{
+		{Component: "a", Requests: 1, InputTokens: 2, OutputTokens: 2, Rejected: 1},
+		{Component: "b", Requests: 2, InputTokens: 6, OutputTokens: 6, Rejected: 1},
+	}
+	if got := usage(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("usage:\nhave %+v\nwant %+v", got, want)
+	}
+
+	// Budgets reset at the start of the next (UTC) day.
+	l.sleep(ctx, time.Minute)
+	if _, err := a.GenerateContent(ctx, nil, prompt); err != nil {
+		t.Fatalf("next day: %v", err)
+	}
+	if l.Today() != "2024-10-02" || len(usage(l)) != 1 {
+		t.Errorf("next day %s: usage %+v, want one component", l.Today(), usage(l))
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	global, comps, err := ParseLimits("rpm=60, tpd=1000,embed.rpm=10,a.b.tpd=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Limit{RequestsPerMinute: 60, TokensPerDay: 1000}); global != want {
+		t.Errorf("global = %+v, want %+v", global, want)
+	}
+	want := map[string]Limit{
+		"embed": {RequestsPerMinute: 10},
+		"a.b":   {TokensPerDay: 5},
+	}
+	if !reflect.DeepEqual(comps, want) {
+		t.Errorf("components = %+v, want %+v", comps, want)
+	}
+
+	if global, comps, err := ParseLimits(""); err != nil || global != (Limit{}) || len(comps) != 0 {
+		t.Errorf(`ParseLimits("") = %v, %v, %v`, global, comps, err)
+	}
+	for _, bad := range []string{"rpm", "rpm=x", "rpm=-1", "a.rph=1"} {
+		if _, _, err := ParseLimits(bad); err == nil {
+			t.Errorf("ParseLimits(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmquota
+
+import (
+	"context"
+	"iter"
+	"strings"
+
+	"golang.org/x/oscar/internal/llm"
+)
+
+// ContentGenerator returns a ContentGenerator that makes the calls
+// of the named component to g, subject to the component's limits
+// and the global limits, and records their usage.
+// The result implements [llm.ContentStreamer], and it implements
+// [llm.ToolCaller] if g does.
+//
+// Token counts come from the usage the model reports at the end of
+// a streamed response. If g implements [llm.ContentStreamer],
+// GenerateContent streams the response from g so that it can count
+// the reported usage. Otherwise, and for GenerateMessage,
+// which has no reported usage, the counts are estimated from
+// the lengths of the prompts and responses (see [llm.EstimateTokens]).
+func (l *Limiter) ContentGenerator(component string, g llm.ContentGenerator) llm.ContentGenerator {
+	checkComponent(component)
+	lg := &generator{l: l, component: component, g: g}
+	if tc, ok := g.(llm.ToolCaller); ok {
+		return &toolCaller{generator: lg, tc: tc}
+	}
+	return lg
+}
+
+// Embedder returns an Embedder that makes the calls of the named
+// component to e, subject to the component's limits and the
+// global limits, and records their usage.
+// Each call of EmbedDocs counts as a single request,
+// and its tokens are estimated from the lengths of the documents.
+func (l *Limiter) Embedder(component string, e llm.Embedder) llm.Embedder {
+	checkComponent(component)
+	return &embedder{l: l, component: component, e: e}
+}
+
+func checkComponent(component string) {
+	if component == "" {
+		panic("llmquota: empty component name")
+	}
+}
+
+// A generator is an [llm.ContentGenerator] returned by [Limiter.ContentGenerator].
+type generator struct {
+	l         *Limiter
+	component string
+	g         llm.ContentGenerator
+}
+
+// Model implements [llm.ContentGenerator.Model].
+func (g *generator) Model() string { return g.g.Model() }
+
+// SetTemperature implements [llm.ContentGenerator.SetTemperature].
+func (g *generator) SetTemperature(t float32) { g.g.SetTemperature(t) }
+
+// GenerateContent implements [llm.ContentGenerator.GenerateContent].
+// It collects the response of GenerateContentStream,
+// so that it records the usage reported by the model, if any.
+func (g *generator) GenerateContent(ctx context.Context, schema *llm.Schema, parts []llm.Part) (string, error) {
+	text, _, err := llm.Collect(g.GenerateContentStream(ctx, schema, parts))
+	if err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// GenerateContentStream implements [llm.ContentStreamer.GenerateContentStream].
+// If the underlying generator does not stream, the response is a single chunk.
+func (g *generator) GenerateContentStream(ctx context.Context, schema *llm.Schema, parts []llm.Part) iter.Seq2[*llm.Chunk, error] {
+	return func(yield func(*llm.Chunk, error) bool) {
+		if err := g.l.acquire(ctx, g.component); err != nil {
+			yield(nil, err)
+			return
+		}
+		var text strings.Builder
+		var usage *llm.Usage
+		for c, err := range llm.Stream(ctx, g.g, schema, parts) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			text.WriteString(c.Text)
+			if c.Usage != nil && c.Usage.TotalTokens > 0 {
+				usage = c.Usage
+			}
+			if !yield(c, nil) {
+				break
+			}
+		}
+		u := &Usage{Requests: 1}
+		if usage != nil {
+			// Reported by the model.
+			// Count all billed tokens, including any used for thinking.
+			u.InputTokens = int64(usage.PromptTokens)
+			u.OutputTokens = int64(usage.TotalTokens - usage.PromptTokens)
+		} else {
+			// Not reported, as when g does not stream: estimate.
+			u.InputTokens = int64(llm.EstimatePartsTokens(parts))
+			u.OutputTokens = int64(llm.EstimateTokens(text.String()))
+		}
+		g.l.record(g.component, u)
+	}
+}
+
+// A toolCaller is an [llm.ToolCaller] returned by [Limiter.ContentGenerator].
+type toolCaller struct {
+	*generator
+	tc llm.ToolCaller
+}
+
+// GenerateMessage implements [llm.ToolCaller.GenerateMessage].
+// Each message generated counts as a request.
+// Messages do not report usage, so the tokens are estimated.
+func (t *toolCaller) GenerateMessage(ctx context.Context, tools []*llm.Tool, msgs []*llm.Message) (*llm.Message, error) {
+	if err := t.l.acquire(ctx, t.component); err != nil {
+		return nil, err
+	}
+	m, err := t.tc.GenerateMessage(ctx, tools, msgs)
+	if err != nil {
+		return nil, err
+	}
+	var in int
+	for _, m := range msgs {
+		in += llm.EstimatePartsTokens(m.Parts)
+	}
+	t.l.record(t.component, &Usage{
+		Requests:     1,
+		InputTokens:  int64(in),
+		OutputTokens: int64(llm.EstimatePartsTokens(m.Parts)),
+	})
+	return m, nil
+}
+
+// An embedder is an [llm.Embedder] returned by [Limiter.Embedder].
+type embedder struct {
+	l         *Limiter
+	component string
+	e         llm.Embedder
+}
+
+// EmbeddingModel implements [llm.Embedder.EmbeddingModel].
+func (e *embedder) EmbeddingModel() string { return e.e.EmbeddingModel() }
+
+// EmbedDocs implements [llm.Embedder.EmbedDocs].
+func (e *embedder) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vector, error) {
+	if err := e.l.acquire(ctx, e.component); err != nil {
+		return nil, err
+	}
+	vecs, err := e.e.EmbedDocs(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+	var in int
+	for _, d := range docs {
+		in += llm.EstimateTokens(d.Title) + llm.EstimateTokens(d.Text)
+	}
+	e.l.record(e.component, &Usage{Requests: 1, InputTokens: int64(in)})
+	return vecs, nil
+}
@@ -0,0 +1,392 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package llmretry makes calls to LLMs more reliable,
+// by wrapping [llm.ContentGenerator] and [llm.Embedder]
+// implementations so that failed calls are retried ([Retry]),
+// slow calls are duplicated ([Hedge]), or calls that fail are
+// made to other models instead ([Fallback]).
+//
+// The wrappers compose. For example,
+//
+//	g := llmretry.Fallback(
+//		llmretry.Retry(gemini, llmretry.DefaultPolicy),
+//		ollama)
+//
+// retries transient Gemini errors with backoff and then,
+// if Gemini still fails, asks a local Ollama model instead.
+//
+// The generators returned by the wrappers implement
+// [llm.ContentStreamer], and they implement [llm.ToolCaller]
+// if all the generators they wrap do.
+package llmretry
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"math/rand/v2"
+	"time"
+
+	"golang.org/x/oscar/internal/gcp/grpcerrors"
+	"golang.org/x/oscar/internal/llm"
+)
+
+// A Policy says when and how often to retry failed calls.
+type Policy struct {
+	// MaxAttempts is the maximum number of calls made,
+	// including the first. Values less than 1 mean 1.
+	MaxAttempts int
+	// InitialBackoff is the approximate wait before the first retry.
+	// The wait doubles after each retry, up to MaxBackoff.
+	// Each wait is chosen at random between half and all of
+	// the current backoff, so that clients that fail together
+	// do not retry together.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Retryable reports whether a call that failed with err
+	// should be retried. If nil, [grpcerrors.IsRetryable] is used.
+	Retryable func(err error) bool
+}
+
+// DefaultPolicy is a policy suitable for calls to hosted LLMs,
+// which retries transient errors for about a minute.
+var DefaultPolicy = Policy{
+	MaxAttempts:    5,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// Retry returns a ContentGenerator that makes its calls to g,
+// retrying them according to the policy p.
+// Streamed responses are retried only if they fail before
+// their first chunk is received.
+func Retry(g llm.ContentGenerator, p Policy) llm.ContentGenerator {
+	return newGenerator([]llm.ContentGenerator{g}, &retrier{p})
+}
+
+// RetryEmbedder returns an Embedder that makes its calls to e,
+// retrying them according to the policy p.
+func RetryEmbedder(e llm.Embedder, p Policy) llm.Embedder {
+	return &embedder{es: []llm.Embedder{e}, r: &retrier{p}}
+}
+
+// Hedge returns a ContentGenerator that makes its calls to g,
+// and makes each call a second time if it has not succeeded after
+// the given delay, returning whichever response is first.
+// Hedging trades extra requests for lower tail latency:
+// delay is typically a high percentile of g's response time.
+// Streamed responses are not hedged.
+func Hedge(g llm.ContentGenerator, delay time.Duration) llm.ContentGenerator {
+	return newGenerator([]llm.ContentGenerator{g}, &hedger{delay})
+}
+
+// HedgeEmbedder returns an Embedder that makes its calls to e,
+// hedging them like [Hedge].
+func HedgeEmbedder(e llm.Embedder, delay time.Duration) llm.Embedder {
+	return &embedder{es: []llm.Embedder{e}, r: &hedger{delay}}
+}
+
+// Fallback returns a ContentGenerator that makes each call
+// to the first of gs, and if that fails, to the next, and so on,
+// returning the first response or, if all fail, the last error.
+// Streamed responses fall back only if they fail before
+// their first chunk is received.
+//
+// The result's Model method returns the model of gs[0].
+// The model that actually generated each response is reported
+// with [llm.ReportModel].
+// Fallback panics if gs is empty.
+func Fallback(gs ...llm.ContentGenerator) llm.ContentGenerator {
+	if len(gs) == 0 {
+		panic("llmretry.Fallback: no generators")
+	}
+	return newGenerator(gs, fallbacker{})
+}
+
+// FallbackEmbedder returns an Embedder that makes each call
+// to the first of es, and if that fails, to the next, and so on.
+// Because vectors from different embedding models cannot be compared,
+// all of es must use the same embedding model, as when they are
+// different servers for the same model.
+// FallbackEmbedder panics if es is empty or their models differ.
+func FallbackEmbedder(es ...llm.Embedder) llm.Embedder {
+	if len(es) == 0 {
+		panic("llmretry.FallbackEmbedder: no embedders")
+	}
+	for _, e := range es[1:] {
+		if e.EmbeddingModel() != es[0].EmbeddingModel() {
+			panic("llmretry.FallbackEmbedder: different embedding models " + es[0].EmbeddingModel() + " and " + e.EmbeddingModel())
+		}
+	}
+	return &embedder{es: es, r: fallbacker{}}
+}
+
+// A runner decides which calls to make for a single request.
+// The call function makes the request to the i'th wrapped generator
+// or embedder.
+type runner interface {
+	// run makes the request, returning the result or error
+	// of the call that decides the outcome.
+	run(ctx context.Context, n int, call func(ctx context.Context, i int) (any, error)) (any, error)
+	// runStream is like run, for calls that start streams.
+	runStream(ctx context.Context, n int, call func(ctx context.Context, i int) (any, error)) (any, error)
+}
+
+// A retrier is a runner for [Retry].
+type retrier struct {
+	p Policy
+}
+
+// sleep waits for d to pass or ctx to be done, whichever is first.
+// It is a variable for testing.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (r *retrier) run(ctx context.Context, n int, call func(context.Context, int) (any, error)) (any, error) {
+	retryable := r.p.Retryable
+	if retryable == nil {
+		retryable = grpcerrors.IsRetryable
+	}
+	backoff := r.p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		v, err := call(ctx, 0)
+		if err == nil || attempt >= r.p.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+			return v, err
+		}
+		wait := backoff / 2
+		if wait > 0 {
+			wait += rand.N(backoff - wait)
+		}
+		if serr := sleep(ctx, wait); serr != nil {
+			return v, errors.Join(err, serr)
+		}
+		backoff = min(2*backoff, r.p.MaxBackoff)
+	}
+}
+
+func (r *retrier) runStream(ctx context.Context, n int, call func(context.Context, int) (any, error)) (any, error) {
+	return r.run(ctx, n, call)
+}
+
+// A hedger is a runner for [Hedge].
+type hedger struct {
+	delay time.Duration
+}
+
+func (h *hedger) run(ctx context.Context, n int, call func(context.Context, int) (any, error)) (any, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		v     any
+		err   error
+		model string // model reported by the call, if any
+	}
+	results := make(chan result, 2)
+	start := func() {
+		go func() {
+			var model string
+			ctx := llm.WithModelReporter(ctx, func(m string) {
+				if model == "" {
+					model = m
+				}
+			})
+			v, err := call(ctx, 0)
+			results <- result{v, err, model}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			start()
+			pending++
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				if r.model != "" {
+					llm.ReportModel(ctx, r.model)
+				}
+				return r.v, nil
+			}
+			if pending == 0 {
+				// The first call failed before the second started,
+				// or both calls failed.
+				return r.v, r.err
+			}
+		}
+	}
+}
+
+func (h *hedger) runStream(ctx context.Context, n int, call func(context.Context, int) (any, error)) (any, error) {
+	return call(ctx, 0)
+}
+
+// A fallbacker is a runner for [Fallback].
+type fallbacker struct{}
+
+func (fallbacker) run(ctx context.Context, n int, call func(context.Context, int) (any, error)) (any, error) {
+	var v any
+	var err error
+	for i := range n {
+		if v, err = call(ctx, i); err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	return v, err
+}
+
+func (f fallbacker) runStream(ctx context.Context, n int, call func(context.Context, int) (any, error)) (any, error) {
+	return f.run(ctx, n, call)
+}
+
+// newGenerator returns a generator that makes the calls
+// to gs decided by r, which is a toolCaller if all of gs are
+// [llm.ToolCaller] implementations.
+func newGenerator(gs []llm.ContentGenerator, r runner) llm.ContentGenerator {
+	g := &generator{gs: gs, r: r}
+	for _, x := range gs {
+		if _, ok := x.(llm.ToolCaller); !ok {
+			return g
+		}
+	}
+	return &toolCaller{g}
+}
+
+// A generator is a ContentGenerator returned by the wrappers in this package.
+type generator struct {
+	gs []llm.ContentGenerator
+	r  runner
+}
+
+// Model implements [llm.ContentGenerator.Model].
+func (g *generator) Model() string { return g.gs[0].Model() }
+
+// SetTemperature implements [llm.ContentGenerator.SetTemperature],
+// setting the temperature of all the wrapped generators.
+func (g *generator) SetTemperature(t float32) {
+	for _, x := range g.gs {
+		x.SetTemperature(t)
+	}
+}
+
+// answered reports that the i'th generator generated a response
+// to a request made with ctx.
+func (g *generator) answered(ctx context.Context, i int) {
+	if len(g.gs) > 1 {
+		llm.ReportModel(ctx, g.gs[i].Model())
+	}
+}
+
+// GenerateContent implements [llm.ContentGenerator.GenerateContent].
+func (g *generator) GenerateContent(ctx context.Context, schema *llm.Schema, parts []llm.Part) (string, error) {
+	v, err := g.r.run(ctx, len(g.gs), func(ctx context.Context, i int) (any, error) {
+		text, err := g.gs[i].GenerateContent(ctx, schema, parts)
+		if err != nil {
+			return nil, err
+		}
+		g.answered(ctx, i)
+		return text, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// A pulledStream is a stream whose first chunk has been received.
+type pulledStream struct {
+	first *llm.Chunk // nil if the stream is empty
+	next  func() (*llm.Chunk, error, bool)
+	stop  func()
+}
+
+// GenerateContentStream implements [llm.ContentStreamer.GenerateContentStream].
+func (g *generator) GenerateContentStream(ctx context.Context, schema *llm.Schema, parts []llm.Part) iter.Seq2[*llm.Chunk, error] {
+	return func(yield func(*llm.Chunk, error) bool) {
+		v, err := g.r.runStream(ctx, len(g.gs), func(ctx context.Context, i int) (any, error) {
+			next, stop := iter.Pull2(llm.Stream(ctx, g.gs[i], schema, parts))
+			c, err, ok := next()
+			if err != nil {
+				stop()
+				return nil, err
+			}
+			g.answered(ctx, i)
+			if !ok {
+				c = nil
+			}
+			return &pulledStream{c, next, stop}, nil
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		s := v.(*pulledStream)
+		defer s.stop()
+		if s.first == nil || !yield(s.first, nil) {
+			return
+		}
+		for {
+			c, err, ok := s.next()
+			if !ok || !yield(c, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// A toolCaller is a generator whose wrapped generators
+// all implement [llm.ToolCaller].
+type toolCaller struct {
+	*generator
+}
+
+// GenerateMessage implements [llm.ToolCaller.GenerateMessage].
+func (t *toolCaller) GenerateMessage(ctx context.Context, tools []*llm.Tool, msgs []*llm.Message) (*llm.Message, error) {
+	v, err := t.r.run(ctx, len(t.gs), func(ctx context.Context, i int) (any, error) {
+		m, err := t.gs[i].(llm.ToolCaller).GenerateMessage(ctx, tools, msgs)
+		if err != nil {
+			return nil, err
+		}
+		t.answered(ctx, i)
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*llm.Message), nil
+}
+
+// An embedder is an Embedder returned by the wrappers in this package.
+type embedder struct {
+	es []llm.Embedder
+	r  runner
+}
+
+// EmbeddingModel implements [llm.Embedder.EmbeddingModel].
+func (e *embedder) EmbeddingModel() string { return e.es[0].EmbeddingModel() }
+
+// EmbedDocs implements [llm.Embedder.EmbedDocs].
+// If all calls fail, it returns the vectors returned
+// with the error that decided the outcome, if any.
+func (e *embedder) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vector, error) {
+	v, err := e.r.run(ctx, len(e.es), func(ctx context.Context, i int) (any, error) {
+		return e.es[i].EmbedDocs(ctx, docs)
+	})
+	vecs, _ := v.([]llm.Vector)
+	return vecs, err
+}
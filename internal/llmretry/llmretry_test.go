@@ -0,0 +1,249 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llmretry
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/gcp/grpcerrors"
+	"golang.org/x/oscar/internal/llm"
+)
+
+var ctx = context.Background()
+
+var (
+	errUnavailable = grpcerrors.WithHTTPStatus(errors.New("unavailable"), 503)
+	errBadRequest  = grpcerrors.WithHTTPStatus(errors.New("bad request"), 400)
+)
+
+// flaky returns a generator named name that fails with err
+// the first fails times it is called, and then echoes its prompts.
+// It also returns a pointer to the number of calls.
+func flaky(name string, fails int, err error) (llm.ContentGenerator, *int) {
+	var calls int
+	return llm.TestContentGenerator(name, func(ctx context.Context, schema *llm.Schema, parts []llm.Part) (string, error) {
+		calls++
+		if calls <= fails {
+			return "", err
+		}
+		return llm.EchoTextResponse(parts...), nil
+	}), &calls
+}
+
+// fakeSleep replaces sleep for the duration of the test,
+// recording the waits in the returned slice.
+func fakeSleep(t *testing.T) *[]time.Duration {
+	var waits []time.Duration
+	old := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { sleep = old })
+	return &waits
+}
+
+var testPolicy = Policy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+
+var hello = []llm.Part{llm.Text("hello world")}
+
+func TestRetry(t *testing.T) {
+	waits := fakeSleep(t)
+	f, calls := flaky("flaky", 3, errUnavailable)
+	g := Retry(f, testPolicy)
+	if g.Model() != "flaky" {
+		t.Errorf("Model() = %q, want flaky", g.Model())
+	}
+	out, err := g.GenerateContent(ctx, nil, hello)
+	if err != nil || out != "hello world" {
+		t.Fatalf("GenerateContent = %q, %v", out, err)
+	}
+	if *calls != 4 || len(*waits) != 3 {
+		t.Fatalf("%d calls and waits %v, want 4 calls and 3 waits", *calls, *waits)
+	}
+	// Backoffs are 1s, 2s, 3s (capped), with jitter.
+	for i, max := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		if w := (*waits)[i]; w < max/2 || w >= max {
+			t.Errorf("wait %d = %v, want in [%v, %v)", i, w, max/2, max)
+		}
+	}
+
+	// Too many failures.
+	f, calls = flaky("flaky", 4, errUnavailable)
+	if _, err := Retry(f, testPolicy).GenerateContent(ctx, nil, hello); !errors.Is(err, errUnavailable) || *calls != 4 {
+		t.Errorf("GenerateContent after %d calls: err = %v, want 4 calls and unavailable", *calls, err)
+	}
+
+	// Errors that are not transient are not retried.
+	f, calls = flaky("flaky", 1, errBadRequest)
+	if _, err := Retry(f, testPolicy).GenerateContent(ctx, nil, hello); !errors.Is(err, errBadRequest) || *calls != 1 {
+		t.Errorf("GenerateContent after %d calls: err = %v, want 1 call and bad request", *calls, err)
+	}
+
+	// Calls are not retried when the context is canceled.
+	f, calls = flaky("flaky", 1, errUnavailable)
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := Retry(f, testPolicy).GenerateContent(cctx, nil, hello); err == nil || *calls != 1 {
+		t.Errorf("GenerateContent after %d calls: err = %v, want 1 call and error", *calls, err)
+	}
+}
+
+func TestRetryStream(t *testing.T) {
+	fakeSleep(t)
+	f, calls := flaky("flaky", 2, errUnavailable)
+	text, _, err := llm.Collect(llm.Stream(ctx, Retry(f, testPolicy), nil, hello))
+	if err != nil || text != "hello world" || *calls != 3 {
+		t.Errorf("Stream = %q, %v after %d calls, want hello world after 3 calls", text, err, *calls)
+	}
+}
+
+func TestRetryEmbedder(t *testing.T) {
+	fakeSleep(t)
+	var calls int
+	e := RetryEmbedder(embedFunc(func(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vector, error) {
+		if calls++; calls == 1 {
+			return nil, errUnavailable
+		}
+		return llm.QuoteEmbedder().EmbedDocs(ctx, docs)
+	}), testPolicy)
+	vecs, err := e.EmbedDocs(ctx, []llm.EmbedDoc{{Text: "hello"}})
+	if err != nil || len(vecs) != 1 || llm.UnquoteVector(vecs[0]) != "hello" || calls != 2 {
+		t.Errorf("EmbedDocs = %v, %v after %d calls", vecs, err, calls)
+	}
+}
+
+// An embedFunc is an [llm.Embedder] for the quote model
+// that calls the function.
+type embedFunc func(context.Context, []llm.EmbedDoc) ([]llm.Vector, error)
+
+func (f embedFunc) EmbeddingModel() string { return "quote" }
+
+func (f embedFunc) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vector, error) {
+	return f(ctx, docs)
+}
+
+func TestHedge(t *testing.T) {
+	// The first call hangs until it is canceled.
+	var calls atomic.Int32
+	slow := llm.TestContentGenerator("slow", func(ctx context.Context, schema *llm.Schema, parts []llm.Part) (string, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return llm.EchoTextResponse(parts...), nil
+	})
+	out, err := Hedge(slow, time.Millisecond).GenerateContent(ctx, nil, hello)
+	if err != nil || out != "hello world" || calls.Load() != 2 {
+		t.Errorf("GenerateContent = %q, %v after %d calls", out, err, calls.Load())
+	}
+
+	// Fast calls are not hedged.
+	calls.Store(1)
+	for range 2 {
+		if _, err := Hedge(slow, time.Hour).GenerateContent(ctx, nil, hello); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls.Load() != 3 {
+		t.Errorf("%d calls after 2 fast requests, want 2", calls.Load()-1)
+	}
+
+	// A call that fails before the delay is not hedged.
+	f, fcalls := flaky("flaky", 1, errUnavailable)
+	if _, err := Hedge(f, time.Hour).GenerateContent(ctx, nil, hello); !errors.Is(err, errUnavailable) || *fcalls != 1 {
+		t.Errorf("GenerateContent after %d calls: err = %v, want 1 call and unavailable", *fcalls, err)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	primary, pcalls := flaky("primary", 1, errBadRequest)
+	secondary, scalls := flaky("secondary", 0, nil)
+	g := Fallback(primary, secondary)
+	if g.Model() != "primary" {
+		t.Errorf("Model() = %q, want primary", g.Model())
+	}
+	if _, ok := g.(llm.ToolCaller); ok {
+		t.Errorf("Fallback of non-ToolCallers is a ToolCaller")
+	}
+
+	var models []string
+	rctx := llm.WithModelReporter(ctx, func(m string) { models = append(models, m) })
+	for _, want := range []string{"secondary", "primary"} {
+		models = nil
+		out, err := g.GenerateContent(rctx, nil, hello)
+		if err != nil || out != "hello world" {
+			t.Fatalf("GenerateContent = %q, %v", out, err)
+		}
+		if len(models) != 1 || models[0] != want {
+			t.Errorf("reported models %v, want [%s]", models, want)
+		}
+	}
+	if *pcalls != 2 || *scalls != 1 {
+		t.Errorf("calls: primary %d, secondary %d; want 2, 1", *pcalls, *scalls)
+	}
+
+	// Nested wrappers report the innermost model.
+	models = nil
+	bad, _ := flaky("bad", 10, errUnavailable)
+	g = Fallback(bad, Hedge(Fallback(bad, secondary), time.Hour))
+	if _, err := g.GenerateContent(rctx, nil, hello); err != nil {
+		t.Fatal(err)
+	}
+	if len(models) == 0 || models[0] != "secondary" {
+		t.Errorf("reported models %v, want secondary first", models)
+	}
+
+	// Streams fall back too.
+	models = nil
+	text, _, err := llm.Collect(llm.Stream(rctx, Fallback(bad, secondary), nil, hello))
+	if err != nil || text != "hello world" || len(models) != 1 || models[0] != "secondary" {
+		t.Errorf("Stream = %q, %v, models %v", text, err, models)
+	}
+
+	// All fail.
+	if _, err := Fallback(bad, bad).GenerateContent(ctx, nil, hello); !errors.Is(err, errUnavailable) {
+		t.Errorf("GenerateContent with all failing = %v, want unavailable", err)
+	}
+}
+
+func TestFallbackToolCaller(t *testing.T) {
+	g := Fallback(llm.EchoToolCaller(), Retry(llm.EchoToolCaller(), testPolicy))
+	if _, ok := g.(llm.ToolCaller); !ok {
+		t.Fatalf("Fallback of ToolCallers is not a ToolCaller")
+	}
+	out, err := llm.GenerateChat(ctx, g, []*llm.Message{{Role: llm.RoleUser, Parts: []llm.Part{llm.Text("hi")}}})
+	if err != nil || out == "" {
+		t.Errorf("GenerateChat = %q, %v", out, err)
+	}
+}
+
+func TestFallbackEmbedder(t *testing.T) {
+	var calls int
+	e := FallbackEmbedder(embedFunc(func(context.Context, []llm.EmbedDoc) ([]llm.Vector, error) {
+		calls++
+		return nil, errBadRequest
+	}), llm.QuoteEmbedder())
+	vecs, err := e.EmbedDocs(ctx, []llm.EmbedDoc{{Text: "hello"}})
+	if err != nil || len(vecs) != 1 || calls != 1 {
+		t.Errorf("EmbedDocs = %v, %v after %d calls", vecs, err, calls)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("FallbackEmbedder with different models did not panic")
+		}
+	}()
+	FallbackEmbedder(llm.QuoteEmbedder(), other{})
+}
+
+// other is an embedder for a model other than quote.
+type other struct{ llm.Embedder }
+
+func (other) EmbeddingModel() string { return "other" }
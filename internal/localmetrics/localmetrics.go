@@ -0,0 +1,52 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package localmetrics supports gathering OpenTelemetry metrics
+// when running locally, without GCP (compare [gcpmetrics]).
+// Metrics can be written periodically to a writer such as standard output,
+// or served over HTTP in the Prometheus text exposition format.
+//
+// [gcpmetrics]: https://pkg.go.dev/golang.org/x/oscar/internal/gcp/gcpmetrics
+package localmetrics
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// NewStdoutMeterProvider creates an [sdkmetric.MeterProvider] that writes
+// all metrics as JSON to w every interval.
+// Call Shutdown on the MeterProvider after use, to write the final values.
+func NewStdoutMeterProvider(w io.Writer, interval time.Duration) (*sdkmetric.MeterProvider, error) {
+	ex, err := stdoutmetric.New(stdoutmetric.WithWriter(w), stdoutmetric.WithoutTimestamps())
+	if err != nil {
+		return nil, err
+	}
+	r := sdkmetric.NewPeriodicReader(ex, sdkmetric.WithInterval(interval))
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(r)), nil
+}
+
+// NewPrometheusMeterProvider creates an [sdkmetric.MeterProvider]
+// whose metrics are served by the returned [http.Handler]
+// in the Prometheus text exposition format,
+// so that they can be scraped by Prometheus or read by a person.
+// The metrics are converted to Prometheus form by the
+// OpenTelemetry Prometheus exporter, which replaces characters
+// not allowed in Prometheus names with underscores and
+// adds a "_total" suffix to counters.
+func NewPrometheusMeterProvider() (*sdkmetric.MeterProvider, http.Handler, error) {
+	reg := prometheus.NewRegistry()
+	ex, err := otelprom.New(otelprom.WithRegisterer(reg), otelprom.WithoutScopeInfo())
+	if err != nil {
+		return nil, nil, err
+	}
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(ex)), promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localmetrics
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+func TestPrometheus(t *testing.T) {
+	ctx := context.Background()
+	mp, h, err := NewPrometheusMeterProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meter := mp.Meter("test")
+	c, err := meter.Int64Counter("test/count", metric.WithDescription("a counter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Add(ctx, 3, metric.WithAttributes(attribute.String("op", "get")))
+	c.Add(ctx, 1, metric.WithAttributes(attribute.String("op", "é \"q\"\n")))
+
+	// The same metric from another meter is reported under one TYPE line.
+	c2, err := mp.Meter("test2").Int64Counter("test/count", metric.WithDescription("a counter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2.Add(ctx, 2, metric.WithAttributes(attribute.String("op", "set")))
+	hist, err := meter.Float64Histogram("test-hist", metric.WithExplicitBucketBoundaries(1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hist.Record(ctx, 0.5)
+	hist.Record(ctx, 5)
+	hist.Record(ctx, 50)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	have := w.Body.String()
+	for _, want := range []string{
+		"# HELP test_count_total a counter\n",
+		"# TYPE test_count_total counter\n",
+		"test_count_total{op=\"get\"} 3\n",
+		"test_count_total{op=\"set\"} 2\n",
+		"test_count_total{op=\"é \\\"q\\\"\\n\"} 1\n",
+		"# TYPE test_hist histogram\n",
+		"test_hist_bucket{le=\"1\"} 1\n",
+		"test_hist_bucket{le=\"10\"} 2\n",
+		"test_hist_bucket{le=\"+Inf\"} 3\n",
+		"test_hist_sum 55.5\n",
+		"test_hist_count 3\n",
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("missing %q in output:\n%s", want, have)
+		}
+	}
+	if n := strings.Count(have, "# TYPE test_count_total "); n != 1 {
+		t.Errorf("output has %d TYPE lines for test_count_total, want 1:\n%s", n, have)
+	}
+}
+
+func TestStdout(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	mp, err := NewStdoutMeterProvider(&buf, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := mp.Meter("test").Int64Counter("test-counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Add(ctx, 1)
+	if err := mp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"Name":"test-counter"`) {
+		t.Errorf("output does not mention test-counter:\n%s", buf.String())
+	}
+}
@@ -4,13 +4,15 @@
 
 // Package ollama implements access to offline Ollama model.
 //
-// [Client] implements [llm.Embedder]. Use [NewClient] to connect.
+// [Client] implements [llm.Embedder] and [llm.ContentGenerator].
+// Use [NewClient] to connect.
 package ollama
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -18,7 +20,9 @@ import (
 	"net/url"
 	"os"
 	"slices"
+	"strings"
 
+	"golang.org/x/oscar/internal/gcp/grpcerrors"
 	"golang.org/x/oscar/internal/llm"
 )
 
@@ -27,17 +31,29 @@ import (
 
 // A Client represents a connection to Ollama.
 type Client struct {
-	slog  *slog.Logger
-	hc    *http.Client
-	url   *url.URL // url of the ollama server
-	model string
+	slog            *slog.Logger
+	hc              *http.Client
+	url             *url.URL // url of the ollama server
+	embeddingModel  string
+	generativeModel string
+	temperature     float32 // negative means use the model's default
 }
 
+// Default models, used by gaby when running offline.
+// The generative model is multimodal, so that it
+// can be used with [golang.org/x/oscar/internal/codeimage].
+const (
+	DefaultEmbeddingModel  = "mxbai-embed-large"
+	DefaultGenerativeModel = "gemma3"
+)
+
 // NewClient returns a connection to Ollama server. If empty, the
 // server is assumed to be hosted at http://127.0.0.1:11434.
-// The model is the model name to use for embedding.
+// The embeddingModel is the model name to use for embedding.
 // A typical model for embedding is "mxbai-embed-large".
-func NewClient(lg *slog.Logger, hc *http.Client, server string, model string) (*Client, error) {
+// The generativeModel is the model name to use for content generation.
+// Either may be empty if the client will not be used for that purpose.
+func NewClient(lg *slog.Logger, hc *http.Client, server, embeddingModel, generativeModel string) (*Client, error) {
 	if server == "" {
 		host := os.Getenv("OLLAMA_HOST")
 		if host == "" {
@@ -49,11 +65,25 @@ func NewClient(lg *slog.Logger, hc *http.Client, server string, model string) (*
 	if err != nil {
 		return nil, err
 	}
-	return &Client{slog: lg, hc: hc, url: u, model: model}, nil
+	return &Client{
+		slog:            lg,
+		hc:              hc,
+		url:             u,
+		embeddingModel:  embeddingModel,
+		generativeModel: generativeModel,
+		temperature:     -1,
+	}, nil
 }
 
 const maxBatch = 512 // default physical batch size in ollama
 
+var _ llm.Embedder = (*Client)(nil)
+
+// EmbeddingModel returns the name of the embedding model.
+func (c *Client) EmbeddingModel() string {
+	return c.embeddingModel
+}
+
 // EmbedDocs returns the vector embeddings for the docs,
 // implementing [llm.Embedder].
 func (c *Client) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vector, error) {
@@ -66,7 +96,7 @@ func (c *Client) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vect
 			input := doc.Title + "\n\n" + doc.Text
 			inputs = append(inputs, input)
 		}
-		vs, err := embed(ctx, c.hc, embedURL, inputs, c.model)
+		vs, err := embed(ctx, c.hc, embedURL, inputs, c.embeddingModel)
 		if err != nil {
 			return nil, err
 		}
@@ -106,28 +136,26 @@ func embed(ctx context.Context, hc *http.Client, embedURL *url.URL, inputs []str
 		return nil, err
 	}
 
-	if err := embedError(response, embResp); err != nil {
+	if err := responseError(response, embResp); err != nil {
 		return nil, err
 	}
 	return embeddings(embResp)
 }
 
-// embedError extracts error from ollama's response, if any.
-func embedError(resp *http.Response, embResp []byte) error {
+// responseError extracts error from ollama's response, if any.
+func responseError(resp *http.Response, body []byte) error {
 	if resp.StatusCode == 200 {
 		return nil
 	}
-	if resp.StatusCode == 400 {
-		var e struct {
-			Error string `json:"error"`
-		}
-		// ollama returns JSON with error field set for bad requests.
-		if err := json.Unmarshal(embResp, &e); err != nil {
-			return err
-		}
-		return fmt.Errorf("ollama response error: %s", e.Error)
+	var e struct {
+		Error string `json:"error"`
+	}
+	// ollama returns JSON with error field set for bad requests
+	// and for unknown models.
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		return grpcerrors.WithHTTPStatus(fmt.Errorf("ollama response error: %s: %s", resp.Status, e.Error), resp.StatusCode)
 	}
-	return fmt.Errorf("ollama response error: %s", resp.Status)
+	return grpcerrors.WithHTTPStatus(fmt.Errorf("ollama response error: %s", resp.Status), resp.StatusCode)
 }
 
 func embeddings(embResp []byte) ([]llm.Vector, error) {
@@ -141,3 +169,110 @@ func embeddings(embResp []byte) ([]llm.Vector, error) {
 	}
 	return e.Embeddings, nil
 }
+
+var _ llm.ContentGenerator = (*Client)(nil)
+
+// Model returns the name of the client's generative model.
+func (c *Client) Model() string {
+	return c.generativeModel
+}
+
+// SetTemperature sets the temperature of the client's generative model.
+func (c *Client) SetTemperature(t float32) {
+	c.temperature = t
+}
+
+// A chatRequest is a request to ollama's chat endpoint.
+type chatRequest struct {
+	Model    string         `json:"model"`
+	Messages []chatMessage  `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Format   map[string]any `json:"format,omitempty"` // JSON schema for the response
+	Options  map[string]any `json:"options,omitempty"`
+}
+
+// A chatMessage is a single message in a chat.
+// Images are base64-encoded and are only
+// understood by multimodal models.
+type chatMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  [][]byte `json:"images,omitempty"`
+}
+
+// GenerateContent returns the model's response for the prompt parts,
+// implementing [llm.ContentGenerator.GenerateContent].
+// If schema is non-nil, the response is constrained to JSON
+// matching the schema, using ollama's structured outputs.
+// Text parts are sent as a single message, separated by blank lines;
+// [llm.Blob] parts are sent as images attached to that message.
+func (c *Client) GenerateContent(ctx context.Context, schema *llm.Schema, promptParts []llm.Part) (string, error) {
+	msg := chatMessage{Role: "user"}
+	var texts []string
+	for _, p := range promptParts {
+		switch p := p.(type) {
+		case llm.Text:
+			texts = append(texts, string(p))
+		case llm.Blob:
+			msg.Images = append(msg.Images, p.Data)
+		default:
+			return "", fmt.Errorf("ollama.GenerateContent: bad type for part: %T; need llm.Text or llm.Blob", p)
+		}
+	}
+	msg.Content = strings.Join(texts, "\n\n")
+	req := &chatRequest{
+		Model:    c.generativeModel,
+		Messages: []chatMessage{msg},
+		Format:   schema.JSONSchema(),
+	}
+	if c.temperature >= 0 {
+		req.Options = map[string]any{"temperature": c.temperature}
+	}
+	resp, err := c.chat(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("ollama.GenerateContent: %w", err)
+	}
+	if resp == "" {
+		return "", errors.New("ollama.GenerateContent: no content generated")
+	}
+	return resp, nil
+}
+
+// chat sends req to ollama's chat endpoint
+// and returns the content of the response message.
+func (c *Client) chat(ctx context.Context, req *chatRequest) (string, error) {
+	js, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	chatURL := c.url.JoinPath("/api/chat") // ollama chat endpoint
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, chatURL.String(), bytes.NewReader(js))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.hc.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if err := responseError(response, body); err != nil {
+		return "", err
+	}
+	var r struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", err
+	}
+	return r.Message.Content, nil
+}
@@ -7,10 +7,14 @@ package ollama
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
 
+	"golang.org/x/oscar/internal/codeimage"
 	"golang.org/x/oscar/internal/httprr"
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/testutil"
@@ -44,7 +48,7 @@ func newTestClient(t *testing.T, rrfile string) *Client {
 	rr, err := httprr.Open(rrfile, http.DefaultTransport)
 	check(err)
 
-	c, err := NewClient(lg, rr.Client(), "", "mxbai-embed-large")
+	c, err := NewClient(lg, rr.Client(), "", DefaultEmbeddingModel, DefaultGenerativeModel)
 	check(err)
 
 	return c
@@ -102,3 +106,99 @@ func TestBigBatch(t *testing.T) {
 		t.Fatalf("len(vecs) = %d, but len(docs) = %d", len(vecs), len(docs))
 	}
 }
+
+// The generate*.httprr and codeimage.httprr traces are recorded
+// against a local ollama server that has pulled DefaultGenerativeModel:
+//
+//	ollama pull gemma3
+//	go test -run='TestGenerate|TestCodeImage' -httprecord='generate|codeimage'
+//
+// The tests are skipped until the traces are recorded.
+
+// skipUnrecorded skips the test if file has not been recorded
+// and is not being recorded.
+func skipUnrecorded(t *testing.T, file string) {
+	if _, err := os.Stat(file); err == nil {
+		return
+	}
+	if rec, _ := httprr.Recording(file); !rec {
+		t.Skipf("%s not recorded", file)
+	}
+}
+
+func TestGenerateContentText(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	skipUnrecorded(t, "testdata/generatetext.httprr")
+	c := newTestClient(t, "testdata/generatetext.httprr")
+	if model := c.Model(); model != DefaultGenerativeModel {
+		t.Fatalf("Model() = %q, want %q", model, DefaultGenerativeModel)
+	}
+	c.SetTemperature(0)
+	response, err := c.GenerateContent(ctx, nil, []llm.Part{llm.Text("CanonicalHeaderKey returns the canonical format of the header key s. The canonicalization converts the first letter and any letter following a hyphen to upper case; the rest are converted to lowercase. For example, the canonical key for 'accept-encoding' is 'Accept-Encoding'. If s contains a space or invalid header field bytes, it is returned without modifications."), llm.Text("When should I use CanonicalHeaderKey?")})
+	check(err)
+	if len(response) == 0 {
+		t.Fatal("no response")
+	}
+}
+
+func TestGenerateContentJSON(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	skipUnrecorded(t, "testdata/generatejson.httprr")
+	c := newTestClient(t, "testdata/generatejson.httprr")
+	c.SetTemperature(0)
+	response, err := c.GenerateContent(ctx,
+		&llm.Schema{
+			Type: llm.TypeObject,
+			Properties: map[string]*llm.Schema{
+				"answer": {
+					Type: llm.TypeString,
+				},
+				"confidence": {
+					Type: llm.TypeInteger,
+				},
+			},
+			Required: []string{"answer", "confidence"},
+		},
+		[]llm.Part{
+			llm.Text("(confidence is between 0 and 100)"),
+			llm.Text("What is the tallest mountain in the world?"),
+		})
+	check(err)
+	var v struct {
+		Answer     string
+		Confidence int
+	}
+	if err := json.Unmarshal([]byte(response), &v); err != nil {
+		t.Fatalf("response %q is not JSON: %v", response, err)
+	}
+	if v.Answer == "" {
+		t.Fatalf("response %q has no answer", response)
+	}
+}
+
+func TestCodeImage(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	skipUnrecorded(t, "testdata/codeimage.httprr")
+	c := newTestClient(t, "testdata/codeimage.httprr")
+	data, err := os.ReadFile("../codeimage/testdata/hello-world.png")
+	check(err)
+	got, err := codeimage.InBlob(ctx, llm.Blob{MIMEType: "image/png", Data: data}, c)
+	check(err)
+	if !strings.Contains(got, "func main()") {
+		t.Errorf("codeimage.InBlob returned:\n%s\nwant a main function", got)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	ctx := context.Background()
+	skipUnrecorded(t, "testdata/generateerror.httprr")
+	c := newTestClient(t, "testdata/generateerror.httprr")
+	c.generativeModel = "no-such-model"
+	_, err := c.GenerateContent(ctx, nil, []llm.Part{llm.Text("hello")})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no-such-model") {
+		t.Fatalf("GenerateContent with bad model = %v, want 404 error mentioning model", err)
+	}
+}
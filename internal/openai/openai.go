@@ -0,0 +1,352 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package openai implements access to models served using the
+// OpenAI-compatible HTTP API, which is implemented by vLLM,
+// the llama.cpp server, and many other model servers.
+//
+// [Client] implements [llm.Embedder] and [llm.ContentGenerator],
+// using the /embeddings and /chat/completions endpoints.
+// Use [NewClient] to connect.
+package openai
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/oscar/internal/gcp/grpcerrors"
+	"golang.org/x/oscar/internal/httprr"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/secret"
+)
+
+// NOTE: This package does not use third party packages for
+// querying models to avoid bringing in their many dependencies.
+
+// Scrub is a request scrubber for use with [rsc.io/httprr].
+func Scrub(req *http.Request) error {
+	req.Header.Del("Authorization") // delete API key
+
+	if ctype := req.Header.Get("Content-Type"); ctype == "application/json" {
+		// Canonicalize JSON body.
+		b := req.Body.(*httprr.Body)
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b.Data); err == nil {
+			b.Data = buf.Bytes()
+		}
+	}
+	return nil
+}
+
+// A Client represents a connection to an OpenAI-compatible server.
+type Client struct {
+	slog            *slog.Logger
+	hc              *http.Client
+	url             *url.URL // base URL of the API, ending in /v1
+	key             string   // API key, if any
+	embeddingModel  string
+	generativeModel string
+	temperature     float32 // negative means use default
+}
+
+// DefaultServer is the server used by [NewClient]
+// when neither its server argument nor $OPENAI_BASE_URL is set.
+// It is the default address of a vLLM server.
+const DefaultServer = "http://127.0.0.1:8000/v1"
+
+// NewClient returns a connection to the OpenAI-compatible server
+// whose API has the given base URL, such as "http://127.0.0.1:8000/v1".
+// If server is empty, NewClient uses $OPENAI_BASE_URL if set,
+// or else [DefaultServer].
+//
+// If sdb has a secret named for the server's host name
+// (for example, "127.0.0.1" or "api.example.com"), of the form
+// "KEY" or "user:KEY", the client sends KEY as a bearer token.
+// Otherwise the client sends no credentials,
+// which is typical for servers running locally.
+//
+// The embeddingModel is the model name to use for embedding,
+// and the generativeModel is the model name to use for generation,
+// as listed by the server's /models endpoint.
+// Either may be empty if the client will not be used for that purpose.
+func NewClient(lg *slog.Logger, sdb secret.DB, hc *http.Client, server, embeddingModel, generativeModel string) (*Client, error) {
+	if server == "" {
+		server = os.Getenv("OPENAI_BASE_URL")
+	}
+	if server == "" {
+		server = DefaultServer
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("openai.NewClient: invalid server URL %q", server)
+	}
+	key, _ := sdb.Get(u.Hostname())
+	// If key is from .netrc, ignore user name.
+	if _, pass, ok := strings.Cut(key, ":"); ok {
+		key = pass
+	}
+	return &Client{
+		slog:            lg,
+		hc:              hc,
+		url:             u,
+		key:             key,
+		embeddingModel:  embeddingModel,
+		generativeModel: generativeModel,
+		temperature:     -1,
+	}, nil
+}
+
+// maxBatch is the maximum number of documents sent in a single
+// embedding request. Servers do not agree on a limit,
+// so this is a conservative choice.
+const maxBatch = 128
+
+var _ llm.Embedder = (*Client)(nil)
+
+// EmbeddingModel returns the name of the embedding model.
+func (c *Client) EmbeddingModel() string {
+	return c.embeddingModel
+}
+
+// EmbedDocs returns the vector embeddings for the docs,
+// implementing [llm.Embedder].
+// The vectors are normalized, since not all servers normalize them.
+func (c *Client) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vector, error) {
+	var vecs []llm.Vector
+	for docs := range slices.Chunk(docs, maxBatch) {
+		var inputs []string
+		for _, d := range docs {
+			// The API has no separate title.
+			input := d.Text
+			if d.Title != "" {
+				input = d.Title + "\n\n" + d.Text
+			}
+			inputs = append(inputs, input)
+		}
+		vs, err := c.embed(ctx, inputs)
+		if err != nil {
+			return vecs, fmt.Errorf("openai.EmbedDocs: %w", err)
+		}
+		vecs = append(vecs, vs...)
+	}
+	return vecs, nil
+}
+
+// embed returns the embeddings of the inputs.
+func (c *Client) embed(ctx context.Context, inputs []string) ([]llm.Vector, error) {
+	req := struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{
+		Model: c.embeddingModel,
+		Input: inputs,
+	}
+	var resp struct {
+		Data []struct {
+			Index     int        `json:"index"`
+			Embedding llm.Vector `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := c.post(ctx, "embeddings", &req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(inputs) {
+		return nil, fmt.Errorf("server returned %d embeddings for %d inputs", len(resp.Data), len(inputs))
+	}
+	vecs := make([]llm.Vector, len(inputs))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vecs) || vecs[d.Index] != nil {
+			return nil, fmt.Errorf("server returned invalid embedding index %d", d.Index)
+		}
+		vecs[d.Index] = d.Embedding.Normal()
+	}
+	return vecs, nil
+}
+
+var _ llm.ContentGenerator = (*Client)(nil)
+
+// Model returns the name of the client's generative model.
+func (c *Client) Model() string {
+	return c.generativeModel
+}
+
+// SetTemperature sets the temperature of the client's generative model.
+func (c *Client) SetTemperature(t float32) {
+	c.temperature = t
+}
+
+// A chatRequest is a request to the /chat/completions endpoint.
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    *float32        `json:"temperature,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+// A chatMessage is a single message in a chat.
+// Content is either a string or a list of [contentPart]s.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+// A contentPart is part of the content of a message.
+type contentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+// A responseFormat constrains the response to JSON matching a schema.
+type responseFormat struct {
+	Type       string      `json:"type"` // "json_schema"
+	JSONSchema *jsonSchema `json:"json_schema"`
+}
+
+type jsonSchema struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+}
+
+// A chatResponse is a response from the /chat/completions endpoint.
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// GenerateContent returns the model's response for the prompt parts,
+// implementing [llm.ContentGenerator.GenerateContent].
+// If schema is non-nil, the response is constrained to JSON
+// matching the schema, using the server's structured output support.
+func (c *Client) GenerateContent(ctx context.Context, schema *llm.Schema, promptParts []llm.Part) (string, error) {
+	content, err := c.content(promptParts)
+	if err != nil {
+		return "", fmt.Errorf("openai.GenerateContent: %w", err)
+	}
+	req := &chatRequest{
+		Model:    c.generativeModel,
+		Messages: []chatMessage{{Role: "user", Content: content}},
+	}
+	if c.temperature >= 0 {
+		req.Temperature = &c.temperature
+	}
+	if schema != nil {
+		req.ResponseFormat = &responseFormat{
+			Type: "json_schema",
+			JSONSchema: &jsonSchema{
+				Name:   "response",
+				Schema: schema.JSONSchema(),
+			},
+		}
+	}
+	var resp chatResponse
+	if err := c.post(ctx, "chat/completions", req, &resp); err != nil {
+		return "", fmt.Errorf("openai.GenerateContent: %w", err)
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return "", errors.New("openai.GenerateContent: no content generated")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// content returns the message content for the prompt parts.
+// A prompt of only text is sent as a single string,
+// which all servers accept; a prompt containing blobs is sent
+// as a list of parts, with the blobs as data URLs.
+func (c *Client) content(promptParts []llm.Part) (any, error) {
+	var texts []string
+	var parts []contentPart
+	hasBlob := false
+	for _, p := range promptParts {
+		switch p := p.(type) {
+		case llm.Text:
+			texts = append(texts, string(p))
+			parts = append(parts, contentPart{Type: "text", Text: string(p)})
+		case llm.Blob:
+			hasBlob = true
+			u := "data:" + p.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(p.Data)
+			parts = append(parts, contentPart{Type: "image_url", ImageURL: &imageURL{URL: u}})
+		default:
+			return nil, fmt.Errorf("bad type for part: %T; need llm.Text or llm.Blob", p)
+		}
+	}
+	if hasBlob {
+		return parts, nil
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// post sends a POST request with the JSON encoding of req
+// to the endpoint and decodes the JSON response into resp.
+func (c *Client) post(ctx context.Context, endpoint string, req, resp any) error {
+	js, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url.JoinPath(endpoint).String(), bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("Accept", "application/json")
+	if c.key != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.key)
+	}
+	hresp, err := c.hc.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+	data, err := io.ReadAll(hresp.Body)
+	if err != nil {
+		return err
+	}
+	if hresp.StatusCode != http.StatusOK {
+		return responseError(hresp, data)
+	}
+	return json.Unmarshal(data, resp)
+}
+
+// responseError returns the error for an unsuccessful response
+// with the given body.
+func responseError(resp *http.Response, body []byte) error {
+	// Servers return JSON describing the problem, either in an
+	// error object, as OpenAI does, or at top level, as some
+	// versions of vLLM do. Proxies may return something else entirely.
+	var e struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil {
+		if msg := cmp.Or(e.Error.Message, e.Message); msg != "" {
+			return grpcerrors.WithHTTPStatus(fmt.Errorf("%s: %s", resp.Status, msg), resp.StatusCode)
+		}
+	}
+	return grpcerrors.WithHTTPStatus(fmt.Errorf("%s", resp.Status), resp.StatusCode)
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/oscar/internal/httprr"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/secret"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+var docs = []llm.EmbedDoc{
+	{Text: "for loops"},
+	{Text: "for all time, always"},
+	{Text: "break statements"},
+	{Text: "breakdancing"},
+	{Text: "forever could never be long enough for me"},
+	{Text: "the macarena"},
+}
+
+var matches = map[string]string{
+	"for loops":            "break statements",
+	"for all time, always": "forever could never be long enough for me",
+	"breakdancing":         "the macarena",
+}
+
+func init() {
+	for k, v := range matches {
+		matches[v] = k
+	}
+}
+
+// The traces in testdata are recorded against a vLLM server
+// at [DefaultServer] serving these models, such as one started with
+//
+//	vllm serve Qwen/Qwen2.5-1.5B-Instruct --port 8000
+//
+// (and an embedding server for BAAI/bge-small-en-v1.5
+// behind the same address), by running
+//
+//	go test -httprecord=.
+//
+// The tests are skipped until the traces are recorded.
+const (
+	testEmbeddingModel  = "BAAI/bge-small-en-v1.5"
+	testGenerativeModel = "Qwen/Qwen2.5-1.5B-Instruct"
+)
+
+func newTestClient(t *testing.T, rrfile string) *Client {
+	if _, err := os.Stat(rrfile); err != nil {
+		if rec, _ := httprr.Recording(rrfile); !rec {
+			t.Skipf("%s not recorded", rrfile)
+		}
+	}
+	check := testutil.Checker(t)
+	lg := testutil.Slogger(t)
+
+	rr, err := httprr.Open(rrfile, http.DefaultTransport)
+	check(err)
+	rr.ScrubReq(Scrub)
+	sdb := secret.ReadOnlyMap{"127.0.0.1": "nokey"}
+	if rr.Recording() {
+		sdb = secret.Netrc()
+	}
+
+	c, err := NewClient(lg, sdb, rr.Client(), DefaultServer, testEmbeddingModel, testGenerativeModel)
+	check(err)
+
+	return c
+}
+
+func TestEmbedBatch(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := newTestClient(t, "testdata/embedbatch.httprr")
+	if model := c.EmbeddingModel(); model != testEmbeddingModel {
+		t.Fatalf("EmbeddingModel() = %q, want %q", model, testEmbeddingModel)
+	}
+	vecs, err := c.EmbedDocs(ctx, docs)
+	check(err)
+	if len(vecs) != len(docs) {
+		t.Fatalf("len(vecs) = %d, but len(docs) = %d", len(vecs), len(docs))
+	}
+
+	var buf bytes.Buffer
+	for i := range docs {
+		for j := range docs {
+			fmt.Fprintf(&buf, " %.4f", vecs[i].Dot(vecs[j]))
+		}
+		fmt.Fprintf(&buf, "\n")
+	}
+
+	for i, d := range docs {
+		if dot := vecs[i].Dot(vecs[i]); math.Abs(dot-1) > 1e-5 {
+			t.Errorf("vecs[%d].Dot(itself) = %v, want 1", i, dot)
+		}
+		best := ""
+		bestDot := 0.0
+		for j := range docs {
+			if dot := vecs[i].Dot(vecs[j]); i != j && dot > bestDot {
+				best, bestDot = docs[j].Text, dot
+			}
+		}
+		if best != matches[d.Text] {
+			if buf.Len() > 0 {
+				t.Errorf("dot matrix:\n%s", buf.String())
+				buf.Reset()
+			}
+			t.Errorf("%q: best=%q, want %q", d.Text, best, matches[d.Text])
+		}
+	}
+}
+
+func TestGenerateContentText(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := newTestClient(t, "testdata/generatetext.httprr")
+	if model := c.Model(); model != testGenerativeModel {
+		t.Fatalf("Model() = %q, want %q", model, testGenerativeModel)
+	}
+	c.SetTemperature(0)
+	response, err := c.GenerateContent(ctx, nil, []llm.Part{llm.Text("CanonicalHeaderKey returns the canonical format of the header key s. The canonicalization converts the first letter and any letter following a hyphen to upper case; the rest are converted to lowercase. For example, the canonical key for 'accept-encoding' is 'Accept-Encoding'. If s contains a space or invalid header field bytes, it is returned without modifications."), llm.Text("When should I use CanonicalHeaderKey?")})
+	check(err)
+	if len(response) == 0 {
+		t.Fatal("no response")
+	}
+}
+
+func TestGenerateContentJSON(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := newTestClient(t, "testdata/generatejson.httprr")
+	c.SetTemperature(0)
+	response, err := c.GenerateContent(ctx,
+		&llm.Schema{
+			Type: llm.TypeObject,
+			Properties: map[string]*llm.Schema{
+				"answer": {
+					Type: llm.TypeString,
+				},
+				"confidence": {
+					Type: llm.TypeInteger,
+				},
+			},
+			Required: []string{"answer", "confidence"},
+		},
+		[]llm.Part{
+			llm.Text("(confidence is between 0 and 100)"),
+			llm.Text("What is the tallest mountain in the world?"),
+		})
+	check(err)
+	var v struct {
+		Answer     string
+		Confidence int
+	}
+	if err := json.Unmarshal([]byte(response), &v); err != nil {
+		t.Fatalf("response %q is not JSON: %v", response, err)
+	}
+	if v.Answer == "" {
+		t.Fatalf("response %q has no answer", response)
+	}
+}
+
+func TestError(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "testdata/error.httprr")
+	c.generativeModel = "no-such-model"
+	_, err := c.GenerateContent(ctx, nil, []llm.Part{llm.Text("hello")})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no-such-model") {
+		t.Fatalf("GenerateContent with bad model = %v, want 404 error mentioning model", err)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	lg := testutil.Slogger(t)
+	sdb := secret.ReadOnlyMap{"api.example.com": "user:sekret"}
+	c, err := NewClient(lg, sdb, http.DefaultClient, "https://api.example.com/v1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.key != "sekret" {
+		t.Errorf("key = %q, want %q", c.key, "sekret")
+	}
+	if _, err := NewClient(lg, sdb, http.DefaultClient, "localhost:8000", "", ""); err == nil {
+		t.Errorf("NewClient with no scheme succeeded")
+	}
+}
+
+func TestContent(t *testing.T) {
+	c := new(Client)
+	content, err := c.content([]llm.Part{llm.Text("a"), llm.Text("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "a\n\nb" {
+		t.Errorf("text content = %#v, want %q", content, "a\n\nb")
+	}
+
+	content, err = c.content([]llm.Part{llm.Text("a"), llm.Blob{MIMEType: "image/png", Data: []byte("png")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []contentPart{
+		{Type: "text", Text: "a"},
+		{Type: "image_url", ImageURL: &imageURL{URL: "data:image/png;base64,cG5n"}},
+	}
+	if !reflect.DeepEqual(content, want) {
+		t.Errorf("blob content = %#v, want %#v", content, want)
+	}
+}
@@ -204,3 +204,12 @@ func (c *Client) runKey() []byte {
 }
 
 const runKind = "overview.Run"
+
+func init() {
+	storage.RegisterDecoder(runKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(runState))
+	})
+	storage.RegisterDecoder(issueStateKind, func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(issueState))
+	})
+}
@@ -0,0 +1,303 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oscar/internal/storage"
+)
+
+// Lease parameters for file locks.
+// A lock file whose modification time is older than leaseTimeout
+// is considered abandoned and may be taken over by another process.
+// So is a lock file whose holder was a process on the same host
+// that no longer exists, without waiting for the lease to expire.
+// The holder renews its leases every leaseRenew.
+const (
+	leaseTimeout = 2 * time.Minute
+	leaseRenew   = 1 * time.Minute
+	lockPoll     = 100 * time.Millisecond
+)
+
+// A fileLocker implements locks shared by all processes using
+// the same directory, by creating one lease file per held lock.
+// A lock is held by whichever process creates its lease file.
+// While a process holds a lock, it periodically updates
+// the file's modification time to renew the lease;
+// if the process dies, the lease expires and
+// the lock can be acquired by another process.
+// Other processes on the same host can tell sooner that the holder died,
+// since the lease file records the holder's host and process ID.
+type fileLocker struct {
+	dir    string // directory holding lease files
+	holder string // holder identity to record in lease files
+	host   string // host name to record in lease files
+	pid    int    // process ID to record in lease files
+
+	mu     sync.Mutex
+	held   map[string]string // nonces of held locks, by name
+	stop   chan struct{}     // closed by close to stop renewals
+	ticker *time.Ticker      // renewal ticker
+}
+
+// A leaseFile is the content of a lease file.
+type leaseFile struct {
+	Name     string
+	Holder   string
+	Acquired time.Time
+	Nonce    string // distinguishes this acquisition from others by the same holder
+	Host     string // host name of the holding process
+	PID      int    // process ID of the holding process
+}
+
+// newFileLocker returns a fileLocker using lease files in dir,
+// creating dir if necessary.
+func newFileLocker(dir, holder string) (*fileLocker, error) {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	l := &fileLocker{
+		dir:    dir,
+		holder: holder,
+		host:   host,
+		pid:    os.Getpid(),
+		held:   make(map[string]string),
+		stop:   make(chan struct{}),
+		ticker: time.NewTicker(leaseRenew),
+	}
+	go l.renew()
+	return l, nil
+}
+
+// close stops renewing the held leases.
+// The lease files are left behind and expire after leaseTimeout,
+// which is the same as what happens when the process dies.
+func (l *fileLocker) close() {
+	l.ticker.Stop()
+	close(l.stop)
+}
+
+// file returns the name of the lease file for the named lock.
+func (l *fileLocker) file(name string) string {
+	return filepath.Join(l.dir, hex.EncodeToString([]byte(name)))
+}
+
+// renew renews the held leases every leaseRenew until l is closed.
+func (l *fileLocker) renew() {
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-l.ticker.C:
+		}
+		l.mu.Lock()
+		now := time.Now()
+		for name := range l.held {
+			// Ignore errors: the lease is only at risk
+			// if renewing keeps failing for leaseTimeout.
+			os.Chtimes(l.file(name), now, now)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// tryLock tries once to acquire the named lock, reporting whether it succeeded.
+func (l *fileLocker) tryLock(name string) (bool, error) {
+	lf := leaseFile{
+		Name:     name,
+		Holder:   l.holder,
+		Acquired: time.Now(),
+		Nonce:    rand.Text(),
+		Host:     l.host,
+		PID:      l.pid,
+	}
+	data, err := json.Marshal(lf)
+	if err != nil {
+		return false, err
+	}
+	file := l.file(name)
+	for range 2 {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+		if err == nil {
+			_, err1 := f.Write(data)
+			err2 := f.Close()
+			if err := errors.Join(err1, err2); err != nil {
+				os.Remove(file)
+				return false, err
+			}
+			l.mu.Lock()
+			l.held[name] = lf.Nonce
+			l.mu.Unlock()
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+		if !l.breakStale(file) {
+			return false, nil
+		}
+		// Stale lease removed; try again.
+	}
+	return false, nil
+}
+
+// breakStale removes the lease file if it is stale,
+// reporting whether it did.
+func (l *fileLocker) breakStale(file string) bool {
+	if !l.stale(file) {
+		return false
+	}
+	// Rename the file out of the way before removing it,
+	// and check again that the renamed file is stale,
+	// so that two processes breaking the same stale lease
+	// cannot remove a fresh lease created in between.
+	tmp := file + ".stale." + rand.Text()
+	if err := os.Rename(file, tmp); err != nil {
+		return false
+	}
+	if !l.stale(tmp) {
+		// Lost a race: someone else broke the lease and relocked.
+		// Put the fresh lease back unless yet another lease appeared.
+		if err := os.Link(tmp, file); err == nil {
+			os.Remove(tmp)
+			return false
+		}
+	}
+	os.Remove(tmp)
+	return true
+}
+
+// stale reports whether the lease in file has expired
+// or was held by a process on l's host that no longer exists.
+func (l *fileLocker) stale(file string) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	if time.Since(info.ModTime()) > leaseTimeout {
+		return true
+	}
+	lf, err := readLease(file)
+	return err == nil && l.dead(lf)
+}
+
+// dead reports whether the process holding the lease lf
+// is known to no longer exist.
+// Only processes on l's host can be checked;
+// for other hosts, dead reports false and the lease must expire.
+func (l *fileLocker) dead(lf *leaseFile) bool {
+	if lf.Host == "" || lf.Host != l.host || lf.PID <= 0 || lf.PID == l.pid {
+		return false
+	}
+	return !processExists(lf.PID)
+}
+
+// lock acquires the named lock, polling until it is available
+// or until ctx is done.
+func (l *fileLocker) lock(ctx context.Context, name string) error {
+	for {
+		ok, err := l.tryLock(name)
+		if ok || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+var (
+	errNotLocked = errors.New("unlock of unlocked key")
+	errLeaseLost = errors.New("lock lease expired and was taken over")
+)
+
+// unlock releases the named lock, which must be held by l.
+// If the lease expired while it was held, so that another
+// process may have acquired the lock, unlock returns errLeaseLost.
+func (l *fileLocker) unlock(name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	nonce, ok := l.held[name]
+	if !ok {
+		return errNotLocked
+	}
+	delete(l.held, name)
+
+	// Check that the lease is still ours:
+	// if it expired, another process may have taken it.
+	file := l.file(name)
+	lf, err := readLease(file)
+	if err != nil || lf.Nonce != nonce {
+		return errLeaseLost
+	}
+	return os.Remove(file)
+}
+
+// locks returns information about the locks held by all processes.
+func (l *fileLocker) locks() ([]storage.LockInfo, error) {
+	files, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []storage.LockInfo
+	for _, f := range files {
+		if strings.Contains(f.Name(), ".") {
+			// stale lease being removed
+			continue
+		}
+		file := filepath.Join(l.dir, f.Name())
+		lf, err := readLease(file)
+		if err != nil {
+			// removed or being written
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		exp := info.ModTime().Add(leaseTimeout)
+		if time.Now().After(exp) || l.dead(lf) {
+			continue
+		}
+		list = append(list, storage.LockInfo{
+			Name:     lf.Name,
+			Holder:   lf.Holder,
+			Acquired: lf.Acquired,
+			Expires:  exp,
+		})
+	}
+	slices.SortFunc(list, func(x, y storage.LockInfo) int {
+		return strings.Compare(x.Name, y.Name)
+	})
+	return list, nil
+}
+
+// readLease reads the lease file.
+func readLease(file string) (*leaseFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lf := new(leaseFile)
+	if err := json.Unmarshal(data, lf); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
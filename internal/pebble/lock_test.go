@@ -0,0 +1,186 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestFileLocker(t *testing.T) {
+	// Two fileLockers on the same directory
+	// act like two processes sharing a database.
+	dir := t.TempDir()
+	l1, err := newFileLocker(dir, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.close()
+	l2, err := newFileLocker(dir, "p2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.close()
+
+	tryLock := func(l *fileLocker, name string) bool {
+		t.Helper()
+		ok, err := l.tryLock(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !tryLock(l1, "abc") {
+		t.Fatalf("p1 tryLock(abc) = false, want true")
+	}
+	if tryLock(l2, "abc") {
+		t.Fatalf("p2 tryLock(abc) while p1 holds it = true, want false")
+	}
+	locks, err := l2.locks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || locks[0].Name != "abc" || locks[0].Holder != "p1" {
+		t.Fatalf("p2 locks() = %+v, want abc held by p1", locks)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPoll)
+	defer cancel()
+	if err := l2.lock(ctx, "abc"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("p2 lock(abc) while p1 holds it = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	c := make(chan error)
+	go func() {
+		c <- l2.lock(context.Background(), "abc")
+	}()
+	time.Sleep(2 * lockPoll)
+	if err := l1.unlock("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-c; err != nil {
+		t.Fatalf("p2 lock(abc) after p1 unlock = %v", err)
+	}
+	if err := l1.unlock("abc"); err != errNotLocked {
+		t.Fatalf("p1 unlock(abc) not held = %v, want %v", err, errNotLocked)
+	}
+
+	// An expired lease can be taken over,
+	// and the old holder finds out when unlocking.
+	old := time.Now().Add(-2 * leaseTimeout)
+	if err := os.Chtimes(l2.file("abc"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if locks, err := l1.locks(); err != nil || len(locks) != 0 {
+		t.Fatalf("locks() with expired lease = %+v, %v, want none", locks, err)
+	}
+	if !tryLock(l1, "abc") {
+		t.Fatalf("p1 tryLock(abc) with expired lease = false, want true")
+	}
+	if err := l2.unlock("abc"); err != errLeaseLost {
+		t.Fatalf("p2 unlock(abc) after takeover = %v, want %v", err, errLeaseLost)
+	}
+	if err := l1.unlock("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("lease files left after unlock: %v", files)
+	}
+}
+
+func TestLockDeadHolder(t *testing.T) {
+	// A lease held by a process on the same host that has exited
+	// can be taken over at once, but not one from another host.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	deadPID := cmd.Process.Pid
+	if processExists(deadPID) {
+		t.Skipf("cannot detect that process %d exited on %s", deadPID, runtime.GOOS)
+	}
+
+	dir := t.TempDir()
+	l1, err := newFileLocker(dir, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.close()
+	l2, err := newFileLocker(dir, "p2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.close()
+
+	l2.host = "elsewhere"
+	l2.pid = deadPID
+	if ok, err := l2.tryLock("abc"); !ok || err != nil {
+		t.Fatalf("p2 tryLock(abc) = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := l1.tryLock("abc"); ok || err != nil {
+		t.Fatalf("p1 tryLock(abc) held by other host = %v, %v, want false, nil", ok, err)
+	}
+	if err := l2.unlock("abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	l2.host = l1.host
+	if ok, err := l2.tryLock("abc"); !ok || err != nil {
+		t.Fatalf("p2 tryLock(abc) = %v, %v, want true, nil", ok, err)
+	}
+	if locks, err := l1.locks(); err != nil || len(locks) != 0 {
+		t.Fatalf("locks() with dead holder = %+v, %v, want none", locks, err)
+	}
+	if ok, err := l1.tryLock("abc"); !ok || err != nil {
+		t.Fatalf("p1 tryLock(abc) held by exited process = %v, %v, want true, nil", ok, err)
+	}
+	if err := l2.unlock("abc"); err != errLeaseLost {
+		t.Fatalf("p2 unlock(abc) after takeover = %v, want %v", err, errLeaseLost)
+	}
+	if err := l1.unlock("abc"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockReopen(t *testing.T) {
+	// A lock left held by a closed database
+	// blocks the next opener until its lease expires.
+	lg := testutil.Slogger(t)
+	dir := filepath.Join(t.TempDir(), "db")
+	sdb, err := Create(lg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := sdb.(*db)
+	d.Lock("abc")
+	d.Close()
+
+	sdb, err = Open(lg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+	d = sdb.(*db)
+	if d.TryLock("abc") {
+		t.Fatalf("TryLock(abc) held by closed db = true, want false")
+	}
+	old := time.Now().Add(-2 * leaseTimeout)
+	if err := os.Chtimes(d.f.file("abc"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if !d.TryLock("abc") {
+		t.Fatalf("TryLock(abc) after lease expired = false, want true")
+	}
+	d.Unlock("abc")
+}
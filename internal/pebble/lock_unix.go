@@ -0,0 +1,20 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package pebble
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processExists reports whether a process with the given ID exists.
+func processExists(pid int) bool {
+	// Signal 0 checks for the process without sending a signal.
+	// EPERM means the process exists but belongs to another user.
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
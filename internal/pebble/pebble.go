@@ -5,13 +5,21 @@
 // Package pebble implements a storage.DB using Pebble,
 // a production-quality key-value database from CockroachDB.
 // A pebble database can only be opened by one process at a time.
+//
+// Locks acquired using the database's Lock method are recorded in
+// lease files in the database directory, so that they are shared
+// with any other process using the same directory.
+// See [db.LockContext] for details.
 package pebble
 
 import (
 	"bytes"
 	"cmp"
+	"context"
 	"iter"
 	"log/slog"
+	"path/filepath"
+	"sync"
 
 	"github.com/cockroachdb/pebble"
 	"golang.org/x/oscar/internal/storage"
@@ -35,28 +43,116 @@ func open(lg *slog.Logger, dir string, opts *pebble.Options) (storage.DB, error)
 		lg.Error("pebble open", "dir", dir, "create", opts.ErrorIfExists, "err", err)
 		return nil, err
 	}
-	return &db{p: p, slog: lg}, nil
+	f, err := newFileLocker(filepath.Join(dir, lockDir), storage.LockHolder())
+	if err != nil {
+		p.Close()
+		lg.Error("pebble open locks", "dir", dir, "err", err)
+		return nil, err
+	}
+	return &db{p: p, f: f, slog: lg}, nil
 }
 
+// lockDir is the subdirectory of the database directory
+// holding lease files for held locks.
+const lockDir = "oscar-locks"
+
 type db struct {
 	p    *pebble.DB
-	m    storage.MemLocker
+	m    storage.MemLocker // locks held by this process
+	f    *fileLocker       // locks held by any process
 	slog *slog.Logger
+
+	// feed notifies subscribers of changes made by this process.
+	feed storage.Feed
+
+	// txmu is held for writing while a transaction commits,
+	// and for reading during all other writes, so that a transaction
+	// can check its reads and apply its writes atomically.
+	txmu sync.RWMutex
 }
 
 type batch struct {
 	db *db
 	b  *pebble.Batch
+	c  storage.Changes // keys changed by b
 }
 
+// Lock acquires the lock with the given name.
+// It first acquires the lock among goroutines in this process
+// and then acquires the lease file shared with other processes.
 func (d *db) Lock(key string) {
-	d.m.Lock(key)
+	if err := d.LockContext(context.Background(), key); err != nil {
+		// unreachable except file system error
+		d.Panic("pebble lock", "key", key, "err", err)
+	}
+}
+
+// LockContext implements [storage.ContextLocker.LockContext].
+//
+// Locks are shared with other processes using lease files
+// stored in the oscar-locks subdirectory of the database directory.
+// While a process holds a lock, it renews the lease periodically.
+// If the process exits without unlocking, the lease expires
+// after two minutes and other processes can acquire the lock.
+// Waiting for a lock held by another process polls the lease file.
+func (d *db) LockContext(ctx context.Context, key string) error {
+	if err := d.m.LockContext(ctx, key); err != nil {
+		return err
+	}
+	if err := d.f.lock(ctx, key); err != nil {
+		d.m.Unlock(key)
+		return err
+	}
+	return nil
+}
+
+// TryLock implements [storage.ContextLocker.TryLock].
+func (d *db) TryLock(key string) bool {
+	if !d.m.TryLock(key) {
+		return false
+	}
+	ok, err := d.f.tryLock(key)
+	if err != nil {
+		// unreachable except file system error
+		d.m.Unlock(key)
+		d.Panic("pebble trylock", "key", key, "err", err)
+	}
+	if !ok {
+		d.m.Unlock(key)
+	}
+	return ok
+}
+
+// Locks implements [storage.ContextLocker.Locks].
+// It lists the locks held by all processes using the database directory.
+func (d *db) Locks() []storage.LockInfo {
+	list, err := d.f.locks()
+	if err != nil {
+		// unreachable except file system error
+		d.Panic("pebble locks", "err", err)
+	}
+	return list
 }
 
 func (d *db) Unlock(key string) {
+	switch err := d.f.unlock(key); {
+	case err == errLeaseLost:
+		// Another process may have held the lock at the same time,
+		// but there is nothing to do about it now.
+		d.slog.Error("pebble unlock", "key", key, "err", err)
+	case err != nil:
+		d.Panic("pebble unlock", "key", key, "err", err)
+	}
 	d.m.Unlock(key)
 }
 
+// Subscribe implements [storage.Notifier.Subscribe].
+// Subscriptions observe only changes made through d,
+// not changes made by other processes using the same directory.
+func (d *db) Subscribe(prefix []byte) *storage.Subscription {
+	return d.feed.Subscribe(prefix)
+}
+
 func (d *db) get(key []byte, yield func(val []byte)) {
 	v, c, err := d.p.Get(key)
 	if err == pebble.ErrNotFound {
@@ -78,10 +174,7 @@ func (d *db) Get(key []byte) (val []byte, ok bool) {
 	return
 }
 
-var (
-	sync   = &pebble.WriteOptions{Sync: true}
-	noSync = &pebble.WriteOptions{Sync: false}
-)
+var noSync = &pebble.WriteOptions{Sync: false}
 
 func (d *db) Panic(msg string, args ...any) {
 	d.slog.Error(msg, args...)
@@ -92,6 +185,9 @@ func (d *db) Set(key, val []byte) {
 	if len(key) == 0 {
 		d.Panic("pebble set: empty key")
 	}
+	defer d.feed.Notify(key, key)
+	d.txmu.RLock()
+	defer d.txmu.RUnlock()
 	if err := d.p.Set(key, val, noSync); err != nil {
 		// unreachable except db error
 		d.Panic("pebble set", "key", storage.Fmt(key), "val", storage.Fmt(val), "err", err)
@@ -99,6 +195,9 @@ func (d *db) Set(key, val []byte) {
 }
 
 func (d *db) Delete(key []byte) {
+	defer d.feed.Notify(key, key)
+	d.txmu.RLock()
+	defer d.txmu.RUnlock()
 	if err := d.p.Delete(key, noSync); err != nil {
 		// unreachable except db error
 		d.Panic("pebble delete", "key", storage.Fmt(key), "err", err)
@@ -106,6 +205,9 @@ func (d *db) Delete(key []byte) {
 }
 
 func (d *db) DeleteRange(start, end []byte) {
+	defer d.feed.Notify(start, end)
+	d.txmu.RLock()
+	defer d.txmu.RUnlock()
 	err := cmp.Or(
 		d.p.DeleteRange(start, end, noSync),
 		d.p.Delete(end, noSync),
@@ -124,6 +226,7 @@ func (d *db) Flush() {
 }
 
 func (d *db) Close() {
+	d.f.close()
 	if err := d.p.Close(); err != nil {
 		// unreachable except db error
 		d.Panic("pebble close", "err", err)
@@ -165,8 +268,45 @@ func (d *db) Scan(start, end []byte) iter.Seq2[[]byte, func() []byte] {
 	}
 }
 
+// Transaction implements [storage.TxDB.Transaction].
+// The commit holds an in-process lock that all other writes respect,
+// which is sufficient because a Pebble database can only be opened
+// by one process at a time.
+func (d *db) Transaction(f func(tx storage.Tx) error) error {
+	return storage.RunTx(d.Get, f, func(t *storage.TxLog) bool {
+		var c storage.Changes
+		defer c.Notify(&d.feed)
+		d.txmu.Lock()
+		defer d.txmu.Unlock()
+
+		if !t.Valid(d.Get) {
+			return false
+		}
+		b := d.p.NewBatch()
+		defer b.Close()
+		for key, val := range t.Writes() {
+			c.Add(key)
+			var err error
+			if val == nil {
+				err = b.Delete(key, noSync)
+			} else {
+				err = b.Set(key, val, noSync)
+			}
+			if err != nil {
+				// unreachable except db error
+				d.Panic("pebble transaction", "key", storage.Fmt(key), "err", err)
+			}
+		}
+		if err := d.p.Apply(b, noSync); err != nil {
+			// unreachable except db error
+			d.Panic("pebble transaction apply", "err", err)
+		}
+		return true
+	})
+}
+
 func (d *db) Batch() storage.Batch {
-	return &batch{d, d.p.NewBatch()}
+	return &batch{db: d, b: d.p.NewBatch()}
 }
 
 func (b *batch) Set(key, val []byte) {
@@ -177,6 +317,7 @@ func (b *batch) Set(key, val []byte) {
 		// unreachable except db error
 		b.db.Panic("pebble batch set", "key", storage.Fmt(key), "val", storage.Fmt(val), "err", err)
 	}
+	b.c.Add(key)
 }
 
 func (b *batch) Delete(key []byte) {
@@ -184,6 +325,7 @@ func (b *batch) Delete(key []byte) {
 		// unreachable except db error
 		b.db.Panic("pebble batch delete", "key", storage.Fmt(key), "err", err)
 	}
+	b.c.Add(key)
 }
 
 func (b *batch) DeleteRange(start, end []byte) {
@@ -195,6 +337,7 @@ func (b *batch) DeleteRange(start, end []byte) {
 		// unreachable except db error
 		b.db.Panic("pebble batch delete range", "start", storage.Fmt(start), "end", storage.Fmt(end), "err", err)
 	}
+	b.c.AddRange(start, end)
 }
 
 // Pebble imposes a higher maximum batch size (4GB), but 100MB is fine.
@@ -210,6 +353,9 @@ func (b *batch) MaybeApply() bool {
 }
 
 func (b *batch) Apply() {
+	defer b.c.Notify(&b.db.feed)
+	b.db.txmu.RLock()
+	defer b.db.txmu.RUnlock()
 	if err := b.db.p.Apply(b.b, noSync); err != nil {
 		// unreachable except db error
 		b.db.Panic("pebble batch apply", "err", err)
@@ -22,6 +22,12 @@ func (w testWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// asDB returns the *db implementing d.
+// (TestDB cannot write d.(*db), because its variable db shadows the type.)
+func asDB(d storage.DB) *db {
+	return d.(*db)
+}
+
 func TestDB(t *testing.T) {
 	lg := testutil.Slogger(t)
 	dir := t.TempDir()
@@ -51,6 +57,9 @@ func TestDB(t *testing.T) {
 
 	storage.TestDB(t, db)
 	storage.TestDBLock(t, db)
+	storage.TestDBContextLock(t, asDB(db))
+	storage.TestNotifier(t, asDB(db))
+	storage.TestTxDB(t, db.(storage.TxDB))
 
 	if testing.Short() {
 		return
@@ -0,0 +1,294 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+	"rsc.io/top"
+)
+
+// A VectorDB is a [storage.VectorDB] stored in a Pebble database.
+//
+// Unlike [storage.MemVectorDB], a VectorDB keeps no copy of the vectors
+// in memory: opening it takes constant time, and Search streams over
+// the stored vectors using a Pebble iterator, computing each similarity
+// directly from the stored encoding.
+//
+// A VectorDB stores each vector compactly, as 2 bytes per entry
+// in the half-precision encoding written by [storage.EncodeHalfVector],
+// using the keys
+//
+//	ordered.Encode("llm.Vector", namespace, id)
+//
+// which are the same keys used by [storage.MemVectorDB].
+// Both can read vectors in either encoding, so the two can be used
+// interchangeably on the same data. Rounding to half precision changes
+// each entry by at most 1 part in 2048, so vectors returned by Get and
+// scores returned by Search differ slightly from the ones passed to Set.
+// Use [VectorDB.FullPrecision] to store vectors exactly instead.
+//
+// VectorDB implements [storage.MetaVectorDB], storing metadata
+// in the same keys and encoding as [storage.MemVectorDB].
+// SearchFilter reads all the metadata in the namespace
+// before streaming over the vectors.
+type VectorDB struct {
+	db        *db
+	namespace string
+	owned     bool // db was opened by OpenVectorDB and is closed by Close
+	full      bool // store vectors with llm.Vector.Encode
+}
+
+// NewVectorDB returns a [VectorDB] storing its vectors in db,
+// which must have been returned by [Open] or [Create].
+// The namespace is incorporated into the keys used in db,
+// to allow multiple vector databases to be stored in a single database.
+func NewVectorDB(sdb storage.DB, namespace string) (*VectorDB, error) {
+	d, ok := sdb.(*db)
+	if !ok {
+		return nil, fmt.Errorf("pebble.NewVectorDB: %T is not a Pebble database", sdb)
+	}
+	return &VectorDB{db: d, namespace: namespace}, nil
+}
+
+// OpenVectorDB opens the existing Pebble database in the named directory
+// and returns a [VectorDB] using the given namespace in that database.
+// Closing the VectorDB closes the database.
+func OpenVectorDB(lg *slog.Logger, dir, namespace string) (*VectorDB, error) {
+	sdb, err := Open(lg, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &VectorDB{db: sdb.(*db), namespace: namespace, owned: true}, nil
+}
+
+// FullPrecision makes v store the vectors passed to later calls to Set
+// exactly, using the 4-byte-per-entry encoding of [llm.Vector.Encode],
+// instead of in half precision.
+// Vectors already stored are unchanged.
+func (v *VectorDB) FullPrecision() {
+	v.full = true
+}
+
+// encode returns the stored encoding of vec.
+func (v *VectorDB) encode(vec llm.Vector) []byte {
+	if v.full {
+		return vec.Encode()
+	}
+	return storage.EncodeHalfVector(vec)
+}
+
+// decode returns the vector stored in key with encoding enc.
+func (v *VectorDB) decode(key, enc []byte) llm.Vector {
+	vec, err := storage.DecodeVector(enc)
+	if err != nil {
+		// unreachable except data corruption
+		v.db.Panic("pebble VectorDB decode", "key", storage.Fmt(key), "err", err)
+	}
+	return vec
+}
+
+// Close closes the underlying database, if it was opened by [OpenVectorDB].
+// Otherwise Close is a no-op; the caller is responsible for closing
+// the database passed to [NewVectorDB].
+func (v *VectorDB) Close() {
+	if v.owned {
+		v.db.Close()
+	}
+}
+
+// key returns the database key for the vector with the given ID.
+func (v *VectorDB) key(id string) []byte {
+	return ordered.Encode("llm.Vector", v.namespace, id)
+}
+
+// metaKey returns the database key for the metadata of the vector with the given ID.
+func (v *VectorDB) metaKey(id string) []byte {
+	return ordered.Encode("llm.VectorMeta", v.namespace, id)
+}
+
+// Set implements [storage.VectorDB.Set].
+func (v *VectorDB) Set(id string, vec llm.Vector) {
+	b := v.Batch()
+	b.Set(id, vec)
+	b.Apply()
+}
+
+// Delete implements [storage.VectorDB.Delete].
+func (v *VectorDB) Delete(id string) {
+	b := v.Batch()
+	b.Delete(id)
+	b.Apply()
+}
+
+// SetMeta implements [storage.MetaVectorDB.SetMeta].
+func (v *VectorDB) SetMeta(id string, meta *storage.VectorMeta) {
+	v.db.Set(v.metaKey(id), storage.JSON(meta))
+}
+
+// Meta implements [storage.MetaVectorDB.Meta].
+func (v *VectorDB) Meta(id string) (*storage.VectorMeta, bool) {
+	var meta *storage.VectorMeta
+	v.db.get(v.metaKey(id), func(val []byte) {
+		meta = v.decodeMeta(v.metaKey(id), val)
+	})
+	return meta, meta != nil
+}
+
+// decodeMeta decodes the metadata val stored in key.
+func (v *VectorDB) decodeMeta(key, val []byte) *storage.VectorMeta {
+	meta := new(storage.VectorMeta)
+	if err := json.Unmarshal(val, meta); err != nil {
+		// unreachable except data corruption
+		v.db.Panic("pebble VectorDB decode", "key", storage.Fmt(key), "err", err)
+	}
+	return meta
+}
+
+// Get implements [storage.VectorDB.Get].
+func (v *VectorDB) Get(id string) (llm.Vector, bool) {
+	var vec llm.Vector
+	ok := false
+	v.db.get(v.key(id), func(val []byte) {
+		vec = v.decode(v.key(id), val)
+		ok = true
+	})
+	return vec, ok
+}
+
+// scan returns an iterator over the keys and encoded vectors in the namespace.
+// The encoded vector is only valid until the next iteration.
+func (v *VectorDB) scan() iter.Seq2[[]byte, func() []byte] {
+	return func(yield func([]byte, func() []byte) bool) {
+		start := ordered.Encode("llm.Vector", v.namespace)
+		end := ordered.Encode("llm.Vector", v.namespace, ordered.Inf)
+		for key, getVal := range v.db.Scan(start, end) {
+			if !yield(key, getVal) {
+				return
+			}
+		}
+	}
+}
+
+// id returns the ID of the vector stored in key.
+func (v *VectorDB) id(key []byte) string {
+	var id string
+	if err := ordered.Decode(key, nil, nil, &id); err != nil {
+		// unreachable except data corruption
+		v.db.Panic("pebble VectorDB decode", "key", storage.Fmt(key), "err", err)
+	}
+	return id
+}
+
+// All implements [storage.VectorDB.All].
+func (v *VectorDB) All() iter.Seq2[string, func() llm.Vector] {
+	return func(yield func(string, func() llm.Vector) bool) {
+		for key, getVal := range v.scan() {
+			val := func() llm.Vector {
+				return v.decode(key, getVal())
+			}
+			if !yield(v.id(key), val) {
+				return
+			}
+		}
+	}
+}
+
+// Search implements [storage.VectorDB.Search].
+// It scans all the stored vectors, without decoding them.
+func (v *VectorDB) Search(target llm.Vector, n int) []storage.VectorResult {
+	return v.SearchFilter(target, n, nil)
+}
+
+// SearchFilter implements [storage.MetaVectorDB.SearchFilter].
+func (v *VectorDB) SearchFilter(target llm.Vector, n int, f *storage.VectorFilter) []storage.VectorResult {
+	// match records whether each ID with metadata matches f.
+	// IDs without metadata match if the zero VectorMeta does.
+	var match map[string]bool
+	zeroOK := true
+	if !f.IsZero() {
+		match = make(map[string]bool)
+		zeroOK = f.Match(nil)
+		start := ordered.Encode("llm.VectorMeta", v.namespace)
+		end := ordered.Encode("llm.VectorMeta", v.namespace, ordered.Inf)
+		for key, getVal := range v.db.Scan(start, end) {
+			var id string
+			if err := ordered.Decode(key, nil, nil, &id); err != nil {
+				// unreachable except data corruption
+				v.db.Panic("pebble VectorDB decode", "key", storage.Fmt(key), "err", err)
+			}
+			match[id] = f.Match(v.decodeMeta(key, getVal()))
+		}
+	}
+
+	best := top.New(n, func(x, y storage.VectorResult) int {
+		return cmp.Or(cmp.Compare(x.Score, y.Score), cmp.Compare(x.ID, y.ID))
+	})
+	for key, getVal := range v.scan() {
+		id := v.id(key)
+		if ok, found := match[id]; !found && !zeroOK || found && !ok {
+			continue
+		}
+		enc := getVal()
+		if storage.EncodedVectorLen(enc) != len(target) {
+			continue
+		}
+		best.Add(storage.VectorResult{ID: id, Score: storage.DotEncoded(target, enc)})
+	}
+	return best.Take()
+}
+
+// Flush implements [storage.VectorDB.Flush].
+func (v *VectorDB) Flush() {
+	v.db.Flush()
+}
+
+// A vectorBatch is a [storage.VectorBatch] for a [VectorDB].
+type vectorBatch struct {
+	v *VectorDB
+	b *batch
+}
+
+// Batch implements [storage.VectorDB.Batch].
+func (v *VectorDB) Batch() storage.VectorBatch {
+	return &vectorBatch{v, &batch{db: v.db, b: v.db.p.NewBatch()}}
+}
+
+// Set implements [storage.VectorBatch.Set].
+func (b *vectorBatch) Set(id string, vec llm.Vector) {
+	if id == "" {
+		b.v.db.Panic("pebble VectorDB batch set: empty ID")
+	}
+	b.b.Set(b.v.key(id), b.v.encode(vec))
+	b.b.Delete(b.v.metaKey(id))
+}
+
+// Delete implements [storage.VectorBatch.Delete].
+func (b *vectorBatch) Delete(id string) {
+	b.b.Delete(b.v.key(id))
+	b.b.Delete(b.v.metaKey(id))
+}
+
+// SetMeta implements [storage.MetaVectorBatch.SetMeta].
+func (b *vectorBatch) SetMeta(id string, meta *storage.VectorMeta) {
+	b.b.Set(b.v.metaKey(id), storage.JSON(meta))
+}
+
+// MaybeApply implements [storage.VectorBatch.MaybeApply].
+func (b *vectorBatch) MaybeApply() bool {
+	return b.b.MaybeApply()
+}
+
+// Apply implements [storage.VectorBatch.Apply].
+func (b *vectorBatch) Apply() {
+	b.b.Apply()
+}
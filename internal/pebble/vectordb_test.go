@@ -0,0 +1,157 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestVectorDB(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db, err := Create(lg, filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// TestVectorDB checks for exact vectors and scores.
+	storage.TestVectorDB(t, func() storage.VectorDB {
+		vdb, err := NewVectorDB(db, "ns")
+		if err != nil {
+			t.Fatal(err)
+		}
+		vdb.FullPrecision()
+		return vdb
+	})
+
+	storage.TestMetaVectorDB(t, func() storage.MetaVectorDB {
+		vdb, err := NewVectorDB(db, "meta")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vdb
+	})
+
+	if _, err := NewVectorDB(storage.MemDB(), "ns"); err == nil {
+		t.Errorf("NewVectorDB(MemDB) succeeded, want error")
+	}
+}
+
+func TestOpenVectorDB(t *testing.T) {
+	lg := testutil.Slogger(t)
+	dir := filepath.Join(t.TempDir(), "db")
+	if _, err := OpenVectorDB(lg, dir, "ns"); err == nil {
+		t.Fatal("OpenVectorDB nonexistent succeeded")
+	}
+	db, err := Create(lg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Vectors written by MemVectorDB are visible to VectorDB and vice versa.
+	mdb := storage.MemVectorDB(db, lg, "ns")
+	mdb.Set("a", llm.Vector{1, 0})
+	vdb, err := NewVectorDB(db, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vdb.Set("b", llm.Vector{0, 1})
+	other, err := NewVectorDB(db, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Set("c", llm.Vector{1, 1})
+	db.Close()
+
+	vdb, err = OpenVectorDB(lg, dir, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vdb.Close()
+	have := vdb.Search(llm.Vector{1, 0}, 3)
+	want := []storage.VectorResult{{ID: "a", Score: 1}, {ID: "b", Score: 0}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Search after reopen = %v, want %v", have, want)
+	}
+	if v, ok := vdb.Get("b"); !ok || !reflect.DeepEqual(v, llm.Vector{0, 1}) {
+		t.Errorf("Get(b) = %v, %v, want [0 1], true", v, ok)
+	}
+	if v, ok := storage.MemVectorDB(vdb.db, lg, "ns").Get("b"); !ok || !reflect.DeepEqual(v, llm.Vector{0, 1}) {
+		t.Errorf("MemVectorDB Get(b) = %v, %v, want [0 1], true", v, ok)
+	}
+}
+
+func TestVectorDBHalf(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db, err := Create(lg, filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	vdb, err := NewVectorDB(db, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const dim = 64
+	r := rand.New(rand.NewPCG(1, 2))
+	randVector := func() llm.Vector {
+		v := make(llm.Vector, dim)
+		for i := range v {
+			v[i] = float32(r.NormFloat64())
+		}
+		return v.Normal()
+	}
+	exact := storage.MemVectorDB(storage.MemDB(), lg, "")
+	b := vdb.Batch()
+	for i := range 200 {
+		id := fmt.Sprint("doc", i)
+		v := randVector()
+		exact.Set(id, v)
+		b.Set(id, v)
+	}
+	b.Apply()
+
+	// Vectors are stored in 2 bytes per entry.
+	val, ok := db.Get(vdb.key("doc0"))
+	if !ok || len(val) != 1+2*dim {
+		t.Fatalf("stored doc0 has %d bytes, want %d", len(val), 1+2*dim)
+	}
+
+	for i := range 200 {
+		id := fmt.Sprint("doc", i)
+		have, _ := vdb.Get(id)
+		want, _ := exact.Get(id)
+		for j := range want {
+			if d := math.Abs(float64(have[j] - want[j])); d > 1.0/2048 {
+				t.Fatalf("Get(%s)[%d] = %v, want %v", id, j, have[j], want[j])
+			}
+		}
+	}
+
+	for range 10 {
+		target := randVector()
+		have := vdb.Search(target, 5)
+		want := exact.Search(target, 5)
+		if len(have) != len(want) {
+			t.Fatalf("Search = %v, want %v", have, want)
+		}
+		for i := range want {
+			if have[i].ID != want[i].ID || math.Abs(have[i].Score-want[i].Score) > 1e-3 {
+				t.Errorf("Search = %v, want %v", have, want)
+				break
+			}
+		}
+	}
+}
@@ -93,7 +93,7 @@ func CheckReproduction(ctx context.Context, lg *slog.Logger, db storage.DB, cgen
 		return "", err
 	}
 
-	jsonRes, err := cgen.GenerateContent(ctx, reproSchema, []llm.Part{llm.Text(sb.String())})
+	jsonRes, err := llm.GenerateJSON(ctx, cgen, reproSchema, []llm.Part{llm.Text(sb.String())}, maxJSONRepairs)
 	if err != nil {
 		return "", err
 	}
@@ -191,6 +191,10 @@ type reproResponse struct {
 	PassRelease string
 }
 
+// maxJSONRepairs is the maximum number of times to ask the LLM
+// to correct a response that does not match [reproSchema].
+const maxJSONRepairs = 2
+
 // reproSchema describes the data the LLM should reply with.
 var reproSchema = &llm.Schema{
 	Type: llm.TypeObject,
@@ -0,0 +1,241 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rulecheck implements an [llm.PolicyChecker] that checks
+// LLM inputs and outputs against policies using fixed rules,
+// without calling any external service.
+//
+// It supports three policies:
+//
+//   - [llm.PolicyTypePIISolicitingReciting]: the text contains
+//     personal information or secrets, such as email addresses,
+//     private keys, and API keys and tokens in known formats.
+//   - [llm.PolicyTypeBlockedTerms]: the text contains one of
+//     a configured list of terms.
+//   - [llm.PolicyTypePromptInjection]: the text contains phrases
+//     commonly used to override a model's instructions, such as
+//     "ignore all previous instructions", or the special tokens
+//     used to delimit the messages of a conversation.
+//
+// Each matching rule contributes a weight between 0 and 1 to its
+// policy's score, and the score for a policy is the probability
+// that at least one match is a real problem, treating the weights
+// as independent probabilities. A text violates the policy if its
+// score is at least the policy's threshold (0.5 by default).
+// For example, a single email address (weight 0.3) does not
+// violate the PII policy at the default threshold, but two do.
+//
+// The rules are simple and will miss many problems that a model-based
+// checker would find; they are meant for self-hosted deployments
+// and tests, which cannot use [golang.org/x/oscar/internal/gcp/checks].
+package rulecheck
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/oscar/internal/llm"
+)
+
+// version is the version of the rules, which is part of the
+// checker's name. Increment it when the rules change, so that
+// cached results from older rules are not used.
+const version = 1
+
+// defaultThreshold is the threshold used for policies
+// that do not specify one.
+const defaultThreshold = 0.5
+
+// A Checker is an implementation of [llm.PolicyChecker]
+// that uses fixed rules.
+type Checker struct {
+	name     string
+	policies []*llm.PolicyConfig
+	blocked  []*rule // rules for blocked terms
+}
+
+var _ llm.PolicyChecker = (*Checker)(nil)
+
+// DefaultPolicies returns the policies supported by a [Checker],
+// at their default thresholds.
+func DefaultPolicies() []*llm.PolicyConfig {
+	return []*llm.PolicyConfig{
+		{PolicyType: llm.PolicyTypePIISolicitingReciting},
+		{PolicyType: llm.PolicyTypeBlockedTerms},
+		{PolicyType: llm.PolicyTypePromptInjection},
+	}
+}
+
+// New returns a new Checker that applies the policies,
+// which must be supported by the Checker (see [DefaultPolicies]).
+// blockedTerms are the terms that violate [llm.PolicyTypeBlockedTerms].
+// They are matched as whole words, ignoring case.
+func New(policies []*llm.PolicyConfig, blockedTerms []string) (*Checker, error) {
+	for _, p := range policies {
+		if rules(p.PolicyType) == nil && p.PolicyType != llm.PolicyTypeBlockedTerms {
+			return nil, fmt.Errorf("rulecheck: unsupported policy %s", p.PolicyType)
+		}
+		if p.Threshold < 0 || p.Threshold > 1 {
+			return nil, fmt.Errorf("rulecheck: policy %s: threshold %v not in [0, 1]", p.PolicyType, p.Threshold)
+		}
+	}
+	c := &Checker{
+		name:     fmt.Sprintf("rulecheck/v%d", version),
+		policies: policies,
+	}
+	var terms []string
+	for _, t := range blockedTerms {
+		if t = strings.TrimSpace(t); t != "" {
+			terms = append(terms, strings.ToLower(t))
+		}
+	}
+	if len(terms) > 0 {
+		slices.Sort(terms)
+		terms = slices.Compact(terms)
+		for _, t := range terms {
+			c.blocked = append(c.blocked, &rule{wordRE(t), 1})
+		}
+		// Results depend on the terms, so the name must too.
+		sum := sha256.Sum256([]byte(strings.Join(terms, "\n")))
+		c.name += fmt.Sprintf("/%x", sum[:8])
+	}
+	return c, nil
+}
+
+// wordRE returns a case-insensitive regexp matching
+// the term as a whole word.
+func wordRE(term string) *regexp.Regexp {
+	re := regexp.QuoteMeta(term)
+	if isWordByte(term[0]) {
+		re = `\b` + re
+	}
+	if isWordByte(term[len(term)-1]) {
+		re += `\b`
+	}
+	return regexp.MustCompile(`(?i)` + re)
+}
+
+func isWordByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// Name implements [llm.PolicyChecker.Name].
+// The name identifies the version of the rules and the blocked terms.
+func (c *Checker) Name() string {
+	return c.name
+}
+
+// Policies implements [llm.PolicyChecker.Policies].
+func (c *Checker) Policies() []*llm.PolicyConfig {
+	return c.policies
+}
+
+// CheckText implements [llm.PolicyChecker.CheckText].
+// Only the text is checked: the prompt is not needed
+// to decide whether the text matches a rule.
+func (c *Checker) CheckText(ctx context.Context, text string, prompt ...llm.Part) ([]*llm.PolicyResult, error) {
+	var results []*llm.PolicyResult
+	for _, p := range c.policies {
+		rs := rules(p.PolicyType)
+		if p.PolicyType == llm.PolicyTypeBlockedTerms {
+			rs = c.blocked
+		}
+		score := score(rs, text)
+		threshold := p.Threshold
+		if threshold == 0 {
+			threshold = defaultThreshold
+		}
+		v := llm.ViolationResultNonViolative
+		if score >= threshold {
+			v = llm.ViolationResultViolative
+		}
+		results = append(results, &llm.PolicyResult{
+			PolicyType:      p.PolicyType,
+			Score:           score,
+			ViolationResult: v,
+		})
+	}
+	return results, nil
+}
+
+// A rule is a pattern whose matches are evidence
+// that a text violates a policy.
+type rule struct {
+	re     *regexp.Regexp
+	weight float64 // in [0, 1]
+}
+
+// score returns the score of the text under the rules:
+// the probability that at least one distinct match is a real
+// problem, if each match of a rule is one with probability
+// given by the rule's weight.
+func score(rules []*rule, text string) float64 {
+	none := 1.0 // probability that no match is a problem
+	for _, r := range rules {
+		seen := make(map[string]bool)
+		for _, m := range r.re.FindAllString(text, -1) {
+			if !seen[m] {
+				seen[m] = true
+				none *= 1 - r.weight
+			}
+		}
+	}
+	return 1 - none
+}
+
+// rules returns the fixed rules for the policy,
+// or nil if there are none.
+func rules(policy llm.PolicyType) []*rule {
+	switch policy {
+	case llm.PolicyTypePIISolicitingReciting:
+		return piiRules
+	case llm.PolicyTypePromptInjection:
+		return injectionRules
+	}
+	return nil
+}
+
+var piiRules = []*rule{
+	// private key
+	{regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----`), 1},
+	// AWS access key ID
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), 1},
+	// GitHub token
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`), 1},
+	// GitHub token
+	{regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`), 1},
+	// Google API key
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`), 1},
+	// Slack token
+	{regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9\-]{10,}`), 1},
+	// secret API key
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}`), 0.8},
+	// JSON Web Token
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`), 0.8},
+	// email address
+	{regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}\b`), 0.3},
+}
+
+var injectionRules = []*rule{
+	// instruction override
+	{regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget)\s+(?:all\s+|any\s+)?(?:of\s+)?(?:the\s+|your\s+)?(?:previous|prior|above|earlier|preceding|system)\s+(?:instructions|prompts?|directions|rules)`), 0.9},
+	// instruction override, without "previous" and the like
+	{regexp.MustCompile(`(?i)\b(?:disregard|forget)\s+(?:all\s+)?(?:your|the)\s+(?:instructions|rules)`), 0.9},
+	// conversation token
+	{regexp.MustCompile(`<\|im_(?:start|end)\|>|<\|(?:system|user|assistant|endoftext)\|>|\[/?INST\]|<</?SYS>>`), 0.9},
+	// prompt extraction
+	{regexp.MustCompile(`(?i)\b(?:reveal|print|show|repeat|output)\s+(?:me\s+)?(?:your|the)\s+(?:system\s+prompt|(?:initial\s+|original\s+)?instructions)`), 0.7},
+	// new instructions
+	{regexp.MustCompile(`(?i)\bnew\s+instructions\s*:`), 0.6},
+	// jailbreak
+	{regexp.MustCompile(`(?i)\b(?:jailbreak|do\s+anything\s+now|developer\s+mode\s+enabled)\b`), 0.5},
+	// role label
+	{regexp.MustCompile(`(?im)^\s*(?:system|assistant)\s*:`), 0.4},
+	// role change
+	{regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(?:a|an|the|in)\b`), 0.3},
+}
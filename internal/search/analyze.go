@@ -26,6 +26,23 @@ func Analyze(ctx context.Context, lc *llmapp.Client, vdb storage.VectorDB, dc *d
 	if !ok {
 		return nil, fmt.Errorf("search.Analyze: main doc %q not in docs corpus", id)
 	}
+	related, err := RelatedDocs(vdb, dc, id)
+	if err != nil {
+		return nil, err
+	}
+	a, err := lc.AnalyzeRelated(ctx, doc, related)
+	if err != nil {
+		return nil, err
+	}
+	return &Analysis{
+		RelatedAnalysis: *a,
+	}, nil
+}
+
+// RelatedDocs returns the documents related to the document identified by id,
+// found as in [Analyze], in a form suitable for use in LLM prompts.
+// id must be present in the vector db, and the results in the docs corpus.
+func RelatedDocs(vdb storage.VectorDB, dc *docs.Corpus, id string) ([]*llmapp.Doc, error) {
 	rs, err := searchRelated(vdb, dc, id)
 	if err != nil {
 		return nil, err
@@ -34,17 +51,11 @@ func Analyze(ctx context.Context, lc *llmapp.Client, vdb storage.VectorDB, dc *d
 	for _, r := range rs {
 		d, ok := llmDoc(dc, "related", r.ID)
 		if !ok {
-			return nil, fmt.Errorf("search.Analyze: related doc %s not in docs corpus", id)
+			return nil, fmt.Errorf("search: related doc %s not in docs corpus", r.ID)
 		}
 		related = append(related, d)
 	}
-	a, err := lc.AnalyzeRelated(ctx, doc, related)
-	if err != nil {
-		return nil, err
-	}
-	return &Analysis{
-		RelatedAnalysis: *a,
-	}, nil
+	return related, nil
 }
 
 var maxResults = 5
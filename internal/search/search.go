@@ -14,6 +14,7 @@ import (
 	"net/url"
 	"path"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
@@ -39,6 +40,13 @@ type Options struct {
 	Limit     int      // max results (fewer if Threshold is set); 0 means use a fixed default
 	AllowKind []string // kinds of documents to keep; empty means keep all
 	DenyKind  []string // kinds of documents to remove; empty means remove none
+
+	// Filter restricts the search to documents whose vector metadata match.
+	// Unlike AllowKind and DenyKind, which are applied to the results of
+	// the search, Filter is applied by the vector database during the search
+	// (see [storage.MetaVectorDB]), so a narrow filter still returns up to
+	// Limit results. The metadata is expected to be as set by [DocMeta].
+	Filter *storage.VectorFilter
 }
 
 // Result is a single result of a search ([Query] or [Vector]).
@@ -102,9 +110,35 @@ func (o *Options) Validate() error {
 			return fmt.Errorf("unrecognized deny kind %q (case-sensitive)", deny)
 		}
 	}
+	if f := o.Filter; f != nil {
+		for _, kind := range slices.Concat(f.Kinds, f.DenyKinds) {
+			if _, ok := kinds[kind]; !ok {
+				return fmt.Errorf("unrecognized filter kind %q (case-sensitive)", kind)
+			}
+		}
+		if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && !f.CreatedAfter.Before(f.CreatedBefore) {
+			return fmt.Errorf("filter CreatedAfter (%v) must be before CreatedBefore (%v)", f.CreatedAfter, f.CreatedBefore)
+		}
+	}
 	return nil
 }
 
+// DocMeta returns the vector metadata for the document with the given ID,
+// for use with [Options.Filter].
+// It sets the Kind and, for GitHub documents, the Project,
+// which it can derive from the ID alone.
+// Callers with access to the document's source must set Created and State;
+// for example, gaby sets them from its GitHub and Gerrit databases.
+func DocMeta(id string) *storage.VectorMeta {
+	meta := &storage.VectorMeta{Kind: docIDKind(id)}
+	if u, err := url.Parse(id); err == nil {
+		if s := githubRE.FindStringSubmatch(path.Join(u.Host, u.Path)); s != nil {
+			meta.Project = s[1]
+		}
+	}
+	return meta
+}
+
 func vector(vdb storage.VectorDB, dc *docs.Corpus, vec llm.Vector, opts *Options) []Result {
 	limit := defaultLimit
 	if opts.Limit > 0 {
@@ -126,8 +160,22 @@ func vector(vdb storage.VectorDB, dc *docs.Corpus, vec llm.Vector, opts *Options
 	if len(opts.DenyKind) != 0 {
 		denyKind = containsFunc(opts.DenyKind)
 	}
+	var results []storage.VectorResult
+	if f := opts.Filter; f.IsZero() {
+		results = vdb.Search(vec, limit)
+	} else if mdb, ok := vdb.(storage.MetaVectorDB); ok {
+		results = mdb.SearchFilter(vec, limit, f)
+	} else {
+		// The database cannot filter; do the best we can
+		// with the metadata derived from the ID.
+		for _, r := range vdb.Search(vec, limit) {
+			if f.Match(DocMeta(r.ID)) {
+				results = append(results, r)
+			}
+		}
+	}
 	var srs []Result
-	for _, r := range vdb.Search(vec, limit) {
+	for _, r := range results {
 		if r.Score < threshold {
 			break
 		}
@@ -329,6 +329,71 @@ func TestOptions(t *testing.T) {
 
 }
 
+func TestFilter(t *testing.T) {
+	lg := testutil.Slogger(t)
+	embedder := llm.QuoteEmbedder()
+	db := storage.MemDB()
+	vdb := storage.MemVectorDB(db, lg, "").(storage.MetaVectorDB)
+	corpus := docs.New(lg, db)
+
+	// Many blog posts are closer to the query than the few issues.
+	var issues []string
+	for i := range 50 {
+		id := fmt.Sprintf("https://go.dev/blog/post%d", i)
+		text := "text-" + strings.Repeat("x", 3+i%3)
+		if i%20 == 19 {
+			id = fmt.Sprintf("https://github.com/golang/go/issues/%d", i)
+			text = "other-" + strings.Repeat("y", i%7)
+			issues = append(issues, id)
+		}
+		corpus.Add(id, "title", text)
+		vdb.Set(id, mustEmbed(t, embedder, llm.EmbedDoc{Text: text}))
+		vdb.SetMeta(id, DocMeta(id))
+	}
+	slices.Sort(issues)
+
+	vreq := &VectorRequest{
+		Options: Options{Limit: 2, AllowKind: []string{KindGitHubIssue}},
+		Vector:  mustEmbed(t, embedder, llm.EmbedDoc{Text: "text-xxx"}),
+	}
+	if got := Vector(vdb, corpus, vreq); len(got) != 0 {
+		t.Errorf("AllowKind: got %v, want no results", got)
+	}
+
+	vreq.Options = Options{Limit: 2, Filter: &storage.VectorFilter{Kinds: []string{KindGitHubIssue}, Project: "golang/go"}}
+	if err := vreq.Options.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range Vector(vdb, corpus, vreq) {
+		got = append(got, r.ID)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, issues) {
+		t.Errorf("Filter: got %v, want %v", got, issues)
+	}
+
+	vreq.Options.Filter.Kinds = []string{"NotAKind"}
+	if err := vreq.Options.Validate(); err == nil {
+		t.Errorf("Validate(bad filter kind) succeeded, want error")
+	}
+}
+
+func TestDocMeta(t *testing.T) {
+	for _, test := range []struct {
+		id   string
+		want storage.VectorMeta
+	}{
+		{"https://github.com/golang/go/issues/123", storage.VectorMeta{Kind: KindGitHubIssue, Project: "golang/go"}},
+		{"https://go.dev/blog/xxx", storage.VectorMeta{Kind: KindGoBlog}},
+		{"something", storage.VectorMeta{Kind: KindUnknown}},
+	} {
+		if got := DocMeta(test.id); *got != test.want {
+			t.Errorf("DocMeta(%q) = %+v, want %+v", test.id, *got, test.want)
+		}
+	}
+}
+
 func mustEmbed(t *testing.T, embedder llm.Embedder, doc llm.EmbedDoc) llm.Vector {
 	t.Helper()
 	vec, err := embedder.EmbedDocs(context.Background(), []llm.EmbedDoc{doc})
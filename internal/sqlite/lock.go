@@ -0,0 +1,192 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/oscar/internal/storage"
+)
+
+// Lease parameters for locks.
+// A lease whose expiration time has passed is considered abandoned
+// and may be taken over by another process.
+// The holder renews its leases every leaseRenew.
+const (
+	leaseTimeout = 2 * time.Minute
+	leaseRenew   = 1 * time.Minute
+	lockPoll     = 100 * time.Millisecond
+)
+
+// A sqlLocker implements locks shared by all processes using
+// the same database, by inserting one row per held lock
+// into the locks table.
+// A lock is held by whichever process inserts its row.
+// While a process holds a lock, it periodically extends
+// the row's expiration time to renew the lease;
+// if the process dies, the lease expires and
+// the lock can be acquired by another process.
+type sqlLocker struct {
+	db     *db
+	holder string // holder identity to record in leases
+
+	mu     sync.Mutex
+	held   map[string]string // nonces of held locks, by name
+	stop   chan struct{}     // closed by close to stop renewals
+	ticker *time.Ticker      // renewal ticker
+}
+
+// newSQLLocker returns a sqlLocker using the locks table in db.
+func newSQLLocker(db *db, holder string) *sqlLocker {
+	l := &sqlLocker{
+		db:     db,
+		holder: holder,
+		held:   make(map[string]string),
+		stop:   make(chan struct{}),
+		ticker: time.NewTicker(leaseRenew),
+	}
+	go l.renew()
+	return l
+}
+
+// close stops renewing the held leases.
+// The leases are left behind and expire after leaseTimeout,
+// which is the same as what happens when the process dies.
+func (l *sqlLocker) close() {
+	l.ticker.Stop()
+	close(l.stop)
+}
+
+// renew renews the held leases every leaseRenew until l is closed.
+func (l *sqlLocker) renew() {
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-l.ticker.C:
+		}
+		l.mu.Lock()
+		exp := time.Now().Add(leaseTimeout).UnixNano()
+		for name, nonce := range l.held {
+			// Ignore errors: the lease is only at risk
+			// if renewing keeps failing for leaseTimeout.
+			l.db.sql.Exec("UPDATE locks SET expires = ? WHERE name = ? AND nonce = ?", exp, name, nonce)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// tryLock tries once to acquire the named lock, reporting whether it succeeded.
+func (l *sqlLocker) tryLock(name string) (bool, error) {
+	now := time.Now()
+	nonce := rand.Text()
+	tx, err := l.db.sql.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Break any expired lease, then try to take the lock.
+	if _, err := tx.Exec("DELETE FROM locks WHERE name = ? AND expires < ?", name, now.UnixNano()); err != nil {
+		return false, err
+	}
+	res, err := tx.Exec("INSERT OR IGNORE INTO locks (name, holder, nonce, acquired, expires) VALUES (?, ?, ?, ?, ?)",
+		name, l.holder, nonce, now.UnixNano(), now.Add(leaseTimeout).UnixNano())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	l.mu.Lock()
+	l.held[name] = nonce
+	l.mu.Unlock()
+	return true, nil
+}
+
+// lock acquires the named lock, polling until it is available
+// or until ctx is done.
+func (l *sqlLocker) lock(ctx context.Context, name string) error {
+	for {
+		ok, err := l.tryLock(name)
+		if ok || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+var (
+	errNotLocked = errors.New("unlock of unlocked key")
+	errLeaseLost = errors.New("lock lease expired and was taken over")
+)
+
+// unlock releases the named lock, which must be held by l.
+// If the lease expired while it was held, so that another
+// process may have acquired the lock, unlock returns errLeaseLost.
+func (l *sqlLocker) unlock(name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	nonce, ok := l.held[name]
+	if !ok {
+		return errNotLocked
+	}
+	delete(l.held, name)
+
+	// Deleting only our own lease checks that it is still ours:
+	// if it expired, another process may have taken it.
+	res, err := l.db.sql.Exec("DELETE FROM locks WHERE name = ? AND nonce = ?", name, nonce)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// locks returns information about the unexpired locks held by all processes.
+func (l *sqlLocker) locks() ([]storage.LockInfo, error) {
+	rows, err := l.db.sql.Query("SELECT name, holder, acquired, expires FROM locks WHERE expires >= ? ORDER BY name",
+		time.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []storage.LockInfo
+	for rows.Next() {
+		var name, holder string
+		var acquired, expires int64
+		if err := rows.Scan(&name, &holder, &acquired, &expires); err != nil {
+			return nil, err
+		}
+		list = append(list, storage.LockInfo{
+			Name:     name,
+			Holder:   holder,
+			Acquired: time.Unix(0, acquired),
+			Expires:  time.Unix(0, expires),
+		})
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestSQLLocker(t *testing.T) {
+	// Two databases on the same file
+	// act like two processes sharing a database.
+	lg := testutil.Slogger(t)
+	file := filepath.Join(t.TempDir(), "db")
+	sdb1, err := Create(lg, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb1.Close()
+	sdb2, err := Open(lg, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb2.Close()
+	l1, l2 := sdb1.(*db).l, sdb2.(*db).l
+	l1.holder, l2.holder = "p1", "p2"
+
+	tryLock := func(l *sqlLocker, name string) bool {
+		t.Helper()
+		ok, err := l.tryLock(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !tryLock(l1, "abc") {
+		t.Fatalf("p1 tryLock(abc) = false, want true")
+	}
+	if tryLock(l2, "abc") {
+		t.Fatalf("p2 tryLock(abc) while p1 holds it = true, want false")
+	}
+	locks, err := l2.locks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || locks[0].Name != "abc" || locks[0].Holder != "p1" {
+		t.Fatalf("p2 locks() = %+v, want abc held by p1", locks)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPoll)
+	defer cancel()
+	if err := l2.lock(ctx, "abc"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("p2 lock(abc) while p1 holds it = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	c := make(chan error)
+	go func() {
+		c <- l2.lock(context.Background(), "abc")
+	}()
+	time.Sleep(2 * lockPoll)
+	if err := l1.unlock("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-c; err != nil {
+		t.Fatalf("p2 lock(abc) after p1 unlock = %v", err)
+	}
+	if err := l1.unlock("abc"); err != errNotLocked {
+		t.Fatalf("p1 unlock(abc) not held = %v, want %v", err, errNotLocked)
+	}
+
+	// An expired lease can be taken over,
+	// and the old holder finds out when unlocking.
+	expire(t, sdb2.(*db), "abc")
+	if locks, err := l1.locks(); err != nil || len(locks) != 0 {
+		t.Fatalf("locks() with expired lease = %+v, %v, want none", locks, err)
+	}
+	if !tryLock(l1, "abc") {
+		t.Fatalf("p1 tryLock(abc) with expired lease = false, want true")
+	}
+	if err := l2.unlock("abc"); err != errLeaseLost {
+		t.Fatalf("p2 unlock(abc) after takeover = %v, want %v", err, errLeaseLost)
+	}
+	if err := l1.unlock("abc"); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := sdb1.(*db).sql.QueryRow("SELECT COUNT(*) FROM locks").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("leases left after unlock: %d, %v", n, err)
+	}
+}
+
+// expire makes the lease for the named lock in d expire.
+func expire(t *testing.T, d *db, name string) {
+	t.Helper()
+	old := time.Now().Add(-2 * leaseTimeout).UnixNano()
+	if _, err := d.sql.Exec("UPDATE locks SET expires = ? WHERE name = ?", old, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockReopen(t *testing.T) {
+	// A lock left held by a closed database
+	// blocks the next opener until its lease expires.
+	lg := testutil.Slogger(t)
+	file := filepath.Join(t.TempDir(), "db")
+	sdb, err := Create(lg, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := sdb.(*db)
+	d.Lock("abc")
+	d.Close()
+
+	sdb, err = Open(lg, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+	d = sdb.(*db)
+	if d.TryLock("abc") {
+		t.Fatalf("TryLock(abc) held by closed db = true, want false")
+	}
+	expire(t, d, "abc")
+	if !d.TryLock("abc") {
+		t.Fatalf("TryLock(abc) after lease expired = false, want true")
+	}
+	d.Unlock("abc")
+}
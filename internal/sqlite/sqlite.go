@@ -0,0 +1,452 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqlite implements a storage.DB using SQLite,
+// with the pure Go driver [modernc.org/sqlite].
+// The database is a single file that can be inspected using
+// standard SQLite tools: each entry is a row in the table
+//
+//	kv(k BLOB PRIMARY KEY, v BLOB)
+//
+// SQLite compares BLOBs bytewise, so the table's order is
+// the same as the order of [storage.DB.Scan].
+//
+// Unlike a Pebble database, a SQLite database can be used
+// by multiple processes at a time.
+// Writes and transactions from all processes are serialized by SQLite.
+// Locks acquired using the database's Lock method are recorded
+// as leases in the locks table, so that they are shared
+// with the other processes. See [db.LockContext] for details.
+// Subscriptions observe only the changes made by the same process
+// (see [db.Subscribe]).
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+
+	"golang.org/x/oscar/internal/storage"
+	_ "modernc.org/sqlite"
+)
+
+// Open opens an existing SQLite database in the named file.
+// The database must already exist.
+func Open(lg *slog.Logger, file string) (storage.DB, error) {
+	if _, err := os.Stat(file); err != nil {
+		lg.Error("sqlite open", "file", file, "err", err)
+		return nil, err
+	}
+	return open(lg, file)
+}
+
+// Create creates a new SQLite database in the named file.
+// The file must not already exist.
+func Create(lg *slog.Logger, file string) (storage.DB, error) {
+	if _, err := os.Stat(file); err == nil {
+		err = &fs.PathError{Op: "create", Path: file, Err: fs.ErrExist}
+		lg.Error("sqlite create", "file", file, "err", err)
+		return nil, err
+	}
+	return open(lg, file)
+}
+
+// schema creates the tables used by a database, if needed.
+const schema = `
+CREATE TABLE IF NOT EXISTS kv (k BLOB PRIMARY KEY, v BLOB NOT NULL) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS locks (
+	name TEXT PRIMARY KEY,
+	holder TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	acquired INTEGER NOT NULL,
+	expires INTEGER NOT NULL
+);
+`
+
+func open(lg *slog.Logger, file string) (storage.DB, error) {
+	// Use write-ahead logging so that readers do not block the writer,
+	// wait for other processes' writes instead of failing,
+	// and begin transactions holding the write lock,
+	// so that a transaction's reads cannot be invalidated
+	// before it writes.
+	q := url.Values{
+		"_pragma": {"busy_timeout(60000)", "journal_mode(wal)", "synchronous(normal)"},
+		"_txlock": {"immediate"},
+	}
+	sdb, err := sql.Open("sqlite", "file:"+file+"?"+q.Encode())
+	if err == nil {
+		_, err = sdb.Exec(schema)
+		if err != nil {
+			sdb.Close()
+		}
+	}
+	if err != nil {
+		lg.Error("sqlite open", "file", file, "err", err)
+		return nil, err
+	}
+	d := &db{sql: sdb, slog: lg}
+	d.l = newSQLLocker(d, storage.LockHolder())
+	return d, nil
+}
+
+type db struct {
+	sql  *sql.DB
+	m    storage.MemLocker // locks held by this process
+	l    *sqlLocker        // locks held by any process
+	slog *slog.Logger
+
+	// feed notifies subscribers of changes made by this process.
+	feed storage.Feed
+
+	closeOnce sync.Once
+}
+
+var (
+	_ storage.TxDB          = (*db)(nil)
+	_ storage.Notifier      = (*db)(nil)
+	_ storage.ContextLocker = (*db)(nil)
+)
+
+// Lock acquires the lock with the given name.
+// It first acquires the lock among goroutines in this process
+// and then acquires the lease shared with other processes.
+func (d *db) Lock(key string) {
+	if err := d.LockContext(context.Background(), key); err != nil {
+		// unreachable except db error
+		d.Panic("sqlite lock", "key", key, "err", err)
+	}
+}
+
+// LockContext implements [storage.ContextLocker.LockContext].
+//
+// Locks are shared with other processes using leases
+// stored in the locks table of the database.
+// While a process holds a lock, it renews the lease periodically.
+// If the process exits without unlocking, the lease expires
+// after two minutes and other processes can acquire the lock.
+// Waiting for a lock held by another process polls the locks table.
+func (d *db) LockContext(ctx context.Context, key string) error {
+	if err := d.m.LockContext(ctx, key); err != nil {
+		return err
+	}
+	if err := d.l.lock(ctx, key); err != nil {
+		d.m.Unlock(key)
+		return err
+	}
+	return nil
+}
+
+// TryLock implements [storage.ContextLocker.TryLock].
+func (d *db) TryLock(key string) bool {
+	if !d.m.TryLock(key) {
+		return false
+	}
+	ok, err := d.l.tryLock(key)
+	if err != nil {
+		// unreachable except db error
+		d.m.Unlock(key)
+		d.Panic("sqlite trylock", "key", key, "err", err)
+	}
+	if !ok {
+		d.m.Unlock(key)
+	}
+	return ok
+}
+
+// Locks implements [storage.ContextLocker.Locks].
+// It lists the locks held by all processes using the database.
+func (d *db) Locks() []storage.LockInfo {
+	list, err := d.l.locks()
+	if err != nil {
+		// unreachable except db error
+		d.Panic("sqlite locks", "err", err)
+	}
+	return list
+}
+
+func (d *db) Unlock(key string) {
+	switch err := d.l.unlock(key); {
+	case err == errLeaseLost:
+		// Another process may have held the lock at the same time,
+		// but there is nothing to do about it now.
+		d.slog.Error("sqlite unlock", "key", key, "err", err)
+	case err != nil:
+		d.Panic("sqlite unlock", "key", key, "err", err)
+	}
+	d.m.Unlock(key)
+}
+
+// Subscribe implements [storage.Notifier.Subscribe].
+// Subscriptions observe only changes made through d,
+// not changes made by other processes using the same file.
+func (d *db) Subscribe(prefix []byte) *storage.Subscription {
+	return d.feed.Subscribe(prefix)
+}
+
+func (d *db) Panic(msg string, args ...any) {
+	d.slog.Error(msg, args...)
+	storage.Panic(msg, args...)
+}
+
+// A querier is a *sql.DB or *sql.Tx.
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// get returns the value for key using q.
+func (d *db) get(q querier, key []byte) ([]byte, bool) {
+	var val []byte
+	err := q.QueryRow("SELECT v FROM kv WHERE k = ?", key).Scan(&val)
+	if err == sql.ErrNoRows {
+		return nil, false
+	}
+	if err != nil {
+		// unreachable except db error
+		d.Panic("sqlite get", "key", storage.Fmt(key), "err", err)
+	}
+	return nonNil(val), true
+}
+
+func (d *db) Get(key []byte) (val []byte, ok bool) {
+	return d.get(d.sql, key)
+}
+
+// nonNil returns val, or an empty slice if val is nil,
+// so that the driver stores an empty BLOB instead of NULL.
+func nonNil(val []byte) []byte {
+	if val == nil {
+		return []byte{}
+	}
+	return val
+}
+
+func (d *db) Set(key, val []byte) {
+	if len(key) == 0 {
+		d.Panic("sqlite set: empty key")
+	}
+	defer d.feed.Notify(key, key)
+	if _, err := d.sql.Exec("INSERT OR REPLACE INTO kv (k, v) VALUES (?, ?)", key, nonNil(val)); err != nil {
+		// unreachable except db error
+		d.Panic("sqlite set", "key", storage.Fmt(key), "val", storage.Fmt(val), "err", err)
+	}
+}
+
+func (d *db) Delete(key []byte) {
+	defer d.feed.Notify(key, key)
+	if _, err := d.sql.Exec("DELETE FROM kv WHERE k = ?", key); err != nil {
+		// unreachable except db error
+		d.Panic("sqlite delete", "key", storage.Fmt(key), "err", err)
+	}
+}
+
+func (d *db) DeleteRange(start, end []byte) {
+	defer d.feed.Notify(start, end)
+	if _, err := d.sql.Exec("DELETE FROM kv WHERE k >= ? AND k <= ?", start, end); err != nil {
+		// unreachable except db error
+		d.Panic("sqlite delete range", "start", storage.Fmt(start), "end", storage.Fmt(end), "err", err)
+	}
+}
+
+// Flush checkpoints the write-ahead log into the database file.
+func (d *db) Flush() {
+	if _, err := d.sql.Exec("PRAGMA wal_checkpoint(FULL)"); err != nil {
+		// unreachable except db error
+		d.Panic("sqlite flush", "err", err)
+	}
+}
+
+func (d *db) Close() {
+	d.closeOnce.Do(func() {
+		d.l.close()
+		if err := d.sql.Close(); err != nil {
+			// unreachable except db error
+			d.Panic("sqlite close", "err", err)
+		}
+	})
+}
+
+// scanPage is the number of entries Scan reads in each query.
+const scanPage = 100
+
+// Scan returns an iterator over the entries with start ≤ key ≤ end.
+// It reads the entries a page at a time, so that no query is left
+// open while the caller runs: each page begins after the last key
+// of the previous one, and the scan observes changes to later keys
+// made during the iteration.
+func (d *db) Scan(start, end []byte) iter.Seq2[[]byte, func() []byte] {
+	start = bytes.Clone(start)
+	end = bytes.Clone(end)
+	return func(yield func(key []byte, val func() []byte) bool) {
+		type entry struct{ key, val []byte }
+		query := "SELECT k, v FROM kv WHERE k >= ? AND k <= ? ORDER BY k LIMIT ?"
+		for {
+			rows, err := d.sql.Query(query, start, end, scanPage)
+			if err != nil {
+				// unreachable except db error
+				d.Panic("sqlite scan", "start", storage.Fmt(start), "end", storage.Fmt(end), "err", err)
+			}
+			var page []entry
+			for rows.Next() {
+				var e entry
+				if err := rows.Scan(&e.key, &e.val); err != nil {
+					// unreachable except db error
+					d.Panic("sqlite scan", "start", storage.Fmt(start), "end", storage.Fmt(end), "err", err)
+				}
+				page = append(page, e)
+			}
+			if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+				// unreachable except db error
+				d.Panic("sqlite scan", "start", storage.Fmt(start), "end", storage.Fmt(end), "err", err)
+			}
+			for _, e := range page {
+				if !yield(e.key, func() []byte { return nonNil(e.val) }) {
+					return
+				}
+			}
+			if len(page) < scanPage {
+				return
+			}
+			start = page[len(page)-1].key
+			query = "SELECT k, v FROM kv WHERE k > ? AND k <= ? ORDER BY k LIMIT ?"
+		}
+	}
+}
+
+// Transaction implements [storage.TxDB.Transaction].
+// The commit runs in a SQLite transaction, which holds
+// the database's write lock while it checks the reads and
+// applies the writes, so transactions are atomic with respect
+// to all processes using the database.
+func (d *db) Transaction(f func(tx storage.Tx) error) error {
+	return storage.RunTx(d.Get, f, func(t *storage.TxLog) bool {
+		var c storage.Changes
+		defer c.Notify(&d.feed)
+
+		ok := false
+		d.inTx("sqlite transaction", func(tx *sql.Tx) {
+			get := func(key []byte) ([]byte, bool) { return d.get(tx, key) }
+			if !t.Valid(get) {
+				return
+			}
+			for key, val := range t.Writes() {
+				c.Add(key)
+				if val == nil {
+					d.exec(tx, "sqlite transaction", key, "DELETE FROM kv WHERE k = ?", key)
+				} else {
+					d.exec(tx, "sqlite transaction", key, "INSERT OR REPLACE INTO kv (k, v) VALUES (?, ?)", key, val)
+				}
+			}
+			ok = true
+		})
+		return ok
+	})
+}
+
+// inTx calls f in a SQLite transaction and commits it,
+// calling d.Panic with msg if that fails.
+func (d *db) inTx(msg string, f func(tx *sql.Tx)) {
+	tx, err := d.sql.Begin()
+	if err != nil {
+		// unreachable except db error
+		d.Panic(msg, "err", err)
+	}
+	defer tx.Rollback() // no-op after Commit; runs if f panics
+	f(tx)
+	if err := tx.Commit(); err != nil {
+		// unreachable except db error
+		d.Panic(msg, "err", err)
+	}
+}
+
+// exec executes the query in tx, calling d.Panic with msg and key if that fails.
+func (d *db) exec(tx *sql.Tx, msg string, key []byte, query string, args ...any) {
+	if _, err := tx.Exec(query, args...); err != nil {
+		// unreachable except db error
+		d.Panic(msg, "key", storage.Fmt(key), "err", err)
+	}
+}
+
+func (d *db) Batch() storage.Batch {
+	return &batch{db: d}
+}
+
+// A batch records its operations in memory
+// and applies them in a single SQLite transaction.
+type batch struct {
+	db   *db
+	ops  []op
+	size int             // approximate size of ops in bytes
+	c    storage.Changes // keys changed by b
+}
+
+// An op is a single batch operation.
+// If end is non-nil, op deletes the range key ≤ k ≤ end.
+// Otherwise, if val is nil, op deletes key.
+// Otherwise it sets key to val.
+type op struct {
+	key, val, end []byte
+}
+
+func (b *batch) Set(key, val []byte) {
+	if len(key) == 0 {
+		b.db.Panic("sqlite batch set: empty key")
+	}
+	b.add(op{key: bytes.Clone(key), val: bytes.Clone(nonNil(val))})
+	b.c.Add(key)
+}
+
+func (b *batch) Delete(key []byte) {
+	b.add(op{key: bytes.Clone(key)})
+	b.c.Add(key)
+}
+
+func (b *batch) DeleteRange(start, end []byte) {
+	b.add(op{key: bytes.Clone(start), end: bytes.Clone(end)})
+	b.c.AddRange(start, end)
+}
+
+func (b *batch) add(o op) {
+	b.ops = append(b.ops, o)
+	b.size += len(o.key) + len(o.val) + len(o.end)
+}
+
+// maxBatch is the size at which MaybeApply applies a batch.
+// That's what storage.Batch's interface definition says is a “typical limit”.
+const maxBatch = 100e6
+
+func (b *batch) MaybeApply() bool {
+	if b.size > maxBatch {
+		b.Apply()
+		return true
+	}
+	return false
+}
+
+func (b *batch) Apply() {
+	defer b.c.Notify(&b.db.feed)
+	if len(b.ops) == 0 {
+		return
+	}
+	b.db.inTx("sqlite batch apply", func(tx *sql.Tx) {
+		for _, o := range b.ops {
+			switch {
+			case o.end != nil:
+				b.db.exec(tx, "sqlite batch delete range", o.key, "DELETE FROM kv WHERE k >= ? AND k <= ?", o.key, o.end)
+			case o.val == nil:
+				b.db.exec(tx, "sqlite batch delete", o.key, "DELETE FROM kv WHERE k = ?", o.key)
+			default:
+				b.db.exec(tx, "sqlite batch set", o.key, "INSERT OR REPLACE INTO kv (k, v) VALUES (?, ?)", o.key, o.val)
+			}
+		}
+	})
+	b.ops = nil
+	b.size = 0
+}
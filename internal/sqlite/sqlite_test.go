@@ -0,0 +1,141 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+// asDB returns the *db implementing d.
+// (TestDB cannot write d.(*db), because its variable db shadows the type.)
+func asDB(d storage.DB) *db {
+	return d.(*db)
+}
+
+func TestDB(t *testing.T) {
+	lg := testutil.Slogger(t)
+	dbname := filepath.Join(t.TempDir(), "db1")
+
+	db, err := Open(lg, dbname)
+	if err == nil {
+		t.Fatal("Open nonexistent succeeded")
+	}
+
+	db, err = Create(lg, dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = Create(lg, dbname)
+	if err == nil {
+		t.Fatal("Create already-existing succeeded")
+	}
+
+	db, err = Open(lg, dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	storage.TestDB(t, db)
+	storage.TestDBLock(t, db)
+	storage.TestDBContextLock(t, asDB(db))
+	storage.TestNotifier(t, asDB(db))
+	storage.TestTxDB(t, db.(storage.TxDB))
+}
+
+func TestScanPages(t *testing.T) {
+	// Scan reads scanPage entries at a time;
+	// check that the pages fit together.
+	lg := testutil.Slogger(t)
+	db, err := Create(lg, filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const n = 3*scanPage + 7
+	b := db.Batch()
+	for i := range n {
+		b.Set(ordered.Encode(i), fmt.Append(nil, i))
+	}
+	b.Apply()
+
+	i := 10
+	for key, val := range db.Scan(ordered.Encode(10), ordered.Encode(n-5)) {
+		if want := ordered.Encode(i); string(key) != string(want) {
+			t.Fatalf("Scan: key %s, want %s", storage.Fmt(key), storage.Fmt(want))
+		}
+		if v := string(val()); v != fmt.Sprint(i) {
+			t.Fatalf("Scan: key %d has value %q", i, v)
+		}
+		// Deleting the current key does not disturb the scan.
+		db.Delete(key)
+		i++
+	}
+	if i != n-4 {
+		t.Fatalf("Scan stopped at %d, want %d", i, n-4)
+	}
+
+	// Breaking out of a scan is allowed.
+	for range db.Scan(ordered.Encode(0), ordered.Encode(n)) {
+		break
+	}
+}
+
+func TestVectorDB(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db, err := Create(lg, filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	storage.TestVectorDB(t, func() storage.VectorDB {
+		return storage.MemVectorDB(db, lg, "ns")
+	})
+}
+
+func TestTwoProcesses(t *testing.T) {
+	// Two databases opened on the same file
+	// act like two processes sharing a database.
+	lg := testutil.Slogger(t)
+	file := filepath.Join(t.TempDir(), "db")
+	db1, err := Create(lg, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db1.Close()
+	db2, err := Open(lg, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+
+	db1.Set([]byte("k"), []byte("v"))
+	if v, ok := db2.Get([]byte("k")); !ok || string(v) != "v" {
+		t.Errorf("db2.Get(k) = %q, %v, want %q, true", v, ok, "v")
+	}
+
+	err = storage.Transaction(db1, func(tx storage.Tx) error {
+		tx.Get([]byte("k"))
+		db2.Set([]byte("k"), []byte("v2"))
+		tx.Set([]byte("k2"), []byte("x"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db2.Get([]byte("k2")); !ok {
+		t.Errorf("transaction did not commit")
+	}
+}
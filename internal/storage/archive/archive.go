@@ -0,0 +1,344 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package archive implements a portable file format for snapshots
+// of a [storage.DB] and its vector databases, for backups and for
+// moving data between database implementations.
+//
+// An archive is a stream of records. It begins with a header record
+// describing the archive and ends with an end record giving the number
+// of data records, so that a truncated archive is detected.
+// Each record carries a CRC-32 checksum, so that corruption is detected
+// before the record is written to a database.
+// The stream may be compressed with gzip; [NewReader] detects this
+// automatically.
+//
+// A full snapshot, written by [Export] with a zero [Options.Since],
+// contains every key-value pair in the database, in key order,
+// followed by the vectors in each requested vector namespace,
+// in namespace and ID order.
+//
+// An incremental snapshot, written with a non-zero Options.Since,
+// contains only the [timed] entries of every kind that were set
+// after Since, along with their time index entries,
+// ordered by kind and then by modification time.
+// An incremental snapshot does not record deleted entries.
+// Importing it leaves behind the old time index entries of
+// entries that were set again, which [timed.ScanAfter] ignores.
+// Applying a full snapshot and then later incremental snapshots in order
+// reproduces the timed entries of the source database,
+// which is typically what is needed for a reproducible test fixture.
+//
+// The binary format of a record is:
+//
+//	kind     byte
+//	len      uvarint
+//	payload  [len]byte
+//	crc      uint32 (big-endian CRC-32C of kind, len, and payload)
+//
+// The header record (kind 'H') has a JSON-encoded [Header] as its payload.
+// A key-value record (kind 'K') has the payload
+//
+//	keylen uvarint, key [keylen]byte, val []byte
+//
+// A vector record (kind 'V') has the payload
+//
+//	nslen uvarint, namespace [nslen]byte,
+//	idlen uvarint, id [idlen]byte,
+//	veclen uvarint, vec [veclen]byte (as encoded by [llm.Vector.Encode]),
+//	meta []byte (a JSON-encoded [storage.VectorMeta], or empty)
+//
+// The end record (kind 'E') has a payload holding the number of
+// key-value and vector records as a uvarint.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/storage/timed"
+)
+
+// magic is the start of every uncompressed archive.
+const magic = "OSCARDB\x01"
+
+// maxRecord is the maximum size of a record payload,
+// to avoid huge allocations when reading a corrupt archive.
+const maxRecord = 1 << 30
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// A Header describes an archive.
+type Header struct {
+	Created    time.Time    // time the archive was written
+	Since      timed.DBTime // for an incremental snapshot, entries set after Since; otherwise 0
+	Namespaces []string     // vector namespaces included in the archive
+}
+
+// A Record is a single data record in an archive:
+// either a key-value pair or a vector.
+type Record struct {
+	// For a key-value pair.
+	Key []byte
+	Val []byte
+
+	// For a vector (when Namespace or ID is non-empty).
+	Namespace string
+	ID        string
+	Vector    llm.Vector
+	Meta      *storage.VectorMeta // nil if the vector has no metadata
+}
+
+// IsVector reports whether r is a vector record.
+func (r *Record) IsVector() bool {
+	return r.Key == nil
+}
+
+// A Writer writes an archive.
+type Writer struct {
+	w   *bufio.Writer
+	gz  *gzip.Writer // nil if not compressing
+	n   int64        // number of data records written
+	buf []byte       // scratch buffer for record headers
+	err error        // first write error
+}
+
+// NewWriter returns a new Writer writing an archive to w
+// with the given header. If compress is true, the archive is
+// compressed with gzip.
+// The caller must call [Writer.Close] to complete the archive.
+func NewWriter(w io.Writer, h *Header, compress bool) (*Writer, error) {
+	aw := new(Writer)
+	if compress {
+		aw.gz = gzip.NewWriter(w)
+		w = aw.gz
+	}
+	aw.w = bufio.NewWriter(w)
+	aw.w.WriteString(magic)
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	aw.record('H', hdr)
+	if aw.err != nil {
+		return nil, aw.err
+	}
+	return aw, nil
+}
+
+// record writes a record with the given kind and payload.
+func (w *Writer) record(kind byte, payload []byte) {
+	if w.err != nil {
+		return
+	}
+	b := append(w.buf[:0], kind)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	crc := crc32.Update(0, crcTable, b)
+	crc = crc32.Update(crc, crcTable, payload)
+	w.buf = b
+	w.w.Write(b)
+	w.w.Write(payload)
+	_, w.err = w.w.Write(binary.BigEndian.AppendUint32(nil, crc))
+}
+
+// Set writes a key-value record.
+func (w *Writer) Set(key, val []byte) error {
+	p := binary.AppendUvarint(nil, uint64(len(key)))
+	p = append(p, key...)
+	p = append(p, val...)
+	w.record('K', p)
+	w.n++
+	return w.err
+}
+
+// SetVector writes a vector record.
+// The meta argument may be nil.
+func (w *Writer) SetVector(namespace, id string, vec llm.Vector, meta *storage.VectorMeta) error {
+	p := binary.AppendUvarint(nil, uint64(len(namespace)))
+	p = append(p, namespace...)
+	p = binary.AppendUvarint(p, uint64(len(id)))
+	p = append(p, id...)
+	enc := vec.Encode()
+	p = binary.AppendUvarint(p, uint64(len(enc)))
+	p = append(p, enc...)
+	if meta != nil {
+		p = append(p, storage.JSON(meta)...)
+	}
+	w.record('V', p)
+	w.n++
+	return w.err
+}
+
+// Close writes the end record and flushes the archive.
+// It does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.record('E', binary.AppendUvarint(nil, uint64(w.n)))
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// A Reader reads an archive.
+type Reader struct {
+	r      *bufio.Reader
+	header Header
+	n      int64 // number of data records read
+	done   bool  // read end record
+}
+
+// ErrCorrupt is the error (wrapped) returned when an archive is corrupt or truncated.
+var ErrCorrupt = errors.New("corrupt archive")
+
+func corrupt(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(format, args...))
+}
+
+// NewReader returns a new Reader reading an archive from r.
+// It reads the archive header, which is then available from [Reader.Header].
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(2); err == nil && b[0] == 0x1f && b[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, m); err != nil || string(m) != magic {
+		return nil, corrupt("missing archive header")
+	}
+	ar := &Reader{r: br}
+	kind, payload, err := ar.record()
+	if err != nil {
+		return nil, err
+	}
+	if kind != 'H' {
+		return nil, corrupt("missing archive header")
+	}
+	if err := json.Unmarshal(payload, &ar.header); err != nil {
+		return nil, corrupt("bad archive header: %v", err)
+	}
+	return ar, nil
+}
+
+// Header returns the archive header.
+func (r *Reader) Header() *Header {
+	return &r.header
+}
+
+// record reads the next record, verifying its checksum.
+func (r *Reader) record() (kind byte, payload []byte, err error) {
+	kind, err = r.r.ReadByte()
+	if err != nil {
+		return 0, nil, corrupt("truncated archive")
+	}
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil || n > maxRecord {
+		return 0, nil, corrupt("bad record length")
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return 0, nil, corrupt("truncated archive")
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r.r, sum[:]); err != nil {
+		return 0, nil, corrupt("truncated archive")
+	}
+	crc := crc32.Update(0, crcTable, binary.AppendUvarint([]byte{kind}, n))
+	crc = crc32.Update(crc, crcTable, payload)
+	if crc != binary.BigEndian.Uint32(sum[:]) {
+		return 0, nil, corrupt("checksum mismatch")
+	}
+	return kind, payload, nil
+}
+
+// Next returns the next data record in the archive.
+// After the last record, Next verifies the end record
+// and returns nil, [io.EOF].
+func (r *Reader) Next() (*Record, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	kind, p, err := r.record()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 'K':
+		key, rest, err := field(p)
+		if err != nil {
+			return nil, err
+		}
+		r.n++
+		return &Record{Key: key, Val: rest}, nil
+
+	case 'V':
+		ns, p, err := field(p)
+		if err != nil {
+			return nil, err
+		}
+		id, p, err := field(p)
+		if err != nil {
+			return nil, err
+		}
+		enc, p, err := field(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(enc)%4 != 0 {
+			return nil, corrupt("bad vector encoding")
+		}
+		rec := &Record{Namespace: string(ns), ID: string(id)}
+		rec.Vector.Decode(enc)
+		if len(p) > 0 {
+			rec.Meta = new(storage.VectorMeta)
+			if err := json.Unmarshal(p, rec.Meta); err != nil {
+				return nil, corrupt("bad vector metadata: %v", err)
+			}
+		}
+		r.n++
+		return rec, nil
+
+	case 'E':
+		n, k := binary.Uvarint(p)
+		if k <= 0 || k != len(p) {
+			return nil, corrupt("bad end record")
+		}
+		if int64(n) != r.n {
+			return nil, corrupt("end record has %d records, read %d", n, r.n)
+		}
+		r.done = true
+		return nil, io.EOF
+	}
+	return nil, corrupt("unknown record kind %q", kind)
+}
+
+// field decodes a length-prefixed field from the start of p,
+// returning the field and the rest of p.
+func field(p []byte) (f, rest []byte, err error) {
+	n, k := binary.Uvarint(p)
+	if k <= 0 || n > uint64(len(p)-k) {
+		return nil, nil, corrupt("bad record field")
+	}
+	p = p[k:]
+	return bytes.Clone(p[:n]), p[n:], nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/storage/timed"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+// dump returns the key-value pairs in db, in order.
+func dump(db storage.DB) []string {
+	var list []string
+	for key, val := range db.Scan(nil, ordered.Encode(ordered.Inf)) {
+		list = append(list, storage.Fmt(key)+" = "+storage.Fmt(val()))
+	}
+	return list
+}
+
+func TestRoundTrip(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	db.Set(ordered.Encode("plain", 1), []byte("one"))
+	db.Set(ordered.Encode("plain", 2), nil)
+	b := db.Batch()
+	timed.Set(db, b, "kind", []byte("key"), []byte("val"))
+	b.Apply()
+
+	vdb := storage.MemVectorDB(db, lg, "ns")
+	vdb.Set("a", llm.Vector{1, 2})
+	vdb.(storage.MetaVectorDB).SetMeta("a", &storage.VectorMeta{Kind: "issue", Project: "p"})
+	vdb.Set("b", llm.Vector{3, 4})
+	other := storage.MemVectorDB(db, lg, "other")
+	other.Set("x", llm.Vector{5})
+
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprint("compress=", compress), func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := &Options{Vectors: map[string]storage.VectorDB{"ns": vdb}, Compress: compress}
+			stats, err := Export(lg, &buf, db, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Vectors != 2 {
+				t.Errorf("Export: %d vectors, want 2", stats.Vectors)
+			}
+			if compress != bytes.HasPrefix(buf.Bytes(), []byte{0x1f, 0x8b}) {
+				t.Errorf("Export: compressed = %v, want %v", !compress, compress)
+			}
+
+			db2 := storage.MemDB()
+			vdb2 := storage.MemVectorDB(db2, lg, "ns")
+			h, stats2, err := Import(lg, &buf, db2, func(ns string) (storage.VectorDB, error) {
+				if ns != "ns" {
+					return nil, fmt.Errorf("unexpected namespace %q", ns)
+				}
+				return vdb2, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(h.Namespaces, []string{"ns"}) || h.Since != 0 || h.Created.IsZero() {
+				t.Errorf("Import: header = %+v", h)
+			}
+			if *stats2 != *stats {
+				t.Errorf("Import: stats = %+v, Export: stats = %+v", stats2, stats)
+			}
+			if d1, d2 := dump(db), dump(db2); !reflect.DeepEqual(d1, d2) {
+				t.Errorf("Import: db = %q\nwant %q", d2, d1)
+			}
+			if m, ok := vdb2.(storage.MetaVectorDB).Meta("a"); !ok || m.Kind != "issue" {
+				t.Errorf("Import: Meta(a) = %+v, %v, want issue", m, ok)
+			}
+		})
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	for i := range 10 {
+		db.Set(ordered.Encode("key", i), []byte("val"))
+	}
+	var buf bytes.Buffer
+	if _, err := Export(lg, &buf, db, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	check := func(name string, data []byte) {
+		t.Helper()
+		_, _, err := Import(lg, bytes.NewReader(data), storage.MemDB(), nil)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: Import err = %v, want ErrCorrupt", name, err)
+		}
+	}
+	check("empty", nil)
+	for _, n := range []int{len(magic), len(magic) + 5, len(data) / 2, len(data) - 1} {
+		check(fmt.Sprint("truncated to ", n), data[:n])
+	}
+	for _, i := range []int{0, len(magic) + 3, len(data) / 2, len(data) - 2} {
+		bad := bytes.Clone(data)
+		bad[i] ^= 0x40
+		check(fmt.Sprint("flipped byte ", i), bad)
+	}
+}
+
+func TestNoVectorDB(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	vdb := storage.MemVectorDB(db, lg, "ns")
+	vdb.Set("a", llm.Vector{1})
+	var buf bytes.Buffer
+	if _, err := Export(lg, &buf, db, &Options{Vectors: map[string]storage.VectorDB{"ns": vdb}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Import(lg, &buf, storage.MemDB(), nil); err == nil {
+		t.Errorf("Import with vectors and no vector func succeeded")
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	db.Set(ordered.Encode("plain"), []byte("untimed"))
+	b := db.Batch()
+	timed.Set(db, b, "a", []byte("old"), []byte("1"))
+	timed.Set(db, b, "b", []byte("old"), []byte("1"))
+	b.Apply()
+
+	var full bytes.Buffer
+	if _, err := Export(lg, &full, db, nil); err != nil {
+		t.Fatal(err)
+	}
+	db2 := storage.MemDB()
+	if _, _, err := Import(lg, &full, db2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var since timed.DBTime
+	for e := range timed.Scan(db, "b", nil, ordered.Encode(ordered.Inf)) {
+		since = e.ModTime
+	}
+	timed.Set(db, b, "a", []byte("new"), []byte("2"))
+	timed.Set(db, b, "b", []byte("old"), []byte("2"))
+	b.Apply()
+	db.Set(ordered.Encode("plain2"), []byte("untimed"))
+
+	var inc bytes.Buffer
+	stats, err := Export(lg, &inc, db, &Options{Since: since})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 4 {
+		t.Errorf("incremental Export: %d keys, want 4 (2 entries and their time index keys)", stats.Keys)
+	}
+	h, _, err := Import(lg, &inc, db2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Since != since {
+		t.Errorf("incremental Import: Since = %v, want %v", h.Since, since)
+	}
+
+	// The timed entries must match, and the untimed key
+	// added after the full snapshot must not have been copied.
+	for _, kind := range []string{"a", "b"} {
+		var want, have []string
+		for e := range timed.ScanAfter(lg, db, kind, 0, nil) {
+			want = append(want, fmt.Sprintf("%s=%s@%d", e.Key, e.Val, e.ModTime))
+		}
+		for e := range timed.ScanAfter(lg, db2, kind, 0, nil) {
+			have = append(have, fmt.Sprintf("%s=%s@%d", e.Key, e.Val, e.ModTime))
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("kind %s: after incremental Import:\nhave %q\nwant %q", kind, have, want)
+		}
+	}
+	if _, ok := db2.Get(ordered.Encode("plain2")); ok {
+		t.Errorf("incremental Import copied untimed key")
+	}
+}
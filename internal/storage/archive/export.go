@@ -0,0 +1,196 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/storage/timed"
+	"rsc.io/ordered"
+)
+
+// Options are options for [Export].
+type Options struct {
+	// Since, if non-zero, makes Export write an incremental snapshot
+	// containing only the timed entries set after Since.
+	Since timed.DBTime
+
+	// Vectors are the vector databases to include, by namespace.
+	// Vectors are always exported in full, even in an incremental snapshot.
+	// The keys that store vectors for these namespaces in the DB itself
+	// (as written by [storage.MemVectorDB] and related implementations)
+	// are omitted, since importing the vector records recreates them.
+	Vectors map[string]storage.VectorDB
+
+	// Compress enables gzip compression of the archive.
+	Compress bool
+}
+
+// Stats reports the number of records exported or imported.
+type Stats struct {
+	Keys    int64 // key-value records
+	Vectors int64 // vector records
+}
+
+// Export writes an archive of db to w, as described in the package comment.
+// It does not close w.
+func Export(lg *slog.Logger, w io.Writer, db storage.DB, opts *Options) (*Stats, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	h := &Header{
+		Created:    time.Now().UTC(),
+		Since:      opts.Since,
+		Namespaces: slices.Sorted(maps.Keys(opts.Vectors)),
+	}
+	aw, err := NewWriter(w, h, opts.Compress)
+	if err != nil {
+		return nil, err
+	}
+	stats := new(Stats)
+	set := func(key, val []byte) error {
+		stats.Keys++
+		if stats.Keys%100000 == 0 {
+			lg.Info("archive export", "keys", stats.Keys, "key", storage.Fmt(key))
+		}
+		return aw.Set(key, val)
+	}
+
+	if opts.Since == 0 {
+		for key, val := range db.Scan(nil, ordered.Encode(ordered.Inf)) {
+			if isVectorKey(key, opts.Vectors) {
+				continue
+			}
+			if err := set(key, val()); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, kind := range timed.Kinds(db) {
+			for e := range timed.ScanAfter(lg, db, kind, opts.Since, nil) {
+				t := int64(e.ModTime)
+				err := set(append(ordered.Encode(kind), e.Key...), append(ordered.Encode(t), e.Val...))
+				if err == nil {
+					err = set(append(ordered.Encode(kind+"ByTime", t), e.Key...), nil)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, ns := range h.Namespaces {
+		vdb := opts.Vectors[ns]
+		mdb, _ := vdb.(storage.MetaVectorDB)
+		for id, vec := range vdb.All() {
+			var meta *storage.VectorMeta
+			if mdb != nil {
+				meta, _ = mdb.Meta(id)
+			}
+			stats.Vectors++
+			if err := aw.SetVector(ns, id, vec(), meta); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	lg.Info("archive exported", "keys", stats.Keys, "vectors", stats.Vectors, "since", opts.Since)
+	return stats, nil
+}
+
+// vectorKinds are the first elements of the keys
+// used by the DB-backed VectorDB implementations.
+var vectorKinds = []string{"llm.Vector", "llm.VectorMeta", "llm.VectorGraph"}
+
+// isVectorKey reports whether key stores data for one of the vector namespaces.
+func isVectorKey(key []byte, vectors map[string]storage.VectorDB) bool {
+	if len(vectors) == 0 {
+		return false
+	}
+	for _, kind := range vectorKinds {
+		prefix := ordered.Encode(kind)
+		if !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		var ns string
+		if _, err := ordered.DecodePrefix(key[len(prefix):], &ns); err != nil {
+			return false
+		}
+		_, ok := vectors[ns]
+		return ok
+	}
+	return false
+}
+
+// Import reads an archive from r and writes its records to db.
+// It writes each vector record to the VectorDB returned by
+// vector(namespace), which is called once per namespace.
+// If vector is nil, vector records are an error.
+//
+// Import writes the records as it reads them, verifying each record's
+// checksum before writing it. If Import returns an error, for example
+// because the archive is truncated, db may contain some of the records.
+// Importing the same archive again is harmless.
+func Import(lg *slog.Logger, r io.Reader, db storage.DB, vector func(namespace string) (storage.VectorDB, error)) (*Header, *Stats, error) {
+	ar, err := NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats := new(Stats)
+	b := db.Batch()
+	vbatches := make(map[string]storage.VectorBatch)
+	for {
+		rec, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !rec.IsVector() {
+			b.Set(rec.Key, rec.Val)
+			b.MaybeApply()
+			stats.Keys++
+			continue
+		}
+
+		vb := vbatches[rec.Namespace]
+		if vb == nil {
+			if vector == nil {
+				return nil, nil, fmt.Errorf("archive contains vectors for namespace %q but no vector database is available", rec.Namespace)
+			}
+			vdb, err := vector(rec.Namespace)
+			if err != nil {
+				return nil, nil, err
+			}
+			vb = vdb.Batch()
+			vbatches[rec.Namespace] = vb
+		}
+		vb.Set(rec.ID, rec.Vector)
+		if mb, ok := vb.(storage.MetaVectorBatch); ok && rec.Meta != nil {
+			mb.SetMeta(rec.ID, rec.Meta)
+		}
+		vb.MaybeApply()
+		stats.Vectors++
+	}
+	b.Apply()
+	for _, vb := range vbatches {
+		vb.Apply()
+	}
+	db.Flush()
+	lg.Info("archive imported", "keys", stats.Keys, "vectors", stats.Vectors, "since", ar.Header().Since)
+	return ar.Header(), stats, nil
+}
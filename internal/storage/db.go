@@ -38,6 +38,7 @@ type DB interface {
 	// must block until Unlock(name) has been called.
 	// In a shared database, a lock may also unlock
 	// when the client disconnects or times out.
+	// To wait with a timeout or without blocking, use [LockContext] or [TryLock].
 	Lock(name string)
 
 	// Unlock releases the lock with the given name,
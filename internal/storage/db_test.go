@@ -5,8 +5,11 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"math"
 	"testing"
+	"time"
 
 	"golang.org/x/oscar/internal/testutil"
 	"rsc.io/ordered"
@@ -62,3 +65,27 @@ func TestMemLocker(t *testing.T) {
 
 	TestDBLock(t, m)
 }
+
+func TestMemLockerContext(t *testing.T) {
+	TestDBContextLock(t, new(MemLocker))
+}
+
+func TestLockContextFallback(t *testing.T) {
+	db := &maybeDB{DB: MemDB()}
+	if TryLock(db, "abc") {
+		t.Fatalf("TryLock without ContextLocker = true, want false")
+	}
+	db.Lock("abc")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := LockContext(ctx, db, "abc"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LockContext while locked = %v, want %v", err, context.DeadlineExceeded)
+	}
+	db.Unlock("abc")
+
+	// The abandoned Lock releases the lock once acquired.
+	if err := LockContext(context.Background(), db, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	db.Unlock("abc")
+}
@@ -0,0 +1,453 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dbmetrics records OpenTelemetry metrics for the operations
+// on a [storage.DB] or [storage.VectorDB].
+//
+// A [Metrics] holds the instruments, created from a [metric.Meter].
+// [Metrics.DB] and [Metrics.VectorDB] wrap a database so that every
+// operation on it is recorded, attributed to a calling component
+// and, for [storage.DB] operations, to the kind of key,
+// which is the first string in its [ordered] encoding
+// (for example, "github.Event").
+// To attribute operations to another component,
+// use [Component] to get a view of the same database with a different name.
+//
+// The instruments, named by appending to the prefix passed to [New], are:
+//
+//   - PREFIX/op-duration: latency of each operation, in seconds,
+//     with attributes "op", "kind" and "component".
+//     The duration of a scan excludes the time spent by the
+//     caller between iterations.
+//   - PREFIX/bytes-read and PREFIX/bytes-written: sizes of the keys and
+//     values read and written, with the same attributes.
+//   - PREFIX/scan-length: the number of entries returned by each scan,
+//     with attributes "kind" and "component".
+//   - PREFIX/lock-wait: time spent waiting to acquire a lock, in seconds,
+//     with attribute "component".
+//   - PREFIX/vector-op-duration: latency of each vector database operation,
+//     with attributes "op" and "component".
+//
+// The meter can export the metrics to GCP (see [gcpmetrics])
+// or locally (see [localmetrics]).
+//
+// [ordered]: https://pkg.go.dev/rsc.io/ordered
+// [gcpmetrics]: https://pkg.go.dev/golang.org/x/oscar/internal/gcp/gcpmetrics
+// [localmetrics]: https://pkg.go.dev/golang.org/x/oscar/internal/localmetrics
+package dbmetrics
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+// Metrics holds the instruments for recording database metrics.
+type Metrics struct {
+	opDuration       metric.Float64Histogram
+	bytesRead        metric.Int64Counter
+	bytesWritten     metric.Int64Counter
+	scanLength       metric.Int64Histogram
+	lockWait         metric.Float64Histogram
+	vectorOpDuration metric.Float64Histogram
+}
+
+// New returns a new Metrics whose instruments are created by meter
+// with names beginning with prefix.
+func New(meter metric.Meter, prefix string) (*Metrics, error) {
+	m := new(Metrics)
+	var err error
+	if m.opDuration, err = meter.Float64Histogram(prefix+"/op-duration",
+		metric.WithDescription("latency of database operations"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.bytesRead, err = meter.Int64Counter(prefix+"/bytes-read",
+		metric.WithDescription("bytes of keys and values read from the database"), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if m.bytesWritten, err = meter.Int64Counter(prefix+"/bytes-written",
+		metric.WithDescription("bytes of keys and values written to the database"), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if m.scanLength, err = meter.Int64Histogram(prefix+"/scan-length",
+		metric.WithDescription("number of entries returned by database scans")); err != nil {
+		return nil, err
+	}
+	if m.lockWait, err = meter.Float64Histogram(prefix+"/lock-wait",
+		metric.WithDescription("time spent waiting for database locks"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.vectorOpDuration, err = meter.Float64Histogram(prefix+"/vector-op-duration",
+		metric.WithDescription("latency of vector database operations"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// kindOf returns the kind of key, for the "kind" attribute:
+// the first string in its ordered encoding, or "other".
+func kindOf(key []byte) string {
+	var kind string
+	if _, err := ordered.DecodePrefix(key, &kind); err != nil {
+		return "other"
+	}
+	return kind
+}
+
+// recordOp records an operation op on keys of the given kind,
+// which started at start.
+func (db *metricsDB) recordOp(op, kind string, start time.Time) {
+	db.m.opDuration.Record(context.Background(), time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("op", op), attribute.String("kind", kind), attribute.String("component", db.component)))
+}
+
+// recordBytes records n bytes read or written by op on keys of the given kind.
+func (db *metricsDB) recordBytes(c metric.Int64Counter, op, kind string, n int) {
+	c.Add(context.Background(), int64(n),
+		metric.WithAttributes(attribute.String("op", op), attribute.String("kind", kind), attribute.String("component", db.component)))
+}
+
+// DB returns a DB that records metrics for the operations on db,
+// attributed to the named component.
+//
+// The returned DB also implements [storage.TxDB], [storage.Notifier]
+// and [storage.ContextLocker], by calling [storage.Transaction],
+// [storage.Subscribe] and [storage.LockContext] (and so on) on db,
+// so it behaves like db when used with those functions.
+// It does not implement other optional interfaces that db implements.
+func (m *Metrics) DB(db storage.DB, component string) storage.DB {
+	return &metricsDB{m: m, base: db, component: component}
+}
+
+// Component returns a view of the DB db returned by [Metrics.DB]
+// that attributes its operations to the named component.
+// If db was not returned by [Metrics.DB] (or Component), Component returns db.
+func Component(db storage.DB, component string) storage.DB {
+	mdb, ok := db.(*metricsDB)
+	if !ok {
+		return db
+	}
+	return mdb.m.DB(mdb.base, component)
+}
+
+type metricsDB struct {
+	m         *Metrics
+	base      storage.DB
+	component string
+}
+
+var (
+	_ storage.TxDB          = (*metricsDB)(nil)
+	_ storage.Notifier      = (*metricsDB)(nil)
+	_ storage.ContextLocker = (*metricsDB)(nil)
+)
+
+// Lock implements [storage.DB.Lock], recording the time spent waiting.
+func (db *metricsDB) Lock(name string) {
+	start := time.Now()
+	db.base.Lock(name)
+	db.recordLockWait(start)
+}
+
+func (db *metricsDB) recordLockWait(start time.Time) {
+	db.m.lockWait.Record(context.Background(), time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("component", db.component)))
+}
+
+// Unlock implements [storage.DB.Unlock].
+func (db *metricsDB) Unlock(name string) {
+	db.base.Unlock(name)
+}
+
+// LockContext implements [storage.ContextLocker.LockContext]
+// by calling [storage.LockContext], recording the time spent waiting.
+func (db *metricsDB) LockContext(ctx context.Context, name string) error {
+	start := time.Now()
+	err := storage.LockContext(ctx, db.base, name)
+	if err == nil {
+		db.recordLockWait(start)
+	}
+	return err
+}
+
+// TryLock implements [storage.ContextLocker.TryLock] by calling [storage.TryLock].
+func (db *metricsDB) TryLock(name string) bool {
+	return storage.TryLock(db.base, name)
+}
+
+// Locks implements [storage.ContextLocker.Locks].
+// It returns nil if the underlying DB is not a [storage.ContextLocker].
+func (db *metricsDB) Locks() []storage.LockInfo {
+	if cl, ok := db.base.(storage.ContextLocker); ok {
+		return cl.Locks()
+	}
+	return nil
+}
+
+// Get implements [storage.DB.Get].
+func (db *metricsDB) Get(key []byte) ([]byte, bool) {
+	kind := kindOf(key)
+	defer db.recordOp("get", kind, time.Now())
+	val, ok := db.base.Get(key)
+	db.recordBytes(db.m.bytesRead, "get", kind, len(val))
+	return val, ok
+}
+
+// Set implements [storage.DB.Set].
+func (db *metricsDB) Set(key, val []byte) {
+	kind := kindOf(key)
+	defer db.recordOp("set", kind, time.Now())
+	db.base.Set(key, val)
+	db.recordBytes(db.m.bytesWritten, "set", kind, len(key)+len(val))
+}
+
+// Delete implements [storage.DB.Delete].
+func (db *metricsDB) Delete(key []byte) {
+	defer db.recordOp("delete", kindOf(key), time.Now())
+	db.base.Delete(key)
+}
+
+// DeleteRange implements [storage.DB.DeleteRange].
+func (db *metricsDB) DeleteRange(start, end []byte) {
+	defer db.recordOp("delete-range", kindOf(start), time.Now())
+	db.base.DeleteRange(start, end)
+}
+
+// Scan implements [storage.DB.Scan].
+func (db *metricsDB) Scan(start, end []byte) iter.Seq2[[]byte, func() []byte] {
+	return func(yield func([]byte, func() []byte) bool) {
+		kind := kindOf(start)
+		var elapsed time.Duration
+		n, nbytes := 0, 0
+		defer func() {
+			attrs := metric.WithAttributes(attribute.String("op", "scan"), attribute.String("kind", kind), attribute.String("component", db.component))
+			db.m.opDuration.Record(context.Background(), elapsed.Seconds(), attrs)
+			db.m.bytesRead.Add(context.Background(), int64(nbytes), attrs)
+			db.m.scanLength.Record(context.Background(), int64(n),
+				metric.WithAttributes(attribute.String("kind", kind), attribute.String("component", db.component)))
+		}()
+
+		t := time.Now()
+		for key, valf := range db.base.Scan(start, end) {
+			elapsed += time.Since(t)
+			n++
+			nbytes += len(key)
+			f := func() []byte {
+				val := valf()
+				nbytes += len(val)
+				return val
+			}
+			if !yield(key, f) {
+				return
+			}
+			t = time.Now()
+		}
+		elapsed += time.Since(t)
+	}
+}
+
+// Batch implements [storage.DB.Batch].
+func (db *metricsDB) Batch() storage.Batch {
+	return &metricsBatch{db: db, b: db.base.Batch()}
+}
+
+// Flush implements [storage.DB.Flush].
+func (db *metricsDB) Flush() {
+	defer db.recordOp("flush", "", time.Now())
+	db.base.Flush()
+}
+
+// Close implements [storage.DB.Close].
+func (db *metricsDB) Close() {
+	db.base.Close()
+}
+
+// Panic implements [storage.DB.Panic].
+func (db *metricsDB) Panic(msg string, args ...any) {
+	db.base.Panic(msg, args...)
+}
+
+// Transaction implements [storage.TxDB.Transaction] by calling [storage.Transaction].
+func (db *metricsDB) Transaction(f func(tx storage.Tx) error) error {
+	defer db.recordOp("transaction", "", time.Now())
+	return storage.Transaction(db.base, f)
+}
+
+// Subscribe implements [storage.Notifier.Subscribe] by calling [storage.Subscribe].
+func (db *metricsDB) Subscribe(prefix []byte) *storage.Subscription {
+	return storage.Subscribe(db.base, prefix)
+}
+
+// A metricsBatch is a [storage.Batch] that records metrics.
+// The bytes written are recorded as operations are added to the batch,
+// attributed to each key's kind, and the latency is recorded
+// when the batch is applied, with kind "".
+type metricsBatch struct {
+	db *metricsDB
+	b  storage.Batch
+}
+
+func (b *metricsBatch) Set(key, val []byte) {
+	b.db.recordBytes(b.db.m.bytesWritten, "batch-set", kindOf(key), len(key)+len(val))
+	b.b.Set(key, val)
+}
+
+func (b *metricsBatch) Delete(key []byte) {
+	b.b.Delete(key)
+}
+
+func (b *metricsBatch) DeleteRange(start, end []byte) {
+	b.b.DeleteRange(start, end)
+}
+
+func (b *metricsBatch) MaybeApply() bool {
+	start := time.Now()
+	if !b.b.MaybeApply() {
+		return false
+	}
+	b.db.recordOp("batch-apply", "", start)
+	return true
+}
+
+func (b *metricsBatch) Apply() {
+	defer b.db.recordOp("batch-apply", "", time.Now())
+	b.b.Apply()
+}
+
+// VectorDB returns a VectorDB that records metrics for the operations on vdb,
+// attributed to the named component.
+// If vdb implements [storage.MetaVectorDB], so does the result.
+func (m *Metrics) VectorDB(vdb storage.VectorDB, component string) storage.VectorDB {
+	v := &metricsVectorDB{m: m, base: vdb, component: component}
+	if mdb, ok := vdb.(storage.MetaVectorDB); ok {
+		return &metricsMetaVectorDB{v, mdb}
+	}
+	return v
+}
+
+type metricsVectorDB struct {
+	m         *Metrics
+	base      storage.VectorDB
+	component string
+}
+
+// recordOp records a vector operation op that started at start.
+func (db *metricsVectorDB) recordOp(op string, start time.Time) {
+	db.m.vectorOpDuration.Record(context.Background(), time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("op", op), attribute.String("component", db.component)))
+}
+
+// Set implements [storage.VectorDB.Set].
+func (db *metricsVectorDB) Set(id string, vec llm.Vector) {
+	defer db.recordOp("set", time.Now())
+	db.base.Set(id, vec)
+}
+
+// Delete implements [storage.VectorDB.Delete].
+func (db *metricsVectorDB) Delete(id string) {
+	defer db.recordOp("delete", time.Now())
+	db.base.Delete(id)
+}
+
+// Get implements [storage.VectorDB.Get].
+func (db *metricsVectorDB) Get(id string) (llm.Vector, bool) {
+	defer db.recordOp("get", time.Now())
+	return db.base.Get(id)
+}
+
+// All implements [storage.VectorDB.All].
+func (db *metricsVectorDB) All() iter.Seq2[string, func() llm.Vector] {
+	return db.base.All()
+}
+
+// Batch implements [storage.VectorDB.Batch].
+// If the underlying batch implements [storage.MetaVectorBatch], so does the result.
+func (db *metricsVectorDB) Batch() storage.VectorBatch {
+	b := &metricsVectorBatch{db: db, b: db.base.Batch()}
+	if mb, ok := b.b.(storage.MetaVectorBatch); ok {
+		return &metricsMetaVectorBatch{b, mb}
+	}
+	return b
+}
+
+// Search implements [storage.VectorDB.Search].
+func (db *metricsVectorDB) Search(vec llm.Vector, n int) []storage.VectorResult {
+	defer db.recordOp("search", time.Now())
+	return db.base.Search(vec, n)
+}
+
+// Flush implements [storage.VectorDB.Flush].
+func (db *metricsVectorDB) Flush() {
+	defer db.recordOp("flush", time.Now())
+	db.base.Flush()
+}
+
+// A metricsMetaVectorDB is a metricsVectorDB for a [storage.MetaVectorDB].
+type metricsMetaVectorDB struct {
+	*metricsVectorDB
+	meta storage.MetaVectorDB
+}
+
+// SetMeta implements [storage.MetaVectorDB.SetMeta].
+func (db *metricsMetaVectorDB) SetMeta(id string, meta *storage.VectorMeta) {
+	defer db.recordOp("set-meta", time.Now())
+	db.meta.SetMeta(id, meta)
+}
+
+// Meta implements [storage.MetaVectorDB.Meta].
+func (db *metricsMetaVectorDB) Meta(id string) (*storage.VectorMeta, bool) {
+	defer db.recordOp("meta", time.Now())
+	return db.meta.Meta(id)
+}
+
+// SearchFilter implements [storage.MetaVectorDB.SearchFilter].
+func (db *metricsMetaVectorDB) SearchFilter(vec llm.Vector, n int, f *storage.VectorFilter) []storage.VectorResult {
+	defer db.recordOp("search-filter", time.Now())
+	return db.meta.SearchFilter(vec, n, f)
+}
+
+// A metricsVectorBatch is a [storage.VectorBatch] that records
+// the latency of applying the batch.
+type metricsVectorBatch struct {
+	db *metricsVectorDB
+	b  storage.VectorBatch
+}
+
+func (b *metricsVectorBatch) Set(id string, vec llm.Vector) {
+	b.b.Set(id, vec)
+}
+
+func (b *metricsVectorBatch) Delete(id string) {
+	b.b.Delete(id)
+}
+
+func (b *metricsVectorBatch) MaybeApply() bool {
+	start := time.Now()
+	if !b.b.MaybeApply() {
+		return false
+	}
+	b.db.recordOp("batch-apply", start)
+	return true
+}
+
+func (b *metricsVectorBatch) Apply() {
+	defer b.db.recordOp("batch-apply", time.Now())
+	b.b.Apply()
+}
+
+// A metricsMetaVectorBatch is a metricsVectorBatch for a [storage.MetaVectorBatch].
+type metricsMetaVectorBatch struct {
+	*metricsVectorBatch
+	meta storage.MetaVectorBatch
+}
+
+func (b *metricsMetaVectorBatch) SetMeta(id string, meta *storage.VectorMeta) {
+	b.meta.SetMeta(id, meta)
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dbmetrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+// newTestMetrics returns a Metrics using a meter that reports to the returned reader.
+func newTestMetrics(t *testing.T) (*Metrics, *sdkmetric.ManualReader) {
+	r := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(r))
+	m, err := New(mp.Meter("test"), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, r
+}
+
+// collect returns the metrics collected by r, keyed by
+// metric name followed by the attribute values, as in
+// "db/op-duration component=c kind=k op=get".
+// Histograms are reported by their count, counters by their sum.
+func collect(t *testing.T, r *sdkmetric.ManualReader) map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	if err := r.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	name := func(m metricdata.Metrics, s attribute.Set) string {
+		name := m.Name
+		for _, kv := range s.ToSlice() {
+			name += fmt.Sprintf(" %s=%s", kv.Key, kv.Value.Emit())
+		}
+		return name
+	}
+	out := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch d := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, p := range d.DataPoints {
+					out[name(m, p.Attributes)] = p.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, p := range d.DataPoints {
+					out[name(m, p.Attributes)] = int64(p.Count)
+				}
+			case metricdata.Histogram[int64]:
+				for _, p := range d.DataPoints {
+					out[name(m, p.Attributes)] = int64(p.Count)
+				}
+			default:
+				t.Fatalf("unexpected metric data %T", d)
+			}
+		}
+	}
+	return out
+}
+
+func TestDB(t *testing.T) {
+	m, _ := newTestMetrics(t)
+	storage.TestDB(t, m.DB(storage.MemDB(), "test"))
+}
+
+func TestMetrics(t *testing.T) {
+	m, r := newTestMetrics(t)
+	db := m.DB(storage.MemDB(), "a")
+
+	db.Set(ordered.Encode("k", 1), []byte("val1"))
+	b := db.Batch()
+	b.Set(ordered.Encode("k", 2), []byte("val2"))
+	b.Apply()
+	if _, ok := db.Get(ordered.Encode("k", 1)); !ok {
+		t.Fatal("Get failed")
+	}
+	db.Lock("x")
+	db.Unlock("x")
+
+	other := Component(db, "b")
+	n := 0
+	for _, val := range other.Scan(ordered.Encode("k"), ordered.Encode("k", ordered.Inf)) {
+		val()
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("Scan returned %d entries, want 2", n)
+	}
+
+	keyLen := len(ordered.Encode("k", 1))
+	want := map[string]int64{
+		"db/op-duration component=a kind=k op=set":         1,
+		"db/op-duration component=a kind=k op=get":         1,
+		"db/op-duration component=a kind= op=batch-apply":  1,
+		"db/op-duration component=b kind=k op=scan":        1,
+		"db/bytes-written component=a kind=k op=set":       int64(keyLen + 4),
+		"db/bytes-written component=a kind=k op=batch-set": int64(keyLen + 4),
+		"db/bytes-read component=a kind=k op=get":          4,
+		"db/bytes-read component=b kind=k op=scan":         int64(2 * (keyLen + 4)),
+		"db/scan-length component=b kind=k":                1,
+		"db/lock-wait component=a":                         1,
+	}
+	have := collect(t, r)
+	for k, w := range want {
+		if h, ok := have[k]; !ok || h != w {
+			t.Errorf("%s = %d, %v; want %d", k, h, ok, w)
+		}
+	}
+	if t.Failed() {
+		t.Logf("have %v", have)
+	}
+
+	if db := Component(storage.MemDB(), "c"); db == nil {
+		t.Errorf("Component(MemDB) = nil")
+	}
+}
+
+func TestVectorDB(t *testing.T) {
+	m, r := newTestMetrics(t)
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	storage.TestVectorDB(t, func() storage.VectorDB {
+		return m.VectorDB(storage.MemVectorDB(db, lg, ""), "v")
+	})
+
+	base := storage.MemVectorDB(storage.MemDB(), lg, "")
+	vdb := m.VectorDB(base, "v")
+	_, baseMeta := base.(storage.MetaVectorDB)
+	if _, ok := vdb.(storage.MetaVectorDB); ok != baseMeta {
+		t.Errorf("VectorDB is MetaVectorDB = %v, want %v", ok, baseMeta)
+	}
+	vdb.Set("a", llm.Vector{1, 0})
+	vdb.Search(llm.Vector{1, 0}, 1)
+
+	have := collect(t, r)
+	for _, k := range []string{
+		"db/vector-op-duration component=v op=set",
+		"db/vector-op-duration component=v op=search",
+	} {
+		if have[k] == 0 {
+			t.Errorf("missing metric %s", k)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+
+	"rsc.io/ordered"
+)
+
+// A Decoder returns a readable, typed rendering of the value
+// of a database entry, for display by tools that browse a database.
+// The key and value are the entry's full key and value,
+// exactly as stored.
+type Decoder func(key, val []byte) (string, error)
+
+var decoders struct {
+	mu sync.Mutex
+	m  map[string]Decoder
+}
+
+// RegisterDecoder registers d as the decoder for entries whose keys
+// begin with the ordered encoding of the string kind,
+// as in ordered.Encode(kind, ...).
+// Packages register decoders for the kinds of keys they store,
+// so that tools can display those entries using [Decode].
+// RegisterDecoder panics if kind already has a decoder,
+// except during testing, when the new decoder replaces the old one.
+func RegisterDecoder(kind string, d Decoder) {
+	decoders.mu.Lock()
+	defer decoders.mu.Unlock()
+
+	if decoders.m == nil {
+		decoders.m = make(map[string]Decoder)
+	}
+	if _, ok := decoders.m[kind]; ok && !testing.Testing() {
+		panic(fmt.Sprintf("storage: decoder for %q already registered", kind))
+	}
+	decoders.m[kind] = d
+}
+
+// DecoderKinds returns the kinds that have registered decoders, in sorted order.
+func DecoderKinds() []string {
+	decoders.mu.Lock()
+	defer decoders.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(decoders.m))
+}
+
+// LookupDecoder returns the [Decoder] registered for the kind of key,
+// or nil if there is none.
+func LookupDecoder(key []byte) Decoder {
+	var kind string
+	if _, err := ordered.DecodePrefix(key, &kind); err != nil {
+		return nil
+	}
+	decoders.mu.Lock()
+	defer decoders.mu.Unlock()
+
+	return decoders.m[kind]
+}
+
+// Decode returns a readable rendering of the value val of the entry with
+// the given key. If the key's kind has a registered [Decoder] that
+// succeeds, Decode returns its result. Otherwise Decode returns [Fmt](val),
+// preceded by the decoder's error, if any.
+func Decode(key, val []byte) string {
+	d := LookupDecoder(key)
+	if d == nil {
+		return Fmt(val)
+	}
+	s, err := d(key, val)
+	if err != nil {
+		return fmt.Sprintf("decode error: %v\n%s", err, Fmt(val))
+	}
+	return s
+}
+
+// DecodeJSON unmarshals the JSON value val into v,
+// which should be a pointer to a value of the type that was
+// marshaled to create val, and returns v marshaled as indented JSON.
+// The result shows the fields of the Go type, omitting any
+// JSON fields it does not define.
+// DecodeJSON is a helper for implementing a [Decoder].
+func DecodeJSON(val []byte, v any) (string, error) {
+	if err := json.Unmarshal(val, v); err != nil {
+		return "", err
+	}
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return string(js), nil
+}
+
+func init() {
+	RegisterDecoder("llm.Vector", decodeVector)
+	RegisterDecoder("llm.VectorMeta", func(_, val []byte) (string, error) {
+		return DecodeJSON(val, new(VectorMeta))
+	})
+	RegisterDecoder("llm.VectorGraph", func(_, val []byte) (string, error) {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, val, "", "\t"); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	})
+}
+
+// decodeVector is the [Decoder] for vectors stored by a [VectorDB],
+// showing the vector's dimension and norm followed by its first few values.
+func decodeVector(_, val []byte) (string, error) {
+	v, err := DecodeVector(val)
+	if err != nil {
+		return "", err
+	}
+	const show = 8
+	return fmt.Sprintf("dim=%d norm=%.6g\n%v", len(v), math.Sqrt(v.Dot(v)), v[:min(len(v), show)]), nil
+}
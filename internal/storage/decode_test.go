@@ -0,0 +1,44 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"rsc.io/ordered"
+)
+
+func TestDecode(t *testing.T) {
+	type point struct{ X, Y int }
+	RegisterDecoder("test.Point", func(_, val []byte) (string, error) {
+		return DecodeJSON(val, new(point))
+	})
+	RegisterDecoder("test.Fail", func(_, val []byte) (string, error) {
+		return "", errors.New("bad value")
+	})
+	if !slices.Contains(DecoderKinds(), "test.Point") {
+		t.Errorf("DecoderKinds() = %v, missing test.Point", DecoderKinds())
+	}
+
+	for _, tc := range []struct {
+		key, val []byte
+		want     string
+	}{
+		{ordered.Encode("test.Point", 1), []byte(`{"X":1,"Y":2,"Z":3}`), "{\n\t\"X\": 1,\n\t\"Y\": 2\n}"},
+		{ordered.Encode("test.Fail", 1), []byte("x"), "decode error: bad value\n`x`"},
+		{ordered.Encode("test.None"), ordered.Encode(1), "(1)"},
+		{[]byte("raw"), []byte("x"), "`x`"},
+		{ordered.Encode("llm.Vector", "ns", "id"), llm.Vector{3, 4}.Encode(), "dim=2 norm=5\n[3 4]"},
+		{ordered.Encode("llm.Vector", "ns", "id"), EncodeHalfVector(llm.Vector{3, 4}), "dim=2 norm=5\n[3 4]"},
+		{ordered.Encode("llm.Vector", "ns", "id"), []byte("abc"), "decode error: bad vector encoding length 3\n`abc`"},
+	} {
+		if got := Decode(tc.key, tc.val); got != tc.want {
+			t.Errorf("Decode(%s, %s):\nhave %q\nwant %q", Fmt(tc.key), Fmt(tc.val), got, tc.want)
+		}
+	}
+}
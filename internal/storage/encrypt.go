@@ -0,0 +1,686 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/oscar/internal/secret"
+	"rsc.io/ordered"
+)
+
+// NewEncryptedDB returns a DB that stores its entries in base,
+// encrypting every value, and also the keys that begin with
+// any of the given prefixes.
+// It can wrap any DB, such as one opened using [dbspec],
+// so that the data stored on disk (or in the cloud) is unreadable
+// without the encryption keys.
+//
+// The encryption keys are read from the secret named name in keys.
+// The secret holds a list of base64-encoded 32-byte AES-256 keys,
+// separated by spaces, newest first. The newest key encrypts all new
+// entries; the others are used only to decrypt older entries.
+// To rotate keys, add a new key to the front of the list and call
+// [KeyRotator.RotateKeys], which re-encrypts all entries with the new key.
+// The old keys can then be removed from the secret.
+//
+// Values are encrypted with AES-GCM, authenticated with their
+// (unencrypted) key, so that values cannot be moved between keys
+// without detection.
+//
+// For keys beginning with one of the prefixes, the prefix is stored
+// unencrypted, followed by an identifier for the encryption key and
+// an order-preserving encryption of the rest of the key, which maps
+// each byte to two bytes using a keyed, strictly increasing function
+// that depends on the bytes before it.
+// Because the encrypted keys sort in the same order as the plain ones,
+// Get, Scan and DeleteRange work directly on ranges of base.
+// The price is that the encrypted keys reveal their order,
+// the length of any common prefix of two keys,
+// and the approximate value of each byte:
+// they hide the exact contents of the keys, not their structure.
+// Prefixes must be non-empty, and no prefix may be a prefix of another.
+//
+// NewEncryptedDB assumes that all keys are encoded with [rsc.io/ordered].
+// Locks, transactions and subscriptions are passed through to base,
+// which need not implement [ContextLocker], [TxDB] or [Notifier].
+//
+// The returned DB also implements [KeyRotator].
+//
+// [dbspec]: https://pkg.go.dev/golang.org/x/oscar/internal/dbspec
+func NewEncryptedDB(base DB, keys secret.DB, name string, prefixes ...[]byte) (DB, error) {
+	for i, p := range prefixes {
+		if len(p) == 0 {
+			return nil, errors.New("storage.NewEncryptedDB: empty prefix")
+		}
+		for j, q := range prefixes {
+			if i != j && bytes.HasPrefix(q, p) {
+				return nil, fmt.Errorf("storage.NewEncryptedDB: prefix %s is a prefix of %s", Fmt(p), Fmt(q))
+			}
+		}
+	}
+	db := &encryptedDB{
+		base:     base,
+		secrets:  keys,
+		name:     name,
+		prefixes: slices.Clone(prefixes),
+	}
+	slices.SortFunc(db.prefixes, bytes.Compare)
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// A KeyRotator is a DB that encrypts its entries and can re-encrypt
+// them when the encryption keys change.
+type KeyRotator interface {
+	DB
+
+	// RotateKeys reloads the encryption keys and re-encrypts with the
+	// newest key all entries encrypted with an older one.
+	// It returns the number of entries re-encrypted.
+	// RotateKeys should not run concurrently with other writes
+	// to the database, which it may overwrite.
+	RotateKeys() (int64, error)
+}
+
+type encryptedDB struct {
+	base     DB
+	secrets  secret.DB
+	name     string
+	prefixes [][]byte // sorted
+
+	mu   sync.Mutex
+	keys []*cryptKey // newest first
+}
+
+var (
+	_ KeyRotator    = (*encryptedDB)(nil)
+	_ TxDB          = (*encryptedDB)(nil)
+	_ Notifier      = (*encryptedDB)(nil)
+	_ ContextLocker = (*encryptedDB)(nil)
+)
+
+// A cryptKey is a single encryption key, with the ciphers derived from it.
+type cryptKey struct {
+	id    [keyIDLen]byte // identifies the key in encrypted data
+	aead  cipher.AEAD    // encrypts values
+	order cipher.Block   // encrypts keys, preserving order
+}
+
+const keyIDLen = 4 // bytes of key ID at start of encrypted keys and values
+
+// load loads the encryption keys from the secret database.
+func (db *encryptedDB) load() error {
+	s, ok := db.secrets.Get(db.name)
+	if !ok {
+		return fmt.Errorf("storage.NewEncryptedDB: no secret %q", db.name)
+	}
+	var keys []*cryptKey
+	seen := make(map[[keyIDLen]byte]bool)
+	for i, f := range strings.Fields(s) {
+		k, err := newCryptKey(f)
+		if err != nil {
+			return fmt.Errorf("storage.NewEncryptedDB: secret %q: key #%d: %v", db.name, i+1, err)
+		}
+		if !seen[k.id] {
+			seen[k.id] = true
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("storage.NewEncryptedDB: secret %q has no keys", db.name)
+	}
+	db.mu.Lock()
+	db.keys = keys
+	db.mu.Unlock()
+	return nil
+}
+
+// keyring returns the current encryption keys, newest first.
+func (db *encryptedDB) keyring() []*cryptKey {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.keys
+}
+
+// newCryptKey returns the cryptKey for the base64-encoded key s.
+func newCryptKey(s string) (*cryptKey, error) {
+	secret, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("key has %d bytes, want 32", len(secret))
+	}
+	derive := func(info string) []byte {
+		b, err := hkdf.Key(sha256.New, secret, nil, info, 32)
+		if err != nil {
+			// unreachable: 32 bytes is a valid length
+			panic(err)
+		}
+		return b
+	}
+	k := new(cryptKey)
+	sum := sha256.Sum256(secret)
+	copy(k.id[:], sum[:])
+	vblock, err := aes.NewCipher(derive("oscar storage value"))
+	if err != nil {
+		return nil, err
+	}
+	if k.aead, err = cipher.NewGCM(vblock); err != nil {
+		return nil, err
+	}
+	if k.order, err = aes.NewCipher(derive("oscar storage key order")); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// An encrypted key is the prefix, the key ID, and then
+// the order-preserving encryption of the rest of the key,
+// which encodes each byte b as the two-byte big-endian value
+// f(b) = b + g[0] + g[1] + ... + g[b].
+// The gaps g[j], in the range [0, 254], are drawn from a keystream
+// that depends on the encryption key and on the bytes before b.
+// Because f is strictly increasing and the encoding of each byte
+// depends only on the bytes before it, encrypted keys sort
+// in the same order as the keys they encrypt.
+// The largest possible f(b) is 255 + 256*254 = 0xfeff,
+// so prefix+id+"\xff\xff" is greater than all keys
+// with that prefix encrypted with that key.
+
+// An orderState is the state of the order-preserving encryption
+// after the bytes encrypted so far.
+type orderState [aes.BlockSize]byte
+
+// gaps returns the gaps for the next byte.
+func (k *cryptKey) gaps(s *orderState) *[256]byte {
+	g := new([256]byte)
+	cipher.NewCTR(k.order, s[:]).XORKeyStream(g[:], g[:])
+	for j := range g {
+		g[j] %= 255
+	}
+	return g
+}
+
+// next advances the state past the byte b.
+func (k *cryptKey) next(s *orderState, b byte) {
+	s[0] ^= b
+	k.order.Encrypt(s[:], s[:])
+}
+
+// appendOrder appends the order-preserving encryption of plain to out.
+func (k *cryptKey) appendOrder(out, plain []byte) []byte {
+	var s orderState
+	for _, b := range plain {
+		v := int(b)
+		for _, x := range k.gaps(&s)[:int(b)+1] {
+			v += int(x)
+		}
+		out = append(out, byte(v>>8), byte(v))
+		k.next(&s, b)
+	}
+	return out
+}
+
+// openOrder returns the bytes whose order-preserving encryption is enc,
+// reporting whether enc is a valid encryption.
+func (k *cryptKey) openOrder(enc []byte) ([]byte, bool) {
+	if len(enc)%2 != 0 {
+		return nil, false
+	}
+	plain := make([]byte, 0, len(enc)/2)
+	var s orderState
+	for i := 0; i < len(enc); i += 2 {
+		want := int(enc[i])<<8 | int(enc[i+1])
+		g := k.gaps(&s)
+		v, b := -1, 0
+		for ; b < len(g); b++ {
+			v += 1 + int(g[b])
+			if v >= want {
+				break
+			}
+		}
+		if v != want {
+			return nil, false
+		}
+		plain = append(plain, byte(b))
+		k.next(&s, byte(b))
+	}
+	return plain, true
+}
+
+// sealKey returns the encrypted form of key, which begins with prefix.
+func (k *cryptKey) sealKey(prefix, key []byte) []byte {
+	return k.appendOrder(slices.Concat(prefix, k.id[:]), key[len(prefix):])
+}
+
+// sealRange returns the range lo ≤ skey ≤ hi of encrypted keys
+// that hold the keys in the range start ≤ key ≤ end
+// beginning with prefix and encrypted with k.
+// The ranges must overlap.
+func (k *cryptKey) sealRange(prefix, start, end []byte) (lo, hi []byte) {
+	lo = slices.Concat(prefix, k.id[:])
+	if bytes.HasPrefix(start, prefix) {
+		lo = k.sealKey(prefix, start)
+	}
+	hi = slices.Concat(prefix, k.id[:], []byte{0xff, 0xff})
+	if bytes.HasPrefix(end, prefix) {
+		hi = k.sealKey(prefix, end)
+	}
+	return lo, hi
+}
+
+// openKey returns the decrypted form of the encrypted key skey,
+// which begins with prefix.
+func (db *encryptedDB) openKey(keys []*cryptKey, prefix, skey []byte) []byte {
+	enc := skey[len(prefix):]
+	if len(enc) < keyIDLen {
+		db.Panic("encrypted db: short key", "key", Fmt(skey))
+	}
+	k := db.lookup(keys, enc[:keyIDLen], skey)
+	rest, ok := k.openOrder(enc[keyIDLen:])
+	if !ok {
+		db.Panic("encrypted db: corrupt key", "key", Fmt(skey))
+	}
+	return slices.Concat(prefix, rest)
+}
+
+// sealVal returns the encrypted form of the value val of key.
+func (k *cryptKey) sealVal(key, val []byte) []byte {
+	out := make([]byte, keyIDLen+k.aead.NonceSize(), keyIDLen+k.aead.NonceSize()+len(val)+k.aead.Overhead())
+	copy(out, k.id[:])
+	rand.Read(out[keyIDLen:])
+	return k.aead.Seal(out, out[keyIDLen:], val, key)
+}
+
+// openVal returns the decrypted form of the encrypted value sval of key.
+func (db *encryptedDB) openVal(keys []*cryptKey, key, sval []byte) []byte {
+	if len(sval) < keyIDLen {
+		db.Panic("encrypted db: short value", "key", Fmt(key))
+	}
+	k := db.lookup(keys, sval[:keyIDLen], key)
+	n := keyIDLen + k.aead.NonceSize()
+	if len(sval) < n {
+		db.Panic("encrypted db: short value", "key", Fmt(key))
+	}
+	val, err := k.aead.Open(nil, sval[keyIDLen:n], sval[n:], key)
+	if err != nil {
+		db.Panic("encrypted db: corrupt value", "key", Fmt(key), "err", err)
+	}
+	if val == nil {
+		val = []byte{}
+	}
+	return val
+}
+
+// lookup returns the key in keys with the given ID,
+// calling db.Panic if there is none.
+// The key argument is the database key being decrypted, for the panic message.
+func (db *encryptedDB) lookup(keys []*cryptKey, id, key []byte) *cryptKey {
+	for _, k := range keys {
+		if bytes.Equal(k.id[:], id) {
+			return k
+		}
+	}
+	db.Panic("encrypted db: unknown encryption key", "key", Fmt(key), "id", fmt.Sprintf("%x", id))
+	panic("unreachable")
+}
+
+// prefix returns the encrypted prefix that key begins with, or nil if none.
+func (db *encryptedDB) prefix(key []byte) []byte {
+	for _, p := range db.prefixes {
+		if bytes.HasPrefix(key, p) {
+			return p
+		}
+	}
+	return nil
+}
+
+// prefixEnd returns a key greater than all keys beginning with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return ordered.Encode(ordered.Inf)
+}
+
+// A segment is a part of a key range whose keys are either
+// all unencrypted or all encrypted with the same prefix.
+type segment struct {
+	start, end []byte
+	prefix     []byte // encrypted prefix, or nil for unencrypted keys
+}
+
+// segments splits the range start ≤ key ≤ end into segments,
+// in increasing order.
+// An unencrypted segment may end at an encrypted prefix p,
+// since the key p itself is stored encrypted, as p+id.
+func (db *encryptedDB) segments(start, end []byte) []segment {
+	var segs []segment
+	for _, p := range db.prefixes {
+		if !overlaps(p, start, end) {
+			continue
+		}
+		if bytes.Compare(start, p) < 0 {
+			segs = append(segs, segment{start: start, end: p})
+		}
+		segs = append(segs, segment{start: start, end: end, prefix: p})
+		start = prefixEnd(p)
+	}
+	if bytes.Compare(start, end) <= 0 {
+		segs = append(segs, segment{start: start, end: end})
+	}
+	return segs
+}
+
+// Get returns the value associated with the key.
+func (db *encryptedDB) Get(key []byte) (val []byte, ok bool) {
+	return db.get(db.base.Get, db.keyring(), key)
+}
+
+// get returns the value associated with the key,
+// reading the encrypted entries using get.
+func (db *encryptedDB) get(get func([]byte) ([]byte, bool), keys []*cryptKey, key []byte) (val []byte, ok bool) {
+	if p := db.prefix(key); p != nil {
+		for _, k := range keys {
+			if sval, ok := get(k.sealKey(p, key)); ok {
+				return db.openVal(keys, key, sval), true
+			}
+		}
+		return nil, false
+	}
+	sval, ok := get(key)
+	if !ok {
+		return nil, false
+	}
+	return db.openVal(keys, key, sval), true
+}
+
+// Scan returns an iterator over all key-value pairs
+// in the range start ≤ key ≤ end.
+func (db *encryptedDB) Scan(start, end []byte) iter.Seq2[[]byte, func() []byte] {
+	return func(yield func([]byte, func() []byte) bool) {
+		keys := db.keyring()
+		for _, seg := range db.segments(start, end) {
+			seq := db.scanPlain(keys, seg.start, seg.end)
+			if seg.prefix != nil {
+				seq = db.scanPrefix(keys, seg.prefix, seg.start, seg.end)
+			}
+			for key, valf := range seq {
+				if !yield(key, valf) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// scanPlain returns an iterator over the key-value pairs
+// with unencrypted keys in the range start ≤ key ≤ end.
+func (db *encryptedDB) scanPlain(keys []*cryptKey, start, end []byte) iter.Seq2[[]byte, func() []byte] {
+	return func(yield func([]byte, func() []byte) bool) {
+		for key, svalf := range db.base.Scan(start, end) {
+			if !yield(key, func() []byte { return db.openVal(keys, key, svalf()) }) {
+				return
+			}
+		}
+	}
+}
+
+// scanPrefix returns an iterator over the key-value pairs
+// with keys in the range start ≤ key ≤ end that begin with
+// the encrypted prefix p, merging the entries encrypted with
+// each of the keys.
+func (db *encryptedDB) scanPrefix(keys []*cryptKey, p, start, end []byte) iter.Seq2[[]byte, func() []byte] {
+	var seq iter.Seq2[[]byte, func() []byte]
+	for _, k := range keys {
+		s := db.scanKey(keys, k, p, start, end)
+		if seq == nil {
+			seq = s
+		} else {
+			seq = unionFunc2(seq, s, bytes.Compare)
+		}
+	}
+	return seq
+}
+
+// scanKey returns an iterator over the key-value pairs
+// with keys in the range start ≤ key ≤ end that begin with
+// the encrypted prefix p and are encrypted with k.
+func (db *encryptedDB) scanKey(keys []*cryptKey, k *cryptKey, p, start, end []byte) iter.Seq2[[]byte, func() []byte] {
+	return func(yield func([]byte, func() []byte) bool) {
+		lo, hi := k.sealRange(p, start, end)
+		for skey, svalf := range db.base.Scan(lo, hi) {
+			key := db.openKey(keys, p, skey)
+			if !yield(key, func() []byte { return db.openVal(keys, key, svalf()) }) {
+				return
+			}
+		}
+	}
+}
+
+// Set sets the value associated with key to val.
+func (db *encryptedDB) Set(key, val []byte) {
+	b := db.Batch()
+	b.Set(key, val)
+	b.Apply()
+}
+
+// Delete deletes any entry with the given key.
+func (db *encryptedDB) Delete(key []byte) {
+	b := db.Batch()
+	b.Delete(key)
+	b.Apply()
+}
+
+// DeleteRange deletes all entries with start ≤ key ≤ end.
+func (db *encryptedDB) DeleteRange(start, end []byte) {
+	b := db.Batch()
+	b.DeleteRange(start, end)
+	b.Apply()
+}
+
+// A writer is the write half of a [Batch] or a [Tx].
+type writer interface {
+	Set(key, val []byte)
+	Delete(key []byte)
+}
+
+// set writes to w the encrypted entry setting key to val.
+func (db *encryptedDB) set(w writer, keys []*cryptKey, key, val []byte) {
+	skey := key
+	if p := db.prefix(key); p != nil {
+		// Delete any entry for key encrypted with an older key.
+		for _, k := range keys[1:] {
+			w.Delete(k.sealKey(p, key))
+		}
+		skey = keys[0].sealKey(p, key)
+	}
+	w.Set(skey, keys[0].sealVal(key, val))
+}
+
+// delete writes to w the deletion of any entry with the given key.
+func (db *encryptedDB) delete(w writer, keys []*cryptKey, key []byte) {
+	p := db.prefix(key)
+	if p == nil {
+		w.Delete(key)
+		return
+	}
+	for _, k := range keys {
+		w.Delete(k.sealKey(p, key))
+	}
+}
+
+// Batch returns a new batch.
+func (db *encryptedDB) Batch() Batch {
+	return &encryptedBatch{db: db, b: db.base.Batch()}
+}
+
+// Transaction implements [TxDB.Transaction] by calling [Transaction]
+// on the base DB, encrypting and decrypting the transaction's
+// keys and values.
+func (db *encryptedDB) Transaction(f func(tx Tx) error) error {
+	return Transaction(db.base, func(tx Tx) error {
+		return f(&encryptedTx{db: db, keys: db.keyring(), tx: tx})
+	})
+}
+
+// Subscribe implements [Notifier.Subscribe] by calling [Subscribe]
+// on the base DB.
+// A prefix that begins with an encrypted prefix is encrypted with
+// the newest key, which is the one all writes use, so a subscription
+// made before [KeyRotator.RotateKeys] loads a new key misses the
+// changes made after it.
+func (db *encryptedDB) Subscribe(prefix []byte) *Subscription {
+	if p := db.prefix(prefix); p != nil {
+		prefix = db.keyring()[0].sealKey(p, prefix)
+	}
+	return Subscribe(db.base, prefix)
+}
+
+// Lock locks name in the base DB.
+func (db *encryptedDB) Lock(name string) { db.base.Lock(name) }
+
+// Unlock unlocks name in the base DB.
+func (db *encryptedDB) Unlock(name string) { db.base.Unlock(name) }
+
+// LockContext implements [ContextLocker.LockContext] by calling [LockContext].
+func (db *encryptedDB) LockContext(ctx context.Context, name string) error {
+	return LockContext(ctx, db.base, name)
+}
+
+// TryLock implements [ContextLocker.TryLock] by calling [TryLock].
+func (db *encryptedDB) TryLock(name string) bool {
+	return TryLock(db.base, name)
+}
+
+// Locks implements [ContextLocker.Locks].
+// It returns nil if the base DB is not a [ContextLocker].
+func (db *encryptedDB) Locks() []LockInfo {
+	if cl, ok := db.base.(ContextLocker); ok {
+		return cl.Locks()
+	}
+	return nil
+}
+
+// Flush flushes the base DB.
+func (db *encryptedDB) Flush() { db.base.Flush() }
+
+// Close closes the base DB.
+func (db *encryptedDB) Close() { db.base.Close() }
+
+// Panic panics using the base DB.
+func (db *encryptedDB) Panic(msg string, args ...any) { db.base.Panic(msg, args...) }
+
+// RotateKeys implements [KeyRotator.RotateKeys].
+func (db *encryptedDB) RotateKeys() (int64, error) {
+	if err := db.load(); err != nil {
+		return 0, err
+	}
+	keys := db.keyring()
+	cur := keys[0]
+	n := int64(0)
+	b := db.base.Batch()
+	for skey, svalf := range db.base.Scan(nil, ordered.Encode(ordered.Inf)) {
+		sval := svalf()
+		key, p := skey, db.prefix(skey)
+		oldKey := false
+		if p != nil {
+			key = db.openKey(keys, p, skey)
+			oldKey = !bytes.Equal(skey[len(p):len(p)+keyIDLen], cur.id[:])
+		}
+		if !oldKey && bytes.HasPrefix(sval, cur.id[:]) {
+			continue
+		}
+		val := db.openVal(keys, key, sval)
+		if oldKey {
+			b.Delete(skey)
+			skey = cur.sealKey(p, key)
+		}
+		b.Set(skey, cur.sealVal(key, val))
+		n++
+		b.MaybeApply()
+	}
+	b.Apply()
+	return n, nil
+}
+
+// An encryptedBatch is a Batch for an encryptedDB.
+type encryptedBatch struct {
+	db *encryptedDB
+	b  Batch
+}
+
+// Set sets the value associated with key to val.
+func (b *encryptedBatch) Set(key, val []byte) {
+	b.db.set(b.b, b.db.keyring(), key, val)
+}
+
+// Delete deletes any entry with the given key.
+func (b *encryptedBatch) Delete(key []byte) {
+	b.db.delete(b.b, b.db.keyring(), key)
+}
+
+// DeleteRange deletes all entries with start ≤ key ≤ end.
+func (b *encryptedBatch) DeleteRange(start, end []byte) {
+	for _, seg := range b.db.segments(start, end) {
+		if seg.prefix == nil {
+			b.b.DeleteRange(seg.start, seg.end)
+			continue
+		}
+		for _, k := range b.db.keyring() {
+			b.b.DeleteRange(k.sealRange(seg.prefix, seg.start, seg.end))
+		}
+	}
+}
+
+// MaybeApply calls Apply if the batch is getting close to full.
+func (b *encryptedBatch) MaybeApply() bool { return b.b.MaybeApply() }
+
+// Apply applies the batch.
+func (b *encryptedBatch) Apply() { b.b.Apply() }
+
+// An encryptedTx is a Tx for an encryptedDB.
+type encryptedTx struct {
+	db   *encryptedDB
+	keys []*cryptKey
+	tx   Tx
+}
+
+// Get looks up the value associated with key.
+func (t *encryptedTx) Get(key []byte) (val []byte, ok bool) {
+	return t.db.get(t.tx.Get, t.keys, key)
+}
+
+// Set sets the value associated with key to val.
+func (t *encryptedTx) Set(key, val []byte) {
+	t.db.set(t.tx, t.keys, key, val)
+}
+
+// Delete deletes any value associated with key.
+func (t *encryptedTx) Delete(key []byte) {
+	t.db.delete(t.tx, t.keys, key)
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/oscar/internal/secret"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+// testKey returns a base64-encoded test encryption key.
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestEncryptedDB(t *testing.T) {
+	keys := secret.Map{"dbkey": testKey(1)}
+
+	// Encrypt the ordered encodings of non-negative integers,
+	// which TestDB uses for its scans.
+	db, err := NewEncryptedDB(MemDB(), keys, "dbkey", ordered.Encode(0)[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	TestDB(t, db)
+
+	db, err = NewEncryptedDB(MemDB(), keys, "dbkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	TestDB(t, db)
+}
+
+func TestEncryptedDBPrefix(t *testing.T) {
+	base := MemDB()
+	keys := secret.Map{"dbkey": testKey(1)}
+	db, err := NewEncryptedDB(base, keys, "dbkey", ordered.Encode("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 20 {
+		db.Set(ordered.Encode("secret", "issue", i), fmt.Appendf(nil, "private body %d", i))
+	}
+	db.Set(ordered.Encode("public", 1), []byte("public body"))
+	db.Set(ordered.Encode("secret"), []byte("prefix only"))
+
+	// Nothing is stored in the clear, and only the prefix is visible.
+	for key, val := range base.Scan(nil, ordered.Encode(ordered.Inf)) {
+		if bytes.Contains(key, []byte("issue")) || bytes.Contains(val(), []byte("body")) {
+			t.Errorf("base has plaintext entry %s: %s", Fmt(key), Fmt(val()))
+		}
+	}
+
+	if val, ok := db.Get(ordered.Encode("secret", "issue", 3)); !ok || string(val) != "private body 3" {
+		t.Errorf("Get = %q, %v, want %q, true", val, ok, "private body 3")
+	}
+
+	scan := func(start, end []byte) []string {
+		var list []string
+		for key, val := range db.Scan(start, end) {
+			list = append(list, Fmt(key)+"="+string(val()))
+		}
+		return list
+	}
+
+	have := scan(ordered.Encode("secret", "issue", 8), ordered.Encode("secret", "issue", 11))
+	want := []string{
+		`("secret", "issue", 8)=private body 8`,
+		`("secret", "issue", 9)=private body 9`,
+		`("secret", "issue", 10)=private body 10`,
+		`("secret", "issue", 11)=private body 11`,
+	}
+	if !slices.Equal(have, want) {
+		t.Errorf("Scan:\nhave %q\nwant %q", have, want)
+	}
+
+	// A scan across both plain and encrypted keys merges them in order.
+	have = scan(ordered.Encode("public"), ordered.Encode("secret", "issue", 1))
+	want = []string{
+		`("public", 1)=public body`,
+		`("secret")=prefix only`,
+		`("secret", "issue", 0)=private body 0`,
+		`("secret", "issue", 1)=private body 1`,
+	}
+	if !slices.Equal(have, want) {
+		t.Errorf("Scan:\nhave %q\nwant %q", have, want)
+	}
+
+	db.DeleteRange(ordered.Encode("secret", "issue", 2), ordered.Encode("secret", "issue", 17))
+	have = scan(ordered.Encode("secret", "issue"), ordered.Encode("secret", "issue", ordered.Inf))
+	want = []string{
+		`("secret", "issue", 0)=private body 0`,
+		`("secret", "issue", 1)=private body 1`,
+		`("secret", "issue", 18)=private body 18`,
+		`("secret", "issue", 19)=private body 19`,
+	}
+	if !slices.Equal(have, want) {
+		t.Errorf("Scan after DeleteRange:\nhave %q\nwant %q", have, want)
+	}
+
+	// A value moved to another key does not decrypt.
+	var k1, k2 []byte
+	for key := range base.Scan(ordered.Encode("public"), ordered.Encode("public", ordered.Inf)) {
+		k1 = bytes.Clone(key)
+	}
+	k2 = ordered.Encode("public", 2)
+	v, _ := base.Get(k1)
+	base.Set(k2, v)
+	testutil.StopPanic(func() {
+		db.Get(k2)
+		t.Errorf("Get of moved value did not panic")
+	})
+}
+
+func TestEncryptedDBOrder(t *testing.T) {
+	base := MemDB()
+	keys := secret.Map{"dbkey": testKey(1)}
+	db, err := NewEncryptedDB(base, keys, "dbkey", ordered.Encode("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The encrypted keys sort in the same order as the keys.
+	words := []string{"", "a", "ab", "abc", "b", "ba", "\x00", "\xff", "\xff\xff", "z"}
+	for _, w := range words {
+		db.Set(ordered.Encode("secret", w), []byte(w))
+	}
+	slices.Sort(words)
+	var have []string
+	for key := range base.Scan(ordered.Encode("secret"), ordered.Encode("secret", ordered.Inf)) {
+		var w string
+		if err := ordered.Decode(db.(*encryptedDB).openKey(db.(*encryptedDB).keyring(), ordered.Encode("secret"), key), nil, &w); err != nil {
+			t.Fatal(err)
+		}
+		have = append(have, w)
+	}
+	if !slices.Equal(have, words) {
+		t.Errorf("base order:\nhave %q\nwant %q", have, words)
+	}
+
+	// Before RotateKeys, entries written with a new key
+	// are merged with the older ones.
+	keys["dbkey"] = testKey(2) + " " + testKey(1)
+	db, err = NewEncryptedDB(base, keys, "dbkey", ordered.Encode("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set(ordered.Encode("secret", "aa"), []byte("aa"))
+	db.Set(ordered.Encode("secret", "b"), []byte("new b"))
+	scan := func(start, end []byte) []string {
+		var list []string
+		for key, val := range db.Scan(start, end) {
+			var w string
+			if err := ordered.Decode(key, nil, &w); err != nil {
+				t.Fatal(err)
+			}
+			list = append(list, w+"="+string(val()))
+		}
+		return list
+	}
+	have = scan(ordered.Encode("secret", "a"), ordered.Encode("secret", "ba"))
+	want := []string{"a=a", "aa=aa", "ab=ab", "abc=abc", "b=new b", "ba=ba"}
+	if !slices.Equal(have, want) {
+		t.Errorf("Scan:\nhave %q\nwant %q", have, want)
+	}
+
+	// DeleteRange deletes the entries written with both keys.
+	db.DeleteRange(ordered.Encode("secret", "aa"), ordered.Encode("secret", "b"))
+	have = scan(ordered.Encode("secret", "a"), ordered.Encode("secret", "ba"))
+	want = []string{"a=a", "ba=ba"}
+	if !slices.Equal(have, want) {
+		t.Errorf("Scan after DeleteRange:\nhave %q\nwant %q", have, want)
+	}
+}
+
+func TestEncryptedDBInterfaces(t *testing.T) {
+	keys := secret.Map{"dbkey": testKey(1)}
+	newDB := func(prefixes ...[]byte) *encryptedDB {
+		db, err := NewEncryptedDB(MemDB(), keys, "dbkey", prefixes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db.(*encryptedDB)
+	}
+	for _, ps := range [][][]byte{nil, {ordered.Encode("feed")}} {
+		TestNotifier(t, newDB(ps...))
+		TestDBContextLock(t, newDB(ps...))
+	}
+	TestTxDB(t, newDB())
+	TestTxDB(t, newDB(ordered.Encode("tx")))
+}
+
+func TestEncryptedDBRotate(t *testing.T) {
+	base := MemDB()
+	keys := secret.Map{"dbkey": testKey(1)}
+	db, err := NewEncryptedDB(base, keys, "dbkey", ordered.Encode("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set(ordered.Encode("secret", 1), []byte("s1"))
+	db.Set(ordered.Encode("plain", 1), []byte("p1"))
+
+	// Add a new key; entries are still readable,
+	// and new entries use the new key.
+	keys["dbkey"] = testKey(2) + " " + testKey(1)
+	n, err := db.(KeyRotator).RotateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("RotateKeys = %d, want 2", n)
+	}
+	if n, _ := db.(KeyRotator).RotateKeys(); n != 0 {
+		t.Errorf("second RotateKeys = %d, want 0", n)
+	}
+
+	// Without the old key, everything is still readable.
+	keys["dbkey"] = testKey(2)
+	db, err = NewEncryptedDB(base, keys, "dbkey", ordered.Encode("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []string
+	for key, val := range db.Scan(nil, ordered.Encode(ordered.Inf)) {
+		list = append(list, Fmt(key)+"="+string(val()))
+	}
+	want := []string{`("plain", 1)=p1`, `("secret", 1)=s1`}
+	if !slices.Equal(list, want) {
+		t.Errorf("after rotation:\nhave %q\nwant %q", list, want)
+	}
+
+	// With only an unrelated key, nothing is.
+	keys["dbkey"] = testKey(3)
+	db, err = NewEncryptedDB(base, keys, "dbkey", ordered.Encode("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.StopPanic(func() {
+		db.Get(ordered.Encode("plain", 1))
+		t.Errorf("Get with wrong key did not panic")
+	})
+}
+
+func TestEncryptedDBErrors(t *testing.T) {
+	for _, tc := range []struct {
+		secret   string
+		prefixes [][]byte
+		err      string
+	}{
+		{"", nil, "has no keys"},
+		{"!!!", nil, "illegal base64"},
+		{base64.StdEncoding.EncodeToString([]byte("short")), nil, "5 bytes"},
+		{testKey(1), [][]byte{nil}, "empty prefix"},
+		{testKey(1), [][]byte{[]byte("ab"), []byte("abc")}, "is a prefix of"},
+	} {
+		_, err := NewEncryptedDB(MemDB(), secret.Map{"k": tc.secret}, "k", tc.prefixes...)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("NewEncryptedDB(%q, %q) = %v, want error containing %q", tc.secret, tc.prefixes, err, tc.err)
+		}
+	}
+	if _, err := NewEncryptedDB(MemDB(), secret.Map{}, "k"); err == nil {
+		t.Errorf("NewEncryptedDB with missing secret succeeded")
+	}
+}
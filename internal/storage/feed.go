@@ -0,0 +1,151 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"sync"
+)
+
+// A Notifier is a [DB] that can notify subscribers
+// when keys in the database change.
+type Notifier interface {
+	// Subscribe returns a new subscription to changes
+	// to keys beginning with prefix.
+	// The caller must call Close on the subscription
+	// when it is no longer needed.
+	Subscribe(prefix []byte) *Subscription
+}
+
+// A Subscription delivers notifications of changes to keys with a given prefix.
+//
+// Notifications carry no data and are coalesced:
+// after one or more changes to keys with the prefix,
+// a single value is sent on C, which has a buffer of one.
+// Subscribers are expected to react to a notification by
+// rescanning for new data, typically using timed.ScanAfter
+// or a timed.Watcher, so that coalescing loses nothing.
+// Notifications may also be spurious, with no matching key having changed.
+//
+// A notification is sent after the change is visible to readers
+// of the database, but only for changes made through the same
+// [Notifier] in the same process: a Subscription does not observe
+// changes made by other processes.
+type Subscription struct {
+	C <-chan struct{} // receives a value after changes
+
+	c      chan struct{}
+	prefix []byte
+	feed   *Feed // nil for a subscription that never fires
+}
+
+// Close ends the subscription.
+// After Close returns, no more values are sent on s.C.
+func (s *Subscription) Close() {
+	if s.feed == nil {
+		return
+	}
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	delete(s.feed.subs, s)
+}
+
+// Subscribe returns a subscription to changes to keys in db
+// beginning with prefix.
+// If db does not implement [Notifier], Subscribe returns
+// a subscription that never receives notifications,
+// so that callers can still rely on their periodic polling.
+func Subscribe(db DB, prefix []byte) *Subscription {
+	if n, ok := db.(Notifier); ok {
+		return n.Subscribe(prefix)
+	}
+	c := make(chan struct{})
+	return &Subscription{C: c, c: c}
+}
+
+// A Feed is an implementation of [Notifier] for use by [DB] implementations,
+// which must call [Feed.Notify] after every change to the database.
+//
+// The zero value for a Feed is a valid Feed with no subscribers.
+// It must not be copied after first use.
+type Feed struct {
+	mu   sync.Mutex
+	subs map[*Subscription]bool
+}
+
+// Subscribe implements [Notifier.Subscribe].
+func (f *Feed) Subscribe(prefix []byte) *Subscription {
+	c := make(chan struct{}, 1)
+	s := &Subscription{C: c, c: c, prefix: bytes.Clone(prefix), feed: f}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[*Subscription]bool)
+	}
+	f.subs[s] = true
+	return s
+}
+
+// Notify notifies the subscribers to any keys k with start ≤ k ≤ end.
+// A single key k can be notified by using Notify(k, k).
+// Notify does not block.
+func (f *Feed) Notify(start, end []byte) {
+	f.notify([][2][]byte{{start, end}})
+}
+
+// notify notifies the subscribers to any keys in the given ranges.
+func (f *Feed) notify(ranges [][2][]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		for _, r := range ranges {
+			if overlaps(s.prefix, r[0], r[1]) {
+				select {
+				case s.c <- struct{}{}:
+				default:
+					// already notified
+				}
+				break
+			}
+		}
+	}
+}
+
+// overlaps reports whether some key k with start ≤ k ≤ end
+// begins with prefix.
+func overlaps(prefix, start, end []byte) bool {
+	if bytes.Compare(start, end) > 0 {
+		return false
+	}
+	return bytes.HasPrefix(start, prefix) || bytes.HasPrefix(end, prefix) ||
+		bytes.Compare(start, prefix) < 0 && bytes.Compare(prefix, end) < 0
+}
+
+// A Changes records the keys changed by a batch,
+// so that the batch can notify a [Feed] when it is applied.
+// The zero value is an empty Changes.
+type Changes struct {
+	ranges [][2][]byte
+}
+
+// Add records a change to key.
+func (c *Changes) Add(key []byte) {
+	c.AddRange(key, key)
+}
+
+// AddRange records a change to the keys from start to end (inclusive).
+func (c *Changes) AddRange(start, end []byte) {
+	c.ranges = append(c.ranges, [2][]byte{bytes.Clone(start), bytes.Clone(end)})
+}
+
+// Notify notifies f of the recorded changes, if any,
+// and then resets c to be empty.
+func (c *Changes) Notify(f *Feed) {
+	if len(c.ranges) == 0 {
+		return
+	}
+	f.notify(c.ranges)
+	c.ranges = nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import "testing"
+
+var overlapsTests = []struct {
+	prefix, start, end string
+	want               bool
+}{
+	{"b", "a", "c", true},
+	{"b", "b", "b", true},
+	{"b", "bz", "bz", true},
+	{"b", "a", "b", true},
+	{"b", "bb", "z", true},
+	{"b", "a", "az", false},
+	{"b", "c", "d", false},
+	{"b", "a", "ba", true},
+	{"", "x", "y", true},
+	{"b", "c", "a", false},
+}
+
+func TestOverlaps(t *testing.T) {
+	for _, tt := range overlapsTests {
+		if have := overlaps([]byte(tt.prefix), []byte(tt.start), []byte(tt.end)); have != tt.want {
+			t.Errorf("overlaps(%q, %q, %q) = %v, want %v", tt.prefix, tt.start, tt.end, have, tt.want)
+		}
+	}
+}
+
+func TestOverlayNotifier(t *testing.T) {
+	TestNotifier(t, NewOverlayDB(MemDB(), MemDB()).(*overlayDB))
+}
+
+func TestSubscribeFallback(t *testing.T) {
+	// maybeDB does not implement Notifier.
+	db := &maybeDB{DB: MemDB()}
+	sub := Subscribe(db, nil)
+	db.Set([]byte("a"), []byte("b"))
+	select {
+	case <-sub.C:
+		t.Fatal("notified without Notifier")
+	default:
+	}
+	sub.Close()
+}
@@ -0,0 +1,575 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/json"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+
+	"golang.org/x/oscar/internal/llm"
+	"rsc.io/ordered"
+	"rsc.io/top"
+)
+
+// HNSW parameters.
+// See Malkov and Yashunin, “Efficient and robust approximate nearest
+// neighbor search using Hierarchical Navigable Small World graphs”
+// (https://arxiv.org/abs/1603.09320) for their meaning.
+const (
+	hnswM              = 16  // max neighbors per node on layers above 0
+	hnswM0             = 32  // max neighbors per node on layer 0
+	hnswEFConstruction = 100 // candidate list size during insertion
+	hnswEFSearch       = 64  // minimum candidate list size during search
+)
+
+// An hnswVectorDB is a VectorDB that answers Search using
+// an approximate nearest-neighbor graph index.
+// The vectors themselves are managed by an underlying memVectorDB.
+//
+// Writes to the vector cache and the graph happen together
+// with imu held, so that the graph always holds the same
+// vectors as the cache.
+type hnswVectorDB struct {
+	*memVectorDB
+
+	imu    sync.RWMutex
+	graphs map[int]*hnswGraph // graphs indexed by vector length
+}
+
+// HNSWVectorDB returns a VectorDB that, like [MemVectorDB],
+// stores its vectors in db and keeps an in-memory copy,
+// but implements Search using a hierarchical navigable small world (HNSW)
+// graph index instead of a brute-force scan.
+// Search results are approximate: with high probability,
+// but not certainty, they are the same as an exact search.
+//
+// The graph is maintained incrementally by Set, Delete, and batch operations
+// and is persisted in db alongside the vectors, so that reopening the
+// vector database does not require rebuilding it.
+// When HNSWVectorDB is called, it reads the previously stored vectors and graph
+// from db, adding to the graph any vectors stored without a graph entry
+// (for example, by [MemVectorDB]) and removing graph entries for deleted vectors.
+//
+// In addition to the keys used by MemVectorDB,
+// the db keys used by an HNSWVectorDB have the form
+//
+//	ordered.Encode("llm.VectorGraph", namespace, id)
+//
+// where id is the document ID passed to Set.
+//
+// The returned VectorDB also implements [MetaVectorDB].
+// SearchFilter does not use the graph: like [MemVectorDB],
+// it scans the vectors with matching metadata, so that
+// the results are complete even for very selective filters.
+func HNSWVectorDB(db DB, lg *slog.Logger, namespace string) VectorDB {
+	vdb := &hnswVectorDB{
+		memVectorDB: MemVectorDB(db, lg, namespace).(*memVectorDB),
+		graphs:      make(map[int]*hnswGraph),
+	}
+	vdb.load()
+	return vdb
+}
+
+// graphKey returns the db key for the graph node with the given ID.
+func (db *hnswVectorDB) graphKey(id string) []byte {
+	return ordered.Encode("llm.VectorGraph", db.namespace, id)
+}
+
+// load loads the graph stored in the underlying storage,
+// repairing any differences from the set of stored vectors.
+func (db *hnswVectorDB) load() {
+	db.imu.Lock()
+	defer db.imu.Unlock()
+
+	type stored struct {
+		node  *hnswNode
+		links [][]string
+	}
+	var nodes []stored
+	byID := make(map[string]*hnswNode)
+	b := db.storage.Batch()
+	for key, getVal := range db.storage.Scan(
+		ordered.Encode("llm.VectorGraph", db.namespace),
+		ordered.Encode("llm.VectorGraph", db.namespace, ordered.Inf)) {
+
+		var id string
+		if err := ordered.Decode(key, nil, nil, &id); err != nil {
+			// unreachable except data corruption
+			db.storage.Panic("HNSWVectorDB decode", "key", Fmt(key), "err", err)
+		}
+		vec, ok := db.cache.Get(id)
+		if !ok {
+			// Vector deleted without updating the graph.
+			b.Delete(key)
+			b.MaybeApply()
+			continue
+		}
+		var e hnswEntry
+		if err := json.Unmarshal(getVal(), &e); err != nil {
+			// unreachable except data corruption
+			db.storage.Panic("HNSWVectorDB decode", "key", Fmt(key), "err", err)
+		}
+		n := newHNSWNode(id, vec, max(len(e.Links)-1, 0))
+		nodes = append(nodes, stored{n, e.Links})
+		byID[id] = n
+	}
+
+	// Resolve links and assign nodes to graphs.
+	changed := make(map[string]bool)
+	for _, s := range nodes {
+		n := s.node
+		for l, ids := range s.links {
+			var links []*hnswNode
+			for _, id := range ids {
+				if m := byID[id]; m != nil && len(m.vec) == len(n.vec) && l <= m.level() {
+					links = append(links, m)
+				} else {
+					changed[n.id] = true
+				}
+			}
+			n.setLinks(l, links)
+		}
+		g := db.graph(len(n.vec))
+		g.nodes[n.id] = n
+		if g.entry == nil || n.level() > g.entry.level() {
+			g.entry = n
+		}
+	}
+
+	// Insert any vectors missing from the graph.
+	added := 0
+	for id, vec := range db.cache.All() {
+		if byID[id] != nil {
+			continue
+		}
+		db.graph(len(vec)).insert(id, vec, changed)
+		added++
+	}
+	db.writeNodes(b, changed)
+	b.Apply()
+	db.slog.Info("loaded vectordb graph", "n", len(nodes), "added", added, "namespace", db.namespace)
+}
+
+// graph returns the graph for vectors of length n, creating it if necessary.
+// db.imu must be held.
+func (db *hnswVectorDB) graph(n int) *hnswGraph {
+	g := db.graphs[n]
+	if g == nil {
+		g = &hnswGraph{nodes: make(map[string]*hnswNode)}
+		db.graphs[n] = g
+	}
+	return g
+}
+
+// An hnswEntry is the stored form of an hnswNode.
+type hnswEntry struct {
+	Links [][]string // neighbor IDs, indexed by layer
+}
+
+// writeNodes adds to b the updates storing the current graph nodes
+// for the given IDs, or deleting the stored nodes for IDs no longer
+// in any graph.
+// db.imu must be held.
+func (db *hnswVectorDB) writeNodes(b Batch, ids map[string]bool) {
+	for _, id := range slices.Sorted(maps.Keys(ids)) {
+		var n *hnswNode
+		for _, g := range db.graphs {
+			if n = g.nodes[id]; n != nil {
+				break
+			}
+		}
+		if n == nil {
+			b.Delete(db.graphKey(id))
+			b.MaybeApply()
+			continue
+		}
+		e := hnswEntry{Links: make([][]string, len(n.links))}
+		for l, links := range n.links {
+			e.Links[l] = []string{}
+			for _, m := range links {
+				e.Links[l] = append(e.Links[l], m.id)
+			}
+		}
+		b.Set(db.graphKey(id), JSON(e))
+		b.MaybeApply()
+	}
+}
+
+// update applies the vector writes and deletes to the graph
+// and stores the changed graph nodes.
+// db.imu must be held.
+func (db *hnswVectorDB) update(w map[string]llm.Vector, d map[string]bool) {
+	changed := make(map[string]bool)
+	for id := range d {
+		for _, g := range db.graphs {
+			g.delete(id, changed)
+		}
+	}
+	for id, vec := range w {
+		for _, g := range db.graphs {
+			g.delete(id, changed)
+		}
+		db.graph(len(vec)).insert(id, vec, changed)
+	}
+
+	b := db.storage.Batch()
+	db.writeNodes(b, changed)
+	b.Apply()
+}
+
+func (db *hnswVectorDB) Set(id string, vec llm.Vector) {
+	if len(id) == 0 {
+		db.storage.Panic("hnswVectorDB set: empty ID")
+	}
+	vec = slices.Clone(vec)
+
+	db.imu.Lock()
+	defer db.imu.Unlock()
+
+	db.memVectorDB.set(id, vec)
+	db.update(map[string]llm.Vector{id: vec}, nil)
+}
+
+func (db *hnswVectorDB) Delete(id string) {
+	db.imu.Lock()
+	defer db.imu.Unlock()
+
+	db.memVectorDB.Delete(id)
+	db.update(nil, map[string]bool{id: true})
+}
+
+func (db *hnswVectorDB) Search(target llm.Vector, n int) []VectorResult {
+	db.imu.RLock()
+	defer db.imu.RUnlock()
+
+	g := db.graphs[len(target)]
+	if g == nil || n <= 0 {
+		return nil
+	}
+	best := top.New(n, VectorResult.cmp)
+	for _, c := range g.search(target, n) {
+		best.Add(VectorResult{c.node.id, c.score})
+	}
+	return best.Take()
+}
+
+// hnswVectorBatch implements VectorBatch for an hnswVectorDB.
+type hnswVectorBatch struct {
+	db *hnswVectorDB
+	mb *memVectorBatch
+}
+
+func (db *hnswVectorDB) Batch() VectorBatch {
+	return &hnswVectorBatch{db, db.memVectorDB.Batch().(*memVectorBatch)}
+}
+
+func (b *hnswVectorBatch) Set(id string, vec llm.Vector) {
+	b.mb.Set(id, vec)
+}
+
+func (b *hnswVectorBatch) Delete(id string) {
+	b.mb.Delete(id)
+}
+
+// SetMeta implements [MetaVectorBatch.SetMeta].
+func (b *hnswVectorBatch) SetMeta(id string, meta *VectorMeta) {
+	b.mb.SetMeta(id, meta)
+}
+
+func (b *hnswVectorBatch) MaybeApply() bool {
+	if !b.mb.sb.MaybeApply() {
+		return false
+	}
+	b.Apply()
+	return true
+}
+
+func (b *hnswVectorBatch) Apply() {
+	b.db.imu.Lock()
+	defer b.db.imu.Unlock()
+
+	w := maps.Clone(b.mb.w)
+	d := maps.Clone(b.mb.d)
+	b.mb.Apply()
+	b.db.update(w, d)
+}
+
+// An hnswGraph is an HNSW graph over vectors of a single length.
+type hnswGraph struct {
+	nodes map[string]*hnswNode
+	entry *hnswNode // entry point: a node with maximum level
+}
+
+// An hnswNode is a single node in an hnswGraph.
+// Links are directed, because pruning can drop the reverse
+// of an edge, so each node also records its incoming links,
+// allowing delete to repair every node that refers to a deleted node.
+type hnswNode struct {
+	id    string
+	vec   llm.Vector
+	links [][]*hnswNode        // outgoing links, indexed by layer
+	in    []map[*hnswNode]bool // incoming links, indexed by layer
+}
+
+// newHNSWNode returns a new node with no links on layers 0 through level.
+func newHNSWNode(id string, vec llm.Vector, level int) *hnswNode {
+	n := &hnswNode{
+		id:    id,
+		vec:   vec,
+		links: make([][]*hnswNode, level+1),
+		in:    make([]map[*hnswNode]bool, level+1),
+	}
+	for l := range n.in {
+		n.in[l] = make(map[*hnswNode]bool)
+	}
+	return n
+}
+
+// setLinks sets the outgoing links of n on layer l,
+// updating the incoming links of the old and new neighbors.
+func (n *hnswNode) setLinks(l int, links []*hnswNode) {
+	for _, m := range n.links[l] {
+		delete(m.in[l], n)
+	}
+	n.links[l] = links
+	for _, m := range links {
+		m.in[l][n] = true
+	}
+}
+
+// level returns the top layer that n appears in.
+func (n *hnswNode) level() int {
+	return len(n.links) - 1
+}
+
+// hnswLevel returns the top layer for the node with the given ID.
+// The level is chosen from an exponentially decaying distribution,
+// as in the HNSW paper, but is derived from a hash of the ID
+// rather than random, so that it is deterministic.
+func hnswLevel(id string) int {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53) // in (0, 1)
+	return int(-math.Log(u) / math.Log(hnswM))
+}
+
+// maxLinks returns the maximum number of neighbors on layer l.
+func maxLinks(l int) int {
+	if l == 0 {
+		return hnswM0
+	}
+	return hnswM
+}
+
+// An hnswCand is a candidate node and its similarity score to a query.
+type hnswCand struct {
+	node  *hnswNode
+	score float64
+}
+
+// insert inserts a node with the given ID and vector into g,
+// which must not already contain the ID.
+// It adds the IDs of nodes whose stored form has changed to changed.
+func (g *hnswGraph) insert(id string, vec llm.Vector, changed map[string]bool) {
+	n := newHNSWNode(id, vec, hnswLevel(id))
+	g.nodes[id] = n
+	changed[id] = true
+	if g.entry == nil {
+		g.entry = n
+		return
+	}
+
+	ep := []hnswCand{{g.entry, vec.Dot(g.entry.vec)}}
+	for l := g.entry.level(); l > n.level(); l-- {
+		ep = g.searchLayer(vec, ep, 1, l)
+	}
+	for l := min(n.level(), g.entry.level()); l >= 0; l-- {
+		ep = g.searchLayer(vec, ep, hnswEFConstruction, l)
+		n.setLinks(l, selectNeighbors(vec, ep, maxLinks(l)))
+		for _, m := range n.links[l] {
+			links := append(slices.Clip(m.links[l]), n)
+			if len(links) > maxLinks(l) {
+				links = selectNeighbors(m.vec, cands(m.vec, links), maxLinks(l))
+			}
+			m.setLinks(l, links)
+			changed[m.id] = true
+		}
+	}
+	if n.level() > g.entry.level() {
+		g.entry = n
+	}
+}
+
+// delete deletes the node with the given ID from g, if present,
+// reconnecting the nodes that linked to it.
+// It adds the IDs of nodes whose stored form has changed to changed.
+func (g *hnswGraph) delete(id string, changed map[string]bool) {
+	n := g.nodes[id]
+	if n == nil {
+		return
+	}
+	delete(g.nodes, id)
+	changed[id] = true
+
+	for l := range n.links {
+		out := n.links[l]
+		n.setLinks(l, nil)
+		for m := range n.in[l] {
+			// Replace m's link to n with the best of
+			// m's other links and n's links.
+			var c []*hnswNode
+			for _, x := range slices.Concat(m.links[l], out) {
+				if x != m && x != n && !slices.Contains(c, x) {
+					c = append(c, x)
+				}
+			}
+			m.setLinks(l, selectNeighbors(m.vec, cands(m.vec, c), maxLinks(l)))
+			changed[m.id] = true
+		}
+	}
+
+	if g.entry == n {
+		// Pick a new entry point with maximum level.
+		// This is a linear scan but only happens for
+		// one node in about hnswM^level deletions.
+		g.entry = nil
+		for _, m := range g.nodes {
+			if g.entry == nil || m.level() > g.entry.level() ||
+				m.level() == g.entry.level() && m.id < g.entry.id {
+				g.entry = m
+			}
+		}
+	}
+}
+
+// search returns approximately the n nodes in g most similar to vec,
+// along with others found along the way.
+func (g *hnswGraph) search(vec llm.Vector, n int) []hnswCand {
+	if g.entry == nil {
+		return nil
+	}
+	ep := []hnswCand{{g.entry, vec.Dot(g.entry.vec)}}
+	for l := g.entry.level(); l > 0; l-- {
+		ep = g.searchLayer(vec, ep, 1, l)
+	}
+	return g.searchLayer(vec, ep, max(n, hnswEFSearch), 0)
+}
+
+// searchLayer performs a greedy best-first search on layer l
+// starting at the entry points ep,
+// returning the ef nodes most similar to vec that it finds,
+// sorted by decreasing score.
+func (g *hnswGraph) searchLayer(vec llm.Vector, ep []hnswCand, ef, l int) []hnswCand {
+	visited := make(map[*hnswNode]bool)
+	// todo is a max-heap of candidates to explore.
+	// found is a min-heap of the best ef candidates found so far.
+	todo := &candHeap{less: func(x, y hnswCand) bool { return x.score > y.score }}
+	found := &candHeap{less: func(x, y hnswCand) bool { return x.score < y.score }}
+	for _, c := range ep {
+		if visited[c.node] {
+			continue
+		}
+		visited[c.node] = true
+		heap.Push(todo, c)
+		heap.Push(found, c)
+	}
+	for todo.Len() > 0 {
+		c := heap.Pop(todo).(hnswCand)
+		if found.Len() >= ef && c.score < found.c[0].score {
+			break
+		}
+		if l >= len(c.node.links) {
+			continue
+		}
+		for _, m := range c.node.links[l] {
+			if visited[m] {
+				continue
+			}
+			visited[m] = true
+			mc := hnswCand{m, vec.Dot(m.vec)}
+			if found.Len() < ef || mc.score > found.c[0].score {
+				heap.Push(todo, mc)
+				heap.Push(found, mc)
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+	slices.SortFunc(found.c, func(x, y hnswCand) int {
+		return cmp.Or(cmp.Compare(y.score, x.score), cmp.Compare(x.node.id, y.node.id))
+	})
+	return found.c
+}
+
+// cands returns the nodes as candidates scored against vec.
+func cands(vec llm.Vector, nodes []*hnswNode) []hnswCand {
+	var c []hnswCand
+	for _, n := range nodes {
+		c = append(c, hnswCand{n, vec.Dot(n.vec)})
+	}
+	return c
+}
+
+// selectNeighbors selects up to m neighbors for vec from the candidates c,
+// using the heuristic from the HNSW paper that prefers candidates
+// that are more similar to vec than to any already-selected neighbor.
+// This keeps the graph connected across clusters.
+// If the heuristic selects fewer than m neighbors,
+// selectNeighbors fills the remainder with the best rejected candidates.
+func selectNeighbors(vec llm.Vector, c []hnswCand, m int) []*hnswNode {
+	c = slices.Clone(c)
+	slices.SortFunc(c, func(x, y hnswCand) int {
+		return cmp.Or(cmp.Compare(y.score, x.score), cmp.Compare(x.node.id, y.node.id))
+	})
+	var sel, rejected []*hnswNode
+	for _, x := range c {
+		if len(sel) >= m {
+			break
+		}
+		ok := true
+		for _, s := range sel {
+			if x.node.vec.Dot(s.vec) > x.score {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			sel = append(sel, x.node)
+		} else {
+			rejected = append(rejected, x.node)
+		}
+	}
+	for _, x := range rejected {
+		if len(sel) >= m {
+			break
+		}
+		sel = append(sel, x)
+	}
+	return sel
+}
+
+// A candHeap is a heap of candidates, implementing [heap.Interface].
+type candHeap struct {
+	c    []hnswCand
+	less func(x, y hnswCand) bool
+}
+
+func (h *candHeap) Len() int           { return len(h.c) }
+func (h *candHeap) Less(i, j int) bool { return h.less(h.c[i], h.c[j]) }
+func (h *candHeap) Swap(i, j int)      { h.c[i], h.c[j] = h.c[j], h.c[i] }
+func (h *candHeap) Push(x any)         { h.c = append(h.c, x.(hnswCand)) }
+func (h *candHeap) Pop() any {
+	x := h.c[len(h.c)-1]
+	h.c = h.c[:len(h.c)-1]
+	return x
+}
@@ -0,0 +1,283 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+func TestHNSWVectorDB(t *testing.T) {
+	db := MemDB()
+	TestVectorDB(t, func() VectorDB { return HNSWVectorDB(db, testutil.Slogger(t), "") })
+
+	db = MemDB()
+	TestMetaVectorDB(t, func() MetaVectorDB { return HNSWVectorDB(db, testutil.Slogger(t), "").(MetaVectorDB) })
+}
+
+// randVector returns a random unit vector of length n.
+func randVector(r *rand.Rand, n int) llm.Vector {
+	v := make(llm.Vector, n)
+	for i := range v {
+		v[i] = float32(r.NormFloat64())
+	}
+	return v.Normal()
+}
+
+// recall returns the fraction of results in want that also appear in have.
+func recall(have, want []VectorResult) float64 {
+	ids := make(map[string]bool)
+	for _, r := range have {
+		ids[r.ID] = true
+	}
+	n := 0
+	for _, r := range want {
+		if ids[r.ID] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(want))
+}
+
+// hnswTest holds a brute-force MemVectorDB and an HNSWVectorDB
+// that are kept in sync, to check the HNSWVectorDB's search results.
+type hnswTest struct {
+	t      *testing.T
+	r      *rand.Rand
+	db     DB
+	exact  VectorDB
+	approx VectorDB
+}
+
+const (
+	hnswTestDim   = 32
+	hnswTestNVec  = 3000
+	hnswTestK     = 10
+	hnswMinRecall = 0.95
+)
+
+func newHNSWTest(t *testing.T, db DB) *hnswTest {
+	if testing.Short() {
+		t.Skip("skipping recall test in short mode")
+	}
+	lg := testutil.Slogger(t)
+	return &hnswTest{
+		t:      t,
+		r:      rand.New(rand.NewPCG(1, 2)),
+		db:     db,
+		exact:  MemVectorDB(MemDB(), lg, ""),
+		approx: HNSWVectorDB(db, lg, ""),
+	}
+}
+
+func (ht *hnswTest) set(id string) {
+	v := randVector(ht.r, hnswTestDim)
+	ht.exact.Set(id, v)
+	ht.approx.Set(id, v)
+}
+
+func (ht *hnswTest) delete(id string) {
+	ht.exact.Delete(id)
+	ht.approx.Delete(id)
+}
+
+// check checks ht.approx's graph and recall,
+// then reopens it and checks again.
+func (ht *hnswTest) check(name string) {
+	ht.t.Helper()
+	ht.checkDB(name, ht.approx)
+	ht.approx = HNSWVectorDB(ht.db, testutil.Slogger(ht.t), "")
+	ht.checkDB(name+" (reopened)", ht.approx)
+}
+
+func (ht *hnswTest) checkDB(name string, vdb VectorDB) {
+	t := ht.t
+	t.Helper()
+
+	// Every vector must have a stored graph entry, and vice versa.
+	var have, want []string
+	for id := range ht.exact.All() {
+		want = append(want, id)
+	}
+	prefix := ordered.Encode("llm.VectorGraph", "")
+	for key := range ht.db.Scan(prefix, ordered.Encode("llm.VectorGraph", "", ordered.Inf)) {
+		var id string
+		if err := ordered.Decode(key, nil, nil, &id); err != nil {
+			t.Fatal(err)
+		}
+		have = append(have, id)
+	}
+	if !slices.Equal(have, want) {
+		t.Errorf("%s: stored graph IDs differ from vector IDs:\nhave %d %v\nwant %d %v", name, len(have), have, len(want), want)
+	}
+	checkHNSWGraph(t, name, vdb.(*hnswVectorDB))
+
+	total := 0.0
+	const nquery = 100
+	for range nquery {
+		q := randVector(ht.r, hnswTestDim)
+		total += recall(vdb.Search(q, hnswTestK), ht.exact.Search(q, hnswTestK))
+	}
+	if avg := total / nquery; avg < hnswMinRecall {
+		t.Errorf("%s: recall = %.3f, want ≥ %.3f", name, avg, hnswMinRecall)
+	}
+}
+
+// checkHNSWGraph checks that every link in the in-memory graph
+// refers to a live node and is recorded in the target's incoming links,
+// and that the graph nodes hold the same vectors as the cache.
+func checkHNSWGraph(t *testing.T, name string, db *hnswVectorDB) {
+	t.Helper()
+	for _, g := range db.graphs {
+		for id, n := range g.nodes {
+			if vec, _ := db.memVectorDB.Get(id); !slices.Equal(vec, n.vec) {
+				t.Errorf("%s: graph node %s has stale vector", name, id)
+			}
+			for l, links := range n.links {
+				for _, m := range links {
+					if g.nodes[m.id] != m {
+						t.Errorf("%s: node %s links to deleted node %s on layer %d", name, id, m.id, l)
+					}
+					if !m.in[l][n] {
+						t.Errorf("%s: link %s → %s on layer %d missing incoming link", name, id, m.id, l)
+					}
+				}
+				for m := range n.in[l] {
+					if !slices.Contains(m.links[l], n) {
+						t.Errorf("%s: incoming link %s → %s on layer %d missing outgoing link", name, m.id, id, l)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	ht := newHNSWTest(t, MemDB())
+	b := ht.approx.Batch()
+	for i := range hnswTestNVec {
+		id := fmt.Sprint("doc", i)
+		v := randVector(ht.r, hnswTestDim)
+		ht.exact.Set(id, v)
+		b.Set(id, v)
+	}
+	b.Apply()
+	ht.check("batch")
+
+	// Delete some vectors to exercise graph repair.
+	for i := 0; i < hnswTestNVec; i += 10 {
+		ht.delete(fmt.Sprint("doc", i))
+	}
+	ht.check("delete")
+
+	// Overwrite existing vectors, as happens when documents are re-embedded.
+	for i := 1; i < hnswTestNVec; i += 3 {
+		ht.set(fmt.Sprint("doc", i))
+	}
+	ht.check("overwrite")
+}
+
+func TestHNSWBatch(t *testing.T) {
+	ht := newHNSWTest(t, MemDB())
+	for i := range hnswTestNVec {
+		ht.set(fmt.Sprint("doc", i))
+	}
+
+	// Mix Set and Delete of the same IDs in a single batch.
+	b := ht.approx.Batch()
+	for i := 0; i < hnswTestNVec; i += 4 {
+		id := fmt.Sprint("doc", i)
+		v := randVector(ht.r, hnswTestDim)
+		switch i % 3 {
+		case 0: // overwrite, then delete
+			b.Set(id, v)
+			b.Delete(id)
+			ht.exact.Delete(id)
+		case 1: // delete, then overwrite
+			b.Delete(id)
+			b.Set(id, v)
+			ht.exact.Set(id, v)
+		case 2: // overwrite twice
+			b.Set(id, randVector(ht.r, hnswTestDim))
+			b.Set(id, v)
+			ht.exact.Set(id, v)
+		}
+	}
+	b.Apply()
+	ht.check("mixed batch")
+}
+
+func TestHNSWMaybeApply(t *testing.T) {
+	db := &maybeDB{DB: MemDB()}
+	ht := newHNSWTest(t, db)
+
+	// Flush the batch partway through, and mix
+	// new vectors, overwrites, and deletes.
+	b := ht.approx.Batch()
+	for i := range hnswTestNVec {
+		id := fmt.Sprint("doc", i%(hnswTestNVec/2))
+		v := randVector(ht.r, hnswTestDim)
+		if i%7 == 0 {
+			b.Delete(id)
+			ht.exact.Delete(id)
+		} else {
+			b.Set(id, v)
+			ht.exact.Set(id, v)
+		}
+		db.maybe = i%500 == 0
+		b.MaybeApply()
+	}
+	db.maybe = false
+	b.Apply()
+	ht.check("MaybeApply")
+}
+
+func TestHNSWLoadMemVectorDB(t *testing.T) {
+	// Vectors written by MemVectorDB have no graph entries;
+	// HNSWVectorDB must add them when opened.
+	lg := testutil.Slogger(t)
+	db := MemDB()
+	mdb := MemVectorDB(db, lg, "ns")
+	for _, s := range []string{"apple3", "apple4", "orange1", "orange2"} {
+		mdb.Set(s, embed(s))
+	}
+	vdb := HNSWVectorDB(db, lg, "ns")
+	have := vdb.Search(embed("apple5"), 2)
+	if len(have) != 2 || have[0].ID != "apple4" || have[1].ID != "apple3" {
+		t.Errorf("Search(apple5, 2) = %v, want apple4, apple3", have)
+	}
+
+	// A vector deleted by MemVectorDB must disappear from the graph.
+	mdb.Delete("apple4")
+	vdb = HNSWVectorDB(db, lg, "ns")
+	have = vdb.Search(embed("apple5"), 1)
+	if len(have) != 1 || have[0].ID != "apple3" {
+		t.Errorf("Search(apple5, 1) after delete = %v, want apple3", have)
+	}
+}
+
+func TestHNSWConcurrentSet(t *testing.T) {
+	// Concurrent Sets of the same IDs must leave the graph
+	// holding the same vectors as the cache.
+	vdb := HNSWVectorDB(MemDB(), testutil.Slogger(t), "").(*hnswVectorDB)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			r := rand.New(rand.NewPCG(uint64(i), 0))
+			for j := range 200 {
+				vdb.Set(fmt.Sprint("doc", j%20), randVector(r, 8))
+			}
+		})
+	}
+	wg.Wait()
+	checkHNSWGraph(t, "concurrent", vdb)
+}
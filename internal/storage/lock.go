@@ -0,0 +1,97 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// A ContextLocker is a [DB] lock implementation that supports
+// cancelling a wait for a lock, trying a lock without waiting,
+// and listing the locks that are held.
+//
+// The locks are the same as the ones acquired by [DB.Lock]
+// and released by [DB.Unlock].
+type ContextLocker interface {
+	// LockContext is like Lock but stops waiting and
+	// returns ctx.Err() if ctx is done before the lock is acquired.
+	// It returns nil if the lock was acquired.
+	LockContext(ctx context.Context, name string) error
+
+	// TryLock tries to acquire the lock with the given name
+	// without waiting, reporting whether it succeeded.
+	TryLock(name string) bool
+
+	// Locks returns information about the locks currently held,
+	// sorted by name.
+	// For a shared database, Locks includes locks held by
+	// other clients, to the extent that the database records them.
+	Locks() []LockInfo
+}
+
+// A LockInfo describes a held lock.
+type LockInfo struct {
+	Name     string    // name passed to Lock
+	Holder   string    // identity of the holder; see [LockHolder]
+	Acquired time.Time // when the lock was acquired
+	Expires  time.Time // when the lock's lease expires unless renewed; zero if there is no lease
+}
+
+// LockHolder returns the holder identity recorded for locks
+// acquired by this process: the host name and process ID,
+// in the form "host:pid".
+func LockHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// LockContext acquires the lock with the given name in db,
+// as described in [ContextLocker.LockContext].
+// If db does not implement [ContextLocker], LockContext calls db.Lock
+// in a separate goroutine. In that case, if ctx is done first,
+// LockContext returns ctx.Err() and the goroutine releases the lock
+// as soon as it is acquired.
+func LockContext(ctx context.Context, db DB, name string) error {
+	if cl, ok := db.(ContextLocker); ok {
+		return cl.LockContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	locked := make(chan struct{})
+	abandon := make(chan struct{})
+	go func() {
+		db.Lock(name)
+		select {
+		case locked <- struct{}{}:
+		case <-abandon:
+			db.Unlock(name)
+		}
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		close(abandon)
+		return ctx.Err()
+	}
+}
+
+// TryLock tries to acquire the lock with the given name in db,
+// as described in [ContextLocker.TryLock].
+// If db does not implement [ContextLocker], TryLock always returns false.
+func TryLock(db DB, name string) bool {
+	if cl, ok := db.(ContextLocker); ok {
+		return cl.TryLock(name)
+	}
+	return false
+}
@@ -6,11 +6,15 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"iter"
 	"log/slog"
+	"maps"
 	"slices"
 	"sync"
+	"time"
 
 	"golang.org/x/oscar/internal/llm"
 	"rsc.io/omap"
@@ -22,40 +26,94 @@ import (
 // of the database Lock and Unlock methods,
 // suitable if there is only one process accessing the
 // database at a time.
+// It also implements [ContextLocker]. Its locks have no lease:
+// they are held until unlocked or until the process exits.
 //
 // The zero value for a MemLocker
 // is a valid MemLocker with no locks held.
 // It must not be copied after first use.
 type MemLocker struct {
 	mu    sync.Mutex
-	locks map[string]*sync.Mutex
+	locks map[string]chan struct{} // holds a value while locked
+	info  map[string]LockInfo      // held locks
 }
 
-// Lock locks the mutex with the given name.
-func (l *MemLocker) Lock(name string) {
+// sem returns the semaphore for the lock with the given name.
+func (l *MemLocker) sem(name string) chan struct{} {
 	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.locks == nil {
-		l.locks = make(map[string]*sync.Mutex)
+		l.locks = make(map[string]chan struct{})
+		l.info = make(map[string]LockInfo)
 	}
-	mu := l.locks[name]
-	if mu == nil {
-		mu = new(sync.Mutex)
-		l.locks[name] = mu
+	c := l.locks[name]
+	if c == nil {
+		c = make(chan struct{}, 1)
+		l.locks[name] = c
 	}
-	l.mu.Unlock()
+	return c
+}
 
-	mu.Lock()
+// locked records that the lock with the given name has been acquired.
+func (l *MemLocker) locked(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.info[name] = LockInfo{Name: name, Holder: LockHolder(), Acquired: time.Now()}
+}
+
+// Lock locks the mutex with the given name.
+func (l *MemLocker) Lock(name string) {
+	l.sem(name) <- struct{}{}
+	l.locked(name)
+}
+
+// LockContext implements [ContextLocker.LockContext].
+func (l *MemLocker) LockContext(ctx context.Context, name string) error {
+	select {
+	case l.sem(name) <- struct{}{}:
+		l.locked(name)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryLock implements [ContextLocker.TryLock].
+func (l *MemLocker) TryLock(name string) bool {
+	select {
+	case l.sem(name) <- struct{}{}:
+		l.locked(name)
+		return true
+	default:
+		return false
+	}
+}
+
+// Locks implements [ContextLocker.Locks].
+func (l *MemLocker) Locks() []LockInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var list []LockInfo
+	for _, name := range slices.Sorted(maps.Keys(l.info)) {
+		list = append(list, l.info[name])
+	}
+	return list
 }
 
 // Unlock unlocks the mutex with the given name.
 func (l *MemLocker) Unlock(name string) {
 	l.mu.Lock()
-	mu := l.locks[name]
+	c := l.locks[name]
+	delete(l.info, name)
 	l.mu.Unlock()
-	if mu == nil {
+	if c == nil {
 		panic("Unlock of never locked key")
 	}
-	mu.Unlock()
+	select {
+	case <-c:
+	default:
+		panic("Unlock of unlocked key")
+	}
 }
 
 // MemDB returns an in-memory DB implementation.
@@ -66,6 +124,7 @@ func MemDB() DB {
 // A memDB is an in-memory DB implementation,.
 type memDB struct {
 	MemLocker
+	Feed
 	mu   sync.RWMutex
 	data omap.Map[string, []byte]
 }
@@ -116,6 +175,7 @@ func (db *memDB) Scan(start, end []byte) iter.Seq2[[]byte, func() []byte] {
 
 // Delete deletes any entry with the given key.
 func (db *memDB) Delete(key []byte) {
+	defer db.Notify(key, key)
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -124,6 +184,7 @@ func (db *memDB) Delete(key []byte) {
 
 // DeleteRange deletes all entries with start ≤ key ≤ end.
 func (db *memDB) DeleteRange(start, end []byte) {
+	defer db.Notify(start, end)
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -135,6 +196,7 @@ func (db *memDB) Set(key, val []byte) {
 	if len(key) == 0 {
 		db.Panic("memdb set: empty key")
 	}
+	defer db.Notify(key, key)
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -151,10 +213,35 @@ func (db *memDB) Batch() Batch {
 func (db *memDB) Flush() {
 }
 
+// Transaction implements [TxDB.Transaction].
+func (db *memDB) Transaction(f func(tx Tx) error) error {
+	return RunTx(db.Get, f, func(t *TxLog) bool {
+		var c Changes
+		defer c.Notify(&db.Feed)
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		get := func(key []byte) ([]byte, bool) { return db.data.Get(string(key)) }
+		if !t.Valid(get) {
+			return false
+		}
+		for key, val := range t.Writes() {
+			c.Add(key)
+			if val == nil {
+				db.data.Delete(string(key))
+			} else {
+				db.data.Set(string(key), val)
+			}
+		}
+		return true
+	})
+}
+
 // A memBatch is a Batch for a memDB.
 type memBatch struct {
 	db  *memDB   // underlying database
 	ops []func() // operations to apply
+	c   Changes  // keys changed by ops
 }
 
 func (b *memBatch) Set(key, val []byte) {
@@ -164,17 +251,20 @@ func (b *memBatch) Set(key, val []byte) {
 	k := string(key)
 	v := bytes.Clone(val)
 	b.ops = append(b.ops, func() { b.db.data.Set(k, v) })
+	b.c.Add(key)
 }
 
 func (b *memBatch) Delete(key []byte) {
 	k := string(key)
 	b.ops = append(b.ops, func() { b.db.data.Delete(k) })
+	b.c.Add(key)
 }
 
 func (b *memBatch) DeleteRange(start, end []byte) {
 	s := string(start)
 	e := string(end)
 	b.ops = append(b.ops, func() { b.db.data.DeleteRange(s, e) })
+	b.c.AddRange(start, end)
 }
 
 func (b *memBatch) MaybeApply() bool {
@@ -182,6 +272,7 @@ func (b *memBatch) MaybeApply() bool {
 }
 
 func (b *memBatch) Apply() {
+	defer b.c.Notify(&b.db.Feed)
 	b.db.mu.Lock()
 	defer b.db.mu.Unlock()
 
@@ -200,6 +291,7 @@ type memVectorDB struct {
 
 	mu    sync.RWMutex
 	cache omap.Map[string, []float32] // in-memory cache of all vectors, indexed by id
+	meta  map[string]*VectorMeta      // in-memory cache of all metadata, indexed by id
 }
 
 // MemVectorDB returns a VectorDB that stores its vectors in db
@@ -220,8 +312,21 @@ type memVectorDB struct {
 //	ordered.Encode("llm.Vector", namespace, id)
 //
 // where id is the document ID passed to Set.
+// MemVectorDB writes vectors using [llm.Vector.Encode],
+// but it can read vectors written in either encoding
+// accepted by [DecodeVector].
+//
+// The returned VectorDB also implements [MetaVectorDB].
+// Metadata is stored in db as JSON using keys of the form
+//
+//	ordered.Encode("llm.VectorMeta", namespace, id)
+//
+// and SearchFilter is implemented by a brute-force scan
+// over the vectors with matching metadata.
 func MemVectorDB(db DB, lg *slog.Logger, namespace string) VectorDB {
 	// NOTE: We could cut the memory per stored vector in half by quantizing to int16.
+	// (QuantizedVectorDB cuts it further, using int8 or binary quantization,
+	// but it must rescore candidates with the full vectors to get exact scores.)
 	//
 	// The worst case score error in a dot product over 768 entries
 	// caused by quantization error of e is approximately 55.4 e:
@@ -251,6 +356,7 @@ func MemVectorDB(db DB, lg *slog.Logger, namespace string) VectorDB {
 		storage:   db,
 		slog:      lg,
 		namespace: namespace,
+		meta:      make(map[string]*VectorMeta),
 	}
 
 	// Load all the previously-stored vectors.
@@ -264,21 +370,42 @@ func MemVectorDB(db DB, lg *slog.Logger, namespace string) VectorDB {
 			// unreachable except data corruption
 			panic(fmt.Errorf("MemVectorDB decode key=%v: %v", Fmt(key), err))
 		}
-		val := getVal()
-		if len(val)%4 != 0 {
+		vec, err := DecodeVector(getVal())
+		if err != nil {
 			// unreachable except data corruption
-			panic(fmt.Errorf("MemVectorDB decode key=%v bad len(val)=%d", Fmt(key), len(val)))
+			panic(fmt.Errorf("MemVectorDB decode key=%v: %v", Fmt(key), err))
 		}
-		var vec llm.Vector
-		vec.Decode(val)
 		vdb.cache.Set(id, vec)
 		clen++
 	}
 
+	// Load all the previously-stored metadata.
+	for key, getVal := range vdb.storage.Scan(
+		ordered.Encode("llm.VectorMeta", namespace),
+		ordered.Encode("llm.VectorMeta", namespace, ordered.Inf)) {
+
+		var id string
+		if err := ordered.Decode(key, nil, nil, &id); err != nil {
+			// unreachable except data corruption
+			panic(fmt.Errorf("MemVectorDB decode key=%v: %v", Fmt(key), err))
+		}
+		meta := new(VectorMeta)
+		if err := json.Unmarshal(getVal(), meta); err != nil {
+			// unreachable except data corruption
+			panic(fmt.Errorf("MemVectorDB decode key=%v: %v", Fmt(key), err))
+		}
+		vdb.meta[id] = meta
+	}
+
 	vdb.slog.Info("loaded vectordb", "n", clen, "namespace", namespace)
 	return vdb
 }
 
+// metaKey returns the db key for the metadata of the vector with the given ID.
+func (db *memVectorDB) metaKey(id string) []byte {
+	return ordered.Encode("llm.VectorMeta", db.namespace, id)
+}
+
 func (db *memVectorDB) Set(id string, vec llm.Vector) {
 	// No need to put db.storage.Set under db.mu.Lock() since
 	// it does its own locking. The other potentially problematic
@@ -289,21 +416,56 @@ func (db *memVectorDB) Set(id string, vec llm.Vector) {
 	if len(id) == 0 {
 		db.storage.Panic("memVectorDB set: empty ID")
 	}
-	db.storage.Set(ordered.Encode("llm.Vector", db.namespace, id), vec.Encode())
+	db.set(id, slices.Clone(vec))
+}
+
+// set stores vec, which the caller must not modify, as the vector for id,
+// removing any metadata for id.
+func (db *memVectorDB) set(id string, vec llm.Vector) {
+	b := db.storage.Batch()
+	b.Set(ordered.Encode("llm.Vector", db.namespace, id), vec.Encode())
+	b.Delete(db.metaKey(id))
+	b.Apply()
 
 	db.mu.Lock()
-	db.cache.Set(id, slices.Clone(vec))
+	db.cache.Set(id, vec)
+	delete(db.meta, id)
 	db.mu.Unlock()
 }
 
 func (db *memVectorDB) Delete(id string) {
-	db.storage.Delete(ordered.Encode("llm.Vector", db.namespace, id))
+	b := db.storage.Batch()
+	b.Delete(ordered.Encode("llm.Vector", db.namespace, id))
+	b.Delete(db.metaKey(id))
+	b.Apply()
 
 	db.mu.Lock()
 	db.cache.Delete(id)
+	delete(db.meta, id)
+	db.mu.Unlock()
+}
+
+// SetMeta implements [MetaVectorDB.SetMeta].
+func (db *memVectorDB) SetMeta(id string, meta *VectorMeta) {
+	meta = new(*meta)
+	db.storage.Set(db.metaKey(id), JSON(meta))
+
+	db.mu.Lock()
+	db.meta[id] = meta
 	db.mu.Unlock()
 }
 
+// Meta implements [MetaVectorDB.Meta].
+func (db *memVectorDB) Meta(id string) (*VectorMeta, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	meta, ok := db.meta[id]
+	if !ok {
+		return nil, false
+	}
+	return new(*meta), true
+}
+
 func (db *memVectorDB) Get(name string) (llm.Vector, bool) {
 	db.mu.RLock()
 	vec, ok := db.cache.Get(name)
@@ -337,6 +499,11 @@ func (db *memVectorDB) All() iter.Seq2[string, func() llm.Vector] {
 }
 
 func (db *memVectorDB) Search(target llm.Vector, n int) []VectorResult {
+	return db.SearchFilter(target, n, nil)
+}
+
+// SearchFilter implements [MetaVectorDB.SearchFilter].
+func (db *memVectorDB) SearchFilter(target llm.Vector, n int, f *VectorFilter) []VectorResult {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 	best := top.New(n, VectorResult.cmp)
@@ -344,6 +511,9 @@ func (db *memVectorDB) Search(target llm.Vector, n int) []VectorResult {
 		if len(vec) != len(target) {
 			continue
 		}
+		if !f.IsZero() && !f.Match(db.meta[name]) {
+			continue
+		}
 		best.Add(VectorResult{name, target.Dot(vec)})
 	}
 	return best.Take()
@@ -355,14 +525,15 @@ func (db *memVectorDB) Flush() {
 
 // memVectorBatch implements VectorBatch for a memVectorDB.
 type memVectorBatch struct {
-	db *memVectorDB          // underlying memVectorDB
-	sb Batch                 // batch for underlying DB
-	w  map[string]llm.Vector // vectors to write
-	d  map[string]bool       // vectors to delete
+	db *memVectorDB           // underlying memVectorDB
+	sb Batch                  // batch for underlying DB
+	w  map[string]llm.Vector  // vectors to write
+	d  map[string]bool        // vectors to delete
+	m  map[string]*VectorMeta // metadata to write
 }
 
 func (db *memVectorDB) Batch() VectorBatch {
-	return &memVectorBatch{db, db.storage.Batch(), make(map[string]llm.Vector), make(map[string]bool)}
+	return &memVectorBatch{db, db.storage.Batch(), make(map[string]llm.Vector), make(map[string]bool), make(map[string]*VectorMeta)}
 }
 
 func (b *memVectorBatch) Set(name string, vec llm.Vector) {
@@ -370,18 +541,29 @@ func (b *memVectorBatch) Set(name string, vec llm.Vector) {
 		b.db.storage.Panic("memVectorDB batch set: empty ID")
 	}
 	b.sb.Set(ordered.Encode("llm.Vector", b.db.namespace, name), vec.Encode())
+	b.sb.Delete(b.db.metaKey(name))
 
 	delete(b.d, name)
+	delete(b.m, name)
 	b.w[name] = slices.Clone(vec)
 }
 
 func (b *memVectorBatch) Delete(name string) {
 	b.sb.Delete(ordered.Encode("llm.Vector", b.db.namespace, name))
+	b.sb.Delete(b.db.metaKey(name))
 
 	delete(b.w, name)
+	delete(b.m, name)
 	b.d[name] = true
 }
 
+// SetMeta implements [MetaVectorBatch.SetMeta].
+func (b *memVectorBatch) SetMeta(name string, meta *VectorMeta) {
+	meta = new(*meta)
+	b.sb.Set(b.db.metaKey(name), JSON(meta))
+	b.m[name] = meta
+}
+
 func (b *memVectorBatch) MaybeApply() bool {
 	if !b.sb.MaybeApply() {
 		return false
@@ -398,11 +580,18 @@ func (b *memVectorBatch) Apply() {
 
 	for name, vec := range b.w {
 		b.db.cache.Set(name, vec)
+		delete(b.db.meta, name)
 	}
 	clear(b.w)
 
 	for name := range b.d {
 		b.db.cache.Delete(name)
+		delete(b.db.meta, name)
 	}
 	clear(b.d)
+
+	for name, meta := range b.m {
+		b.db.meta[name] = meta
+	}
+	clear(b.m)
 }
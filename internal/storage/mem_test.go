@@ -14,11 +14,15 @@ func TestMemDB(t *testing.T) {
 	db := MemDB()
 	TestDB(t, db)
 	TestDBLock(t, db)
+	TestNotifier(t, db.(*memDB))
 }
 
 func TestMemVectorDB(t *testing.T) {
 	db := MemDB()
 	TestVectorDB(t, func() VectorDB { return MemVectorDB(db, testutil.Slogger(t), "") })
+
+	db = MemDB()
+	TestMetaVectorDB(t, func() MetaVectorDB { return MemVectorDB(db, testutil.Slogger(t), "").(MetaVectorDB) })
 }
 
 type maybeDB struct {
@@ -0,0 +1,293 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package migrate implements versioned migrations of the
+// key layouts stored in a [storage.DB].
+//
+// Each package that stores data in a database owns a set of key layouts,
+// such as ["github.Event", Project, Issue, API, ID], documented in its
+// package comment. When a package changes one of its layouts,
+// it registers a numbered [Migration] that rewrites the existing entries:
+//
+//	func init() {
+//		migrate.Register("github", &migrate.Migration{
+//			Version: 1,
+//			Doc:     "move github.Event to github.Event2",
+//			Prefix:  ordered.Encode("github.Event"),
+//			Func:    migrate.Move(ordered.Encode("github.Event"), ordered.Encode("github.Event2")),
+//		})
+//	}
+//
+// The database records, for each package, the version of the last
+// migration applied to it. [Run] applies the registered migrations
+// that are newer than that version, in order.
+//
+// A migration calls its Func for each database entry whose key
+// begins with its Prefix, in key order, writing any changes
+// to a batch that is applied periodically using [storage.Batch.MaybeApply].
+// Along with each change, the batch records the last key processed,
+// so if a migration is interrupted, the next call to [Run]
+// resumes it after that key.
+//
+// Migrations are stored in the database under the keys
+// ["migrate.Version", pkg] and ["migrate.Progress", pkg, version].
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+// A Migration is a single numbered change to the key layout of a package.
+type Migration struct {
+	// Version is the migration's version number.
+	// The migrations registered for a package must be numbered
+	// consecutively starting at 1.
+	Version int
+
+	// Doc is a one-line description of the migration.
+	Doc string
+
+	// Prefix is the prefix of the keys that the migration examines.
+	Prefix []byte
+
+	// Func is called for each entry whose key begins with Prefix.
+	// It writes any changes for that entry to b.
+	// Func must be idempotent: if a migration is interrupted,
+	// Func may be called again for entries whose changes were
+	// applied but not recorded as processed.
+	// If Func sets new keys beginning with Prefix that sort after key,
+	// Func may be called for them later in the same migration.
+	//
+	// Like other database operations, Func should call
+	// [storage.DB.Panic] for unrecoverable errors.
+	Func func(db storage.DB, b storage.Batch, key []byte, val func() []byte)
+}
+
+// Move returns a Migration.Func that moves each entry with a key
+// beginning with old to the key obtained by replacing old with new.
+// It is the versioned equivalent of the dbedit mvprefix command.
+func Move(old, new []byte) func(storage.DB, storage.Batch, []byte, func() []byte) {
+	old = bytes.Clone(old)
+	new = bytes.Clone(new)
+	return func(db storage.DB, b storage.Batch, key []byte, val func() []byte) {
+		if !bytes.HasPrefix(key, old) {
+			return
+		}
+		b.Set(append(bytes.Clone(new), key[len(old):]...), val())
+		b.Delete(key)
+	}
+}
+
+var registry struct {
+	mu   sync.Mutex
+	pkgs map[string][]*Migration
+}
+
+// Register registers migrations for the named package.
+// Register may be called multiple times for the same package,
+// but the combined migrations must be numbered consecutively
+// starting at 1. Register panics if they are not,
+// except during testing, when registering a version replaces any
+// existing migration with the same version.
+func Register(pkg string, ms ...*Migration) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.pkgs == nil {
+		registry.pkgs = make(map[string][]*Migration)
+	}
+	list := registry.pkgs[pkg]
+	for _, m := range ms {
+		if m.Func == nil || len(m.Prefix) == 0 {
+			panic(fmt.Sprintf("migrate: %s migration version %d has no Func or Prefix", pkg, m.Version))
+		}
+		switch {
+		case m.Version == len(list)+1:
+			list = append(list, m)
+		case testing.Testing() && 1 <= m.Version && m.Version <= len(list):
+			list[m.Version-1] = m
+		default:
+			panic(fmt.Sprintf("migrate: %s migration version %d registered after version %d", pkg, m.Version, len(list)))
+		}
+	}
+	registry.pkgs[pkg] = list
+}
+
+// registered returns a copy of the registered migrations.
+func registered() map[string][]*Migration {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	m := make(map[string][]*Migration)
+	for pkg, list := range registry.pkgs {
+		m[pkg] = slices.Clone(list)
+	}
+	return m
+}
+
+// Version returns the version of the last migration
+// applied to db for the named package, or 0 if none have been applied.
+func Version(db storage.DB, pkg string) int {
+	val, ok := db.Get(versionKey(pkg))
+	if !ok {
+		return 0
+	}
+	var v int64
+	if err := ordered.Decode(val, &v); err != nil {
+		// unreachable unless corrupt storage
+		db.Panic("migrate decode", "key", storage.Fmt(versionKey(pkg)), "err", err)
+	}
+	return int(v)
+}
+
+// A Result describes a migration applied (or, in a dry run,
+// that would be applied) by [Run].
+type Result struct {
+	Package string
+	Version int
+	Doc     string
+	Resumed bool  // migration was resumed after an interruption
+	Keys    int64 // number of entries passed to Func
+	Sets    int64 // number of Set calls made by Func
+	Deletes int64 // number of Delete and DeleteRange calls made by Func
+}
+
+// Run applies to db all the registered migrations that have not yet
+// been applied, ordered by package name and then by version.
+// It returns a Result for each migration, in the order they were run.
+//
+// If dryRun is true, Run calls each pending migration's Func
+// but discards the changes, so the Results report what Run would do.
+// Because the changes are discarded, a dry run of a package with
+// several pending migrations runs each of them against the
+// current, unmigrated database.
+//
+// Run holds a database lock for each package while migrating it,
+// so concurrent calls to Run do not run the same migration twice.
+// Run returns an error without migrating a package if db records a
+// version newer than any registered for the package,
+// which means that db has been migrated by a newer program.
+func Run(lg *slog.Logger, db storage.DB, dryRun bool) ([]*Result, error) {
+	pkgs := registered()
+	var results []*Result
+	for _, pkg := range slices.Sorted(maps.Keys(pkgs)) {
+		rs, err := runPackage(lg, db, pkg, pkgs[pkg], dryRun)
+		results = append(results, rs...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// runPackage applies the pending migrations ms of the named package.
+func runPackage(lg *slog.Logger, db storage.DB, pkg string, ms []*Migration, dryRun bool) ([]*Result, error) {
+	lock := "migrate." + pkg
+	db.Lock(lock)
+	defer db.Unlock(lock)
+
+	v := Version(db, pkg)
+	if v > len(ms) {
+		return nil, fmt.Errorf("migrate: database has %s version %d, newer than latest known version %d", pkg, v, len(ms))
+	}
+	var results []*Result
+	for _, m := range ms[v:] {
+		r := &Result{Package: pkg, Version: m.Version, Doc: m.Doc}
+		lg.Info("migrate start", "pkg", pkg, "version", m.Version, "doc", m.Doc, "dryrun", dryRun)
+		if dryRun {
+			runDry(db, m, r)
+		} else {
+			run(db, pkg, m, r)
+		}
+		lg.Info("migrate done", "pkg", pkg, "version", m.Version, "resumed", r.Resumed,
+			"keys", r.Keys, "sets", r.Sets, "deletes", r.Deletes)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// run applies the migration m of package pkg to db, recording the result in r.
+func run(db storage.DB, pkg string, m *Migration, r *Result) {
+	pkey := progressKey(pkg, m.Version)
+	start := m.Prefix
+	if last, ok := db.Get(pkey); ok {
+		r.Resumed = true
+		start = append(bytes.Clone(last), 0)
+	}
+
+	b := &countBatch{Batch: db.Batch(), r: r}
+	for key, val := range db.Scan(start, append(bytes.Clone(m.Prefix), 0xff)) {
+		if !bytes.HasPrefix(key, m.Prefix) {
+			break
+		}
+		r.Keys++
+		m.Func(db, b, key, val)
+		b.Batch.Set(pkey, key)
+		b.MaybeApply()
+	}
+	b.Batch.Delete(pkey)
+	b.Batch.Set(versionKey(pkg), ordered.Encode(int64(m.Version)))
+	b.Apply()
+}
+
+// runDry calls the Func of migration m for each entry
+// but discards the changes, recording the result in r.
+func runDry(db storage.DB, m *Migration, r *Result) {
+	b := &countBatch{Batch: discard{}, r: r}
+	for key, val := range db.Scan(m.Prefix, append(bytes.Clone(m.Prefix), 0xff)) {
+		if !bytes.HasPrefix(key, m.Prefix) {
+			break
+		}
+		r.Keys++
+		m.Func(db, b, key, val)
+	}
+}
+
+func versionKey(pkg string) []byte {
+	return ordered.Encode("migrate.Version", pkg)
+}
+
+func progressKey(pkg string, version int) []byte {
+	return ordered.Encode("migrate.Progress", pkg, int64(version))
+}
+
+// A countBatch is a [storage.Batch] that counts
+// the changes made by a migration in a [Result].
+type countBatch struct {
+	storage.Batch
+	r *Result
+}
+
+func (b *countBatch) Set(key, val []byte) {
+	b.r.Sets++
+	b.Batch.Set(key, val)
+}
+
+func (b *countBatch) Delete(key []byte) {
+	b.r.Deletes++
+	b.Batch.Delete(key)
+}
+
+func (b *countBatch) DeleteRange(start, end []byte) {
+	b.r.Deletes++
+	b.Batch.DeleteRange(start, end)
+}
+
+// discard is a [storage.Batch] that discards all changes.
+type discard struct{}
+
+func (discard) Set(key, val []byte)           {}
+func (discard) Delete(key []byte)             {}
+func (discard) DeleteRange(start, end []byte) {}
+func (discard) MaybeApply() bool              { return false }
+func (discard) Apply()                        {}
@@ -0,0 +1,186 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+// register registers ms for pkg for the duration of the test.
+func register(t *testing.T, pkg string, ms ...*Migration) {
+	Register(pkg, ms...)
+	t.Cleanup(func() {
+		registry.mu.Lock()
+		defer registry.mu.Unlock()
+		delete(registry.pkgs, pkg)
+	})
+}
+
+// dump returns the keys and values in db, formatted with [storage.Fmt],
+// omitting the keys used by this package.
+func dump(db storage.DB) []string {
+	var out []string
+	for key, val := range db.Scan(nil, ordered.Encode(ordered.Inf)) {
+		var prefix string
+		if _, err := ordered.DecodePrefix(key, &prefix); err == nil && (prefix == "migrate.Version" || prefix == "migrate.Progress") {
+			continue
+		}
+		out = append(out, storage.Fmt(key)+"="+storage.Fmt(val()))
+	}
+	return out
+}
+
+func TestRun(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	for i := range 3 {
+		db.Set(ordered.Encode("old", int64(i)), ordered.Encode(fmt.Sprint("v", i)))
+	}
+	db.Set(ordered.Encode("other"), ordered.Encode("x"))
+
+	register(t, "test.pkg",
+		&Migration{
+			Version: 1,
+			Doc:     "move old to new",
+			Prefix:  ordered.Encode("old"),
+			Func:    Move(ordered.Encode("old"), ordered.Encode("new")),
+		},
+		&Migration{
+			Version: 2,
+			Doc:     "rewrite values",
+			Prefix:  ordered.Encode("new"),
+			Func: func(db storage.DB, b storage.Batch, key []byte, val func() []byte) {
+				var s string
+				if err := ordered.Decode(val(), &s); err != nil {
+					db.Panic("decode", "err", err)
+				}
+				b.Set(key, ordered.Encode(s+"!"))
+			},
+		})
+
+	before := dump(db)
+	rs, err := Run(lg, db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Result{
+		{Package: "test.pkg", Version: 1, Doc: "move old to new", Keys: 3, Sets: 3, Deletes: 3},
+		{Package: "test.pkg", Version: 2, Doc: "rewrite values"},
+	}
+	if !reflect.DeepEqual(rs, want) {
+		t.Errorf("dry run:\nhave %v\nwant %v", rs, want)
+	}
+	if after := dump(db); !reflect.DeepEqual(after, before) {
+		t.Errorf("dry run changed db:\nhave %q\nwant %q", after, before)
+	}
+	if v := Version(db, "test.pkg"); v != 0 {
+		t.Errorf("after dry run: Version = %d, want 0", v)
+	}
+
+	rs, err = Run(lg, db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want[1].Keys = 3
+	want[1].Sets = 3
+	if !reflect.DeepEqual(rs, want) {
+		t.Errorf("run:\nhave %v\nwant %v", rs, want)
+	}
+	wantDB := []string{
+		`("new", 0)=("v0!")`,
+		`("new", 1)=("v1!")`,
+		`("new", 2)=("v2!")`,
+		`("other")=("x")`,
+	}
+	if have := dump(db); !reflect.DeepEqual(have, wantDB) {
+		t.Errorf("after run:\nhave %q\nwant %q", have, wantDB)
+	}
+	if v := Version(db, "test.pkg"); v != 2 {
+		t.Errorf("after run: Version = %d, want 2", v)
+	}
+
+	// Nothing left to do.
+	rs, err = Run(lg, db, false)
+	if err != nil || len(rs) != 0 {
+		t.Errorf("second run = %v, %v, want nothing", rs, err)
+	}
+
+	// A database migrated by a newer program is an error.
+	db.Set(versionKey("test.pkg"), ordered.Encode(int64(3)))
+	if _, err := Run(lg, db, false); err == nil {
+		t.Errorf("run with newer version: no error")
+	}
+}
+
+func TestResume(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	for i := range 4 {
+		db.Set(ordered.Encode("old", int64(i)), ordered.Encode(int64(i)))
+	}
+
+	register(t, "test.resume", &Migration{
+		Version: 1,
+		Prefix:  ordered.Encode("old"),
+		Func:    Move(ordered.Encode("old"), ordered.Encode("new")),
+	})
+
+	// Simulate a migration interrupted after moving the first two entries.
+	b := db.Batch()
+	for i := range 2 {
+		key := ordered.Encode("old", int64(i))
+		b.Set(ordered.Encode("new", int64(i)), ordered.Encode(int64(i)))
+		b.Delete(key)
+		b.Set(progressKey("test.resume", 1), key)
+	}
+	b.Apply()
+
+	rs, err := Run(lg, db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Result{{Package: "test.resume", Version: 1, Resumed: true, Keys: 2, Sets: 2, Deletes: 2}}
+	if !reflect.DeepEqual(rs, want) {
+		t.Errorf("run:\nhave %v\nwant %v", rs, want)
+	}
+	wantDB := []string{
+		`("new", 0)=(0)`,
+		`("new", 1)=(1)`,
+		`("new", 2)=(2)`,
+		`("new", 3)=(3)`,
+	}
+	if have := dump(db); !reflect.DeepEqual(have, wantDB) {
+		t.Errorf("after run:\nhave %q\nwant %q", have, wantDB)
+	}
+	if _, ok := db.Get(progressKey("test.resume", 1)); ok {
+		t.Errorf("progress key not deleted")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	f := func(storage.DB, storage.Batch, []byte, func() []byte) {}
+	register(t, "test.register", &Migration{Version: 1, Prefix: []byte("x"), Func: f})
+
+	for _, m := range []*Migration{
+		{Version: 3, Prefix: []byte("x"), Func: f},
+		{Version: 2, Func: f},
+		{Version: 2, Prefix: []byte("x")},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(version %d) did not panic", m.Version)
+				}
+			}()
+			Register("test.register", m)
+		}()
+	}
+}
@@ -6,7 +6,13 @@ package storage
 
 import (
 	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"iter"
+	"slices"
+	"strings"
 	"sync"
 
 	"rsc.io/ordered"
@@ -39,6 +45,9 @@ const overlayPrefix = "__overlay"
 // The overlay DB assumes that all keys are encoded with [rsc.io/ordered].
 // The part of the key space beginning with ordered.Encode(overlayPrefix) in the overlay
 // DB is reserved for use by the implementation.
+//
+// The returned DB also implements [Overlay], to report the changes
+// made in the overlay and to commit them to the base.
 func NewOverlayDB(overlay, base DB) DB {
 	return &overlayDB{
 		overlay: overlay,
@@ -51,6 +60,10 @@ func (db *overlayDB) Get(key []byte) (val []byte, ok bool) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
+	return db.getLocked(key)
+}
+
+func (db *overlayDB) getLocked(key []byte) (val []byte, ok bool) {
 	if oval, ok := db.overlay.Get(key); ok {
 		return oval, true
 	}
@@ -69,6 +82,7 @@ func (db *overlayDB) Set(key, val []byte) {
 }
 
 func (db *overlayDB) setLocked(key, val []byte) {
+	db.recordOrig(key)
 	db.overlay.Set(key, val)
 	db.unmarkDeleted(key)
 }
@@ -81,6 +95,7 @@ func (db *overlayDB) Delete(key []byte) {
 }
 
 func (db *overlayDB) deleteLocked(key []byte) {
+	db.recordOrig(key)
 	db.overlay.Delete(key)
 	db.markDeleted(key)
 }
@@ -194,10 +209,46 @@ func (db *overlayDB) unmarkDeleted(key []byte) {
 // It isn't sufficient to delete each key in the range that appears in base,
 // because a key in the range might be added to base but not overlay, and then
 // it would be visible.
+//
+// The mark is a single entry, which also records the base state
+// of the range when it was first deleted (see [rangeHash]):
+//
+//	ordered.Encode(overlayPrefix, "ranges", string(start), string(end)) → rangeHash(base, start, end)
+//
+// Deleting the same range again leaves the entry unchanged.
 func (db *overlayDB) markRangeDeleted(start, end []byte) {
-	// The key for a deleted range is the start of the range.
-	key := ordered.Encode(overlayPrefix, "ranges", ordered.Raw(start))
-	db.overlay.Set(key, end)
+	key := ordered.Encode(overlayPrefix, rangesTag, string(start), string(end))
+	if _, ok := db.overlay.Get(key); ok {
+		return
+	}
+	db.overlay.Set(key, rangeHash(db.base, start, end))
+}
+
+// deletedRanges returns an iterator over the ranges deleted in the overlay.
+// Along with each range, it yields the recorded hash of its base state,
+// or nil if there is none.
+func (db *overlayDB) deletedRanges() iter.Seq2[keyRange, []byte] {
+	return func(yield func(keyRange, []byte) bool) {
+		prefix := ordered.Encode(overlayPrefix, rangesTag)
+		for k, vf := range db.overlay.Scan(prefix, ordered.Encode(overlayPrefix, rangesTag, ordered.Inf)) {
+			var start, end string
+			var raw ordered.Raw
+			var r keyRange
+			var orig []byte
+			if err := ordered.Decode(k, nil, nil, &start, &end); err == nil {
+				r, orig = keyRange{[]byte(start), []byte(end)}, vf()
+			} else if err := ordered.Decode(k, nil, nil, &raw); err == nil {
+				// A range recorded by an older version, as start → end.
+				r = keyRange{raw, vf()}
+			} else {
+				// unreachable except data corruption
+				db.Panic("overlay decode range", "key", Fmt(k), "err", err)
+			}
+			if !yield(r, orig) {
+				return
+			}
+		}
+	}
 }
 
 // deleted reports whether key is deleted.
@@ -209,16 +260,36 @@ func (db *overlayDB) deleted(key []byte) bool {
 	if _, ok := db.overlay.Get(tombstone); ok {
 		return true
 	}
-	// Scan deleted ranges up to where the start of the range is equal to key.
-	prefix := ordered.Encode(overlayPrefix, "ranges")
-	for _, vf := range db.overlay.Scan(prefix, append(prefix, ordered.Encode(ordered.Raw(key))...)) {
-		// We know start <= key, so just compare end >= key.
-		end := vf()
-		if bytes.Compare(end, key) >= 0 {
-			return true
+	return db.inDeletedRange(key)
+}
+
+// Transaction implements [TxDB.Transaction].
+// It only detects conflicting writes made through db,
+// not writes made directly to the base.
+func (db *overlayDB) Transaction(f func(tx Tx) error) error {
+	return RunTx(db.Get, f, func(t *TxLog) bool {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		if !t.Valid(db.getLocked) {
+			return false
 		}
-	}
-	return false
+		for key, val := range t.Writes() {
+			if val == nil {
+				db.deleteLocked(key)
+			} else {
+				db.setLocked(key, val)
+			}
+		}
+		return true
+	})
+}
+
+// Subscribe implements [Notifier.Subscribe].
+// Since all writes go to the overlay, the subscription
+// is a subscription to the overlay, as returned by [Subscribe].
+func (db *overlayDB) Subscribe(prefix []byte) *Subscription {
+	return Subscribe(db.overlay, prefix)
 }
 
 // Batch returns a new batch.
@@ -279,3 +350,231 @@ func (b *overlayBatch) Apply() {
 	}
 	b.ops = nil
 }
+
+// An Overlay is a [DB] that buffers changes to a base DB,
+// as returned by [NewOverlayDB].
+// The changes can be inspected with Diff and applied to the base with Commit.
+type Overlay interface {
+	DB
+
+	// Diff returns the changes made in the overlay,
+	// relative to the base.
+	Diff() *OverlayDiff
+
+	// Commit applies the changes made in the overlay to the base DB
+	// as a single transaction (see [Transaction]) and then clears the overlay.
+	//
+	// If the base has changed since the overlay first changed a key
+	// or deleted a range, Commit returns an error wrapping [ErrOverlayConflict]
+	// and leaves both the base and the overlay unchanged.
+	// The conflict check and the transaction cover the keys in the diff;
+	// a concurrent insertion into a deleted range of the base
+	// made after the check may survive the commit.
+	Commit() error
+}
+
+// ErrOverlayConflict is the error (wrapped) returned by [Overlay.Commit]
+// when the base DB has changed underneath the overlay.
+var ErrOverlayConflict = errors.New("overlay commit conflict")
+
+// An OverlayDiff is the set of changes made in an [Overlay].
+// Applying the range deletions and then the changes
+// to the base DB gives the contents of the overlay.
+type OverlayDiff struct {
+	Ranges  []OverlayRange  // deleted ranges, sorted by start
+	Changes []OverlayChange // changed keys, sorted by key
+}
+
+// An OverlayRange is a range of keys start ≤ key ≤ end deleted in an [Overlay].
+type OverlayRange struct {
+	Start, End []byte
+}
+
+// An OverlayChange is a single key changed in an [Overlay].
+type OverlayChange struct {
+	Key    []byte
+	Val    []byte // new value, if not Delete
+	Delete bool   // key was deleted
+}
+
+// String returns a textual form of the diff, one change per line,
+// formatting keys and values with [Fmt].
+func (d *OverlayDiff) String() string {
+	var buf bytes.Buffer
+	for _, r := range d.Ranges {
+		fmt.Fprintf(&buf, "delete %s..%s\n", Fmt(r.Start), Fmt(r.End))
+	}
+	for _, c := range d.Changes {
+		if c.Delete {
+			fmt.Fprintf(&buf, "delete %s\n", Fmt(c.Key))
+		} else {
+			fmt.Fprintf(&buf, "set %s = %s\n", Fmt(c.Key), Fmt(c.Val))
+		}
+	}
+	return buf.String()
+}
+
+// The overlay records the state of the base for each key and range
+// when the overlay first changes it, so that Commit can detect conflicts.
+// The record for a range is part of its deleted range entry (see markRangeDeleted).
+// The record for a key is stored in the overlay,
+// using a string tag that cannot be confused with tombstones, as
+//
+//	ordered.Encode(overlayPrefix, "__orig", ordered.Raw(key)) → baseHash(val, ok)
+const (
+	origTag   = "__orig"
+	rangesTag = "ranges" // see markRangeDeleted
+)
+
+// baseHash returns a hash of a base value (val, ok) as returned by Get.
+// A missing value has an empty hash.
+func baseHash(val []byte, ok bool) []byte {
+	if !ok {
+		return []byte{}
+	}
+	h := sha256.Sum256(val)
+	return h[:]
+}
+
+// rangeHash returns a hash of the keys and values in db
+// with start ≤ key ≤ end.
+func rangeHash(db DB, start, end []byte) []byte {
+	h := sha256.New()
+	for k, vf := range db.Scan(start, end) {
+		h.Write(ordered.Encode(string(k), string(vf())))
+	}
+	return h.Sum(nil)
+}
+
+// recordOrig records the base state of key when the overlay first changes it.
+// If the key has been changed before, its state is already recorded,
+// either in its own record or, if it was first deleted as part of a range,
+// in the range's record, so recordOrig does nothing.
+func (db *overlayDB) recordOrig(key []byte) {
+	okey := ordered.Encode(overlayPrefix, origTag, ordered.Raw(key))
+	if _, ok := db.overlay.Get(okey); ok {
+		return
+	}
+	if db.inDeletedRange(key) {
+		return
+	}
+	db.overlay.Set(okey, baseHash(db.base.Get(key)))
+}
+
+// Diff implements [Overlay.Diff].
+func (db *overlayDB) Diff() *OverlayDiff {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.diffLocked()
+}
+
+func (db *overlayDB) diffLocked() *OverlayDiff {
+	d := new(OverlayDiff)
+	prefix := ordered.Encode(overlayPrefix)
+
+	// unchanged reports whether the base value of key
+	// is recorded and matches (val, ok).
+	unchanged := func(key, val []byte, ok bool) bool {
+		orig, recorded := db.overlay.Get(ordered.Encode(overlayPrefix, origTag, ordered.Raw(key)))
+		return recorded && bytes.Equal(orig, baseHash(val, ok))
+	}
+
+	// Sets are the keys in the overlay, other than the reserved ones.
+	for k, vf := range db.overlay.Scan(nil, ordered.Encode(ordered.Inf)) {
+		if bytes.HasPrefix(k, prefix) {
+			continue
+		}
+		v := vf()
+		if unchanged(k, v, true) && !db.inDeletedRange(k) {
+			continue
+		}
+		d.Changes = append(d.Changes, OverlayChange{Key: bytes.Clone(k), Val: bytes.Clone(v)})
+	}
+
+	// Deletions are the tombstones and the deleted ranges.
+	for k := range db.overlay.Scan(prefix, ordered.Encode(overlayPrefix, ordered.Inf)) {
+		var key ordered.Raw
+		if err := ordered.Decode(k, nil, &key); err != nil {
+			continue // not a tombstone
+		}
+		if unchanged(key, nil, false) && !db.inDeletedRange(key) {
+			// Deleting a key that was not in the base.
+			continue
+		}
+		d.Changes = append(d.Changes, OverlayChange{Key: bytes.Clone(key), Delete: true})
+	}
+	for r := range db.deletedRanges() {
+		d.Ranges = append(d.Ranges, OverlayRange{Start: bytes.Clone(r.start), End: bytes.Clone(r.end)})
+	}
+	slices.SortFunc(d.Ranges, func(x, y OverlayRange) int {
+		return cmp.Or(bytes.Compare(x.Start, y.Start), bytes.Compare(x.End, y.End))
+	})
+	slices.SortFunc(d.Changes, func(x, y OverlayChange) int { return bytes.Compare(x.Key, y.Key) })
+	return d
+}
+
+// inDeletedRange reports whether key is in a range deleted in the overlay.
+func (db *overlayDB) inDeletedRange(key []byte) bool {
+	for r := range db.deletedRanges() {
+		if bytes.Compare(r.start, key) <= 0 && bytes.Compare(key, r.end) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Commit implements [Overlay.Commit].
+func (db *overlayDB) Commit() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	d := db.diffLocked()
+	err := Transaction(db.base, func(tx Tx) error {
+		var conflicts []string
+		for r, orig := range db.deletedRanges() {
+			if orig != nil && !bytes.Equal(orig, rangeHash(db.base, r.start, r.end)) {
+				conflicts = append(conflicts, Fmt(r.start)+".."+Fmt(r.end))
+			}
+		}
+		for _, c := range d.Changes {
+			okey := ordered.Encode(overlayPrefix, origTag, ordered.Raw(c.Key))
+			if orig, ok := db.overlay.Get(okey); ok && !bytes.Equal(orig, baseHash(tx.Get(c.Key))) {
+				conflicts = append(conflicts, Fmt(c.Key))
+			}
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%w: base changed: %s", ErrOverlayConflict, strings.Join(conflicts, ", "))
+		}
+
+		for _, r := range d.Ranges {
+			for k := range db.base.Scan(r.Start, r.End) {
+				tx.Delete(k)
+			}
+		}
+		for _, c := range d.Changes {
+			if c.Delete {
+				tx.Delete(c.Key)
+			} else {
+				tx.Set(c.Key, c.Val)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.base.Flush()
+
+	// Clear the overlay, so that reads go to the updated base.
+	var keys [][]byte
+	for k := range db.overlay.Scan(nil, ordered.Encode(ordered.Inf)) {
+		keys = append(keys, bytes.Clone(k))
+	}
+	b := db.overlay.Batch()
+	for _, k := range keys {
+		b.Delete(k)
+		b.MaybeApply()
+	}
+	b.Apply()
+	return nil
+}
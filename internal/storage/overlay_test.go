@@ -6,7 +6,9 @@ package storage
 
 import (
 	"bytes"
+	"errors"
 	"slices"
+	"strings"
 	"testing"
 
 	"rsc.io/ordered"
@@ -131,6 +133,22 @@ func TestOverlayDB(t *testing.T) {
 			if !slices.EqualFunc(bgot, items(newbase()), item.Equal) {
 				t.Errorf("base changed: %v", bgot)
 			}
+
+			// Committing the overlay should make the base
+			// look like the overlay.
+			odb := gdb.(Overlay)
+			if err := odb.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if bgot := items(base); !slices.EqualFunc(bgot, want, item.Equal) {
+				t.Errorf("after Commit: base:\ngot  %v\nwant %v", bgot, want)
+			}
+			if got := items(gdb); !slices.EqualFunc(got, want, item.Equal) {
+				t.Errorf("after Commit: overlay:\ngot  %v\nwant %v", got, want)
+			}
+			if d := odb.Diff(); len(d.Changes) != 0 || len(d.Ranges) != 0 {
+				t.Errorf("after Commit: Diff:\n%s", d)
+			}
 		})
 	}
 }
@@ -154,3 +172,112 @@ func items(db DB) []item {
 	}
 	return items
 }
+
+func TestOverlayDiff(t *testing.T) {
+	o := ordered.Encode
+	base := MemDB()
+	for i := range 5 {
+		base.Set(o("k", i), o(i))
+	}
+	db := NewOverlayDB(MemDB(), base).(Overlay)
+	db.Set(o("k", 0), o(10))
+	db.Set(o("k", 1), o(1)) // unchanged
+	db.Delete(o("k", 2))
+	db.Delete(o("x")) // not in base
+	db.Set(o("y"), o(1))
+	db.Delete(o("y")) // not in base
+	db.DeleteRange(o("k", 3), o("k", 4))
+	db.Set(o("k", 4), o(4)) // deleted by range, so changed
+
+	want := `delete ("k", 3)..("k", 4)
+set ("k", 0) = (10)
+delete ("k", 2)
+set ("k", 4) = (4)
+`
+	if have := db.Diff().String(); have != want {
+		t.Errorf("Diff:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestOverlayRanges(t *testing.T) {
+	o := ordered.Encode
+	base := MemDB()
+	for i := range 5 {
+		base.Set(o(i), o(i))
+	}
+	odb := &overlayDB{overlay: MemDB(), base: base}
+
+	// A range deletion is a single entry recording its base state,
+	// and a key first deleted by a range has no record of its own.
+	odb.DeleteRange(o(0), o(4))
+	odb.Set(o(2), o(20))
+	odb.DeleteRange(o(0), o(1)) // same start, smaller range
+	var ranges []string
+	for k := range odb.overlay.Scan(o(overlayPrefix), o(overlayPrefix, ordered.Inf)) {
+		ranges = append(ranges, Fmt(k))
+	}
+	want := []string{
+		Fmt(o(overlayPrefix, rangesTag, string(o(0)), string(o(1)))),
+		Fmt(o(overlayPrefix, rangesTag, string(o(0)), string(o(4)))),
+	}
+	if !slices.Equal(ranges, want) {
+		t.Errorf("overlay records:\n%s\nwant:\n%s", strings.Join(ranges, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Both deleted ranges still apply.
+	for i := range 5 {
+		val, ok := odb.Get(o(i))
+		if i == 2 {
+			if !ok || !bytes.Equal(val, o(20)) {
+				t.Errorf("Get(%d) = %s, %v, want (20), true", i, Fmt(val), ok)
+			}
+		} else if ok {
+			t.Errorf("Get(%d) = %s, true, want deleted", i, Fmt(val))
+		}
+	}
+}
+
+func TestOverlayConflict(t *testing.T) {
+	o := ordered.Encode
+	for _, test := range []struct {
+		name   string
+		ops    func(DB)
+		change func(base DB)
+	}{
+		{"set", func(db DB) { db.Set(o(1), o(10)) }, func(base DB) { base.Set(o(1), o(11)) }},
+		{"set-new", func(db DB) { db.Set(o(5), o(10)) }, func(base DB) { base.Set(o(5), o(11)) }},
+		{"delete", func(db DB) { db.Delete(o(1)) }, func(base DB) { base.Set(o(1), o(11)) }},
+		{"delete-deleted", func(db DB) { db.Set(o(1), o(10)) }, func(base DB) { base.Delete(o(1)) }},
+		{"range", func(db DB) { db.DeleteRange(o(0), o(3)) }, func(base DB) { base.Set(o(2), o(12)) }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			base := MemDB()
+			base.Set(o(1), o(1))
+			db := NewOverlayDB(MemDB(), base).(Overlay)
+			test.ops(db)
+			before := db.Diff().String()
+			test.change(base)
+			bitems := items(base)
+
+			err := db.Commit()
+			if !errors.Is(err, ErrOverlayConflict) {
+				t.Fatalf("Commit = %v, want ErrOverlayConflict", err)
+			}
+			if after := db.Diff().String(); after != before {
+				t.Errorf("Commit changed overlay: Diff = %s, want %s", after, before)
+			}
+			if !slices.EqualFunc(items(base), bitems, item.Equal) {
+				t.Errorf("Commit changed base")
+			}
+		})
+	}
+
+	// Changes to other keys are not conflicts.
+	base := MemDB()
+	db := NewOverlayDB(MemDB(), base).(Overlay)
+	db.Set(o(1), o(1))
+	base.Set(o(2), o(2))
+	if err := db.Commit(); err != nil {
+		t.Fatalf("Commit = %v, want nil", err)
+	}
+}
@@ -0,0 +1,466 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+	"math"
+	"sync"
+
+	"golang.org/x/oscar/internal/llm"
+	"rsc.io/omap"
+	"rsc.io/ordered"
+	"rsc.io/top"
+)
+
+// A Quantization is a way to store vectors in memory for searching.
+type Quantization int
+
+const (
+	// Float32 stores each vector entry as a float32 (4 bytes).
+	// It is the format used by [MemVectorDB].
+	Float32 Quantization = iota
+
+	// Int8 stores each vector entry as an int8 (1 byte),
+	// scaled so that the largest entry of each vector is ±127.
+	Int8
+
+	// Binary stores only the sign of each vector entry (1 bit).
+	Binary
+)
+
+var quantNames = []string{
+	Float32: "float32",
+	Int8:    "int8",
+	Binary:  "binary",
+}
+
+func (q Quantization) String() string {
+	if q < 0 || int(q) >= len(quantNames) {
+		return fmt.Sprintf("Quantization(%d)", int(q))
+	}
+	return quantNames[q]
+}
+
+// ParseQuantization returns the Quantization with the given name:
+// "float32", "int8", or "binary".
+func ParseQuantization(name string) (Quantization, error) {
+	for q, n := range quantNames {
+		if n == name {
+			return Quantization(q), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown quantization %q", name)
+}
+
+// rescore returns the number of candidates per requested result
+// that a search using quantized vectors rescores with the full vectors.
+func (q Quantization) rescore() int {
+	if q == Binary {
+		return 10
+	}
+	return 4
+}
+
+// A quantVectorDB is a VectorDB implementing in-memory search
+// over quantized vectors, storing the full vectors in an underlying DB.
+type quantVectorDB struct {
+	storage   DB
+	slog      *slog.Logger
+	namespace string
+	q         Quantization
+
+	mu    sync.RWMutex
+	cache omap.Map[string, *qvec] // in-memory cache of all quantized vectors, indexed by id
+	meta  map[string]*VectorMeta  // in-memory cache of all metadata, indexed by id
+}
+
+// QuantizedVectorDB returns a VectorDB that stores its vectors in db
+// but, like [MemVectorDB], uses an in-memory copy to implement Search
+// using a brute-force scan. The in-memory copy is quantized
+// as specified by q, so Search first finds candidates using the
+// quantized vectors and then rescores the best candidates using the
+// full vectors read from db. The returned scores are exact,
+// but quantization may cause Search to miss some of the best results.
+//
+// The stored vectors are the same as for MemVectorDB, using the same keys,
+// and the quantized copy is computed when QuantizedVectorDB is called,
+// so the quantization can be chosen separately for each namespace
+// and changed without rewriting the database.
+// The returned VectorDB implements [MetaVectorDB], storing metadata
+// in the same keys as MemVectorDB and keeping a copy in memory.
+// If q is [Float32], QuantizedVectorDB returns MemVectorDB(db, lg, namespace).
+//
+// For 768-entry vectors, a QuantizedVectorDB requires approximately
+// 900 bytes of memory per stored vector for [Int8], and 200 bytes
+// for [Binary], compared to 3kB for MemVectorDB.
+// Searches must read the rescored vectors from db, which is fast for an
+// on-disk database but may be slow for a remote one.
+func QuantizedVectorDB(db DB, lg *slog.Logger, namespace string, q Quantization) VectorDB {
+	switch q {
+	case Float32:
+		return MemVectorDB(db, lg, namespace)
+	case Int8, Binary:
+		// ok
+	default:
+		db.Panic("QuantizedVectorDB: invalid quantization", "q", q)
+	}
+
+	vdb := &quantVectorDB{
+		storage:   db,
+		slog:      lg,
+		namespace: namespace,
+		q:         q,
+		meta:      make(map[string]*VectorMeta),
+	}
+
+	// Load and quantize all the previously-stored vectors.
+	clen := 0
+	for key, getVal := range vdb.storage.Scan(
+		ordered.Encode("llm.Vector", namespace),
+		ordered.Encode("llm.Vector", namespace, ordered.Inf)) {
+
+		var id string
+		if err := ordered.Decode(key, nil, nil, &id); err != nil {
+			// unreachable except data corruption
+			panic(fmt.Errorf("QuantizedVectorDB decode key=%v: %v", Fmt(key), err))
+		}
+		vec, err := DecodeVector(getVal())
+		if err != nil {
+			// unreachable except data corruption
+			panic(fmt.Errorf("QuantizedVectorDB decode key=%v: %v", Fmt(key), err))
+		}
+		vdb.cache.Set(id, quantize(q, vec))
+		clen++
+	}
+
+	// Load all the previously-stored metadata.
+	for key, getVal := range vdb.storage.Scan(
+		ordered.Encode("llm.VectorMeta", namespace),
+		ordered.Encode("llm.VectorMeta", namespace, ordered.Inf)) {
+
+		var id string
+		if err := ordered.Decode(key, nil, nil, &id); err != nil {
+			// unreachable except data corruption
+			panic(fmt.Errorf("QuantizedVectorDB decode key=%v: %v", Fmt(key), err))
+		}
+		meta := new(VectorMeta)
+		if err := json.Unmarshal(getVal(), meta); err != nil {
+			// unreachable except data corruption
+			panic(fmt.Errorf("QuantizedVectorDB decode key=%v: %v", Fmt(key), err))
+		}
+		vdb.meta[id] = meta
+	}
+
+	vdb.slog.Info("loaded vectordb", "n", clen, "namespace", namespace, "quantization", q)
+	return vdb
+}
+
+// key returns the db key for the vector with the given ID.
+func (db *quantVectorDB) key(id string) []byte {
+	return ordered.Encode("llm.Vector", db.namespace, id)
+}
+
+// metaKey returns the db key for the metadata of the vector with the given ID.
+func (db *quantVectorDB) metaKey(id string) []byte {
+	return ordered.Encode("llm.VectorMeta", db.namespace, id)
+}
+
+func (db *quantVectorDB) Set(id string, vec llm.Vector) {
+	if len(id) == 0 {
+		db.storage.Panic("quantVectorDB set: empty ID")
+	}
+	b := db.storage.Batch()
+	b.Set(db.key(id), vec.Encode())
+	b.Delete(db.metaKey(id))
+	b.Apply()
+
+	db.mu.Lock()
+	db.cache.Set(id, quantize(db.q, vec))
+	delete(db.meta, id)
+	db.mu.Unlock()
+}
+
+func (db *quantVectorDB) Delete(id string) {
+	b := db.storage.Batch()
+	b.Delete(db.key(id))
+	b.Delete(db.metaKey(id))
+	b.Apply()
+
+	db.mu.Lock()
+	db.cache.Delete(id)
+	delete(db.meta, id)
+	db.mu.Unlock()
+}
+
+// SetMeta implements [MetaVectorDB.SetMeta].
+func (db *quantVectorDB) SetMeta(id string, meta *VectorMeta) {
+	meta = new(*meta)
+	db.storage.Set(db.metaKey(id), JSON(meta))
+
+	db.mu.Lock()
+	db.meta[id] = meta
+	db.mu.Unlock()
+}
+
+// Meta implements [MetaVectorDB.Meta].
+func (db *quantVectorDB) Meta(id string) (*VectorMeta, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	meta, ok := db.meta[id]
+	if !ok {
+		return nil, false
+	}
+	return new(*meta), true
+}
+
+func (db *quantVectorDB) Get(id string) (llm.Vector, bool) {
+	val, ok := db.storage.Get(db.key(id))
+	if !ok {
+		return nil, false
+	}
+	vec, err := DecodeVector(val)
+	if err != nil {
+		// unreachable except data corruption
+		db.storage.Panic("quantVectorDB decode", "key", Fmt(db.key(id)), "err", err)
+	}
+	return vec, true
+}
+
+// All returns all ID-vector pairs in lexicographic order of IDs.
+// The vectors are read from the underlying DB.
+func (db *quantVectorDB) All() iter.Seq2[string, func() llm.Vector] {
+	return func(yield func(string, func() llm.Vector) bool) {
+		for key, getVal := range db.storage.Scan(
+			ordered.Encode("llm.Vector", db.namespace),
+			ordered.Encode("llm.Vector", db.namespace, ordered.Inf)) {
+
+			var id string
+			if err := ordered.Decode(key, nil, nil, &id); err != nil {
+				// unreachable except data corruption
+				db.storage.Panic("quantVectorDB decode", "key", Fmt(key), "err", err)
+			}
+			val := func() llm.Vector {
+				vec, err := DecodeVector(getVal())
+				if err != nil {
+					// unreachable except data corruption
+					db.storage.Panic("quantVectorDB decode", "key", Fmt(key), "err", err)
+				}
+				return vec
+			}
+			if !yield(id, val) {
+				return
+			}
+		}
+	}
+}
+
+func (db *quantVectorDB) Search(target llm.Vector, n int) []VectorResult {
+	return db.SearchFilter(target, n, nil)
+}
+
+// SearchFilter implements [MetaVectorDB.SearchFilter].
+func (db *quantVectorDB) SearchFilter(target llm.Vector, n int, f *VectorFilter) []VectorResult {
+	// Find candidates using the quantized vectors.
+	db.mu.RLock()
+	cands := top.New(n*db.q.rescore(), VectorResult.cmp)
+	qq := newQuery(db.q, target)
+	for id, qv := range db.cache.All() {
+		if qv.n != len(target) {
+			continue
+		}
+		if !f.IsZero() && !f.Match(db.meta[id]) {
+			continue
+		}
+		cands.Add(VectorResult{id, qv.dot(qq)})
+	}
+	db.mu.RUnlock()
+
+	// Rescore the candidates using the full vectors.
+	best := top.New(n, VectorResult.cmp)
+	for _, r := range cands.Take() {
+		vec, ok := db.Get(r.ID)
+		if !ok || len(vec) != len(target) {
+			// deleted or replaced since the scan
+			continue
+		}
+		best.Add(VectorResult{r.ID, target.Dot(vec)})
+	}
+	return best.Take()
+}
+
+func (db *quantVectorDB) Flush() {
+	db.storage.Flush()
+}
+
+// quantVectorBatch implements VectorBatch for a quantVectorDB.
+type quantVectorBatch struct {
+	db *quantVectorDB         // underlying quantVectorDB
+	sb Batch                  // batch for underlying DB
+	w  map[string]*qvec       // quantized vectors to write
+	d  map[string]bool        // vectors to delete
+	m  map[string]*VectorMeta // metadata to write
+}
+
+func (db *quantVectorDB) Batch() VectorBatch {
+	return &quantVectorBatch{db, db.storage.Batch(), make(map[string]*qvec), make(map[string]bool), make(map[string]*VectorMeta)}
+}
+
+func (b *quantVectorBatch) Set(id string, vec llm.Vector) {
+	if len(id) == 0 {
+		b.db.storage.Panic("quantVectorDB batch set: empty ID")
+	}
+	b.sb.Set(b.db.key(id), vec.Encode())
+	b.sb.Delete(b.db.metaKey(id))
+
+	delete(b.d, id)
+	delete(b.m, id)
+	b.w[id] = quantize(b.db.q, vec)
+}
+
+func (b *quantVectorBatch) Delete(id string) {
+	b.sb.Delete(b.db.key(id))
+	b.sb.Delete(b.db.metaKey(id))
+
+	delete(b.w, id)
+	delete(b.m, id)
+	b.d[id] = true
+}
+
+// SetMeta implements [MetaVectorBatch.SetMeta].
+func (b *quantVectorBatch) SetMeta(id string, meta *VectorMeta) {
+	meta = new(*meta)
+	b.sb.Set(b.db.metaKey(id), JSON(meta))
+	b.m[id] = meta
+}
+
+func (b *quantVectorBatch) MaybeApply() bool {
+	if !b.sb.MaybeApply() {
+		return false
+	}
+	b.Apply()
+	return true
+}
+
+func (b *quantVectorBatch) Apply() {
+	b.sb.Apply()
+
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+
+	for id, qv := range b.w {
+		b.db.cache.Set(id, qv)
+		delete(b.db.meta, id)
+	}
+	clear(b.w)
+
+	for id := range b.d {
+		b.db.cache.Delete(id)
+		delete(b.db.meta, id)
+	}
+	clear(b.d)
+
+	for id, meta := range b.m {
+		b.db.meta[id] = meta
+	}
+	clear(b.m)
+}
+
+// A qvec is a quantized vector.
+type qvec struct {
+	n     int     // length of original vector
+	scale float32 // multiplier to recover original entries
+	i8    []int8  // for Int8: entries divided by scale
+	bits  []byte  // for Binary: sign bits, 1 for non-negative entries
+}
+
+// quantize returns the quantized form of vec.
+func quantize(q Quantization, vec llm.Vector) *qvec {
+	qv := &qvec{n: len(vec)}
+	switch q {
+	case Int8:
+		// Scale so that the largest entry maps to ±127.
+		m := float32(0)
+		for _, x := range vec {
+			m = max(m, float32(math.Abs(float64(x))))
+		}
+		if m == 0 {
+			m = 1
+		}
+		qv.scale = m / 127
+		qv.i8 = make([]int8, len(vec))
+		for i, x := range vec {
+			qv.i8[i] = int8(math.Round(float64(x / qv.scale)))
+		}
+	case Binary:
+		// Scale ±1 entries by the mean absolute entry,
+		// so that dot approximates the original dot product.
+		t := float64(0)
+		qv.bits = make([]byte, (len(vec)+7)/8)
+		for i, x := range vec {
+			t += math.Abs(float64(x))
+			if x >= 0 {
+				qv.bits[i/8] |= 1 << (i % 8)
+			}
+		}
+		if len(vec) > 0 {
+			qv.scale = float32(t / float64(len(vec)))
+		}
+	}
+	return qv
+}
+
+// A qquery is a search target prepared for computing
+// approximate dot products with quantized vectors.
+type qquery struct {
+	vec llm.Vector
+	sum float64        // for Binary: sum of vec entries
+	tab [][256]float64 // for Binary: tab[i][b] is the sum of vec[8*i+j] for bits j set in b
+}
+
+// newQuery returns a qquery for vec.
+func newQuery(q Quantization, vec llm.Vector) *qquery {
+	qq := &qquery{vec: vec}
+	if q == Binary {
+		qq.tab = make([][256]float64, (len(vec)+7)/8)
+		for i, x := range vec {
+			qq.sum += float64(x)
+			t := &qq.tab[i/8]
+			bit := 1 << (i % 8)
+			for b := range t {
+				if b&bit != 0 {
+					t[b] += float64(x)
+				}
+			}
+		}
+	}
+	return qq
+}
+
+// dot returns the approximate dot product of the original vector with
+// the query vector, which must have length qv.n.
+func (qv *qvec) dot(qq *qquery) float64 {
+	t := float64(0)
+	if qv.i8 != nil {
+		for i, x := range qv.i8 {
+			t += float64(qq.vec[i]) * float64(x)
+		}
+		return t * float64(qv.scale)
+	}
+	// Σ ±vec[i] = Σ_{bit set} vec[i] - Σ_{bit clear} vec[i] = 2 Σ_{bit set} vec[i] - Σ vec[i].
+	for i, b := range qv.bits {
+		t += qq.tab[i][b]
+	}
+	return (2*t - qq.sum) * float64(qv.scale)
+}
+
+// size returns the approximate number of bytes of memory used by qv.
+func (qv *qvec) size() int {
+	const overhead = 2*8 + 4 + 2*24 // n, scale, slice headers
+	return overhead + len(qv.i8) + len(qv.bits)
+}
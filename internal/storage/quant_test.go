@@ -0,0 +1,131 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestQuantizedVectorDB(t *testing.T) {
+	for _, q := range []Quantization{Int8, Binary} {
+		t.Run(q.String(), func(t *testing.T) {
+			db := MemDB()
+			TestVectorDB(t, func() VectorDB { return QuantizedVectorDB(db, testutil.Slogger(t), "", q) })
+			mdb := MemDB()
+			TestMetaVectorDB(t, func() MetaVectorDB { return QuantizedVectorDB(mdb, testutil.Slogger(t), "", q).(MetaVectorDB) })
+		})
+	}
+	if _, ok := QuantizedVectorDB(MemDB(), testutil.Slogger(t), "", Float32).(*memVectorDB); !ok {
+		t.Errorf("QuantizedVectorDB(Float32) is not a MemVectorDB")
+	}
+}
+
+func TestParseQuantization(t *testing.T) {
+	for _, q := range []Quantization{Float32, Int8, Binary} {
+		p, err := ParseQuantization(q.String())
+		if p != q || err != nil {
+			t.Errorf("ParseQuantization(%q) = %v, %v, want %v, nil", q.String(), p, err, q)
+		}
+	}
+	if _, err := ParseQuantization("int4"); err == nil {
+		t.Errorf("ParseQuantization(int4) succeeded, want error")
+	}
+}
+
+func TestQuantizedRecall(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping recall test in short mode")
+	}
+	for _, tt := range []struct {
+		q         Quantization
+		minRecall float64
+	}{
+		{Int8, 0.99},
+		// Random vectors are the worst case for binary quantization:
+		// real embeddings are clustered, so their nearest neighbors
+		// are much closer than the rest.
+		{Binary, 0.8},
+	} {
+		t.Run(tt.q.String(), func(t *testing.T) {
+			exact, approx, _ := quantTestDBs(testutil.Slogger(t), tt.q, 3000, 128)
+			if r := quantRecall(rand.New(rand.NewPCG(3, 4)), exact, approx, 128); r < tt.minRecall {
+				t.Errorf("recall = %.3f, want ≥ %.3f", r, tt.minRecall)
+			}
+		})
+	}
+}
+
+// quantTestDBs returns a MemVectorDB and a QuantizedVectorDB
+// holding the same nvec random vectors of length dim,
+// along with the approximate memory used per quantized vector.
+func quantTestDBs(lg *slog.Logger, q Quantization, nvec, dim int) (exact, approx VectorDB, size int) {
+	r := rand.New(rand.NewPCG(1, 2))
+	exact = MemVectorDB(MemDB(), lg, "")
+	db := MemDB()
+	b := QuantizedVectorDB(db, lg, "", q).Batch()
+	for i := range nvec {
+		id := fmt.Sprint("doc", i)
+		v := randVector(r, dim)
+		exact.Set(id, v)
+		b.Set(id, v)
+	}
+	b.Apply()
+
+	// Reopen to check that the quantized vectors are rebuilt.
+	approx = QuantizedVectorDB(db, lg, "", q)
+	if qdb, ok := approx.(*quantVectorDB); ok {
+		for _, qv := range qdb.cache.All() {
+			size += qv.size()
+		}
+	} else {
+		size = nvec * 4 * dim
+	}
+	return exact, approx, size / nvec
+}
+
+// quantRecall returns the average recall of approx's search results
+// compared to exact's, for random queries of length dim.
+func quantRecall(r *rand.Rand, exact, approx VectorDB, dim int) float64 {
+	const nquery = 100
+	total := 0.0
+	for range nquery {
+		q := randVector(r, dim)
+		total += recall(approx.Search(q, 10), exact.Search(q, 10))
+	}
+	return total / nquery
+}
+
+// BenchmarkQuantizedSearch compares the search time, recall, and memory
+// per vector (B/vec) of the quantizations, for vectors with
+// as many entries as the Gemini embeddings.
+func BenchmarkQuantizedSearch(b *testing.B) {
+	const (
+		nvec = 5000
+		dim  = 768
+	)
+	for _, q := range []Quantization{Float32, Int8, Binary} {
+		b.Run(q.String(), func(b *testing.B) {
+			exact, approx, size := quantTestDBs(slog.New(slog.DiscardHandler), q, nvec, dim)
+			r := rand.New(rand.NewPCG(3, 4))
+			rc := quantRecall(r, exact, approx, dim)
+			queries := make([]llm.Vector, 100)
+			for i := range queries {
+				queries[i] = randVector(r, dim)
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				approx.Search(queries[i%len(queries)], 10)
+			}
+			b.ReportMetric(rc, "recall")
+			b.ReportMetric(float64(size), "B/vec")
+		})
+	}
+}
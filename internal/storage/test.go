@@ -5,8 +5,11 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"slices"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -163,3 +166,252 @@ func TestDBLock(t *testing.T, db locker) {
 		t.Errorf("Unlock never-locked key did not panic")
 	})
 }
+
+// TestDBContextLock verifies that implementations of [ContextLocker]
+// conform to its specification.
+// Like [TestDBLock], it can't be used with a recorder/replayer.
+func TestDBContextLock(t *testing.T, db interface {
+	locker
+	ContextLocker
+}) {
+	if !db.TryLock("abc") {
+		t.Fatalf("TryLock(abc) = false, want true")
+	}
+	if db.TryLock("abc") {
+		t.Fatalf("TryLock(abc) while locked = true, want false")
+	}
+
+	// Locks may include locks held by other clients of a shared database,
+	// so only look for abc.
+	find := func(name string) (LockInfo, bool) {
+		for _, l := range db.Locks() {
+			if l.Name == name {
+				return l, true
+			}
+		}
+		return LockInfo{}, false
+	}
+	l, ok := find("abc")
+	if !ok || l.Holder == "" || l.Acquired.IsZero() {
+		t.Fatalf("Locks() = %+v, want lock abc with holder and time", db.Locks())
+	}
+	if !l.Expires.IsZero() && !l.Expires.After(l.Acquired) {
+		t.Errorf("Locks() Expires = %v, want after Acquired = %v", l.Expires, l.Acquired)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := db.LockContext(ctx, "abc"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LockContext(abc) while locked = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	c := make(chan error)
+	go func() {
+		c <- db.LockContext(context.Background(), "abc")
+	}()
+	select {
+	case err := <-c:
+		t.Fatalf("LockContext did not wait: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	db.Unlock("abc")
+	if err := <-c; err != nil {
+		t.Fatalf("LockContext(abc) after Unlock = %v", err)
+	}
+	db.Unlock("abc")
+
+	if _, ok := find("abc"); ok {
+		t.Fatalf("Locks() after Unlock = %+v, want no abc", db.Locks())
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := db.LockContext(ctx, "def"); err == nil {
+		// A canceled context may still acquire an available lock.
+		db.Unlock("def")
+	}
+	if !db.TryLock("def") {
+		t.Fatalf("TryLock(def) after canceled LockContext = false, want true")
+	}
+	db.Unlock("def")
+}
+
+// TestNotifier verifies that implementations of [Notifier]
+// conform to its specification.
+func TestNotifier(t *testing.T, db interface {
+	DB
+	Notifier
+}) {
+	sub := db.Subscribe(ordered.Encode("feed", "a"))
+	notified := func() bool {
+		select {
+		case <-sub.C:
+			return true
+		default:
+			return false
+		}
+	}
+	check := func(op string, want bool) {
+		t.Helper()
+		if have := notified(); have != want {
+			t.Fatalf("after %s: notified = %v, want %v", op, have, want)
+		}
+	}
+
+	check("Subscribe", false)
+	db.Set(ordered.Encode("feed", "a", 1), []byte("x"))
+	db.Set(ordered.Encode("feed", "a", 2), []byte("x"))
+	check("Set", true)
+	check("second receive", false)
+	db.Set(ordered.Encode("feed", "b", 1), []byte("x"))
+	check("Set of other prefix", false)
+	db.Delete(ordered.Encode("feed", "a", 1))
+	check("Delete", true)
+	db.DeleteRange(ordered.Encode("feed"), ordered.Encode("feed", ordered.Inf))
+	check("DeleteRange", true)
+	db.DeleteRange(ordered.Encode("feed", "b"), ordered.Encode("feed", "c"))
+	check("DeleteRange of other prefix", false)
+
+	b := db.Batch()
+	b.Set(ordered.Encode("feed", "a", 3), []byte("x"))
+	check("Batch.Set", false)
+	b.Apply()
+	check("Batch.Apply", true)
+
+	if tdb, ok := db.(TxDB); ok {
+		err := tdb.Transaction(func(tx Tx) error {
+			tx.Set(ordered.Encode("feed", "a", 4), []byte("x"))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("Transaction", true)
+	}
+
+	sub.Close()
+	db.Set(ordered.Encode("feed", "a", 5), []byte("x"))
+	check("Close", false)
+}
+
+// TestTxDB verifies that implementations of [TxDB]
+// conform to its specification.
+func TestTxDB(t *testing.T, db TxDB) {
+	testTx(t, db, db.Transaction)
+
+	// A transaction that always conflicts gives up.
+	key := ordered.Encode("tx", "conflict")
+	db.Set(key, []byte("0"))
+	n := 0
+	err := db.Transaction(func(tx Tx) error {
+		tx.Get(key)
+		n++
+		db.Set(key, []byte(strconv.Itoa(n)))
+		tx.Set(key, []byte("tx"))
+		return nil
+	})
+	if !errors.Is(err, ErrTxConflict) {
+		t.Errorf("Transaction with constant conflicts = %v, want ErrTxConflict", err)
+	}
+	if val, _ := db.Get(key); string(val) == "tx" {
+		t.Errorf("Transaction with constant conflicts committed")
+	}
+}
+
+// testTx runs the transaction tests on db using transaction.
+func testTx(t *testing.T, db DB, transaction func(func(Tx) error) error) {
+	key := func(s string) []byte { return ordered.Encode("tx", s) }
+	check := func(k, want string, wantOK bool) {
+		t.Helper()
+		val, ok := db.Get(key(k))
+		if string(val) != want || ok != wantOK {
+			t.Errorf("Get(%s) = %q, %v, want %q, %v", k, val, ok, want, wantOK)
+		}
+	}
+
+	db.Set(key("a"), []byte("1"))
+	db.Set(key("c"), []byte("3"))
+	err := transaction(func(tx Tx) error {
+		val, ok := tx.Get(key("a"))
+		if !ok {
+			return errors.New("missing a")
+		}
+		tx.Set(key("a"), append(val, '1'))
+		tx.Set(key("b"), []byte("2"))
+		tx.Delete(key("c"))
+		if val, ok := tx.Get(key("b")); string(val) != "2" || !ok {
+			return fmt.Errorf("Get(b) in transaction = %q, %v, want 2, true", val, ok)
+		}
+		if val, ok := tx.Get(key("c")); ok {
+			return fmt.Errorf("Get(c) in transaction = %q, true, want deleted", val)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("a", "11", true)
+	check("b", "2", true)
+	check("c", "", false)
+
+	// An error discards the writes.
+	errTest := errors.New("test error")
+	err = transaction(func(tx Tx) error {
+		tx.Set(key("a"), []byte("error"))
+		return errTest
+	})
+	if err != errTest {
+		t.Errorf("Transaction returning error = %v, want %v", err, errTest)
+	}
+	check("a", "11", true)
+
+	// A conflicting write causes a retry.
+	tries := 0
+	err = transaction(func(tx Tx) error {
+		tries++
+		val, _ := tx.Get(key("a"))
+		if tries == 1 {
+			db.Set(key("a"), []byte("x"))
+		}
+		tx.Set(key("a"), append(val, '!'))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.(TxDB); ok && tries != 2 {
+		t.Errorf("conflicting Transaction tried %d times, want 2", tries)
+	}
+
+	// Concurrent transactions do not lose updates.
+	db.Set(key("n"), []byte("0"))
+	var wg sync.WaitGroup
+	const N, M = 10, 20
+	for range N {
+		wg.Go(func() {
+			for range M {
+				err := transaction(func(tx Tx) error {
+					val, _ := tx.Get(key("n"))
+					n, err := strconv.Atoi(string(val))
+					if err != nil {
+						return err
+					}
+					tx.Set(key("n"), []byte(strconv.Itoa(n+1)))
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	check("n", strconv.Itoa(N*M), true)
+
+	testutil.StopPanic(func() {
+		transaction(func(tx Tx) error {
+			tx.Set(nil, []byte("x"))
+			return nil
+		})
+		t.Errorf("Transaction Set with empty key did not panic")
+	})
+}
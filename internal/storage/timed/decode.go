@@ -0,0 +1,43 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timed
+
+import (
+	"fmt"
+
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+// RegisterDecoder registers d with [storage.RegisterDecoder]
+// as the decoder for entries of the given kind.
+// The decoder is called with the key and value of a logical entry,
+// as passed to [Set], and its result is shown after the entry's DBTime.
+// If d is nil, the decoder shows only the DBTime,
+// for kinds whose values are always empty.
+func RegisterDecoder(kind string, d storage.Decoder) {
+	prefix := ordered.Encode(kind)
+	storage.RegisterDecoder(kind, func(key, val []byte) (string, error) {
+		var t int64
+		v, err := ordered.DecodePrefix(val, &t)
+		if err != nil {
+			return "", fmt.Errorf("timed %s: %v", kind, err)
+		}
+		if d == nil {
+			return fmt.Sprintf("DBTime(%d)", t), nil
+		}
+		s, err := d(key[len(prefix):], v)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("DBTime(%d)\n%s", t, s), nil
+	})
+}
+
+func init() {
+	storage.RegisterDecoder("timed.Watcher", func(_, val []byte) (string, error) {
+		return storage.DecodeJSON(val, new(registryEntry))
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timed
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+func TestRegisterDecoder(t *testing.T) {
+	db := storage.MemDB()
+	RegisterDecoder("test.Kind", func(key, val []byte) (string, error) {
+		return fmt.Sprintf("key %s val %s", storage.Fmt(key), val), nil
+	})
+	RegisterDecoder("test.Nil", nil)
+
+	b := db.Batch()
+	t1 := Set(db, b, "test.Kind", ordered.Encode("k"), []byte("v"))
+	t2 := Set(db, b, "test.Nil", ordered.Encode("k"), nil)
+	b.Apply()
+
+	for _, tc := range []struct {
+		kind string
+		want string
+	}{
+		{"test.Kind", fmt.Sprintf("DBTime(%d)\nkey (\"k\") val v", t1)},
+		{"test.Nil", fmt.Sprintf("DBTime(%d)", t2)},
+	} {
+		key := ordered.Encode(tc.kind, "k")
+		val, _ := db.Get(key)
+		if got := storage.Decode(key, val); got != tc.want {
+			t.Errorf("Decode(%s) = %q, want %q", storage.Fmt(key), got, tc.want)
+		}
+	}
+}
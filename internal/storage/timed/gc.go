@@ -0,0 +1,149 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timed
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+// A GCReport describes the result of a call to [GC].
+type GCReport struct {
+	Kind     string            // kind of entries examined
+	DryRun   bool              // stale entries were only counted, not deleted
+	Limit    DBTime            // index entries at or before Limit were examined
+	Watchers map[string]DBTime // times marked old by the kind's watchers, by watcher name
+	Scanned  int64             // number of index entries examined
+	Stale    int64             // number of stale index entries found (and deleted unless DryRun)
+}
+
+// GC removes stale time index entries of the given kind from db.
+// If dryRun is true, GC only counts the stale entries.
+//
+// [Set] deletes the previous time index entry for a key,
+// but it finds that entry by reading the database, not the batch.
+// So when a batch sets the same key more than once, or sets and
+// then deletes a key, the earlier time index entries are left behind,
+// as they are by importing an incremental snapshot.
+// [ScanAfter] skips these stale entries, but nothing else removes them,
+// so for kinds whose keys are often rewritten within a batch,
+// such as event streams, the time index grows without bound.
+//
+// GC only examines index entries at or before the minimum of before
+// and the times marked old by all the [Watcher]s of the kind that
+// have ever called [Watcher.MarkOld]. Because a stale entry can never become
+// current again, and because watchers never return stale entries,
+// GC is safe to run concurrently with watchers and with [Set].
+// The before limit guards against deleting the index entry of a [Set]
+// whose batch is still being applied (for example, by a large batch
+// using MaybeApply), which can look stale until the batch completes;
+// it should be at least a few minutes in the past.
+func GC(lg *slog.Logger, db storage.DB, kind string, before DBTime, dryRun bool) *GCReport {
+	r := &GCReport{
+		Kind:     kind,
+		DryRun:   dryRun,
+		Limit:    before,
+		Watchers: watchers(db, kind),
+	}
+	for _, t := range r.Watchers {
+		r.Limit = min(r.Limit, t)
+	}
+
+	b := db.Batch()
+	start := ordered.Encode(kind + "ByTime")
+	end := ordered.Encode(kind+"ByTime", int64(r.Limit), ordered.Inf)
+	for tkey := range db.Scan(start, end) {
+		r.Scanned++
+		var t int64
+		key, err := ordered.DecodePrefix(tkey, nil, &t) // drop kind
+		if err != nil {
+			// unreachable unless corrupt storage
+			db.Panic("timed.GC decode", "tkey", storage.Fmt(tkey), "err", err)
+		}
+		if !stale(db, kind, key, t) {
+			continue
+		}
+		r.Stale++
+		if !dryRun {
+			b.Delete(tkey)
+			b.MaybeApply()
+		}
+	}
+	b.Apply()
+	lg.Info("timed.GC", "kind", kind, "dryrun", dryRun, "limit", r.Limit, "scanned", r.Scanned, "stale", r.Stale)
+	return r
+}
+
+// stale reports whether the time index entry for key at time t
+// is stale, meaning that the entry for key is missing or
+// was set at a later time.
+func stale(db storage.DB, kind string, key []byte, t int64) bool {
+	dval, ok := db.Get(append(ordered.Encode(kind), key...))
+	if !ok {
+		return true
+	}
+	var t2 int64
+	if _, err := ordered.DecodePrefix(dval, &t2); err != nil {
+		// unreachable unless corrupt storage
+		db.Panic("timed.GC decode dval", "key", storage.Fmt(key), "dval", storage.Fmt(dval), "err", err)
+	}
+	return t < t2
+}
+
+// watchers returns the times marked old by the watchers of the given kind,
+// keyed by watcher name.
+func watchers(db storage.DB, kind string) map[string]DBTime {
+	m := make(map[string]DBTime)
+	for key, val := range db.Scan(ordered.Encode(kind+"Watcher"), ordered.Encode(kind+"Watcher", ordered.Inf)) {
+		var name string
+		var t int64
+		if err := ordered.Decode(key, nil, &name); err != nil {
+			// unreachable unless corrupt storage
+			db.Panic("timed.GC watcher decode", "key", storage.Fmt(key), "err", err)
+		}
+		if err := ordered.Decode(val(), &t); err != nil {
+			// unreachable unless corrupt storage
+			db.Panic("timed.GC watcher decode", "key", storage.Fmt(key), "err", err)
+		}
+		m[name] = DBTime(t)
+	}
+	return m
+}
+
+// Kinds returns the kinds of entries stored in db using [Set],
+// as identified by their time index entries.
+// Kinds skips from one key prefix to the next,
+// reading only one key for each distinct string
+// at the start of the keys in db.
+func Kinds(db storage.DB) []string {
+	var kinds []string
+	inf := ordered.Encode(ordered.Inf)
+	start := []byte{}
+	for {
+		var key []byte
+		for k := range db.Scan(start, inf) {
+			key = k
+			break
+		}
+		if key == nil || bytes.Equal(key, inf) {
+			break
+		}
+		var s string
+		if _, err := ordered.DecodePrefix(key, &s); err != nil {
+			// Not a string-prefixed key; move past it.
+			start = append(bytes.Clone(key), 0)
+			continue
+		}
+		if kind, ok := strings.CutSuffix(s, "ByTime"); ok {
+			kinds = append(kinds, kind)
+		}
+		start = ordered.Encode(s, ordered.Inf)
+	}
+	return kinds
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timed
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+	"rsc.io/ordered"
+)
+
+func TestGC(t *testing.T) {
+	db := storage.MemDB()
+	lg := testutil.Slogger(t)
+
+	// Setting a key twice in one batch, or setting and deleting
+	// an existing key in one batch, leaves stale time index entries.
+	b := db.Batch()
+	Set(db, b, "kind", []byte("k1"), []byte("v1"))
+	Set(db, b, "kind", []byte("k1"), []byte("v1b"))
+	Set(db, b, "kind", []byte("k2"), []byte("v2"))
+	b.Apply()
+	Set(db, b, "kind", []byte("k2"), []byte("v2b"))
+	Delete(db, b, "kind", []byte("k2"))
+	b.Apply()
+	Set(db, b, "kind", []byte("k3"), []byte("v3"))
+	b.Apply()
+	Set(db, b, "kind", []byte("k4"), []byte("v4"))
+	Set(db, b, "kind", []byte("k4"), []byte("v4b"))
+	b.Apply()
+	Set(db, b, "other", []byte("k1"), []byte("v1"))
+	Set(db, b, "other", []byte("k1"), []byte("v1b"))
+	b.Apply()
+
+	scan := func() []string {
+		var list []string
+		for e := range ScanAfter(lg, db, "kind", 0, nil) {
+			list = append(list, fmt.Sprintf("%s=%s", e.Key, e.Val))
+		}
+		return list
+	}
+	count := func(kind string) int {
+		n := 0
+		for range db.Scan(ordered.Encode(kind+"ByTime"), ordered.Encode(kind+"ByTime", ordered.Inf)) {
+			n++
+		}
+		return n
+	}
+	want := scan()
+	if n := count("kind"); n != 6 {
+		t.Fatalf("before GC: %d index entries, want 6", n)
+	}
+
+	// A watcher that has not moved past k4 protects its stale entry.
+	w := NewWatcher(lg, db, "w", "kind", func(e *Entry) *Entry { return e })
+	for e := range w.Recent() {
+		if string(e.Key) == "k3" {
+			w.MarkOld(e.ModTime)
+			break
+		}
+	}
+	wt := w.Latest()
+
+	r := GC(lg, db, "kind", math.MaxInt64, true)
+	wantReport := &GCReport{
+		Kind:     "kind",
+		DryRun:   true,
+		Limit:    wt,
+		Watchers: map[string]DBTime{"w": wt},
+		Scanned:  4,
+		Stale:    2,
+	}
+	if !reflect.DeepEqual(r, wantReport) {
+		t.Errorf("GC dry run = %+v, want %+v", r, wantReport)
+	}
+	if n := count("kind"); n != 6 {
+		t.Errorf("after dry run: %d index entries, want 6", n)
+	}
+
+	r = GC(lg, db, "kind", math.MaxInt64, false)
+	if r.Stale != 2 {
+		t.Errorf("GC: %d stale, want 2", r.Stale)
+	}
+	if n := count("kind"); n != 4 {
+		t.Errorf("after GC: %d index entries, want 4", n)
+	}
+
+	for e := range w.Recent() {
+		w.MarkOld(e.ModTime)
+	}
+	r = GC(lg, db, "kind", math.MaxInt64, false)
+	if r.Stale != 1 {
+		t.Errorf("GC after watcher: %d stale, want 1", r.Stale)
+	}
+	if n := count("kind"); n != 3 {
+		t.Errorf("after GC: %d index entries, want 3", n)
+	}
+	if have := scan(); !slices.Equal(have, want) {
+		t.Errorf("after GC: ScanAfter = %q, want %q", have, want)
+	}
+
+	// The before limit applies too.
+	if r := GC(lg, db, "other", 0, false); r.Scanned != 0 || r.Stale != 0 {
+		t.Errorf("GC(before=0) = %+v, want nothing scanned", r)
+	}
+	if n := count("other"); n != 2 {
+		t.Errorf("after GC(before=0): %d index entries, want 2", n)
+	}
+}
+
+func TestKinds(t *testing.T) {
+	db := storage.MemDB()
+	db.Set(ordered.Encode("plain"), nil)
+	db.Set(ordered.Encode(1, 2), nil)
+	db.Set([]byte("raw"), nil)
+	b := db.Batch()
+	for _, kind := range []string{"b", "a", "c"} {
+		for i := range 3 {
+			Set(db, b, kind, ordered.Encode(i), nil)
+		}
+	}
+	b.Apply()
+	if have, want := Kinds(db), []string{"a", "b", "c"}; !slices.Equal(have, want) {
+		t.Errorf("Kinds = %q, want %q", have, want)
+	}
+}
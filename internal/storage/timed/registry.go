@@ -0,0 +1,168 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timed
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"golang.org/x/oscar/internal/storage"
+	"rsc.io/ordered"
+)
+
+// A WatcherInfo describes a registered [Watcher].
+type WatcherInfo struct {
+	Kind    string    // kind of entries watched
+	Name    string    // watcher name
+	Latest  DBTime    // latest time marked old
+	LastRun time.Time // when the watcher last finished an iteration
+	Holder  string    // holder of the watcher's lock, if it is locked and the holder is known
+
+	// Pending is the number of entries of the kind set after Latest,
+	// and Newest is the time of the newest of those entries (0 if none).
+	// Pending may include a few stale time index entries (see [GC]),
+	// so it is an upper bound.
+	Pending int64
+	Newest  DBTime
+}
+
+// Lag returns how far the watcher is behind the newest entry of its kind,
+// or 0 if the watcher is up to date.
+func (w *WatcherInfo) Lag() time.Duration {
+	if w.Newest <= w.Latest {
+		return 0
+	}
+	return w.Newest.Time().Sub(w.Latest.Time())
+}
+
+// A registryEntry is the value stored in the watcher registry.
+type registryEntry struct {
+	LastRun time.Time
+}
+
+// register records w in the watcher registry.
+func (w *Watcher[T]) register() {
+	w.db.Set(ordered.Encode("timed.Watcher", w.kind, w.name), storage.JSON(&registryEntry{LastRun: time.Now()}))
+}
+
+// Watchers returns information about the watchers registered in db,
+// sorted by kind and then name.
+//
+// Each time a Watcher finishes an iteration over [Watcher.Recent],
+// it records the time in the database using the key
+// ordered.Encode("timed.Watcher", kind, name),
+// so Watchers lists the watchers used by all processes
+// sharing the database, once they have run.
+func Watchers(db storage.DB) []*WatcherInfo {
+	var list []*WatcherInfo
+	for key, val := range db.Scan(ordered.Encode("timed.Watcher"), ordered.Encode("timed.Watcher", ordered.Inf)) {
+		w := new(WatcherInfo)
+		if err := ordered.Decode(key, nil, &w.Kind, &w.Name); err != nil {
+			// unreachable unless corrupt storage
+			db.Panic("timed.Watchers decode", "key", storage.Fmt(key), "err", err)
+		}
+		var e registryEntry
+		if err := json.Unmarshal(val(), &e); err != nil {
+			// unreachable unless corrupt storage
+			db.Panic("timed.Watchers decode", "key", storage.Fmt(key), "err", err)
+		}
+		w.LastRun = e.LastRun
+		list = append(list, w)
+	}
+
+	var holders map[string]string
+	if cl, ok := db.(storage.ContextLocker); ok {
+		holders = make(map[string]string)
+		for _, l := range cl.Locks() {
+			holders[l.Name] = l.Holder
+		}
+	}
+
+	// Fill in the positions, and the pending entries for each kind.
+	for i := 0; i < len(list); {
+		kind := list[i].Kind
+		j := i
+		for j < len(list) && list[j].Kind == kind {
+			j++
+		}
+		ws := list[i:j]
+		i = j
+
+		positions := watchers(db, kind)
+		oldest := DBTime(-1)
+		for _, w := range ws {
+			w.Latest = positions[w.Name]
+			w.Holder = holders[string(ordered.Encode(kind+"Watcher", w.Name))]
+			if oldest < 0 || w.Latest < oldest {
+				oldest = w.Latest
+			}
+		}
+		times := indexTimes(db, kind, oldest)
+		for _, w := range ws {
+			k, _ := slices.BinarySearch(times, w.Latest+1)
+			w.Pending = int64(len(times) - k)
+			if w.Pending > 0 {
+				w.Newest = times[len(times)-1]
+			}
+		}
+	}
+	return list
+}
+
+// indexTimes returns the times of the time index entries
+// of the given kind set after t, in increasing order.
+func indexTimes(db storage.DB, kind string, t DBTime) []DBTime {
+	var times []DBTime
+	start, end := ordered.Encode(kind+"ByTime", int64(t+1)), ordered.Encode(kind+"ByTime", ordered.Inf)
+	for tkey := range db.Scan(start, end) {
+		var t int64
+		if _, err := ordered.DecodePrefix(tkey, nil, &t); err != nil {
+			// unreachable unless corrupt storage
+			db.Panic("timed.Watchers decode", "tkey", storage.Fmt(tkey), "err", err)
+		}
+		times = append(times, DBTime(t))
+	}
+	return times
+}
+
+// Reset sets the position of the watcher with the given kind and name,
+// so that its next iteration over [Watcher.Recent] starts
+// with the entries set after t.
+// Unlike [Watcher.MarkOld], Reset can move a watcher backward,
+// to reprocess entries, as well as forward, to skip them.
+// Resetting to 0 is the same as [Watcher.Restart].
+//
+// Reset acquires the watcher's database lock, so it waits for
+// any iteration in progress to finish.
+// A Watcher in another process may continue to report the old
+// position from [Watcher.Latest] until its next iteration.
+func Reset(db storage.DB, kind, name string, t DBTime) {
+	dkey := ordered.Encode(kind+"Watcher", name)
+	db.Lock(string(dkey))
+	defer db.Unlock(string(dkey))
+
+	if t <= 0 {
+		db.Delete(dkey)
+	} else {
+		db.Set(dkey, ordered.Encode(int64(t)))
+	}
+	db.Flush()
+}
+
+// Time returns the wall-clock time corresponding to t.
+// DBTimes are opaque, but they are derived from the clock
+// of the system that wrote the entry, so Time
+// is useful for displaying approximate times.
+func (t DBTime) Time() time.Time {
+	return time.Unix(0, int64(t))
+}
+
+// FromTime returns the DBTime corresponding to the wall-clock time tm.
+// Entries set after tm have DBTimes greater than FromTime(tm),
+// provided the system clocks are accurate.
+func FromTime(tm time.Time) DBTime {
+	return DBTime(tm.UnixNano())
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestWatchers(t *testing.T) {
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	b := db.Batch()
+	var times []DBTime
+	for i := range 5 {
+		times = append(times, Set(db, b, "kind", fmt.Appendf(nil, "k%d", i), nil))
+	}
+	Set(db, b, "other", []byte("k"), nil)
+	b.Apply()
+
+	decode := func(e *Entry) *Entry { return e }
+	w1 := NewWatcher(lg, db, "w1", "kind", decode)
+	w2 := NewWatcher(lg, db, "w2", "kind", decode)
+	NewWatcher(lg, db, "unused", "kind", decode)
+	w3 := NewWatcher(lg, db, "w3", "other", decode)
+
+	if list := Watchers(db); len(list) != 0 {
+		t.Fatalf("Watchers before any iteration = %v, want none", list)
+	}
+
+	start := time.Now()
+	for e := range w1.Recent() {
+		w1.MarkOld(e.ModTime)
+	}
+	for e := range w2.Recent() {
+		w2.MarkOld(e.ModTime)
+		if e.ModTime == times[1] {
+			break
+		}
+	}
+	for range w3.Recent() {
+		break
+	}
+
+	type info struct {
+		Kind, Name     string
+		Latest, Newest DBTime
+		Pending        int64
+		Lag            time.Duration
+	}
+	check := func(want ...info) {
+		t.Helper()
+		list := Watchers(db)
+		if len(list) != len(want) {
+			t.Fatalf("Watchers() = %d watchers, want %d", len(list), len(want))
+		}
+		for i, w := range list {
+			have := info{w.Kind, w.Name, w.Latest, w.Newest, w.Pending, w.Lag()}
+			if have != want[i] {
+				t.Errorf("Watchers()[%d] = %+v, want %+v", i, have, want[i])
+			}
+			if w.LastRun.Before(start) {
+				t.Errorf("Watchers()[%d].LastRun = %v, want after %v", i, w.LastRun, start)
+			}
+		}
+	}
+	lag := func(from, to DBTime) time.Duration { return time.Duration(to - from) }
+	check(
+		info{"kind", "w1", times[4], 0, 0, 0},
+		info{"kind", "w2", times[1], times[4], 3, lag(times[1], times[4])},
+		info{"other", "w3", 0, w3Newest(db), 1, lag(0, w3Newest(db))},
+	)
+
+	Reset(db, "kind", "w1", times[2])
+	Reset(db, "kind", "w2", 0)
+	check(
+		info{"kind", "w1", times[2], times[4], 2, lag(times[2], times[4])},
+		info{"kind", "w2", 0, times[4], 5, lag(0, times[4])},
+		info{"other", "w3", 0, w3Newest(db), 1, lag(0, w3Newest(db))},
+	)
+
+	var keys []string
+	for e := range w1.Recent() {
+		keys = append(keys, string(e.Key))
+	}
+	if fmt.Sprint(keys) != "[k3 k4]" {
+		t.Errorf("after Reset, Recent = %v, want [k3 k4]", keys)
+	}
+	if l := w1.Latest(); l != times[2] {
+		t.Errorf("after Reset, Latest = %v, want %v", l, times[2])
+	}
+}
+
+func w3Newest(db storage.DB) DBTime {
+	e, _ := Get(db, "other", []byte("k"))
+	return e.ModTime
+}
+
+func TestFromTime(t *testing.T) {
+	tm := time.Now()
+	if d := FromTime(tm); !d.Time().Equal(tm) {
+		t.Errorf("FromTime(%v).Time() = %v", tm, d.Time())
+	}
+}
@@ -252,6 +252,15 @@ func ScanAfter(lg *slog.Logger, db storage.DB, kind string, t DBTime, filter fun
 	}
 }
 
+// Subscribe returns a subscription to changes to entries of the given kind in db,
+// as described in [storage.Subscribe].
+// The subscription is notified when entries are set or deleted
+// using [Set], [Delete], or [DeleteRange].
+// After a notification, [ScanAfter] or a [Watcher] returns the new entries.
+func Subscribe(db storage.DB, kind string) *storage.Subscription {
+	return storage.Subscribe(db, ordered.Encode(kind+"ByTime"))
+}
+
 // A Watcher is a named cursor over recently modified time-stamped key-value pairs
 // (written using [Set]).
 // The state of the cursor is stored in the underlying database so that
@@ -269,11 +278,14 @@ func ScanAfter(lg *slog.Logger, db storage.DB, kind string, t DBTime, filter fun
 // ordered.Encode(kind+"Watcher", name),
 // and while a Watcher is iterating, it locks a database lock
 // with the same name as that key.
+// Use [Watchers] to list the Watchers using a database
+// and [Reset] to change a Watcher's position.
 type Watcher[T any] struct {
 	slog   *slog.Logger
 	db     storage.DB
 	dkey   []byte
 	kind   string
+	name   string
 	decode func(*Entry) T
 	locked atomic.Bool
 	latest atomic.Int64 // highest known DBTime marked old, for fast retrieval by metrics
@@ -293,6 +305,7 @@ func NewWatcher[T any](lg *slog.Logger, db storage.DB, name, kind string, decode
 		db:     db,
 		dkey:   ordered.Encode(kind+"Watcher", name),
 		kind:   kind,
+		name:   name,
 		decode: decode,
 	}
 	// Set w.latest to current DB value.
@@ -321,7 +334,11 @@ func (w *Watcher[T]) cutoff() DBTime {
 		// unreachable unless called wrong in this file
 		w.db.Panic("timed.Watcher not locked")
 	}
-	return w.cutoffUnlocked()
+	t := w.cutoffUnlocked()
+	// With the lock held, the database value is authoritative,
+	// even if it has moved backward (see [Reset]).
+	w.latest.Store(int64(t))
+	return t
 }
 
 // cutoffUnlocked returns the value of the watcher key in the DB.
@@ -367,6 +384,7 @@ func (w *Watcher[T]) RecentFiltered(filter func(key []byte) bool) iter.Seq[T] {
 	return func(yield func(T) bool) {
 		w.lock()
 		defer func() {
+			w.register()
 			w.Flush()
 			w.unlock()
 		}()
@@ -379,6 +397,12 @@ func (w *Watcher[T]) RecentFiltered(filter func(key []byte) bool) iter.Seq[T] {
 	}
 }
 
+// Subscribe returns a subscription to changes to the entries
+// the Watcher iterates over. See the top-level [Subscribe] function.
+func (w *Watcher[T]) Subscribe() *storage.Subscription {
+	return Subscribe(w.db, w.kind)
+}
+
 // Restart resets the event watcher so that the next iteration over new events
 // will start at the earliest possible event.
 // In effect, Restart undoes all previous calls to MarkOld.
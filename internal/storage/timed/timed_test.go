@@ -338,3 +338,47 @@ func TestNow(t *testing.T) {
 		t1 = t2
 	}
 }
+
+func TestSubscribe(t *testing.T) {
+	db := storage.MemDB()
+	lg := testutil.Slogger(t)
+	w := NewWatcher(lg, db, "name", "kind", func(e *Entry) *Entry { return e })
+	sub := w.Subscribe()
+	defer sub.Close()
+	notified := func() bool {
+		select {
+		case <-sub.C:
+			return true
+		default:
+			return false
+		}
+	}
+
+	b := db.Batch()
+	Set(db, b, "kind2", []byte("key"), []byte("val"))
+	b.Apply()
+	if notified() {
+		t.Fatalf("notified after Set of other kind")
+	}
+
+	Set(db, b, "kind", []byte("key"), []byte("val"))
+	if notified() {
+		t.Fatalf("notified before Apply")
+	}
+	b.Apply()
+	if !notified() {
+		t.Fatalf("not notified after Set")
+	}
+	for e := range w.Recent() {
+		w.MarkOld(e.ModTime)
+	}
+	if notified() {
+		t.Fatalf("notified after MarkOld")
+	}
+
+	Delete(db, b, "kind", []byte("key"))
+	b.Apply()
+	if !notified() {
+		t.Fatalf("not notified after Delete")
+	}
+}
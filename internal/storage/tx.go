@@ -0,0 +1,209 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+)
+
+// A Tx is an optimistic read-modify-write transaction on a [DB].
+//
+// Get reads from the database and records the key in the
+// transaction's read set; Set and Delete buffer writes.
+// When the transaction commits, the buffered writes are applied
+// atomically, but only if no key in the read set has changed
+// since it was read. Otherwise the transaction is retried.
+// (See [TxDB.Transaction].)
+//
+// Reads observe the transaction's own buffered writes,
+// and repeated reads of a key return the same value.
+type Tx interface {
+	// Get looks up the value associated with key,
+	// adding key to the transaction's read set.
+	Get(key []byte) (val []byte, ok bool)
+
+	// Set sets the value associated with key to val
+	// when the transaction commits.
+	Set(key, val []byte)
+
+	// Delete deletes any value associated with key
+	// when the transaction commits.
+	Delete(key []byte)
+}
+
+// A TxDB is a [DB] that supports optimistic transactions.
+type TxDB interface {
+	DB
+
+	// Transaction calls f with a new transaction and then tries to commit it.
+	// If another client has changed a key that f read, the commit fails,
+	// the transaction's writes are discarded, and Transaction
+	// calls f again with a new transaction.
+	// Because f may be called many times, it must not have effects
+	// other than through tx.
+	//
+	// If f returns an error, Transaction discards the transaction's writes
+	// and returns that error. If the transaction does not commit after
+	// many retries, Transaction returns an error wrapping [ErrTxConflict].
+	// Otherwise Transaction returns nil.
+	//
+	// A transaction only detects changes made by Set, Delete,
+	// DeleteRange, and Batch.Apply, and by other transactions.
+	// It does not take or respect any locks held using Lock.
+	Transaction(f func(tx Tx) error) error
+}
+
+// ErrTxConflict is the error (wrapped) returned by [TxDB.Transaction]
+// when the transaction could not be committed due to repeated conflicts.
+var ErrTxConflict = errors.New("transaction conflict")
+
+// maxTxAttempts is the number of times a transaction is tried
+// before giving up with [ErrTxConflict].
+const maxTxAttempts = 100
+
+// Transaction calls f in a transaction on db, as described in [TxDB.Transaction].
+// If db does not implement [TxDB], Transaction emulates it by holding
+// a lock named "storage.Transaction" while calling f and applying its
+// writes in a single [Batch]. In that case, transactions are serialized
+// with respect to each other but not with respect to other writes to db.
+func Transaction(db DB, f func(tx Tx) error) error {
+	if tdb, ok := db.(TxDB); ok {
+		return tdb.Transaction(f)
+	}
+
+	const lockName = "storage.Transaction"
+	db.Lock(lockName)
+	defer db.Unlock(lockName)
+
+	t := NewTxLog(db.Get)
+	if err := f(t); err != nil {
+		return err
+	}
+	b := db.Batch()
+	t.Apply(b)
+	b.Apply()
+	return nil
+}
+
+// RunTx implements the retry loop for [TxDB.Transaction].
+// It repeatedly calls f with a new [TxLog] reading from get
+// and then calls commit, until either f returns an error or
+// commit reports that it committed the transaction.
+// Commit should validate the transaction using [TxLog.Valid]
+// and apply its writes atomically.
+//
+// RunTx is intended for use by implementations of TxDB.
+func RunTx(get func(key []byte) ([]byte, bool), f func(tx Tx) error, commit func(t *TxLog) bool) error {
+	for range maxTxAttempts {
+		t := NewTxLog(get)
+		if err := f(t); err != nil {
+			return err
+		}
+		if commit(t) {
+			return nil
+		}
+	}
+	return fmt.Errorf("storage.Transaction: %w after %d attempts", ErrTxConflict, maxTxAttempts)
+}
+
+// A TxLog is a [Tx] that records the values it reads
+// and buffers the writes, for committing later.
+//
+// TxLog is intended for use by implementations of [TxDB].
+type TxLog struct {
+	get    func(key []byte) ([]byte, bool)
+	reads  map[string]txVal
+	writes map[string]txVal
+}
+
+// A txVal is a value read or written by a transaction.
+type txVal struct {
+	val []byte
+	ok  bool // false for a missing key or a deletion
+}
+
+// NewTxLog returns a new TxLog that reads using get.
+func NewTxLog(get func(key []byte) ([]byte, bool)) *TxLog {
+	return &TxLog{
+		get:    get,
+		reads:  make(map[string]txVal),
+		writes: make(map[string]txVal),
+	}
+}
+
+// Get implements [Tx.Get].
+func (t *TxLog) Get(key []byte) ([]byte, bool) {
+	if w, ok := t.writes[string(key)]; ok {
+		return bytes.Clone(w.val), w.ok
+	}
+	r, ok := t.reads[string(key)]
+	if !ok {
+		r.val, r.ok = t.get(key)
+		r.val = bytes.Clone(r.val)
+		t.reads[string(key)] = r
+	}
+	return bytes.Clone(r.val), r.ok
+}
+
+// Set implements [Tx.Set].
+func (t *TxLog) Set(key, val []byte) {
+	if len(key) == 0 {
+		Panic("storage transaction set: empty key")
+	}
+	t.writes[string(key)] = txVal{bytes.Clone(val), true}
+}
+
+// Delete implements [Tx.Delete].
+func (t *TxLog) Delete(key []byte) {
+	t.writes[string(key)] = txVal{nil, false}
+}
+
+// Valid reports whether every key read by the transaction
+// still has the value it had when read, according to get.
+// The caller must ensure that the values returned by get
+// cannot change until the writes have been applied.
+func (t *TxLog) Valid(get func(key []byte) ([]byte, bool)) bool {
+	for key, r := range t.reads {
+		val, ok := get([]byte(key))
+		if ok != r.ok || !bytes.Equal(val, r.val) {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes returns an iterator over the transaction's writes,
+// in key order. The value is nil for a deletion
+// and non-nil (but possibly empty) for a set.
+func (t *TxLog) Writes() iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		for _, key := range slices.Sorted(maps.Keys(t.writes)) {
+			w := t.writes[key]
+			val := w.val
+			if w.ok && val == nil {
+				val = []byte{}
+			}
+			if !yield([]byte(key), val) {
+				return
+			}
+		}
+	}
+}
+
+// Apply adds the transaction's writes to b.
+func (t *TxLog) Apply(b Batch) {
+	for key, val := range t.Writes() {
+		if val == nil {
+			b.Delete(key)
+		} else {
+			b.Set(key, val)
+		}
+	}
+}
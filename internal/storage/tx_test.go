@@ -0,0 +1,27 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"testing"
+)
+
+func TestMemTxDB(t *testing.T) {
+	TestTxDB(t, MemDB().(TxDB))
+}
+
+func TestOverlayTxDB(t *testing.T) {
+	TestTxDB(t, NewOverlayDB(MemDB(), MemDB()).(TxDB))
+}
+
+func TestTransactionLocked(t *testing.T) {
+	// maybeDB does not implement TxDB,
+	// so Transaction must fall back to using a lock.
+	db := &maybeDB{DB: MemDB()}
+	if _, ok := DB(db).(TxDB); ok {
+		t.Fatal("maybeDB implements TxDB")
+	}
+	testTx(t, db, func(f func(Tx) error) error { return Transaction(db, f) })
+}
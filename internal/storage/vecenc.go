@@ -0,0 +1,169 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+
+	"golang.org/x/oscar/internal/llm"
+)
+
+// Vectors are stored in a [DB] in one of two encodings:
+//
+//   - the full encoding, produced by [llm.Vector.Encode],
+//     which stores each entry as a big-endian float32 (4 bytes);
+//   - the half encoding, produced by [EncodeHalfVector],
+//     which is a single halfTag byte followed by each entry
+//     as a big-endian IEEE 754 half-precision float (2 bytes).
+//
+// The full encoding always has a length that is a multiple of 4,
+// while the half encoding always has an odd length,
+// so the two can be told apart without any other information.
+
+// halfTag is the first byte of the half encoding.
+const halfTag = 'h'
+
+// EncodeHalfVector returns the half-precision encoding of vec,
+// which takes half the space of [llm.Vector.Encode].
+// Entries are rounded to the nearest half-precision value,
+// which keeps about 3 significant decimal digits
+// for entries with magnitude between 6e-5 and 65504.
+// Use [DecodeVector] to decode it.
+func EncodeHalfVector(vec llm.Vector) []byte {
+	enc := make([]byte, 1+2*len(vec))
+	enc[0] = halfTag
+	for i, f := range vec {
+		binary.BigEndian.PutUint16(enc[1+2*i:], toHalf(f))
+	}
+	return enc
+}
+
+// DecodeVector decodes a vector stored in either
+// the full encoding or the half encoding.
+func DecodeVector(enc []byte) (llm.Vector, error) {
+	if isHalf(enc) {
+		vec := make(llm.Vector, len(enc)/2)
+		tab := halfTable()
+		for i := range vec {
+			vec[i] = tab[binary.BigEndian.Uint16(enc[1+2*i:])]
+		}
+		return vec, nil
+	}
+	if len(enc)%4 != 0 {
+		return nil, fmt.Errorf("bad vector encoding length %d", len(enc))
+	}
+	var vec llm.Vector
+	vec.Decode(enc)
+	return vec, nil
+}
+
+// EncodedVectorLen returns the number of entries in the vector
+// stored in either encoding in enc, or -1 if enc is not a valid encoding.
+func EncodedVectorLen(enc []byte) int {
+	if isHalf(enc) {
+		return len(enc) / 2
+	}
+	if len(enc)%4 != 0 {
+		return -1
+	}
+	return len(enc) / 4
+}
+
+// DotEncoded returns the dot product of vec with the vector
+// stored in either encoding in enc, without decoding enc.
+// It assumes EncodedVectorLen(enc) == len(vec).
+func DotEncoded(vec llm.Vector, enc []byte) float64 {
+	t := float64(0)
+	if isHalf(enc) {
+		tab := halfTable()
+		enc = enc[1 : 1+2*len(vec)]
+		for i, f := range vec {
+			t += float64(f) * float64(tab[binary.BigEndian.Uint16(enc[2*i:])])
+		}
+		return t
+	}
+	enc = enc[:4*len(vec)]
+	for i, f := range vec {
+		t += float64(f) * float64(math.Float32frombits(binary.BigEndian.Uint32(enc[4*i:])))
+	}
+	return t
+}
+
+// isHalf reports whether enc is in the half encoding.
+func isHalf(enc []byte) bool {
+	return len(enc)%2 == 1 && enc[0] == halfTag
+}
+
+// halfTable returns a table mapping each half-precision value
+// to the equivalent float32.
+var halfTable = sync.OnceValue(func() *[1 << 16]float32 {
+	tab := new([1 << 16]float32)
+	for h := range tab {
+		tab[h] = fromHalf(uint16(h))
+	}
+	return tab
+})
+
+// toHalf returns the half-precision value nearest to f,
+// rounding ties to even.
+func toHalf(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	switch {
+	case b>>23&0xff == 0xff:
+		// Inf or NaN.
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f:
+		// Too large: round to Inf.
+		return sign | 0x7c00
+	case exp <= 0:
+		// Subnormal or zero.
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		return sign | uint16(roundShift(mant, shift))
+	}
+	// Rounding may carry into the exponent, which is correct,
+	// including when it produces Inf.
+	return sign | uint16(roundShift(uint32(exp)<<23|mant, 13))
+}
+
+// roundShift returns x>>shift, rounded to the nearest integer, ties to even.
+func roundShift(x uint32, shift uint) uint32 {
+	r := x >> shift
+	rem := x & (1<<shift - 1)
+	half := uint32(1) << (shift - 1)
+	if rem > half || rem == half && r&1 == 1 {
+		r++
+	}
+	return r
+}
+
+// fromHalf returns the float32 equal to the half-precision value h.
+func fromHalf(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch exp {
+	case 0:
+		// Subnormal or zero: mant × 2⁻²⁴, exactly.
+		f := float32(mant) / (1 << 24)
+		return math.Float32frombits(sign | math.Float32bits(f))
+	case 0x1f:
+		// Inf or NaN.
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+}
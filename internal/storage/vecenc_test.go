@@ -0,0 +1,98 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oscar/internal/llm"
+)
+
+func TestHalf(t *testing.T) {
+	// Every half-precision value round-trips.
+	for h := range 1 << 16 {
+		f := fromHalf(uint16(h))
+		if f != f {
+			continue // NaN
+		}
+		if back := toHalf(f); back != uint16(h) {
+			t.Fatalf("toHalf(fromHalf(%#04x)=%v) = %#04x", h, f, back)
+		}
+	}
+
+	for _, tt := range []struct {
+		f float32
+		h uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{65504, 0x7bff},                       // largest finite
+		{65519, 0x7bff},                       // rounds down to largest finite
+		{65520, 0x7c00},                       // rounds up to Inf
+		{float32(math.Inf(-1)), 0xfc00},       // -Inf
+		{0x1p-24, 0x0001},                     // smallest subnormal
+		{0x1p-25, 0x0000},                     // tie, rounds to even (zero)
+		{0x1.8p-25, 0x0001},                   // above tie, rounds up
+		{0x1p-14, 0x0400},                     // smallest normal
+		{1 + 0x1p-11, 0x3c00},                 // tie, rounds to even
+		{1 + 0x3p-11, 0x3c02},                 // tie, rounds to even
+		{1 + 0x1p-11 + 0x1p-20, 0x3c01},       // above tie, rounds up
+		{0x1.ffcp-15, 0x0400},                 // subnormal rounds up to smallest normal
+		{float32(math.NaN()), 0x7e00},         // NaN
+		{float32(-math.NaN()), 0xfe00},        // -NaN
+		{1e-10, 0x0000},                       // underflow
+		{-1e10, 0xfc00},                       // overflow
+		{0.333251953125, 0x3555},              // exact
+		{0.1, 0x2e66},                         // rounded
+		{float32(math.Float32frombits(1)), 0}, // float32 subnormal
+	} {
+		if h := toHalf(tt.f); h != tt.h {
+			t.Errorf("toHalf(%v) = %#04x, want %#04x", tt.f, h, tt.h)
+		}
+	}
+}
+
+func TestVectorEncoding(t *testing.T) {
+	vec := llm.Vector{1, -0.5, 0.1, 3}
+	for _, enc := range [][]byte{vec.Encode(), EncodeHalfVector(vec)} {
+		if n := EncodedVectorLen(enc); n != len(vec) {
+			t.Errorf("EncodedVectorLen(%x) = %d, want %d", enc, n, len(vec))
+		}
+		dec, err := DecodeVector(enc)
+		if err != nil {
+			t.Fatalf("DecodeVector(%x): %v", enc, err)
+		}
+		for i := range vec {
+			if math.Abs(float64(dec[i]-vec[i])) > 1e-3 {
+				t.Errorf("DecodeVector(%x) = %v, want %v", enc, dec, vec)
+				break
+			}
+		}
+		target := llm.Vector{1, 2, 3, 4}
+		if d, want := DotEncoded(target, enc), target.Dot(dec); d != want {
+			t.Errorf("DotEncoded(%v, %x) = %v, want %v", target, enc, d, want)
+		}
+	}
+	if len(EncodeHalfVector(vec)) != 1+2*len(vec) {
+		t.Errorf("len(EncodeHalfVector) = %d, want %d", len(EncodeHalfVector(vec)), 1+2*len(vec))
+	}
+	dec, err := DecodeVector(EncodeHalfVector(vec))
+	if want := (llm.Vector{1, -0.5, 0.099975586, 3}); err != nil || !reflect.DeepEqual(dec, want) {
+		t.Errorf("DecodeVector(EncodeHalfVector(%v)) = %v, %v, want %v", vec, dec, err, want)
+	}
+
+	for _, bad := range []string{"abc", "x", "h1"} {
+		if _, err := DecodeVector([]byte(bad)); err == nil {
+			t.Errorf("DecodeVector(%q) succeeded, want error", bad)
+		}
+		if n := EncodedVectorLen([]byte(bad)); n != -1 {
+			t.Errorf("EncodedVectorLen(%q) = %d, want -1", bad, n)
+		}
+	}
+}
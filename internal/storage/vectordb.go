@@ -7,6 +7,8 @@ package storage
 import (
 	"cmp"
 	"iter"
+	"slices"
+	"time"
 
 	"golang.org/x/oscar/internal/llm"
 )
@@ -101,3 +103,86 @@ func (x VectorResult) cmp(y VectorResult) int {
 	}
 	return cmp.Compare(x.ID, y.ID)
 }
+
+// VectorMeta is metadata about the document corresponding to a stored vector,
+// used to restrict a search with a [VectorFilter].
+type VectorMeta struct {
+	Kind    string    // kind of document: issue, doc page, etc.
+	Project string    // project the document belongs to, such as "golang/go"
+	Created time.Time // time the document was created
+	State   string    // document state, such as "open" or "closed"
+}
+
+// A VectorFilter restricts a [MetaVectorDB.SearchFilter] to vectors
+// whose [VectorMeta] match. The zero value matches all vectors.
+// A vector with no metadata is treated as having the zero VectorMeta.
+type VectorFilter struct {
+	Kinds         []string  // if non-empty, only vectors with one of these kinds
+	DenyKinds     []string  // exclude vectors with these kinds
+	Project       string    // if non-empty, only vectors in this project
+	State         string    // if non-empty, only vectors in this state
+	CreatedAfter  time.Time // if non-zero, only vectors created after this time
+	CreatedBefore time.Time // if non-zero, only vectors created before this time
+}
+
+// IsZero reports whether f is the zero VectorFilter, which matches all vectors.
+func (f *VectorFilter) IsZero() bool {
+	return f == nil || len(f.Kinds) == 0 && len(f.DenyKinds) == 0 &&
+		f.Project == "" && f.State == "" &&
+		f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero()
+}
+
+// Match reports whether the metadata m matches the filter f.
+// A nil m is treated as the zero VectorMeta.
+func (f *VectorFilter) Match(m *VectorMeta) bool {
+	if f == nil {
+		return true
+	}
+	if m == nil {
+		m = new(VectorMeta)
+	}
+	switch {
+	case len(f.Kinds) > 0 && !slices.Contains(f.Kinds, m.Kind),
+		slices.Contains(f.DenyKinds, m.Kind),
+		f.Project != "" && m.Project != f.Project,
+		f.State != "" && m.State != f.State,
+		!f.CreatedAfter.IsZero() && !m.Created.After(f.CreatedAfter),
+		!f.CreatedBefore.IsZero() && !m.Created.Before(f.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+// A MetaVectorDB is a [VectorDB] that can also store metadata for each vector
+// and apply a [VectorFilter] to that metadata during a search.
+//
+// Metadata belongs to the vector: [VectorDB.Set] and [VectorDB.Delete]
+// (and the corresponding [VectorBatch] operations) remove any metadata
+// for the ID, so callers that replace a vector must set its metadata again.
+type MetaVectorDB interface {
+	VectorDB
+
+	// SetMeta sets the metadata for the vector with the given ID,
+	// which should already be stored.
+	SetMeta(id string, meta *VectorMeta)
+
+	// Meta returns the metadata for the vector with the given ID.
+	// If there is no metadata, Meta returns nil, false.
+	Meta(id string) (*VectorMeta, bool)
+
+	// SearchFilter is like [VectorDB.Search] but only considers vectors
+	// whose metadata match f. Because the filter is applied during the search,
+	// SearchFilter returns the n most similar matching vectors,
+	// even when most vectors do not match.
+	SearchFilter(vec llm.Vector, n int, f *VectorFilter) []VectorResult
+}
+
+// A MetaVectorBatch is a [VectorBatch] for a [MetaVectorDB],
+// which can also set metadata as part of the batch.
+type MetaVectorBatch interface {
+	VectorBatch
+
+	// SetMeta sets the metadata for the vector with the given ID.
+	// It must follow any Set of the same ID in the batch.
+	SetMeta(id string, meta *VectorMeta)
+}
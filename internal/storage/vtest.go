@@ -5,10 +5,12 @@
 package storage
 
 import (
+	"fmt"
 	"math"
 	"reflect"
 	"slices"
 	"testing"
+	"time"
 
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/testutil"
@@ -103,6 +105,76 @@ func TestVectorDB(t *testing.T, opendb func() VectorDB) {
 	}
 }
 
+// TestMetaVectorDB verifies that implementations of [MetaVectorDB]
+// conform to its specification.
+// The opendb function should create a new connection to the same underlying storage.
+func TestMetaVectorDB(t *testing.T, opendb func() MetaVectorDB) {
+	vdb := opendb()
+
+	// Only a few of many similar vectors match the filter:
+	// SearchFilter must still return all of them.
+	var ids []string
+	b := vdb.Batch().(MetaVectorBatch)
+	for i := range 200 {
+		id := fmt.Sprintf("apple%03d", i)
+		b.Set(id, embed(id))
+		meta := &VectorMeta{Kind: "doc", Project: "golang/go", State: "open"}
+		if i%50 == 7 {
+			meta.Kind = "issue"
+			ids = append(ids, id)
+		}
+		meta.Created = time.Date(2024, 1, 1+i%28, 0, 0, 0, 0, time.UTC)
+		b.SetMeta(id, meta)
+	}
+	b.Apply()
+
+	f := &VectorFilter{Kinds: []string{"issue"}}
+	check := func(name string, vdb MetaVectorDB, f *VectorFilter, want []string) {
+		t.Helper()
+		var have []string
+		for _, r := range vdb.SearchFilter(embed("apple"), 10, f) {
+			have = append(have, r.ID)
+		}
+		slices.Sort(have)
+		if !slices.Equal(have, want) {
+			t.Errorf("%s: SearchFilter(apple, 10, %+v) = %v, want %v", name, *f, have, want)
+		}
+	}
+	check("batch", vdb, f, ids)
+	check("deny", vdb, &VectorFilter{DenyKinds: []string{"doc"}, Project: "golang/go"}, ids)
+	check("project", vdb, &VectorFilter{Kinds: []string{"issue"}, Project: "golang/tools"}, nil)
+	check("created", vdb, &VectorFilter{
+		Kinds:         []string{"issue"},
+		CreatedAfter:  time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2024, 1, 25, 0, 0, 0, 0, time.UTC),
+	}, []string{"apple107", "apple157"})
+
+	if have := vdb.SearchFilter(embed("apple"), 3, nil); !reflect.DeepEqual(have, vdb.Search(embed("apple"), 3)) {
+		t.Errorf("SearchFilter(nil) = %v, want %v", have, vdb.Search(embed("apple"), 3))
+	}
+
+	meta, ok := vdb.Meta("apple007")
+	if !ok || meta.Kind != "issue" || meta.Project != "golang/go" {
+		t.Errorf("Meta(apple007) = %+v, %v, want issue in golang/go", meta, ok)
+	}
+
+	// Set and Delete remove the metadata.
+	vdb.Set("apple007", embed("apple007"))
+	vdb.Delete("apple057")
+	for _, id := range []string{"apple007", "apple057"} {
+		if meta, ok := vdb.Meta(id); ok {
+			t.Errorf("Meta(%s) = %+v, true after Set/Delete, want nil, false", id, meta)
+		}
+	}
+	vdb.SetMeta("apple008", &VectorMeta{Kind: "issue"})
+	ids = []string{"apple008", "apple107", "apple157"}
+	check("set", vdb, f, ids)
+
+	vdb.Flush()
+	vdb = opendb()
+	check("reopen", vdb, f, ids)
+}
+
 func allIDs(vdb VectorDB) []string {
 	var all []string
 	for k := range vdb.All() {
@@ -30,7 +30,9 @@ Usage:
 The databases src and dst can be specified using one of these forms:
 
 	pebble:DIR[:VECNAMESPACE]
-	   A Pebble database in the directory DIR
+	   A Pebble database in the directory DIR.
+	   With -vec, the vectors are read and written directly on disk
+	   using a [pebble.VectorDB], without loading them into memory.
 
 	firestore:PROJECT,DATABASE[:VECNAMESPACE]
 	   A Firestore DB in the given GCP project and Firestore database.
@@ -137,11 +139,7 @@ func openVecDB(spec string) (storage.VectorDB, error) {
 
 	switch kind {
 	case "pebble":
-		db, err := pebble.Open(slog.Default(), dbInfo)
-		if err != nil {
-			return nil, err
-		}
-		return storage.MemVectorDB(db, slog.Default(), namespace), nil
+		return pebble.OpenVectorDB(slog.Default(), dbInfo, namespace)
 	case "firestore":
 		proj, db, _ := strings.Cut(dbInfo, ",")
 		if proj == "" || db == "" {